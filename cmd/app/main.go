@@ -5,16 +5,19 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"time"
 
 	"mr-weasel/internal/bot"
 	"mr-weasel/internal/commands"
 	"mr-weasel/internal/config"
 	"mr-weasel/internal/lib/db"
 	"mr-weasel/internal/lib/logger"
-	"mr-weasel/internal/lib/queue"
 	"mr-weasel/internal/lib/telegram"
+	"mr-weasel/internal/queue"
 	"mr-weasel/internal/storage"
 	"mr-weasel/internal/utils"
+	"mr-weasel/internal/worker"
 
 	"mr-weasel/migrations"
 )
@@ -37,39 +40,99 @@ func main() {
 		os.Exit(1)
 	}
 
-	queue := queue.NewQueue(config.QueuePool, config.QueueParallel)
+	ctx := mainContext()
+
+	queue := queue.NewQueue(storage.NewJobStorage(store.DBX()), config.QueuePool, config.QueueParallel)
+	interruptedJobs, err := queue.Restore(ctx)
+	if err != nil {
+		logger.GetLogger().Error("unable to restore the job queue", "err", err)
+		os.Exit(1)
+	}
 
-	audioSeparator := utils.NewAudioSeparator()
-	voiceChanger := utils.NewVoiceChanger()
+	// heavy audio jobs run in-process, or on a remote worker connected to the dispatcher
+	var runner worker.Runner
+	if config.WorkerMode == "remote" {
+		dispatcher := worker.NewDispatcher(config.WorkerToken, filepath.Join(utils.GetDownloadFolderPath(), "jobs"))
+		if err := dispatcher.Start(ctx, config.WorkerListen); err != nil {
+			logger.GetLogger().Error("unable to start the worker dispatcher", "err", err)
+			os.Exit(1)
+		}
+		runner = dispatcher
+	} else {
+		runner = worker.NewLocal(worker.NewTools(
+			utils.NewAudioSeparator(config.Tools.SeparatorPath),
+			utils.NewVoiceChanger(config.Tools.RVCPath, config.Tools.RVCPython),
+		))
+	}
 
-	tgClient, err := telegram.Connect(config.TGToken)
+	tgClient, err := telegram.ConnectWithURL(config.TGToken, config.TGAPIURL)
 	if err != nil {
 		logger.GetLogger().Error("unable to connect to the telegram", "err", err)
 		os.Exit(1)
 	}
 
-	botManager := bot.NewManager(tgClient)
+	botManager := bot.NewManager(tgClient, storage.NewStateStorage(store.DBX()))
+	botManager.Use(
+		commands.Recover(),
+		commands.RateLimit(config.RateLimit, config.RateBurst),
+		commands.Logger(logger.GetLogger()),
+	)
 
-	if config.RTXMode {
-		commands := botManager.AddCommands(
-			commands.NewPingCommand(),
-			commands.NewYTMP3Command(),
-			commands.NewExtractVoiceCommand(queue, audioSeparator),
-			commands.NewChangeVoiceCommand(storage.NewRvcStorage(store.DBX()), queue, audioSeparator, voiceChanger),
-		)
-		botManager.PublishCommands(commands)
+	botManager.SetUserLists(config.AllowUsers, config.DenyUsers)
+	botManager.SetTaskStore(storage.NewTaskStorage(store.DBX()))
+
+	userStorage := storage.NewUserStorage(store.DBX())
+	if config.AdminID != 0 {
+		admin := storage.User{ID: config.AdminID, Name: "admin", Role: storage.RoleAdmin, Timestamp: time.Now().Unix()}
+		if err := userStorage.UpsertUserInDB(context.Background(), admin); err != nil {
+			logger.GetLogger().Error("unable to create the admin user", "err", err)
+			os.Exit(1)
+		}
+		botManager.SetUserStore(userStorage)
 	} else {
-		commands := botManager.AddCommands(
-			commands.NewPingCommand(),
-			commands.NewCarCommand(storage.NewCarStorage(store.DBX())),
-			commands.NewHolidayCommand(storage.NewHolidayStorage(store.DBX())),
-			commands.NewYTMP3Command(),
-		)
-		botManager.PublishCommands(commands)
+		logger.GetLogger().Warn("ADMIN_ID is not set, user roles are not enforced and admin commands are disabled")
 	}
 
-	ctx := mainContext()
-	botManager.Start(ctx)
+	// commands with missing requirements are disabled, and explained in /help
+	botCommands := botManager.AddCommands(storage.RolePending,
+		commands.NewHelpCommand(botManager),
+	)
+	botCommands = append(botCommands, botManager.AddCommands(storage.RoleMember,
+		commands.NewPingCommand(),
+		commands.NewCarCommand(storage.NewCarStorage(store.DBX()), botManager),
+		commands.NewHolidayCommand(storage.NewHolidayStorage(store.DBX())),
+		commands.NewYTMP3Command(),
+		commands.NewExtractVoiceCommand(queue, runner),
+		commands.NewChangeVoiceCommand(storage.NewRvcStorage(store.DBX()), queue, runner),
+	)...)
+	if config.AdminID != 0 {
+		botCommands = append(botCommands, botManager.AddCommands(storage.RoleAdmin,
+			commands.NewAdminCommand(userStorage),
+		)...)
+	}
+	botManager.PublishCommands(botCommands)
+
+	// queued jobs are resumed by executing their commands again
+	for _, job := range interruptedJobs {
+		botManager.ResumeJob(ctx, job)
+	}
+
+	// scheduled tasks, e.g. the car maintenance reminders, run in the background
+	botManager.StartScheduler(ctx, time.Minute)
+
+	if config.UpdatesMode == "webhook" {
+		err := botManager.StartWebhook(ctx, bot.WebhookConfig{
+			URL:    config.WebhookURL,
+			Listen: config.WebhookListen,
+			Secret: config.WebhookSecret,
+		})
+		if err != nil {
+			logger.GetLogger().Error("unable to start the webhook", "err", err)
+			os.Exit(1)
+		}
+	} else {
+		botManager.StartPolling(ctx)
+	}
 }
 
 func mainContext() context.Context {
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"mr-weasel/internal/config"
+	"mr-weasel/internal/lib/logger"
+	"mr-weasel/internal/utils"
+	"mr-weasel/internal/worker"
+)
+
+func main() {
+	config := config.GetWorkerConfig()
+
+	if config.Debug {
+		logger.SetLevel(slog.LevelDebug)
+	}
+
+	tools := worker.NewTools(
+		utils.NewAudioSeparator(config.Tools.SeparatorPath),
+		utils.NewVoiceChanger(config.Tools.RVCPath, config.Tools.RVCPython),
+	)
+
+	requirements := append(tools.Requirements(), utils.RequireBinary("ffmpeg"))
+	if _, err := utils.ProbeRequirements(requirements); err != nil {
+		logger.GetLogger().Error("worker requirements are missing", "err", err)
+		os.Exit(1)
+	}
+
+	client := worker.NewClient(config.WorkerURL, config.WorkerToken, filepath.Join(utils.GetDownloadFolderPath(), "jobs"), tools)
+	client.Run(mainContext())
+}
+
+func mainContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		select {
+		case <-c:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx
+}
@@ -11,6 +11,7 @@ require (
 	github.com/joho/godotenv v1.5.1
 	github.com/mattn/go-sqlite3 v1.14.23
 	github.com/pressly/goose/v3 v3.22.0
+	golang.org/x/image v0.25.0
 	modernc.org/sqlite v1.33.0
 )
 
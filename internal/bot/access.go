@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"mr-weasel/internal/commands"
+	"mr-weasel/internal/lib/telegram"
+	"mr-weasel/internal/lib/wrap"
+	"mr-weasel/internal/storage"
+)
+
+// UserStore persists the bot users and their roles, implemented by storage.UserStorage.
+type UserStore interface {
+	GetUserFromDB(ctx context.Context, userID int64) (storage.User, error)
+	SelectUsersByRoleFromDB(ctx context.Context, role string) ([]storage.User, error)
+	InsertUserIntoDB(ctx context.Context, user storage.User) (bool, error)
+}
+
+var roleRanks = map[string]int{
+	storage.RoleBlocked: 0,
+	storage.RolePending: 1,
+	storage.RoleMember:  2,
+	storage.RoleAdmin:   3,
+}
+
+// SetUserStore enables the role checks of the registered commands, it has to be called before the updates are processed.
+// Unknown users are registered as pending, and the admins are asked to approve them.
+func (m *Manager) SetUserStore(users UserStore) {
+	m.users = users
+}
+
+// SetUserLists ignores the users from the deny list, and the users not in the allow list, if it is not empty.
+// The lists are checked before the roles, so the ignored users are never registered and the admins are not asked about them.
+func (m *Manager) SetUserLists(allow []int64, deny []int64) {
+	m.allowed = make(map[int64]bool, len(allow))
+	for _, userID := range allow {
+		m.allowed[userID] = true
+	}
+	m.denied = make(map[int64]bool, len(deny))
+	for _, userID := range deny {
+		m.denied[userID] = true
+	}
+}
+
+// listed checks the user against the allow and the deny lists.
+func (m *Manager) listed(userID int64) bool {
+	return !m.denied[userID] && (len(m.allowed) == 0 || m.allowed[userID])
+}
+
+// authorize checks the user role against the role required by the command.
+func (m *Manager) authorize(ctx context.Context, pl commands.Payload, required string) bool {
+	const op = "bot.Manager.authorize"
+
+	if !m.listed(pl.UserID) {
+		// ignored silently, like the blocked users
+		return false
+	}
+
+	if m.users == nil {
+		// without the user store nobody can be verified as an admin
+		return required != storage.RoleAdmin
+	}
+
+	user, err := m.users.GetUserFromDB(ctx, pl.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		user = storage.User{ID: pl.UserID, Name: pl.UserName, Role: storage.RolePending, Timestamp: time.Now().Unix()}
+		if _, err := m.users.InsertUserIntoDB(ctx, user); err != nil {
+			log.Println("[ERROR]", wrap.IfErr(op, err))
+			return false
+		}
+		if roleRanks[user.Role] < roleRanks[required] {
+			m.requestAccess(ctx, pl, user)
+			return false
+		}
+	} else if err != nil {
+		log.Println("[ERROR]", wrap.IfErr(op, err))
+		return false
+	}
+
+	if user.Role != storage.RoleBlocked && roleRanks[user.Role] >= roleRanks[required] {
+		return true
+	}
+
+	switch user.Role {
+	case storage.RoleBlocked:
+		// blocked users are ignored
+	case storage.RolePending:
+		m.send(ctx, pl.ChatID, pl.ThreadID, commands.Result{Text: "Your access request is waiting for approval."})
+	default:
+		m.send(ctx, pl.ChatID, pl.ThreadID, commands.Result{Text: "You are not allowed to use this command."})
+	}
+
+	return false
+}
+
+// permitted checks the user role like authorize, but silently and without registering unknown users.
+func (m *Manager) permitted(ctx context.Context, userID int64, required string) bool {
+	const op = "bot.Manager.permitted"
+
+	if !m.listed(userID) {
+		return false
+	}
+
+	if m.users == nil {
+		return required != storage.RoleAdmin
+	}
+
+	user, err := m.users.GetUserFromDB(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	} else if err != nil {
+		log.Println("[ERROR]", wrap.IfErr(op, err))
+		return false
+	}
+
+	return user.Role != storage.RoleBlocked && roleRanks[user.Role] >= roleRanks[required]
+}
+
+// requestAccess notifies the user and the admins about the new access request.
+func (m *Manager) requestAccess(ctx context.Context, pl commands.Payload, user storage.User) {
+	const op = "bot.Manager.requestAccess"
+
+	m.send(ctx, pl.ChatID, pl.ThreadID, commands.Result{Text: "Your access request has been sent to the admins."})
+
+	admins, err := m.users.SelectUsersByRoleFromDB(ctx, storage.RoleAdmin)
+	if err != nil {
+		log.Println("[ERROR]", wrap.IfErr(op, err))
+		return
+	}
+
+	for _, admin := range admins {
+		// admins receive the request in their private chat with the bot
+		m.send(ctx, admin.ID, 0, commands.AccessRequest(user))
+	}
+}
+
+// send sends the result as a new message outside of the command execution.
+func (m *Manager) send(ctx context.Context, chatID int64, threadID int, result commands.Result) {
+	const op = "bot.Manager.send"
+
+	var replyMarkup telegram.ReplyMarkup
+	if result.InlineMarkup.InlineKeyboard != nil {
+		replyMarkup = result.InlineMarkup
+	}
+
+	_, err := m.client.SendMessage(ctx, telegram.SendMessageConfig{
+		ChatID:          chatID,
+		MessageThreadId: threadID,
+		Text:            result.Text,
+		ParseMode:       "HTML",
+		ReplyMarkup:     replyMarkup,
+	})
+	if err != nil {
+		log.Println("[ERROR]", wrap.IfErr(op, err))
+	}
+}
@@ -0,0 +1,1191 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"mr-weasel/internal/commands"
+	"mr-weasel/internal/lib/db"
+	"mr-weasel/internal/lib/telegram"
+	"mr-weasel/internal/lib/telegram/telegramtest"
+	"mr-weasel/internal/storage"
+	"mr-weasel/migrations"
+)
+
+// startTestBot runs the bot with polling against a fake Bot API server and a fresh database.
+// User roles are enforced if adminID is set, the manager can be configured further before it starts.
+func startTestBot(t *testing.T, adminID int64, configure ...func(*Manager)) (*telegramtest.Server, db.Store) {
+	srv := telegramtest.NewServer()
+	t.Cleanup(srv.Close)
+
+	store, err := db.NewStore("sqlite", t.TempDir()+"/data.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MigrateUp(slog.Default(), "sqlite", store.DB(), migrations.MigrationsFS, "."); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := telegram.ConnectWithURL("token", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(client, storage.NewStateStorage(store.DBX()))
+	m.SetTaskStore(storage.NewTaskStorage(store.DBX()))
+	m.AddCommands(storage.RoleMember,
+		commands.NewPingCommand(),
+		commands.NewCarCommand(storage.NewCarStorage(store.DBX()), m),
+		commands.NewHolidayCommand(storage.NewHolidayStorage(store.DBX())),
+	)
+
+	userStorage := storage.NewUserStorage(store.DBX())
+	if adminID != 0 {
+		m.AddCommands(storage.RoleAdmin, commands.NewAdminCommand(userStorage))
+		admin := storage.User{ID: adminID, Name: "admin", Role: storage.RoleAdmin}
+		if err := userStorage.UpsertUserInDB(context.Background(), admin); err != nil {
+			t.Fatal(err)
+		}
+		m.SetUserStore(userStorage)
+	}
+	for _, f := range configure {
+		f(m)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.StartPolling(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		store.DB().Close()
+	})
+
+	return srv, store
+}
+
+func TestConversationCarAdd(t *testing.T) {
+	srv, _ := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John", Username: "john"}
+
+	srv.SendText(user, "/car")
+	reply := srv.NextReply(t)
+	button, ok := reply.Button("« New Car »")
+	if !ok {
+		t.Fatalf("actual [%s], [%+v]\n", reply.Text(), reply.Result.ReplyMarkup)
+	}
+
+	srv.PressButton(user, reply.Result, button.CallbackData)
+
+	script := []struct {
+		input    string
+		expected string
+	}{
+		{"", "Please choose a name for your car."},
+		{"Civic", "What is the model year?"},
+		{"two thousand", "Please enter a valid number."},
+		{"2019", "What is your plate number? /skip"},
+		{"AB-123", "What is the price? /skip"},
+	}
+
+	for _, s := range script {
+		if s.input != "" {
+			srv.SendText(user, s.input)
+		}
+		reply = srv.NextReply(t)
+		if reply.Method != "sendMessage" || reply.Text() != s.expected {
+			t.Fatalf("input [%s], actual [%s %s], expected [%s]\n", s.input, reply.Method, reply.Text(), s.expected)
+		}
+	}
+
+	srv.SendText(user, "15000")
+	reply = srv.NextReply(t)
+	for _, expected := range []string{"Civic (2019)", "15000€", "AB-123"} {
+		if !strings.Contains(reply.Text(), expected) {
+			t.Fatalf("actual [%s], expected [%s]\n", reply.Text(), expected)
+		}
+	}
+	if _, ok := reply.Button("Edit Car"); !ok {
+		t.Fatalf("actual [%+v], expected [Edit Car] button\n", reply.Result.ReplyMarkup)
+	}
+
+	// conversation is over, plain text is ignored
+	srv.SendText(user, "hello")
+	srv.SendText(user, "/car")
+	reply = srv.NextReply(t)
+	if _, ok := reply.Button("Civic (2019)"); !ok {
+		t.Fatalf("actual [%s], [%+v]\n", reply.Text(), reply.Result.ReplyMarkup)
+	}
+}
+
+func TestConversationEditsKeyboard(t *testing.T) {
+	srv, _ := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John"}
+
+	srv.SendText(user, "/car add")
+	srv.NextReply(t)
+	for _, input := range []string{"Golf", "2008", "/skip", "/skip"} {
+		srv.SendText(user, input)
+		srv.NextReply(t)
+	}
+
+	srv.SendText(user, "/car")
+	list := srv.NextReply(t)
+	button, _ := list.Button("Golf (2008)")
+
+	// pressing a button on a message with an inline keyboard edits the same message
+	srv.PressButton(user, list.Result, button.CallbackData)
+	reply := srv.NextReply(t)
+	if reply.Method != "editMessageText" || reply.Result.MessageID != list.Result.MessageID {
+		t.Fatalf("actual [%s %d], expected [editMessageText %d]\n", reply.Method, reply.Result.MessageID, list.Result.MessageID)
+	}
+	if !strings.Contains(reply.Text(), "Golf (2008)") {
+		t.Fatalf("actual [%s]\n", reply.Text())
+	}
+}
+
+func TestConversationPerChat(t *testing.T) {
+	srv, _ := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John", Username: "john"}
+	group := telegram.Chat{ID: -100, Type: "group"}
+	private := telegram.Chat{ID: user.ID, Type: "private"}
+
+	script := []struct {
+		chat     telegram.Chat
+		input    string
+		expected string
+	}{
+		{group, "/car add@weasel_bot", "Please choose a name for your car."},
+		{private, "/car add", "Please choose a name for your car."},
+		{private, "Golf", "What is the model year?"},
+		{group, "Civic", "What is the model year?"},
+		{group, "2019", "What is your plate number? /skip"},
+		{private, "2008", "What is your plate number? /skip"},
+		{group, "/skip", "What is the price? /skip"},
+		{group, "/skip", "Civic (2019)"},
+		{private, "/skip", "What is the price? /skip"},
+		{private, "/skip", "Golf (2008)"},
+	}
+
+	for _, s := range script {
+		srv.SendMessage(user, s.chat, s.input)
+		reply := srv.NextReply(t)
+		if reply.Result.Chat.ID != s.chat.ID || !strings.Contains(reply.Text(), s.expected) {
+			t.Fatalf("input [%d %s], actual [%d %s], expected [%d %s]\n", s.chat.ID, s.input, reply.Result.Chat.ID, reply.Text(), s.chat.ID, s.expected)
+		}
+	}
+}
+
+func TestConversationAccessRequest(t *testing.T) {
+	srv, _ := startTestBot(t, 1000)
+	admin := telegram.User{ID: 1000, FirstName: "Admin"}
+	user := telegram.User{ID: 42, FirstName: "John", Username: "john"}
+
+	// unknown user is registered as pending, and the admin is asked for approval
+	srv.SendText(user, "/ping")
+	replies := map[int64]telegramtest.Call{}
+	for range 2 {
+		reply := srv.NextReply(t)
+		replies[reply.Result.Chat.ID] = reply
+	}
+	if replies[user.ID].Text() != "Your access request has been sent to the admins." {
+		t.Fatalf("actual [%s]\n", replies[user.ID].Text())
+	}
+	request := replies[admin.ID]
+	approve, ok := request.Button("Approve")
+	if !ok || !strings.Contains(request.Text(), "@john") {
+		t.Fatalf("actual [%s], [%+v]\n", request.Text(), request.Result.ReplyMarkup)
+	}
+
+	srv.SendText(user, "/ping")
+	if reply := srv.NextReply(t); reply.Text() != "Your access request is waiting for approval." {
+		t.Fatalf("actual [%s]\n", reply.Text())
+	}
+
+	// admin approves the request
+	srv.SendText(admin, "/admin")
+	srv.NextReply(t)
+	srv.PressButton(admin, request.Result, approve.CallbackData)
+	reply := srv.NextReply(t)
+	if reply.Method != "editMessageText" || !strings.Contains(reply.Text(), "member") {
+		t.Fatalf("actual [%s %s]\n", reply.Method, reply.Text())
+	}
+
+	srv.SendText(user, "/ping")
+	if reply := srv.NextReply(t); reply.Text() != "pong!" {
+		t.Fatalf("actual [%s]\n", reply.Text())
+	}
+
+	// members cannot use admin commands
+	srv.SendText(user, "/admin")
+	if reply := srv.NextReply(t); reply.Text() != "You are not allowed to use this command." {
+		t.Fatalf("actual [%s]\n", reply.Text())
+	}
+
+	// blocked users are ignored
+	block, _ := reply.Button("Block")
+	srv.PressButton(admin, reply.Result, block.CallbackData)
+	srv.NextReply(t)
+	srv.SendText(user, "/ping")
+	srv.SendText(admin, "/ping")
+	if reply := srv.NextReply(t); reply.Result.Chat.ID != admin.ID {
+		t.Fatalf("actual [%d %s]\n", reply.Result.Chat.ID, reply.Text())
+	}
+}
+
+func TestConversationDeniedUser(t *testing.T) {
+	srv, store := startTestBot(t, 1000, func(m *Manager) { m.SetUserLists(nil, []int64{42}) })
+	admin := telegram.User{ID: 1000, FirstName: "Admin"}
+	user := telegram.User{ID: 42, FirstName: "John", Username: "john"}
+
+	// denied user is ignored before the roles, so it is neither registered nor reported to the admins
+	srv.SendText(user, "/ping")
+	srv.SendText(admin, "/ping")
+	if reply := srv.NextReply(t); reply.Result.Chat.ID != admin.ID || reply.Text() != "pong!" {
+		t.Fatalf("actual [%d %s]\n", reply.Result.Chat.ID, reply.Text())
+	}
+	if calls := srv.Calls("sendMessage"); len(calls) != 1 {
+		t.Fatalf("actual [%d] messages, expected only the admin pong\n", len(calls))
+	}
+	if _, err := storage.NewUserStorage(store.DBX()).GetUserFromDB(context.Background(), user.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("actual error [%v], expected no user row\n", err)
+	}
+}
+
+func TestConversationCarStats(t *testing.T) {
+	srv, store := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John"}
+
+	ctx := context.Background()
+	cars := storage.NewCarStorage(store.DBX())
+	carID, err := cars.InsertCarIntoDB(ctx, storage.CarBase{UserID: user.ID, Name: "Golf", Year: 2008})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receipts := []struct {
+		date       string
+		liters     int64
+		kilometers int64
+		euros      int64
+	}{
+		{"2026-09-01", 40, 1000, 80},
+		{"2026-09-15", 30, 1500, 60},
+		{"2026-10-01", 35, 2000, 70},
+		{"2026-10-20", 36, 2600, 72},
+	}
+	for _, r := range receipts {
+		ts, _ := time.Parse("2006-01-02", r.date)
+		fuel := storage.FuelBase{CarID: carID, Timestamp: ts.Unix(), Type: "A95", Milliliters: r.liters * 1000, Kilometers: r.kilometers, Cents: r.euros * 100, FullTank: true}
+		if _, err := cars.InsertFuelIntoDB(ctx, fuel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv.SendText(user, fmt.Sprintf("/car stats %d month 0", carID))
+	reply := srv.NextReply(t)
+	for _, expected := range []string{
+		"October 2026",
+		"71.00L (2 receipts)",
+		"142.00€ (2.00€/L)",
+		"1100Km (6.45L/100Km)",
+		"6.00L/100Km (20 Oct 2026)",
+		"7.00L/100Km (01 Oct 2026)",
+		"Compared to September 2026",
+		"500Km (+120%)",
+	} {
+		if !strings.Contains(reply.Text(), expected) {
+			t.Fatalf("actual [%s], expected [%s]\n", reply.Text(), expected)
+		}
+	}
+
+	button, ok := reply.Button("Yearly")
+	if !ok {
+		t.Fatalf("actual [%+v], expected [Yearly] button\n", reply.Result.ReplyMarkup)
+	}
+	srv.PressButton(user, reply.Result, button.CallbackData)
+	reply = srv.NextReply(t)
+	for _, expected := range []string{"2026", "141.00L (4 receipts)", "1600Km (6.31L/100Km)"} {
+		if !strings.Contains(reply.Text(), expected) {
+			t.Fatalf("actual [%s], expected [%s]\n", reply.Text(), expected)
+		}
+	}
+	if strings.Contains(reply.Text(), "Compared to") {
+		t.Errorf("actual [%s], expected no previous period\n", reply.Text())
+	}
+}
+
+func TestConversationCarTCO(t *testing.T) {
+	srv, store := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John"}
+
+	ctx := context.Background()
+	cars := storage.NewCarStorage(store.DBX())
+	car := storage.CarBase{UserID: user.ID, Name: "Golf", Year: 2008}
+	car.Price.Int64, car.Price.Valid = 10000, true
+	car.Resale.Int64, car.Resale.Valid = 8000, true
+	carID, err := cars.InsertCarIntoDB(ctx, car)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cars.InsertFuelIntoDB(ctx, storage.FuelBase{CarID: carID, Timestamp: time.Now().Unix(), Type: "A95", Milliliters: 40000, Kilometers: 1000, Cents: 8000, FullTank: true})
+	cars.InsertServiceIntoDB(ctx, storage.ServiceBase{CarID: carID, Timestamp: time.Now().Unix(), Description: "Oil", Cents: 12000})
+
+	srv.SendText(user, fmt.Sprintf("/car tco %d", carID))
+	reply := srv.NextReply(t)
+	for _, expected := range []string{"80.00€", "120.00€", "2000.00€ (8000€ resale, entered)", "2200.00€", "2.20€ (1000Km)", "2200.00€ (1 months)"} {
+		if !strings.Contains(reply.Text(), expected) {
+			t.Fatalf("actual [%s], expected [%s]\n", reply.Text(), expected)
+		}
+	}
+}
+
+func TestConversationCarCurrency(t *testing.T) {
+	srv, store := startTestBot(t, 42)
+	user := telegram.User{ID: 42, FirstName: "John"}
+
+	ctx := context.Background()
+	cars := storage.NewCarStorage(store.DBX())
+	carID, err := cars.InsertCarIntoDB(ctx, storage.CarBase{UserID: user.ID, Name: "Golf", Year: 2008})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cars.InsertFuelIntoDB(ctx, storage.FuelBase{CarID: carID, Timestamp: time.Now().Unix(), Type: "A95", Milliliters: 40000, Kilometers: 1000, Cents: 7000, FullTank: true})
+	cars.InsertServiceIntoDB(ctx, storage.ServiceBase{CarID: carID, Timestamp: time.Now().Unix(), Description: "Oil", Cents: 9400, Currency: "CHF"})
+
+	srv.SendText(user, "/car rates")
+	if reply := srv.NextReply(t); !strings.Contains(reply.Result.Text, "No rates for CHF, the receipts are converted 1:1.") {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendText(user, "/car rates_set CHF 0,94")
+	if reply := srv.NextReply(t); !strings.Contains(reply.Result.Text, "line 1: expected a currency and a rate") {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendText(user, "CHF 0.94")
+	if reply := srv.NextReply(t); reply.Result.Text != "1 exchange rates have been successfully updated!" {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+
+	steps := []struct {
+		Command  string
+		Reply    string
+		Expected []string
+	}{
+		{Command: "/car currency EUR", Reply: "Base currency has been successfully set to EUR!", Expected: []string{"70.00€", "100.00€", "170.00€"}},
+		{Command: "/car currency chf", Reply: "Base currency has been successfully set to CHF!", Expected: []string{"65.80 CHF", "94.00 CHF", "159.80 CHF"}},
+		{Command: fmt.Sprintf("/car upd_distance %d", carID), Reply: "Car distances are now in Miles!", Expected: []string{"Per mi:", "(621mi)"}},
+	}
+	for _, step := range steps {
+		srv.SendText(user, step.Command)
+		if reply := srv.NextReply(t); reply.Result.Text != step.Reply {
+			t.Fatalf("actual [%s], expected [%s]\n", reply.Result.Text, step.Reply)
+		}
+		srv.SendText(user, fmt.Sprintf("/car tco %d", carID))
+		reply := srv.NextReply(t)
+		for _, expected := range step.Expected {
+			if !strings.Contains(reply.Text(), expected) {
+				t.Fatalf("actual [%s], expected [%s]\n", reply.Text(), expected)
+			}
+		}
+	}
+}
+
+func TestConversationCarRatesAdminOnly(t *testing.T) {
+	srv, store := startTestBot(t, 1)
+	admin := telegram.User{ID: 1, FirstName: "Admin"}
+	member := telegram.User{ID: 42, FirstName: "John"}
+
+	users := storage.NewUserStorage(store.DBX())
+	if err := users.UpsertUserInDB(context.Background(), storage.User{ID: member.ID, Name: "John", Role: storage.RoleMember}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rates are shared by all users
+	srv.SendText(member, "/car rates")
+	if reply := srv.NextReply(t); strings.Contains(fmt.Sprint(reply.Result.ReplyMarkup), "Update Rates") {
+		t.Fatalf("actual [%+v], expected no [Update Rates] button\n", reply.Result.ReplyMarkup)
+	}
+	srv.SendText(member, "/car rates_set CHF 0.5")
+	if reply := srv.NextReply(t); reply.Result.Text != "Only the admins can update the exchange rates, they are shared by all users." {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendText(admin, "/car rates_set CHF 0.94")
+	if reply := srv.NextReply(t); reply.Result.Text != "1 exchange rates have been successfully updated!" {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+}
+
+func TestConversationCarRatesWithoutRoles(t *testing.T) {
+	srv, _ := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John"}
+
+	// nobody is an admin if the roles are not enforced
+	srv.SendText(user, "/car rates_set CHF 0.5")
+	if reply := srv.NextReply(t); reply.Result.Text != "Only the admins can update the exchange rates, they are shared by all users." {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+}
+
+func TestConversationCarChart(t *testing.T) {
+	srv, store := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John"}
+
+	ctx := context.Background()
+	cars := storage.NewCarStorage(store.DBX())
+	carID, err := cars.InsertCarIntoDB(ctx, storage.CarBase{UserID: user.ID, Name: "Golf", Year: 2008})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, kilometers := range []int64{1000, 1500, 2100} {
+		ts := time.Date(2026, 9, 1+i*10, 0, 0, 0, 0, time.UTC).Unix()
+		cars.InsertFuelIntoDB(ctx, storage.FuelBase{CarID: carID, Timestamp: ts, Type: "A95", Milliliters: 35000, Kilometers: kilometers, Cents: 7000, FullTank: true})
+	}
+
+	srv.SendText(user, fmt.Sprintf("/car stats %d month 0", carID))
+	stats := srv.NextReply(t)
+	button, ok := stats.Button("📈 Consumption")
+	if !ok {
+		t.Fatalf("actual [%+v], expected [📈 Consumption] button\n", stats.Result.ReplyMarkup)
+	}
+
+	// chart is sent as a new photo, the stats message keeps its keyboard
+	srv.PressButton(user, stats.Result, button.CallbackData)
+	reply := srv.NextReply(t)
+	if reply.Method != "sendPhoto" || len(reply.Files) != 1 || reply.Result.Caption != "📈 Fuel consumption of Golf (2008)" {
+		t.Fatalf("actual [%s %v %s]\n", reply.Method, reply.Files, reply.Result.Caption)
+	}
+}
+
+func TestConversationCarExportImport(t *testing.T) {
+	srv, store := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John"}
+
+	ctx := context.Background()
+	cars := storage.NewCarStorage(store.DBX())
+	carID, err := cars.InsertCarIntoDB(ctx, storage.CarBase{UserID: user.ID, Name: "Golf", Year: 2008})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC).Unix()
+	cars.InsertFuelIntoDB(ctx, storage.FuelBase{CarID: carID, Timestamp: ts, Type: "A95", Milliliters: 35500, Kilometers: 1000, Cents: 7000, FullTank: true})
+	cars.InsertServiceIntoDB(ctx, storage.ServiceBase{CarID: carID, Timestamp: ts + 86400, Description: "Oil change", Cents: 12000})
+
+	srv.SendText(user, fmt.Sprintf("/car export %d csv", carID))
+	reply := srv.NextReply(t)
+	expected := "record,date,fuel_type,liters,kilometers,amount,currency,description,full_tank\nfuel,2026-09-01,A95,35.5,1000,70.00,EUR,,yes\nservice,2026-09-02,,,,120.00,EUR,Oil change,\n"
+	if reply.Method != "sendDocument" || string(reply.Data["Golf_2008.csv"]) != expected {
+		t.Fatalf("actual [%s %v]\n", reply.Method, reply.Files)
+	}
+
+	// the exported file is imported into another car
+	otherID, _ := cars.InsertCarIntoDB(ctx, storage.CarBase{UserID: user.ID, Name: "Polo", Year: 2012})
+	srv.SendText(user, fmt.Sprintf("/car import %d", otherID))
+	if reply := srv.NextReply(t); !strings.Contains(reply.Result.Text, "Please upload a CSV file") {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+
+	srv.SendDocument(user, "broken.csv", []byte("record,date,euros\nfuel,2026-09-01,70\n"))
+	if reply := srv.NextReply(t); !strings.Contains(reply.Result.Text, "line 2: fuel_type is empty") {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+
+	srv.SendDocument(user, "Golf_2008.csv", []byte(expected))
+	preview := srv.NextReply(t)
+	if !strings.Contains(preview.Result.Text, "1 receipts, 35.50L, 70.00€") || !strings.Contains(preview.Result.Text, "01 Sep 2026 - 02 Sep 2026") {
+		t.Fatalf("actual [%s]\n", preview.Result.Text)
+	}
+	if fuels, _ := cars.SelectFuelsFromDB(ctx, user.ID, otherID); len(fuels) != 0 {
+		t.Fatalf("actual fuels [%d] before the confirmation\n", len(fuels))
+	}
+
+	button, ok := preview.Button("Yes, import")
+	if !ok {
+		t.Fatalf("actual [%+v], expected [Yes, import] button\n", preview.Result.ReplyMarkup)
+	}
+	srv.PressButton(user, preview.Result, button.CallbackData)
+	if reply := srv.NextReply(t); reply.Result.Text != "2 receipts have been successfully imported!" {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+
+	fuels, _ := cars.SelectFuelsFromDB(ctx, user.ID, otherID)
+	services, _ := cars.SelectServicesFromDB(ctx, user.ID, otherID)
+	if len(fuels) != 1 || fuels[0].Milliliters != 35500 || len(services) != 1 || services[0].Description != "Oil change" {
+		t.Errorf("actual fuels [%+v], services [%+v]\n", fuels, services)
+	}
+
+	// the receipts which already exist are skipped
+	srv.SendText(user, fmt.Sprintf("/car import %d", otherID))
+	srv.NextReply(t)
+	srv.SendDocument(user, "Golf_2008.csv", []byte(expected))
+	if reply := srv.NextReply(t); reply.Result.Text != "All the 2 receipts already exist, nothing to import." {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+
+	srv.SendText(user, fmt.Sprintf("/car import %d", otherID))
+	srv.NextReply(t)
+	srv.SendDocument(user, "more.csv", []byte(expected+"lease,2026-09-03,,,,300.00,EUR,September,\nlease,2026-09-03,,,,300.00,EUR,September,\n"))
+	preview = srv.NextReply(t)
+	if !strings.Contains(preview.Result.Text, "Lease:</b> 1 receipts, 300.00€") || !strings.Contains(preview.Result.Text, "Skipped:</b> 3 receipts already exist") {
+		t.Fatalf("actual [%s]\n", preview.Result.Text)
+	}
+	button, _ = preview.Button("Yes, import")
+	srv.PressButton(user, preview.Result, button.CallbackData)
+	if reply := srv.NextReply(t); reply.Result.Text != "1 receipts have been successfully imported!" {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	// the same file confirmed twice does not duplicate the receipts either
+	if count, err := cars.InsertCarRecordsIntoDB(ctx, storage.CarRecords{Fuels: []storage.FuelBase{fuels[0].FuelBase}}); err != nil || count != 0 {
+		t.Errorf("actual count [%d], error [%v]\n", count, err)
+	}
+}
+
+func TestConversationCarFuelEdit(t *testing.T) {
+	srv, store := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John"}
+
+	ctx := context.Background()
+	cars := storage.NewCarStorage(store.DBX())
+	carID, err := cars.InsertCarIntoDB(ctx, storage.CarBase{UserID: user.ID, Name: "Golf", Year: 2008})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC).Unix()
+	fuelID, _ := cars.InsertFuelIntoDB(ctx, storage.FuelBase{CarID: carID, Timestamp: ts, Type: "A95", Milliliters: 3550, Kilometers: 1000, Cents: 7000, FullTank: true})
+
+	srv.SendText(user, fmt.Sprintf("/car fuel_get %d 0", carID))
+	details := srv.NextReply(t)
+	button, ok := details.Button("Edit")
+	if !ok {
+		t.Fatalf("actual [%+v], expected [Edit] button\n", details.Result.ReplyMarkup)
+	}
+
+	srv.PressButton(user, details.Result, button.CallbackData)
+	menu := srv.NextReply(t)
+	button, ok = menu.Button("Set Liters")
+	if !ok {
+		t.Fatalf("actual [%+v], expected [Set Liters] button\n", menu.Result.ReplyMarkup)
+	}
+
+	srv.PressButton(user, menu.Result, button.CallbackData)
+	if reply := srv.NextReply(t); reply.Result.Text != "What is the new fuel amount in Liters?" {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendText(user, "thirty")
+	if reply := srv.NextReply(t); reply.Result.Text != "Please enter a valid decimal number." {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendText(user, "35.5")
+	if reply := srv.NextReply(t); reply.Result.Text != "Receipt has been successfully updated!" {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+
+	fuel, err := cars.GetFuelByIDFromDB(ctx, user.ID, carID, fuelID)
+	if err != nil || fuel.Milliliters != 35500 || fuel.Type != "A95" || fuel.Kilometers != 1000 || fuel.Cents != 7000 || fuel.Timestamp != ts {
+		t.Errorf("actual [%+v], error [%v]\n", fuel, err)
+	}
+
+	// receipts of other users can not be edited
+	fuel.Milliliters = 1000
+	if affected, err := cars.UpdateFuelInDB(ctx, 43, fuel.FuelBase); err != nil || affected != 0 {
+		t.Errorf("actual affected [%d], error [%v]\n", affected, err)
+	}
+	srv.SendText(telegram.User{ID: 43, FirstName: "Jane"}, fmt.Sprintf("/car fuel_upd %d %d", carID, fuelID))
+	if reply := srv.NextReply(t); reply.Result.Text != "Car not found." {
+		t.Errorf("actual [%s]\n", reply.Result.Text)
+	}
+}
+
+func TestConversationCarFuelValidation(t *testing.T) {
+	srv, store := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John"}
+
+	ctx := context.Background()
+	cars := storage.NewCarStorage(store.DBX())
+	carID, err := cars.InsertCarIntoDB(ctx, storage.CarBase{UserID: user.ID, Name: "Golf", Year: 2008})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC).Unix()
+	cars.InsertFuelIntoDB(ctx, storage.FuelBase{CarID: carID, Timestamp: ts, Type: "A95", Milliliters: 40000, Kilometers: 1000, Cents: 6000, FullTank: true})
+
+	srv.SendText(user, fmt.Sprintf("/car fuel_add %d", carID))
+	calendar := srv.NextReply(t)
+	srv.PressButton(user, calendar.Result, fmt.Sprint(ts+9*86400))
+	srv.NextReply(t) // date is confirmed
+	srv.NextReply(t) // fuel type is asked
+
+	steps := []struct {
+		Input    string
+		Expected string
+	}{
+		{Input: "A95", Expected: "What is the fuel amount in Liters?"},
+		{Input: "40", Expected: "Did you fill the tank up?"},
+		{Input: "Maybe", Expected: "Please answer Yes or No."},
+		{Input: "Yes", Expected: "What is your total mileage now in Kilometers?"},
+		{Input: "900", Expected: "The odometer can not go backwards, the previous receipt on Tuesday, 01 September 2026 has 1000Km. Please enter a valid mileage."},
+		{Input: "1100", Expected: "How much money did you spend in EUR?"},
+		{Input: "60", Expected: "⚠️ Please double check the receipt:\n\n• 40.00L/100Km consumption is unusual"},
+	}
+	var reply telegramtest.Call
+	for _, step := range steps {
+		srv.SendText(user, step.Input)
+		if reply = srv.NextReply(t); reply.Result.Text != step.Expected {
+			t.Fatalf("actual [%s], expected [%s]\n", reply.Result.Text, step.Expected)
+		}
+	}
+
+	srv.PressButton(user, reply.Result, "fuel_save_yes")
+	if reply := srv.NextReply(t); reply.Result.Text != "Receipt has been successfully saved!" {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+
+	srv.SendText(user, fmt.Sprintf("/car audit %d", carID))
+	audit := srv.NextReply(t)
+	if !strings.Contains(audit.Result.Text, "40.00L/100Km consumption is unusual") {
+		t.Errorf("actual [%s]\n", audit.Result.Text)
+	}
+	if _, ok := audit.Button("Edit 10.09.26"); !ok {
+		t.Errorf("actual [%+v], expected [Edit 10.09.26] button\n", audit.Result.ReplyMarkup)
+	}
+}
+
+func TestConversationCarPartialFill(t *testing.T) {
+	srv, store := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John"}
+
+	ctx := context.Background()
+	cars := storage.NewCarStorage(store.DBX())
+	carID, err := cars.InsertCarIntoDB(ctx, storage.CarBase{UserID: user.ID, Name: "Golf", Year: 2008})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the partial fill in between is counted in the consumption of the next full tank
+	receipts := []struct {
+		day        int
+		liters     int64
+		kilometers int64
+		fullTank   bool
+	}{
+		{day: 1, liters: 40, kilometers: 1000, fullTank: true},
+		{day: 5, liters: 20, kilometers: 1300, fullTank: false},
+		{day: 9, liters: 20, kilometers: 1600, fullTank: true},
+	}
+	for _, r := range receipts {
+		ts := time.Date(2026, 9, r.day, 0, 0, 0, 0, time.UTC).Unix()
+		fuel := storage.FuelBase{CarID: carID, Timestamp: ts, Type: "A95", Milliliters: r.liters * 1000, Kilometers: r.kilometers, Cents: r.liters * 180, FullTank: r.fullTank}
+		if _, err := cars.InsertFuelIntoDB(ctx, fuel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		Command  string
+		Expected string
+	}{
+		{Command: fmt.Sprintf("/car fuel_get %d 0", carID), Expected: "300Km (6.67L/100Km over 600Km)"},
+		{Command: fmt.Sprintf("/car fuel_get %d 1", carID), Expected: "300Km (partial fill)"},
+		{Command: fmt.Sprintf("/car stats %d month 0", carID), Expected: "600Km (6.67L/100Km)"},
+	}
+	for _, test := range tests {
+		srv.SendText(user, test.Command)
+		if reply := srv.NextReply(t); !strings.Contains(reply.Result.Text, test.Expected) {
+			t.Errorf("actual [%s], expected [%s]\n", reply.Result.Text, test.Expected)
+		}
+	}
+}
+
+func TestConversationCarQuickFuel(t *testing.T) {
+	srv, store := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John"}
+
+	ctx := context.Background()
+	cars := storage.NewCarStorage(store.DBX())
+	carID, err := cars.InsertCarIntoDB(ctx, storage.CarBase{UserID: user.ID, Name: "Golf", Year: 2008})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC).Unix()
+	cars.InsertFuelIntoDB(ctx, storage.FuelBase{CarID: carID, Timestamp: ts, Type: "Diesel", Milliliters: 40000, Kilometers: 1000, Cents: 6000, FullTank: true})
+
+	srv.SendText(user, fmt.Sprintf("/car fuel %d 40L 1000km", carID))
+	if reply := srv.NextReply(t); !strings.HasPrefix(reply.Result.Text, "Unable to read the receipt, the amount is missing.") {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+
+	// the fuel type is taken from the last receipt and the amount is computed from the price
+	srv.SendText(user, "40L 1.50€/L 1600km")
+	card := srv.NextReply(t)
+	if !strings.Contains(card.Result.Text, "40.00L (Diesel)") || !strings.Contains(card.Result.Text, "60.00€ (1.50€/L)") {
+		t.Fatalf("actual [%s]\n", card.Result.Text)
+	}
+	srv.PressButton(user, card.Result, "fuel_quick_save")
+	if reply := srv.NextReply(t); reply.Result.Text != "Receipt has been successfully saved!" {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+
+	srv.SendText(user, fmt.Sprintf("/car fuel_get %d 0", carID))
+	if reply := srv.NextReply(t); !strings.Contains(reply.Result.Text, "600Km (6.67L/100Km)") {
+		t.Errorf("actual [%s]\n", reply.Result.Text)
+	}
+}
+
+func TestConversationCarMaintenance(t *testing.T) {
+	srv, store := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John"}
+
+	ctx := context.Background()
+	cars := storage.NewCarStorage(store.DBX())
+	carID, err := cars.InsertCarIntoDB(ctx, storage.CarBase{UserID: user.ID, Name: "Golf", Year: 2008})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	fuel := storage.FuelBase{CarID: carID, Timestamp: now.Unix(), Type: "A95", Milliliters: 40000, Kilometers: 110000, Cents: 7000, FullTank: true}
+	fuelID, err := cars.InsertFuelIntoDB(ctx, fuel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.SendText(user, fmt.Sprintf("/car maint %d", carID))
+	list := srv.NextReply(t)
+	button, ok := list.Button("Add")
+	if !ok {
+		t.Fatalf("actual [%+v], expected [Add] button\n", list.Result.ReplyMarkup)
+	}
+	srv.PressButton(user, list.Result, button.CallbackData)
+	presets := srv.NextReply(t)
+	button, ok = presets.Button("Oil change (15000Km or 12 months)")
+	if !ok {
+		t.Fatalf("actual [%+v], expected [Oil change] button\n", presets.Result.ReplyMarkup)
+	}
+	srv.PressButton(user, presets.Result, button.CallbackData)
+	calendar := srv.NextReply(t)
+	if calendar.Result.Text != "When was it done the last time? Please pick a date." {
+		t.Fatalf("actual [%s]\n", calendar.Result.Text)
+	}
+	day := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	srv.PressButton(user, calendar.Result, fmt.Sprint(day.Unix()))
+	srv.NextReply(t) // calendar is removed
+	if reply := srv.NextReply(t); reply.Result.Text != "What was the mileage then? /skip to use the current one" {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendText(user, "100000")
+	list = srv.NextReply(t)
+	button, ok = list.Button("🟢 Oil change")
+	if !ok {
+		t.Fatalf("actual [%+v], expected [🟢 Oil change] button\n", list.Result.ReplyMarkup)
+	}
+
+	// the first plan schedules the daily reminders of the user
+	tasks := storage.NewTaskStorage(store.DBX())
+	due, err := tasks.SelectDueTasksFromDB(ctx, now.AddDate(0, 0, 2).Unix())
+	if err != nil || len(due) != 1 || due[0].Command != "/car maint_remind" || due[0].ChatID != user.ID {
+		t.Fatalf("actual [%+v], error [%v]\n", due, err)
+	}
+
+	// the reminder is sent once the plan is due, and not repeated right away
+	srv.SendText(user, due[0].Command)
+	if reply := srv.NextReply(t); reply.Result.Text != "No maintenance is due." {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	fuel.ID, fuel.Kilometers = fuelID, 114500
+	if _, err := cars.UpdateFuelInDB(ctx, user.ID, fuel); err != nil {
+		t.Fatal(err)
+	}
+	srv.SendText(user, due[0].Command)
+	reminder := srv.NextReply(t)
+	if !strings.Contains(reminder.Result.Text, "115000Km (500Km left)") {
+		t.Errorf("actual [%s]\n", reminder.Result.Text)
+	}
+	if _, ok := reminder.Button("Snooze 1 week"); !ok {
+		t.Errorf("actual [%+v], expected [Snooze 1 week] button\n", reminder.Result.ReplyMarkup)
+	}
+	srv.SendText(user, due[0].Command)
+	if reply := srv.NextReply(t); reply.Result.Text != "No maintenance is due." {
+		t.Errorf("actual [%s]\n", reply.Result.Text)
+	}
+
+	srv.PressButton(user, list.Result, button.CallbackData)
+	details := srv.NextReply(t)
+	button, ok = details.Button("Done")
+	if !ok {
+		t.Fatalf("actual [%+v], expected [Done] button\n", details.Result.ReplyMarkup)
+	}
+	srv.PressButton(user, details.Result, button.CallbackData)
+	if reply := srv.NextReply(t); reply.Result.Text != "✅ Oil change is done, the plan starts over." {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	if reply := srv.NextReply(t); reply.Result.Text != "How much money did you spend in EUR? /skip" {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendText(user, "89.90")
+	if reply := srv.NextReply(t); !strings.Contains(reply.Result.Text, "Oil change") || !strings.Contains(reply.Result.Text, "89.90€") {
+		t.Errorf("actual [%s]\n", reply.Result.Text)
+	}
+
+	maints, err := cars.SelectMaintenancesFromDB(ctx, user.ID, carID)
+	if err != nil || len(maints) != 1 || maints[0].LastKilometers != 114500 {
+		t.Fatalf("actual [%+v], error [%v]\n", maints, err)
+	}
+
+	srv.SendText(user, fmt.Sprintf("/car maint_snooze %d %d", carID, maints[0].ID))
+	if reply := srv.NextReply(t); reply.Result.Text != "💤 Oil change is snoozed for a week." {
+		t.Errorf("actual [%s]\n", reply.Result.Text)
+	}
+
+	// plans of other users can not be changed
+	srv.SendText(telegram.User{ID: 43, FirstName: "Jane"}, fmt.Sprintf("/car maint_done %d %d", carID, maints[0].ID))
+	if reply := srv.NextReply(t); reply.Result.Text != "Maintenance plan not found." {
+		t.Errorf("actual [%s]\n", reply.Result.Text)
+	}
+
+	// the reminders stop with the last plan
+	srv.SendText(user, fmt.Sprintf("/car maint_del_yes %d %d", carID, maints[0].ID))
+	if reply := srv.NextReply(t); reply.Result.Text != "Maintenance plan has been successfully deleted!" {
+		t.Errorf("actual [%s]\n", reply.Result.Text)
+	}
+	if due, err := tasks.SelectDueTasksFromDB(ctx, now.AddDate(0, 0, 2).Unix()); err != nil || len(due) != 0 {
+		t.Errorf("actual [%+v], error [%v]\n", due, err)
+	}
+}
+
+func TestConversationCarMaintenanceReminders(t *testing.T) {
+	srv, store := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John"}
+
+	ctx := context.Background()
+	cars := storage.NewCarStorage(store.DBX())
+	for _, name := range []string{"Golf", "Polo"} {
+		carID, err := cars.InsertCarIntoDB(ctx, storage.CarBase{UserID: user.ID, Name: name, Year: 2008})
+		if err != nil {
+			t.Fatal(err)
+		}
+		maint := storage.MaintenanceBase{CarID: carID, Description: "Inspection", Months: sql.NullInt64{Int64: 12, Valid: true}, LastTimestamp: time.Now().AddDate(-2, 0, 0).Unix()}
+		if _, err := cars.InsertMaintenanceIntoDB(ctx, maint); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// each due plan is reminded in its own message with its own buttons
+	srv.SendText(user, "/car maint_remind")
+	for _, name := range []string{"Golf", "Polo"} {
+		if reply := srv.NextReply(t); reply.Method != "sendMessage" || !strings.Contains(reply.Result.Text, name) {
+			t.Fatalf("actual [%s] [%s], expected the reminder of %s\n", reply.Method, reply.Result.Text, name)
+		}
+	}
+	if calls := srv.Calls("editMessageText"); len(calls) != 0 {
+		t.Errorf("actual [%d] edits, expected none\n", len(calls))
+	}
+}
+
+func TestConversationCarSharing(t *testing.T) {
+	srv, store := startTestBot(t, 0)
+	owner := telegram.User{ID: 42, FirstName: "John"}
+	driver := telegram.User{ID: 43, FirstName: "Jane"}
+
+	ctx := context.Background()
+	cars := storage.NewCarStorage(store.DBX())
+	carID, err := cars.InsertCarIntoDB(ctx, storage.CarBase{UserID: owner.ID, Name: "Golf", Year: 2008})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// receipts without the user are counted to the owner
+	fuel := storage.FuelBase{CarID: carID, Timestamp: 1790000000, Type: "A95", Milliliters: 40000, Kilometers: 1000, Cents: 6000, FullTank: true}
+	fuelID, err := cars.InsertFuelIntoDB(ctx, fuel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := storage.NewUserStorage(store.DBX())
+	if err := users.UpsertUserInDB(ctx, storage.User{ID: driver.ID, Name: "Jane", Role: storage.RoleMember}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.SendText(driver, fmt.Sprintf("/car get %d", carID))
+	if reply := srv.NextReply(t); reply.Result.Text != "Car not found." {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+
+	srv.SendText(owner, fmt.Sprintf("/car access_add %d %s", carID, storage.CarRoleEditor))
+	if reply := srv.NextReply(t); !strings.HasPrefix(reply.Result.Text, "Select the contact") {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendUserShared(owner, driver.ID)
+	if reply := srv.NextReply(t); !strings.HasPrefix(reply.Result.Text, "The car has been successfully shared as Editor!") {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	if reply := srv.NextReply(t); !strings.Contains(reply.Text(), "Jane (Editor)") {
+		t.Fatalf("actual [%s]\n", reply.Text())
+	}
+
+	srv.SendText(driver, "/car")
+	if reply := srv.NextReply(t); !strings.Contains(fmt.Sprint(reply.Result.ReplyMarkup), "Golf (2008) 👥") {
+		t.Fatalf("actual [%+v], expected the shared car\n", reply.Result.ReplyMarkup)
+	}
+
+	// the editors log the receipts under their name
+	srv.SendText(driver, fmt.Sprintf("/car service_add %d", carID))
+	if reply := srv.NextReply(t); !strings.HasPrefix(reply.Result.Text, "Please pick a receipt date.") {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendText(driver, "1790100000")
+	srv.NextReply(t) // date
+	srv.NextReply(t) // description
+	srv.SendText(driver, "Tyres")
+	srv.NextReply(t) // amount
+	srv.SendText(driver, "140")
+	if reply := srv.NextReply(t); !strings.Contains(reply.Text(), "Tyres") || !strings.Contains(reply.Text(), "👤 Jane") {
+		t.Fatalf("actual [%s]\n", reply.Text())
+	}
+
+	srv.SendText(owner, fmt.Sprintf("/car drivers %d", carID))
+	reply := srv.NextReply(t)
+	for _, expected := range []string{"Jane:</b> 140.00€ (70%, 1 receipts)", "User 42:</b> 60.00€ (30%, 1 receipts)", "60.00€ (40.00L)"} {
+		if !strings.Contains(reply.Result.Text, expected) {
+			t.Fatalf("actual [%s], expected [%s]\n", reply.Result.Text, expected)
+		}
+	}
+
+	// the plans added by the editors remind the owner too
+	srv.SendText(driver, fmt.Sprintf("/car maint_add %d custom", carID))
+	if reply := srv.NextReply(t); reply.Result.Text != "Provide maintenance description." {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendText(driver, "Inspection")
+	srv.NextReply(t) // mileage
+	srv.SendText(driver, "/skip")
+	srv.NextReply(t) // months
+	srv.SendText(driver, "24")
+	srv.NextReply(t) // calendar
+	srv.SendText(driver, "1790100000")
+	srv.NextReply(t) // calendar is removed
+	if reply := srv.NextReply(t); !strings.Contains(fmt.Sprint(reply.Result.ReplyMarkup), "Inspection") {
+		t.Fatalf("actual [%+v], expected the plan\n", reply.Result.ReplyMarkup)
+	}
+	due, err := storage.NewTaskStorage(store.DBX()).SelectDueTasksFromDB(ctx, time.Now().AddDate(0, 0, 2).Unix())
+	if err != nil || len(due) != 2 {
+		t.Fatalf("actual [%+v], error [%v]\n", due, err)
+	}
+	for _, task := range due {
+		if task.Command != "/car maint_remind" || task.ChatID != task.UserID {
+			t.Errorf("actual [%+v]\n", task)
+		}
+	}
+
+	// sharing again changes the role
+	srv.SendText(owner, fmt.Sprintf("/car access_add %d %s", carID, storage.CarRoleViewer))
+	srv.NextReply(t)
+	srv.SendUserShared(owner, driver.ID)
+	srv.NextReply(t)
+	if reply := srv.NextReply(t); !strings.Contains(reply.Text(), "Jane (Viewer)") {
+		t.Fatalf("actual [%s]\n", reply.Text())
+	}
+
+	srv.SendText(driver, fmt.Sprintf("/car fuel_add %d", carID))
+	if reply := srv.NextReply(t); reply.Result.Text != "You can only view this car, ask the owner for the editor access." {
+		t.Errorf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendText(driver, fmt.Sprintf("/car upd_name %d", carID))
+	if reply := srv.NextReply(t); reply.Result.Text != "Only the owner can change the car." {
+		t.Errorf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendText(driver, fmt.Sprintf("/car fuel_get %d", carID))
+	if reply := srv.NextReply(t); strings.Contains(fmt.Sprint(reply.Result.ReplyMarkup), "Delete") {
+		t.Errorf("actual [%+v], expected no changes for the viewer\n", reply.Result.ReplyMarkup)
+	}
+	for _, cmd := range []string{"fuel_upd", "fuel_upd_euros", "fuel_upd_photo"} {
+		srv.SendText(driver, fmt.Sprintf("/car %s %d %d", cmd, carID, fuelID))
+		if reply := srv.NextReply(t); reply.Result.Text != "You can only view this car, ask the owner for the editor access." {
+			t.Errorf("%s: actual [%s]\n", cmd, reply.Result.Text)
+		}
+	}
+
+	// the viewers are warned about the receipts without the exchange rates as well
+	cars.InsertServiceIntoDB(ctx, storage.ServiceBase{CarID: carID, Timestamp: 1790200000, Description: "Vignette", Cents: 4000, Currency: "CHF"})
+	srv.SendText(driver, "/car rates")
+	if reply := srv.NextReply(t); !strings.Contains(reply.Result.Text, "No rates for CHF, the receipts are converted 1:1.") {
+		t.Errorf("actual [%s]\n", reply.Result.Text)
+	}
+
+	srv.SendText(owner, fmt.Sprintf("/car access_del %d %d", carID, driver.ID))
+	if reply := srv.NextReply(t); reply.Result.Text != "Access has been successfully revoked!" {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendText(driver, fmt.Sprintf("/car get %d", carID))
+	if reply := srv.NextReply(t); reply.Result.Text != "Car not found." {
+		t.Errorf("actual [%s]\n", reply.Result.Text)
+	}
+}
+
+func TestConversationCarReceiptPhoto(t *testing.T) {
+	srv, store := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John"}
+
+	ctx := context.Background()
+	cars := storage.NewCarStorage(store.DBX())
+	carID, err := cars.InsertCarIntoDB(ctx, storage.CarBase{UserID: user.ID, Name: "Golf", Year: 2008})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceID, err := cars.InsertServiceIntoDB(ctx, storage.ServiceBase{CarID: carID, Timestamp: 1790000000, Description: "Tyres", Cents: 14000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.SendText(user, fmt.Sprintf("/car service_get %d", carID))
+	if reply := srv.NextReply(t); strings.Contains(fmt.Sprint(reply.Result.ReplyMarkup), "View Receipt") {
+		t.Fatalf("actual [%+v], expected no photo\n", reply.Result.ReplyMarkup)
+	}
+
+	srv.SendText(user, fmt.Sprintf("/car service_upd_photo %d %d", carID, serviceID))
+	if reply := srv.NextReply(t); !strings.HasPrefix(reply.Result.Text, "Please send a photo of the paper receipt.") {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendText(user, "here it is")
+	if reply := srv.NextReply(t); reply.Result.Text != "Please send the receipt as a photo." {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	fileID := srv.SendPhoto(user, "")
+	if reply := srv.NextReply(t); reply.Result.Text != "Receipt has been successfully updated!" {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+
+	srv.SendText(user, fmt.Sprintf("/car service_get %d", carID))
+	reply := srv.NextReply(t)
+	button, ok := reply.Button("View Receipt")
+	if !ok {
+		t.Fatalf("actual [%+v], expected [View Receipt] button\n", reply.Result.ReplyMarkup)
+	}
+	srv.PressButton(user, reply.Result, button.CallbackData)
+	reply = srv.NextReply(t)
+	if reply.Method != "sendPhoto" || string(reply.Params["photo"]) != fmt.Sprintf("%q", fileID) {
+		t.Fatalf("actual [%s %s], expected the largest photo [%s] to be sent again\n", reply.Method, reply.Params["photo"], fileID)
+	}
+	if !strings.Contains(reply.Result.Caption, "Tyres") {
+		t.Errorf("actual [%s]\n", reply.Result.Caption)
+	}
+
+	// the photo can be removed
+	srv.SendText(user, fmt.Sprintf("/car service_upd_photo %d %d", carID, serviceID))
+	srv.NextReply(t)
+	srv.SendText(user, "/skip")
+	srv.NextReply(t)
+	if service, err := cars.GetServiceByIDFromDB(ctx, user.ID, carID, serviceID); err != nil || service.Photo.Valid {
+		t.Errorf("actual [%+v], error [%v]\n", service.Photo, err)
+	}
+
+	// the photo can be sent while the receipt is added, the caption answers the question
+	srv.SendText(user, fmt.Sprintf("/car service_add %d", carID))
+	srv.NextReply(t)
+	srv.SendPhoto(user, "")
+	if reply := srv.NextReply(t); reply.Result.Text != "The photo is attached to the receipt, please answer the question above." {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendText(user, "1790100000")
+	srv.NextReply(t) // date
+	srv.NextReply(t) // description
+	srv.SendText(user, "Brakes")
+	srv.NextReply(t) // amount
+	fileID = srv.SendPhoto(user, "250")
+	if reply := srv.NextReply(t); !strings.Contains(reply.Text(), "Brakes") || !strings.Contains(reply.Text(), "250.00€") {
+		t.Fatalf("actual [%s]\n", reply.Text())
+	}
+	services, err := cars.SelectServicesFromDB(ctx, user.ID, carID)
+	if err != nil || len(services) != 2 || services[1].Photo.String != fileID {
+		t.Errorf("actual [%+v], error [%v], expected the photo [%s]\n", services, err, fileID)
+	}
+
+	// and with the one line fuel receipt
+	srv.SendText(user, fmt.Sprintf("/car fuel_add %d", carID))
+	srv.NextReply(t)
+	fileID = srv.SendPhoto(user, "45.2 80.91 123456 A95")
+	card := srv.NextReply(t)
+	button, ok = card.Button("Save")
+	if !ok {
+		t.Fatalf("actual [%+v], expected [Save] button\n", card.Result.ReplyMarkup)
+	}
+	srv.PressButton(user, card.Result, button.CallbackData)
+	if reply := srv.NextReply(t); reply.Result.Text != "Receipt has been successfully saved!" {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	if fuels, err := cars.SelectFuelsFromDB(ctx, user.ID, carID); err != nil || len(fuels) != 1 || fuels[0].Photo.String != fileID {
+		t.Errorf("actual [%+v], error [%v], expected the photo [%s]\n", fuels, err, fileID)
+	}
+}
+
+func TestConversationHolidayAllowance(t *testing.T) {
+	srv, _ := startTestBot(t, 0)
+	user := telegram.User{ID: 42, FirstName: "John"}
+	year := time.Now().Year()
+
+	steps := []struct {
+		Input    string
+		Expected string
+	}{
+		{Input: fmt.Sprintf("/holiday allowance_set %d", year), Expected: fmt.Sprintf("How many holiday days do you have in %d?", year)},
+		{Input: "-1", Expected: "Please enter a valid whole number."},
+		{Input: "25", Expected: "How many unused days can be carried over to the next year?"},
+		{Input: "0", Expected: fmt.Sprintf("<b>%d</b> - 25 days, nothing is carried over", year)},
+	}
+	for _, step := range steps {
+		srv.SendText(user, step.Input)
+		if reply := srv.NextReply(t); !strings.Contains(reply.Result.Text, step.Expected) {
+			t.Fatalf("actual [%s], expected [%s]\n", reply.Result.Text, step.Expected)
+		}
+	}
+
+	// the public holidays are not counted as the working days
+	date := func(day int) int64 {
+		return time.Date(year+1, 12, day, 0, 0, 0, 0, time.UTC).Unix()
+	}
+	srv.SendText(user, "/holiday public_add")
+	calendar := srv.NextReply(t)
+	srv.PressButton(user, calendar.Result, fmt.Sprint(date(25)))
+	srv.NextReply(t) // date is confirmed
+	srv.NextReply(t) // name is asked
+	srv.SendText(user, "Christmas")
+	if reply := srv.NextReply(t); !strings.Contains(reply.Result.Text, "Christmas") {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+
+	expected := 0
+	for day := 21; day <= 27; day++ {
+		if wd := time.Unix(date(day), 0).UTC().Weekday(); wd != time.Saturday && wd != time.Sunday && day != 25 {
+			expected++
+		}
+	}
+	srv.SendText(user, "/holiday add")
+	calendar = srv.NextReply(t)
+	srv.PressButton(user, calendar.Result, fmt.Sprint(date(21)))
+	srv.NextReply(t) // start is confirmed
+	calendar = srv.NextReply(t)
+	srv.PressButton(user, calendar.Result, fmt.Sprint(date(27)))
+	srv.NextReply(t) // end is confirmed
+	if reply := srv.NextReply(t); !strings.HasSuffix(reply.Result.Text, fmt.Sprintf("/skip to use %d without the weekends and the public holidays", expected)) {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+	srv.SendText(user, "/skip")
+	if reply := srv.NextReply(t); !strings.Contains(reply.Result.Text, fmt.Sprintf("Working days:</b> %d", expected)) {
+		t.Fatalf("actual [%s]\n", reply.Result.Text)
+	}
+
+	srv.SendText(user, "/holiday")
+	reply := srv.NextReply(t)
+	for _, line := range []string{
+		fmt.Sprintf("<b>%d</b> - 25 days, 0 used, 0 planned, 25 remaining", year),
+		fmt.Sprintf("<b>%d</b> - 25 days, 0 used, %d planned, %d remaining", year+1, expected, 25-expected),
+	} {
+		if !strings.Contains(reply.Result.Text, line) {
+			t.Errorf("actual [%s], expected [%s]\n", reply.Result.Text, line)
+		}
+	}
+}
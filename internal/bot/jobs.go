@@ -0,0 +1,55 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"mr-weasel/internal/commands"
+	"mr-weasel/internal/lib/telegram"
+	"mr-weasel/internal/lib/wrap"
+	"mr-weasel/internal/storage"
+)
+
+// ResumeJob executes the command of a job interrupted by the restart again, on behalf of the user who queued it.
+// The results are sent as replies to a new message, because the original one is not known anymore.
+func (m *Manager) ResumeJob(ctx context.Context, job storage.Job) {
+	const op = "bot.Manager.ResumeJob"
+
+	pl := commands.Payload{
+		UserID:     job.UserID,
+		UserName:   job.UserName,
+		ChatID:     job.ChatID,
+		ThreadID:   int(job.ThreadID),
+		IsPrivate:  job.ChatID == job.UserID,
+		Command:    job.Command,
+		ResultChan: make(chan commands.Result),
+	}
+
+	execFn, ok := m.getExecuteFunc(ctx, &pl)
+	if !ok {
+		return
+	}
+
+	res := commands.Result{Text: "♻️ Resuming your job after the restart..."}
+	res.InlineMarkup.AddKeyboardButton("Queued...", "-")
+
+	if !pl.IsPrivate {
+		res.Text = fmt.Sprintf("<a href=\"tg://user?id=%d\">%s</a>\n\n%s", pl.UserID, pl.UserName, res.Text)
+	}
+
+	message, err := m.client.SendMessage(ctx, telegram.SendMessageConfig{
+		ChatID:          pl.ChatID,
+		MessageThreadId: pl.ThreadID,
+		Text:            res.Text,
+		ParseMode:       "HTML",
+		ReplyMarkup:     res.InlineMarkup,
+	})
+	if err != nil {
+		log.Println("[ERROR]", wrap.IfErr(op, err))
+		return
+	}
+
+	resolve := func(context.Context, *commands.Payload) (commands.ExecuteFunc, bool) { return execFn, true }
+	m.dispatch(ctx, pl, message, resolve)
+}
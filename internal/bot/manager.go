@@ -2,53 +2,99 @@ package bot
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
-	"reflect"
-	"runtime"
+	"net/url"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"mr-weasel/internal/commands"
 	"mr-weasel/internal/lib/telegram"
 	"mr-weasel/internal/lib/wrap"
+	"mr-weasel/internal/storage"
+	"mr-weasel/internal/utils"
 )
 
 type Manager struct {
-	client   *telegram.Client               // telegram api client
-	handlers map[string]commands.Handler    // registered command handlers
-	states   map[int64]commands.ExecuteFunc // active user states
-	tokens   map[string]context.CancelFunc  // cancellation tokens
+	client   telegram.API     // telegram api client
+	username string           // bot username, resolved when listening starts
+	handlers *handlerRegistry // registered command handlers
+	sessions *sessions        // active user states
+	tokens   *tokenRegistry   // cancellation tokens
+	users    UserStore        // user roles, nil if roles are not enforced
+	allowed  map[int64]bool   // allow list, everyone is allowed if it is empty
+	denied   map[int64]bool   // deny list, checked before the roles
+	tasks    TaskStore        // scheduled tasks, nil if the scheduler is disabled
+	running  sync.WaitGroup   // running executions and their result processing
+
+	middlewares []commands.Middleware // wrap every execution, the first one being the outermost
 }
 
-func NewManager(client *telegram.Client) *Manager {
+func NewManager(client telegram.API, states StateStore) *Manager {
 	return &Manager{
 		client:   client,
-		handlers: map[string]commands.Handler{},
-		states:   map[int64]commands.ExecuteFunc{},
-		tokens:   map[string]context.CancelFunc{},
+		handlers: newHandlerRegistry(),
+		sessions: newSessions(states),
+		tokens:   newTokenRegistry(),
 	}
 }
 
-func (m *Manager) AddCommands(handlers ...commands.Handler) []telegram.BotCommand {
+// AddCommands registers the handlers, available to the users with the role or higher (see SetUserStore).
+// Handlers with missing requirements are registered as disabled, and are not returned for publishing.
+func (m *Manager) AddCommands(role string, handlers ...commands.Handler) []telegram.BotCommand {
 	botCommands := make([]telegram.BotCommand, 0, len(handlers))
 
 	for _, handler := range handlers {
 		prefix := handler.Prefix()
-		m.handlers[prefix] = handler
+		reg := registration{handler: handler, role: role}
+
+		if requirer, ok := handler.(commands.Requirer); ok {
+			var err error
+			reg.missing, err = utils.ProbeRequirements(requirer.Requirements())
+			if err != nil {
+				log.Printf("[WARN] Disabled %s: %s\n", prefix, err)
+				m.handlers.add(reg)
+				continue
+			}
+		}
+
+		m.handlers.add(reg)
 
 		botCommands = append(botCommands, telegram.BotCommand{
 			Command:     handler.Prefix(),
 			Description: handler.Description(),
 		})
 
-		log.Printf("[INFO] Registered %s\n", prefix)
+		log.Printf("[INFO] Registered %s for %s\n", prefix, role)
 	}
 
 	return botCommands
 }
 
+// ListCommands returns all registered commands, including the disabled ones.
+func (m *Manager) ListCommands() []commands.CommandInfo {
+	regs := m.handlers.list()
+	infos := make([]commands.CommandInfo, 0, len(regs))
+	for _, reg := range regs {
+		infos = append(infos, commands.CommandInfo{
+			Prefix:      reg.handler.Prefix(),
+			Description: reg.handler.Description(),
+			Role:        reg.role,
+			Missing:     reg.missing,
+		})
+	}
+	return infos
+}
+
+// Use registers middlewares for all command executions, it has to be called before the updates are processed.
+func (m *Manager) Use(middlewares ...commands.Middleware) {
+	m.middlewares = append(m.middlewares, middlewares...)
+}
+
 func (m *Manager) PublishCommands(botCommands []telegram.BotCommand) {
 	cfg := telegram.SetMyCommandsConfig{Commands: botCommands}
 	if _, err := m.client.SetMyCommands(context.Background(), cfg); err != nil {
@@ -56,13 +102,77 @@ func (m *Manager) PublishCommands(botCommands []telegram.BotCommand) {
 	}
 }
 
-func (m *Manager) Start(ctx context.Context) {
+type WebhookConfig struct {
+	URL    string // public HTTPS URL, as seen by the Bot API through the reverse proxy
+	Listen string // local address for the HTTP server, e.g. ":8080"
+	Secret string // secret token checked against X-Telegram-Bot-Api-Secret-Token
+}
+
+var allowedUpdates = []string{"message", "callback_query"}
+
+// StartPolling receives updates with getUpdates long polling until ctx is cancelled.
+func (m *Manager) StartPolling(ctx context.Context) {
+	// getUpdates is rejected by the Bot API while a webhook is set
+	if _, err := m.client.DeleteWebhook(ctx, telegram.DeleteWebhookConfig{}); err != nil {
+		log.Println("[ERROR]", err)
+	}
+
 	cfg := telegram.GetUpdatesConfig{
 		Offset:         -1,
 		Timeout:        60,
-		AllowedUpdates: []string{"message", "callback_query"},
+		AllowedUpdates: allowedUpdates,
+	}
+	m.listen(ctx, m.client.GetUpdatesChan(ctx, cfg, 100))
+}
+
+// StartWebhook registers the webhook and receives updates over HTTP until ctx is cancelled.
+// The errors are returned if the server can not listen, or the webhook can not be registered.
+func (m *Manager) StartWebhook(ctx context.Context, webhook WebhookConfig) error {
+	const op = "bot.Manager.StartWebhook"
+
+	u, err := url.Parse(webhook.URL)
+	if err != nil || u.Scheme != "https" {
+		return wrap.IfErr(op, fmt.Errorf("webhook URL must be a valid https URL: %s", webhook.URL))
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	// the server is stopped if the webhook is not registered
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the address is bound first, so the Bot API does not send the updates to nowhere
+	updates, err := m.client.GetWebhookChan(ctx, webhook.Listen, path, webhook.Secret, 100)
+	if err != nil {
+		return wrap.IfErr(op, err)
+	}
+
+	cfg := telegram.SetWebhookConfig{
+		URL:            webhook.URL,
+		AllowedUpdates: allowedUpdates,
+		SecretToken:    webhook.Secret,
+	}
+	if _, err := m.client.SetWebhook(ctx, cfg); err != nil {
+		return wrap.IfErr(op, err)
 	}
-	updates := m.client.GetUpdatesChan(ctx, cfg, 100)
+
+	m.listen(ctx, updates)
+	return nil
+}
+
+// listen processes updates until the channel is closed, and waits for the running executions to finish.
+func (m *Manager) listen(ctx context.Context, updates <-chan telegram.Update) {
+	defer m.running.Wait()
+
+	me, err := m.client.GetMe(ctx, telegram.GetMeConfig{})
+	if err != nil {
+		log.Println("[ERROR]", err)
+	}
+	m.username = me.Username
+
 	for update := range updates {
 		if update.Message != nil && update.Message.From != nil {
 			m.onMessage(ctx, *update.Message)
@@ -80,12 +190,7 @@ func (m *Manager) onMessage(ctx context.Context, message telegram.Message) {
 	const op = "bot.Manager.processMessage"
 
 	// command has /prefix@bot_username syntax
-	message.Text = strings.TrimSuffix(message.Text, fmt.Sprintf("@%s", m.client.Me.Username))
-
-	execFn, ok := m.getExecuteFunc(message.From.ID, message.Text)
-	if !ok {
-		return
-	}
+	message.Text = strings.TrimSuffix(message.Text, fmt.Sprintf("@%s", m.username))
 
 	userName := "@" + message.From.Username
 	if userName == "@" {
@@ -95,6 +200,9 @@ func (m *Manager) onMessage(ctx context.Context, message telegram.Message) {
 	pl := commands.Payload{
 		UserID:     message.From.ID,
 		UserName:   userName,
+		ChatID:     message.Chat.ID,
+		MessageID:  message.MessageID,
+		ThreadID:   threadID(message),
 		IsPrivate:  message.Chat.Type == "private",
 		Command:    message.Text,
 		ResultChan: make(chan commands.Result),
@@ -108,6 +216,14 @@ func (m *Manager) onMessage(ctx context.Context, message telegram.Message) {
 		}
 		pl.FileURL = fileURL
 		pl.Command = message.Audio.FileName
+	} else if message.Document != nil {
+		fileURL, err := m.client.GetFileURL(ctx, telegram.GetFileConfig{FileID: message.Document.FileID})
+		if err != nil {
+			log.Println("[ERROR]", wrap.IfErr(op, err))
+			return
+		}
+		pl.FileURL = fileURL
+		pl.Command = message.Document.FileName
 	} else if message.Voice != nil {
 		fileURL, err := m.client.GetFileURL(ctx, telegram.GetFileConfig{FileID: message.Voice.FileID})
 		if err != nil {
@@ -116,50 +232,43 @@ func (m *Manager) onMessage(ctx context.Context, message telegram.Message) {
 		}
 		pl.FileURL = fileURL
 		pl.Command = fmt.Sprintf("%s.oga", message.Voice.FileUniqueID)
+	} else if len(message.Photo) > 0 {
+		// sizes are in ascending order, the last one is the original
+		pl.FileID = message.Photo[len(message.Photo)-1].FileID
+		pl.Command = message.Caption
 	}
 
 	if message.UserShared != nil {
 		pl.Command = strconv.FormatInt(message.UserShared.UserID, 10)
 	}
 
-	go func() {
-		ctx := context.WithValue(ctx, "contextID", fmt.Sprintf("%p", &pl))
-		ctx, cancel := context.WithCancel(ctx)
-		tokenKey := fmt.Sprintf("%d:%p", pl.UserID, &pl)
-		m.tokens[tokenKey] = cancel
-
-		defer close(pl.ResultChan)
-		defer delete(m.tokens, tokenKey)
-
-		execFn(ctx, pl)
-	}()
-
-	go m.processResults(ctx, pl, message)
+	m.dispatch(ctx, pl, message, m.getExecuteFunc)
 }
 
 func (m *Manager) onCallbackQuery(ctx context.Context, callbackQuery telegram.CallbackQuery) {
 	const op = "telegram.Manager.processCallbackQuery"
 
+	// Message is not available if it is too old
+	if callbackQuery.Message == nil || callbackQuery.Message.Chat == nil {
+		return
+	}
+
 	// Check if chat user is message owner (for groups)
 	if callbackQuery.Message.Chat.Type != "private" {
-		if callbackQuery.Message.Entities[0].User.ID != callbackQuery.From.ID {
+		entities := callbackQuery.Message.Entities
+		if len(entities) == 0 || entities[0].User == nil || entities[0].User.ID != callbackQuery.From.ID {
 			return
 		}
 	}
 
 	if strings.HasPrefix(callbackQuery.Data, commands.CmdCancel) {
-		cancelFn, ok := m.getCancelFunc(callbackQuery.From.ID, callbackQuery.Data)
+		cancelFn, ok := m.getCancelFunc(callbackQuery.Message.Chat.ID, callbackQuery.From.ID, callbackQuery.Data)
 		if ok {
 			cancelFn()
 		}
 		return
 	}
 
-	execFn, ok := m.getExecuteFunc(callbackQuery.From.ID, callbackQuery.Data)
-	if !ok {
-		return
-	}
-
 	userName := "@" + callbackQuery.From.Username
 	if userName == "@" {
 		userName = callbackQuery.From.FirstName
@@ -168,41 +277,92 @@ func (m *Manager) onCallbackQuery(ctx context.Context, callbackQuery telegram.Ca
 	pl := commands.Payload{
 		UserID:     callbackQuery.From.ID,
 		UserName:   userName,
+		ChatID:     callbackQuery.Message.Chat.ID,
+		MessageID:  callbackQuery.Message.MessageID,
+		ThreadID:   threadID(*callbackQuery.Message),
 		IsPrivate:  callbackQuery.Message.Chat.Type == "private",
 		Command:    callbackQuery.Data,
 		ResultChan: make(chan commands.Result),
 	}
 
+	m.dispatch(ctx, pl, *callbackQuery.Message, m.getExecuteFunc)
+}
+
+// dispatch waits for the previous update of the same conversation, then resolves and executes the command in the background.
+// The conversation stays locked until the state is updated by the first response, or until the execution is over.
+func (m *Manager) dispatch(ctx context.Context, pl commands.Payload, previousResponse telegram.Message, resolve func(context.Context, *commands.Payload) (commands.ExecuteFunc, bool)) {
+	wait, unlock := m.sessions.lock(newSessionKey(pl))
+	m.running.Add(1)
+
 	go func() {
+		defer m.running.Done()
+		<-wait
+
+		execFn, ok := resolve(ctx, &pl)
+		if !ok {
+			unlock()
+			return
+		}
+		m.execute(ctx, execFn, pl, previousResponse, unlock)
+	}()
+}
+
+// execute runs the command in the background, and sends its results as replies to the previous response.
+// The unlock func is called once the results have updated the state, see dispatch.
+func (m *Manager) execute(ctx context.Context, execFn commands.ExecuteFunc, pl commands.Payload, previousResponse telegram.Message, unlock func()) {
+	m.running.Add(2)
+	execFn = commands.Chain(execFn, m.middlewares...)
+
+	go func() {
+		defer m.running.Done()
+
 		ctx := context.WithValue(ctx, "contextID", fmt.Sprintf("%p", &pl))
 		ctx, cancel := context.WithCancel(ctx)
-		tokenKey := fmt.Sprintf("%d:%p", pl.UserID, &pl)
-		m.tokens[tokenKey] = cancel
+		tokenKey := fmt.Sprintf("%d:%d:%p", pl.ChatID, pl.UserID, &pl)
+		m.tokens.add(tokenKey, cancel)
 
 		defer close(pl.ResultChan)
-		defer delete(m.tokens, tokenKey)
+		defer m.tokens.remove(tokenKey)
+		defer cancel()
 
 		execFn(ctx, pl)
 	}()
 
-	go m.processResults(ctx, pl, *callbackQuery.Message)
+	go func() {
+		defer m.running.Done()
+		defer unlock()
+		m.processResults(ctx, pl, previousResponse, unlock)
+	}()
 }
 
-func (m *Manager) processResults(ctx context.Context, pl commands.Payload, previousResponse telegram.Message) {
+func (m *Manager) processResults(ctx context.Context, pl commands.Payload, previousResponse telegram.Message, unlock func()) {
 	const op = "bot.Manager.processResults"
 	var err error
 
 	for result := range pl.ResultChan {
+		if result.Release != nil {
+			defer result.Release()
+		}
 		if result.Error != nil {
 			log.Println("[ERROR]", wrap.IfErr(op, result.Error))
 		}
 
 		if previousResponse.Chat == nil {
+			// keep draining the results, so the execution is not blocked
 			log.Println("[WARN]", "Chat no longer exists, bot has been kicked!")
-			return
+			continue
 		}
 
-		if result.Audio != nil {
+		if result.Image != nil || result.Document != nil || result.Photo != "" {
+			// files are sent separately, so the keyboard of the previous response keeps working
+			if !pl.IsPrivate {
+				result.Text = fmt.Sprintf("<a href=\"tg://user?id=%d\">%s</a>\n\n%s", pl.UserID, pl.UserName, result.Text)
+			}
+			if err = m.sendFile(ctx, pl, result); err != nil {
+				log.Println("[ERROR]", wrap.IfErr(op, err))
+			}
+
+		} else if result.Audio != nil {
 			media := []telegram.InputMedia{}
 
 			keys := make([]string, 0, len(result.Audio))
@@ -215,21 +375,23 @@ func (m *Manager) processResults(ctx context.Context, pl commands.Payload, previ
 				media = append(media, &telegram.InputMediaAudio{Media: "attach://" + name})
 			}
 
-			_, err = m.client.SendMediaGroup(ctx, telegram.SendMediaGroupConfig{ChatID: previousResponse.Chat.ID, Media: media}, result.Audio)
+			_, err = m.client.SendMediaGroup(ctx, telegram.SendMediaGroupConfig{ChatID: pl.ChatID, MessageThreadID: int64(pl.ThreadID), Media: media}, result.Audio)
 			if err != nil {
 				log.Println("[ERROR]", wrap.IfErr(op, err))
 			}
 
-		} else if result.InlineMarkup.InlineKeyboard != nil && previousResponse.ReplyMarkup != nil {
+		} else if result.InlineMarkup.InlineKeyboard != nil && previousResponse.ReplyMarkup != nil && !result.NewMessage {
 			// if both previous and new response contain an inline keyboard, then it is update
 
 			// in case of update we can change states only, or if requested explicitly
-			if result.State != nil {
-				m.states[pl.UserID] = result.State
+			if result.State != "" {
+				m.setState(ctx, newSessionKey(pl), result)
 			} else if result.ClearState {
-				delete(m.states, pl.UserID)
+				m.clearState(ctx, newSessionKey(pl))
 			}
 
+			unlock()
+
 			// in case of update, keep original text if not specified explicitly
 			if result.Text == "" {
 				result.Text = previousResponse.Text
@@ -258,12 +420,14 @@ func (m *Manager) processResults(ctx context.Context, pl commands.Payload, previ
 		} else if result.Text != "" {
 			// otherwise it is just a new message
 
-			// in case of new reponse message we can both change and escape states
-			if result.State != nil {
-				m.states[pl.UserID] = result.State
-			} else {
-				delete(m.states, pl.UserID)
+			// in case of new reponse message we can both change and escape states,
+			// scheduled executions escape only if requested explicitly, not to break the user conversation
+			if result.State != "" {
+				m.setState(ctx, newSessionKey(pl), result)
+			} else if !pl.Scheduled || result.ClearState {
+				m.clearState(ctx, newSessionKey(pl))
 			}
+			unlock()
 
 			var replyMarkup telegram.ReplyMarkup
 			if result.InlineMarkup.InlineKeyboard != nil {
@@ -279,10 +443,11 @@ func (m *Manager) processResults(ctx context.Context, pl commands.Payload, previ
 			}
 
 			previousResponse, err = m.client.SendMessage(ctx, telegram.SendMessageConfig{
-				ChatID:      previousResponse.Chat.ID,
-				Text:        result.Text,
-				ParseMode:   "HTML",
-				ReplyMarkup: replyMarkup,
+				ChatID:          pl.ChatID,
+				MessageThreadId: pl.ThreadID,
+				Text:            result.Text,
+				ParseMode:       "HTML",
+				ReplyMarkup:     replyMarkup,
 			})
 			if err != nil {
 				log.Println("[ERROR]", wrap.IfErr(op, err))
@@ -292,35 +457,129 @@ func (m *Manager) processResults(ctx context.Context, pl commands.Payload, previ
 	}
 }
 
-func (m *Manager) getExecuteFunc(userID int64, text string) (commands.ExecuteFunc, bool) {
-	if strings.HasPrefix(text, "/") { // New command
-		prefix := strings.SplitN(text, " ", 2)[0]
-		handler, ok := m.handlers[prefix]
+// sendFile uploads the image or the document from a temporary file, the multipart attachments are read from the disk.
+// The photos which are already on the telegram servers are sent by their file id.
+func (m *Manager) sendFile(ctx context.Context, pl commands.Payload, result commands.Result) error {
+	if result.Photo != "" {
+		_, err := m.client.SendPhoto(ctx, telegram.SendPhotoConfig{
+			ChatID:          pl.ChatID,
+			MessageThreadID: int64(pl.ThreadID),
+			Photo:           result.Photo,
+			Caption:         result.Text,
+			ParseMode:       "HTML",
+		}, nil)
+		return err
+	}
+
+	name, data := "photo.png", result.Image
+	if result.Document != nil {
+		name, data = result.Document.Name, result.Document.Data
+	}
+
+	file, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	attach := map[string]string{name: file.Name()}
+	if result.Document != nil {
+		_, err = m.client.SendDocument(ctx, telegram.SendDocumentConfig{
+			ChatID:          pl.ChatID,
+			MessageThreadID: int64(pl.ThreadID),
+			Document:        "attach://" + name,
+			Caption:         result.Text,
+			ParseMode:       "HTML",
+		}, attach)
+	} else {
+		_, err = m.client.SendPhoto(ctx, telegram.SendPhotoConfig{
+			ChatID:          pl.ChatID,
+			MessageThreadID: int64(pl.ThreadID),
+			Photo:           "attach://" + name,
+			Caption:         result.Text,
+			ParseMode:       "HTML",
+		}, attach)
+	}
+	return err
+}
+
+func (m *Manager) getExecuteFunc(ctx context.Context, pl *commands.Payload) (commands.ExecuteFunc, bool) {
+	const op = "bot.Manager.getExecuteFunc"
+
+	if strings.HasPrefix(pl.Command, "/") { // New command
+		prefix := strings.SplitN(pl.Command, " ", 2)[0]
+		reg, ok := m.handlers.get(prefix)
 		if ok {
-			log.Printf("[VERB] %d: %s\n", userID, text)
-			return handler.Execute, true
+			if !m.authorize(ctx, *pl, reg.role) {
+				return nil, false
+			}
+			pl.IsAdmin = m.permitted(ctx, pl.UserID, storage.RoleAdmin)
+			log.Printf("[VERB] %d: %s\n", pl.UserID, pl.Command)
+			return reg.handler.Execute, true
 		}
 	}
 
-	fn, ok := m.states[userID] // Stateful command
-	if ok {
-		log.Printf("[VERB] %d: %s\n", userID, runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name())
+	state, ok, err := m.sessions.get(ctx, newSessionKey(*pl)) // Stateful command
+	if err != nil {
+		log.Println("[ERROR]", wrap.IfErr(op, err))
+		return nil, false
+	} else if !ok {
+		return nil, false
+	}
+
+	prefix := strings.SplitN(state.Step, " ", 2)[0]
+	reg, ok := m.handlers.get(prefix)
+	if !ok || !m.authorize(ctx, *pl, reg.role) {
+		return nil, false
+	}
+
+	log.Printf("[VERB] %d: %s\n", pl.UserID, state.Step)
+	pl.IsAdmin = m.permitted(ctx, pl.UserID, storage.RoleAdmin)
+	pl.State, pl.Draft = state.Step, json.RawMessage(state.Draft)
+	return reg.handler.Resume, true
+}
+
+func (m *Manager) setState(ctx context.Context, key sessionKey, result commands.Result) {
+	const op = "bot.Manager.setState"
+	if err := m.sessions.set(ctx, key, result); err != nil {
+		log.Println("[ERROR]", wrap.IfErr(op, err))
 	}
+}
 
-	return fn, ok
+func (m *Manager) clearState(ctx context.Context, key sessionKey) {
+	const op = "bot.Manager.clearState"
+	if err := m.sessions.clear(ctx, key); err != nil {
+		log.Println("[ERROR]", wrap.IfErr(op, err))
+	}
 }
 
-func (m *Manager) getCancelFunc(userID int64, text string) (context.CancelFunc, bool) {
+func (m *Manager) getCancelFunc(chatID int64, userID int64, text string) (context.CancelFunc, bool) {
 	split := strings.SplitN(text, " ", 2)
 	if len(split) != 2 {
 		return nil, false
 	}
 
-	tokenKey := fmt.Sprintf("%d:%s", userID, split[1])
-	cancel, ok := m.tokens[tokenKey]
+	tokenKey := fmt.Sprintf("%d:%d:%s", chatID, userID, split[1])
+	cancel, ok := m.tokens.get(tokenKey)
 	if ok {
 		log.Printf("[VERB] %d: %s\n", userID, text)
 	}
 
 	return cancel, ok
 }
+
+// threadID returns the forum topic of the message, replies outside of topics are not separate conversations.
+func threadID(message telegram.Message) int {
+	if message.IsTopicMessage {
+		return message.MessageThreadID
+	}
+	return 0
+}
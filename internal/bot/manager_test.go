@@ -0,0 +1,431 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mr-weasel/internal/commands"
+	"mr-weasel/internal/lib/telegram"
+	"mr-weasel/internal/storage"
+	"mr-weasel/internal/utils"
+)
+
+// fakeClient records outgoing requests instead of calling the Bot API.
+type fakeClient struct {
+	mu       sync.Mutex
+	lastID   int
+	messages []telegram.Message
+}
+
+func (c *fakeClient) GetMe(ctx context.Context, cfg telegram.GetMeConfig) (telegram.User, error) {
+	return telegram.User{ID: 1, IsBot: true, Username: "weasel_bot"}, nil
+}
+
+func (c *fakeClient) SetMyCommands(ctx context.Context, cfg telegram.SetMyCommandsConfig) (bool, error) {
+	return true, nil
+}
+
+func (c *fakeClient) SetWebhook(ctx context.Context, cfg telegram.SetWebhookConfig) (bool, error) {
+	return true, nil
+}
+
+func (c *fakeClient) DeleteWebhook(ctx context.Context, cfg telegram.DeleteWebhookConfig) (bool, error) {
+	return true, nil
+}
+
+func (c *fakeClient) GetUpdatesChan(ctx context.Context, cfg telegram.GetUpdatesConfig, chanSize int) <-chan telegram.Update {
+	return nil
+}
+
+func (c *fakeClient) GetWebhookChan(ctx context.Context, addr string, path string, secret string, chanSize int) (<-chan telegram.Update, error) {
+	return nil, nil
+}
+
+func (c *fakeClient) GetFileURL(ctx context.Context, cfg telegram.GetFileConfig) (string, error) {
+	return "https://api.telegram.org/file/" + cfg.FileID, nil
+}
+
+func (c *fakeClient) SendMessage(ctx context.Context, cfg telegram.SendMessageConfig) (telegram.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastID++
+	msg := telegram.Message{MessageID: c.lastID, Chat: &telegram.Chat{ID: cfg.ChatID, Type: "private"}, Text: cfg.Text}
+	if markup, ok := cfg.ReplyMarkup.(telegram.InlineKeyboardMarkup); ok {
+		msg.ReplyMarkup = &markup
+	}
+	c.messages = append(c.messages, msg)
+	return msg, nil
+}
+
+func (c *fakeClient) SendPhoto(ctx context.Context, cfg telegram.SendPhotoConfig, attach map[string]string) (telegram.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastID++
+	msg := telegram.Message{MessageID: c.lastID, Chat: &telegram.Chat{ID: cfg.ChatID, Type: "private"}, Caption: cfg.Caption}
+	c.messages = append(c.messages, msg)
+	return msg, nil
+}
+
+func (c *fakeClient) SendDocument(ctx context.Context, cfg telegram.SendDocumentConfig, attach map[string]string) (telegram.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastID++
+	msg := telegram.Message{MessageID: c.lastID, Chat: &telegram.Chat{ID: cfg.ChatID, Type: "private"}, Caption: cfg.Caption}
+	c.messages = append(c.messages, msg)
+	return msg, nil
+}
+
+func (c *fakeClient) SendMediaGroup(ctx context.Context, cfg telegram.SendMediaGroupConfig, attach map[string]string) ([]telegram.Message, error) {
+	return nil, nil
+}
+
+func (c *fakeClient) EditMessageText(ctx context.Context, cfg telegram.EditMessageTextConfig) (telegram.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	msg := telegram.Message{MessageID: cfg.MessageID, Chat: &telegram.Chat{ID: cfg.ChatID, Type: "private"}, Text: cfg.Text, ReplyMarkup: cfg.ReplyMarkup}
+	c.messages = append(c.messages, msg)
+	return msg, nil
+}
+
+func (c *fakeClient) AnswerCallbackQuery(ctx context.Context, cfg telegram.AnswerCallbackQueryConfig) (bool, error) {
+	return true, nil
+}
+
+// sent returns messages sent or edited in the chat.
+func (c *fakeClient) sent(chatID int64) []telegram.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var messages []telegram.Message
+	for _, msg := range c.messages {
+		if msg.Chat.ID == chatID {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// waitSent waits until n messages are sent or edited in the chat.
+func (c *fakeClient) waitSent(t *testing.T, chatID int64, n int) []telegram.Message {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if messages := c.sent(chatID); len(messages) >= n {
+			return messages
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %d messages in chat %d, actual [%+v]\n", n, chatID, c.sent(chatID))
+	return nil
+}
+
+// memoryStates is an in-memory StateStore.
+type memoryStates struct {
+	mu     sync.Mutex
+	states map[sessionKey]storage.State
+}
+
+func (s *memoryStates) GetStateFromDB(ctx context.Context, chatID int64, userID int64, threadID int64) (storage.State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[sessionKey{chatID, userID, threadID}]
+	if !ok {
+		return state, sql.ErrNoRows
+	}
+	return state, nil
+}
+
+func (s *memoryStates) SetStateInDB(ctx context.Context, state storage.State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[sessionKey{state.ChatID, state.UserID, state.ThreadID}] = state
+	return nil
+}
+
+func (s *memoryStates) DeleteStateFromDB(ctx context.Context, chatID int64, userID int64, threadID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, sessionKey{chatID, userID, threadID})
+	return nil
+}
+
+// echoCommand asks for a text and echoes it back, or waits until cancelled with /echo slow.
+type echoCommand struct{}
+
+func (echoCommand) Prefix() string      { return "/echo" }
+func (echoCommand) Description() string { return "echo" }
+
+func (echoCommand) Execute(ctx context.Context, pl commands.Payload) {
+	if pl.Command == "/echo panic" {
+		panic("boom")
+	}
+	if pl.Command != "/echo slow" {
+		pl.ResultChan <- commands.Result{Text: "Say something.", State: "/echo text", Draft: pl.UserID}
+		return
+	}
+	res := commands.Result{Text: "Waiting..."}
+	res.InlineMarkup.AddKeyboardButton("Cancel", fmt.Sprintf("%s %s", commands.CmdCancel, ctx.Value("contextID")))
+	pl.ResultChan <- res
+	<-ctx.Done()
+	res = commands.Result{Text: "Cancelled."}
+	res.InlineMarkup.AddKeyboardRow() // remove keyboard
+	pl.ResultChan <- res
+}
+
+func (echoCommand) Resume(ctx context.Context, pl commands.Payload) {
+	pl.ResultChan <- commands.Result{Text: fmt.Sprintf("%s %s", pl.Command, pl.Draft)}
+}
+
+func newTestManager() (*Manager, *fakeClient, *memoryStates) {
+	client := &fakeClient{}
+	states := &memoryStates{states: map[sessionKey]storage.State{}}
+	m := NewManager(client, states)
+	m.AddCommands(storage.RoleMember, echoCommand{})
+	return m, client, states
+}
+
+func newMessageUpdate(userID int64, text string) telegram.Update {
+	return telegram.Update{Message: &telegram.Message{
+		From: &telegram.User{ID: userID, Username: fmt.Sprint("user", userID)},
+		Chat: &telegram.Chat{ID: userID, Type: "private"},
+		Text: text,
+	}}
+}
+
+func newCallbackUpdate(userID int64, message telegram.Message, data string) telegram.Update {
+	return telegram.Update{CallbackQuery: &telegram.CallbackQuery{
+		ID:      fmt.Sprint(userID),
+		From:    &telegram.User{ID: userID},
+		Message: &message,
+		Data:    data,
+	}}
+}
+
+func TestManagerConversation(t *testing.T) {
+	m, client, states := newTestManager()
+	updates := make(chan telegram.Update)
+	done := make(chan struct{})
+	go func() {
+		m.listen(context.Background(), updates)
+		close(done)
+	}()
+
+	updates <- newMessageUpdate(7, "/echo@weasel_bot")
+	client.waitSent(t, 7, 1)
+	updates <- newMessageUpdate(7, "hello")
+	messages := client.waitSent(t, 7, 2)
+
+	close(updates)
+	<-done
+
+	if messages[1].Text != "hello 7" {
+		t.Fatalf("actual [%s], expected [hello 7]\n", messages[1].Text)
+	}
+	if _, err := states.GetStateFromDB(context.Background(), 7, 7, 0); err != sql.ErrNoRows {
+		t.Fatalf("state is not cleared, err [%v]\n", err)
+	}
+}
+
+func TestManagerConcurrentUsers(t *testing.T) {
+	const users = 50
+
+	m, client, _ := newTestManager()
+	updates := make(chan telegram.Update)
+	done := make(chan struct{})
+	go func() {
+		m.listen(context.Background(), updates)
+		close(done)
+	}()
+
+	var wg sync.WaitGroup
+	for userID := int64(1); userID <= users; userID++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			updates <- newMessageUpdate(userID, "/echo slow")
+			waiting := client.waitSent(t, userID, 1)[0]
+			updates <- newMessageUpdate(userID, "/echo")
+			client.waitSent(t, userID, 2)
+			updates <- newCallbackUpdate(userID, waiting, waiting.ReplyMarkup.InlineKeyboard[0][0].CallbackData)
+			client.waitSent(t, userID, 3)
+			updates <- newMessageUpdate(userID, "hi")
+			client.waitSent(t, userID, 4)
+		}()
+	}
+	wg.Wait()
+
+	close(updates)
+	<-done
+
+	for userID := int64(1); userID <= users; userID++ {
+		messages := client.sent(userID)
+		if len(messages) != 4 {
+			t.Fatalf("user %d, actual [%+v]\n", userID, messages)
+		}
+		texts := map[string]bool{}
+		for _, msg := range messages {
+			texts[msg.Text] = true
+		}
+		for _, expected := range []string{"Waiting...", "Say something.", "Cancelled.", fmt.Sprintf("hi %d", userID)} {
+			if !texts[expected] {
+				t.Fatalf("user %d, missing [%s], actual [%+v]\n", userID, expected, messages)
+			}
+		}
+	}
+}
+
+// countCommand increments the number in the draft with every message, slowly enough to overlap the next update.
+type countCommand struct{}
+
+func (countCommand) Prefix() string      { return "/count" }
+func (countCommand) Description() string { return "count" }
+
+func (countCommand) Execute(ctx context.Context, pl commands.Payload) {
+	pl.ResultChan <- commands.Result{Text: "0", State: "/count next", Draft: 0}
+}
+
+func (countCommand) Resume(ctx context.Context, pl commands.Payload) {
+	var count int
+	if err := json.Unmarshal(pl.Draft, &count); err != nil {
+		pl.ResultChan <- commands.Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	time.Sleep(20 * time.Millisecond)
+	pl.ResultChan <- commands.Result{Text: fmt.Sprint(count + 1), State: "/count next", Draft: count + 1}
+}
+
+func TestManagerSameConversation(t *testing.T) {
+	m, client, states := newTestManager()
+	m.AddCommands(storage.RoleMember, countCommand{})
+	updates := make(chan telegram.Update)
+	done := make(chan struct{})
+	go func() {
+		m.listen(context.Background(), updates)
+		close(done)
+	}()
+
+	updates <- newMessageUpdate(7, "/count")
+	client.waitSent(t, 7, 1)
+
+	// both updates arrive before the first one is answered
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			updates <- newMessageUpdate(7, "+1")
+		}()
+	}
+	wg.Wait()
+	messages := client.waitSent(t, 7, 3)
+
+	close(updates)
+	<-done
+
+	for i, expected := range []string{"0", "1", "2"} {
+		if messages[i].Text != expected {
+			t.Errorf("actual [%s], expected [%s]\n", messages[i].Text, expected)
+		}
+	}
+	state, err := states.GetStateFromDB(context.Background(), 7, 7, 0)
+	if err != nil || state.Draft != "2" {
+		t.Errorf("actual [%+v], err [%v], expected draft [2]\n", state, err)
+	}
+}
+
+func TestManagerRecover(t *testing.T) {
+	m, client, _ := newTestManager()
+	m.Use(commands.Recover())
+	updates := make(chan telegram.Update)
+	done := make(chan struct{})
+	go func() {
+		m.listen(context.Background(), updates)
+		close(done)
+	}()
+
+	updates <- newMessageUpdate(7, "/echo panic")
+	messages := client.waitSent(t, 7, 1)
+	updates <- newMessageUpdate(8, "/echo")
+	client.waitSent(t, 8, 1)
+
+	close(updates)
+	<-done
+
+	if messages[0].Text != "There is something wrong, please try again." {
+		t.Fatalf("actual [%s]\n", messages[0].Text)
+	}
+}
+
+// missingCommand depends on a tool which is never installed.
+type missingCommand struct {
+	echoCommand
+}
+
+func (missingCommand) Prefix() string { return "/missing" }
+
+func (missingCommand) Requirements() []utils.Requirement {
+	return []utils.Requirement{utils.RequireBinary("mr-weasel-missing-binary")}
+}
+
+func TestManagerRequirements(t *testing.T) {
+	m, client, _ := newTestManager()
+	published := m.AddCommands(storage.RoleMember, missingCommand{}, commands.NewHelpCommand(m))
+	if len(published) != 1 || published[0].Command != "/help" {
+		t.Fatalf("actual [%+v], expected [/help]\n", published)
+	}
+
+	updates := make(chan telegram.Update)
+	done := make(chan struct{})
+	go func() {
+		m.listen(context.Background(), updates)
+		close(done)
+	}()
+
+	updates <- newMessageUpdate(7, "/missing")
+	updates <- newMessageUpdate(7, "/help")
+	client.waitSent(t, 7, 1)
+
+	close(updates)
+	<-done
+
+	messages := client.sent(7)
+	if len(messages) != 1 {
+		t.Fatalf("actual [%+v], expected /help only\n", messages)
+	}
+	for _, expected := range []string{"/echo - echo", "Disabled commands", "/missing - echo\n🚫 missing mr-weasel-missing-binary"} {
+		if !strings.Contains(messages[0].Text, expected) {
+			t.Fatalf("actual [%s], expected [%s]\n", messages[0].Text, expected)
+		}
+	}
+}
+
+func TestManagerStartWebhookInvalidURL(t *testing.T) {
+	m, _, _ := newTestManager()
+	err := m.StartWebhook(context.Background(), WebhookConfig{URL: "http://example.com/webhook", Listen: ":0", Secret: "s3cret"})
+	if err == nil {
+		t.Fatalf("expected the error for the non-https URL\n")
+	}
+}
+
+func TestManagerResumeJob(t *testing.T) {
+	m, client, states := newTestManager()
+
+	m.ResumeJob(context.Background(), storage.Job{UserID: 9, UserName: "@john", ChatID: 9, Command: "/echo"})
+	messages := client.waitSent(t, 9, 2)
+	m.running.Wait()
+
+	if !strings.HasPrefix(messages[0].Text, "♻️") || messages[0].ReplyMarkup == nil {
+		t.Errorf("actual [%s], [%+v]\n", messages[0].Text, messages[0].ReplyMarkup)
+	}
+	if messages[1].Text != "Say something." {
+		t.Errorf("actual [%s]\n", messages[1].Text)
+	}
+	if _, err := states.GetStateFromDB(context.Background(), 9, 9, 0); err != nil {
+		t.Errorf("actual error [%s]\n", err)
+	}
+}
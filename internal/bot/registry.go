@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"context"
+	"sync"
+
+	"mr-weasel/internal/commands"
+)
+
+// registration is a command handler with the role required to use it.
+type registration struct {
+	handler commands.Handler
+	role    string
+	missing []string // missing requirements, the handler is disabled if not empty
+}
+
+// handlerRegistry holds registered command handlers by their prefix.
+type handlerRegistry struct {
+	mu       sync.RWMutex
+	handlers map[string]registration
+	order    []string // prefixes in the registration order
+}
+
+func newHandlerRegistry() *handlerRegistry {
+	return &handlerRegistry{handlers: map[string]registration{}}
+}
+
+func (r *handlerRegistry) add(reg registration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prefix := reg.handler.Prefix()
+	if _, ok := r.handlers[prefix]; !ok {
+		r.order = append(r.order, prefix)
+	}
+	r.handlers[prefix] = reg
+}
+
+// get returns the enabled handler with the prefix.
+func (r *handlerRegistry) get(prefix string) (registration, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	reg, ok := r.handlers[prefix]
+	return reg, ok && len(reg.missing) == 0
+}
+
+// list returns all handlers in the registration order, including the disabled ones.
+func (r *handlerRegistry) list() []registration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	regs := make([]registration, 0, len(r.order))
+	for _, prefix := range r.order {
+		regs = append(regs, r.handlers[prefix])
+	}
+	return regs
+}
+
+// tokenRegistry holds cancellation tokens of running executions.
+type tokenRegistry struct {
+	mu     sync.Mutex
+	tokens map[string]context.CancelFunc
+}
+
+func newTokenRegistry() *tokenRegistry {
+	return &tokenRegistry{tokens: map[string]context.CancelFunc{}}
+}
+
+func (r *tokenRegistry) add(key string, cancel context.CancelFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[key] = cancel
+}
+
+func (r *tokenRegistry) remove(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tokens, key)
+}
+
+func (r *tokenRegistry) get(key string) (context.CancelFunc, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cancel, ok := r.tokens[key]
+	return cancel, ok
+}
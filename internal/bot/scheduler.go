@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"mr-weasel/internal/commands"
+	"mr-weasel/internal/lib/cron"
+	"mr-weasel/internal/lib/telegram"
+	"mr-weasel/internal/lib/wrap"
+	"mr-weasel/internal/storage"
+)
+
+// TaskStore persists the scheduled tasks, implemented by storage.TaskStorage.
+type TaskStore interface {
+	UpsertTaskInDB(ctx context.Context, task storage.Task) error
+	SelectDueTasksFromDB(ctx context.Context, timestamp int64) ([]storage.Task, error)
+	SetTaskNextRunInDB(ctx context.Context, taskID int64, timestamp int64) error
+	DeleteTaskFromDB(ctx context.Context, taskID int64) error
+	DeleteTaskByKeyFromDB(ctx context.Context, userID int64, key string) error
+}
+
+// schedulerGrace is how late a task may run before it counts as missed, and its catch-up policy applies.
+const schedulerGrace = 5 * time.Minute
+
+// SetTaskStore enables the scheduled tasks, it has to be called before the scheduler is started.
+func (m *Manager) SetTaskStore(tasks TaskStore) {
+	m.tasks = tasks
+}
+
+// ScheduleTask saves the task, replacing the task of the user with the same key. The first run of a task
+// with a cron spec is its next occurrence, a one-shot task runs at NextRunAt. Missed runs are caught up once by default.
+func (m *Manager) ScheduleTask(ctx context.Context, task storage.Task) error {
+	const op = "bot.Manager.ScheduleTask"
+
+	if m.tasks == nil {
+		return wrap.IfErr(op, errors.New("scheduler is not enabled"))
+	}
+	if !strings.HasPrefix(task.Command, "/") || task.Key == "" {
+		return wrap.IfErr(op, fmt.Errorf("invalid task %q with command %q", task.Key, task.Command))
+	}
+
+	now := time.Now()
+	if task.Spec != "" {
+		schedule, err := cron.Parse(task.Spec)
+		if err != nil {
+			return wrap.IfErr(op, err)
+		}
+		task.NextRunAt = schedule.Next(now).Unix()
+	} else if task.NextRunAt == 0 {
+		return wrap.IfErr(op, fmt.Errorf("one-shot task %q has no run time", task.Key))
+	}
+	if task.CatchUp == "" {
+		task.CatchUp = storage.TaskCatchUpOnce
+	}
+	task.CreatedAt = now.Unix()
+
+	return wrap.IfErr(op, m.tasks.UpsertTaskInDB(ctx, task))
+}
+
+// UnscheduleTask deletes the task of the user, it is not an error if there is none.
+func (m *Manager) UnscheduleTask(ctx context.Context, userID int64, key string) error {
+	const op = "bot.Manager.UnscheduleTask"
+
+	if m.tasks == nil {
+		return wrap.IfErr(op, errors.New("scheduler is not enabled"))
+	}
+	return wrap.IfErr(op, m.tasks.DeleteTaskByKeyFromDB(ctx, userID, key))
+}
+
+// StartScheduler runs the due tasks every interval until ctx is cancelled.
+// The tasks missed while the bot was down are handled on the first run according to their catch-up policy.
+func (m *Manager) StartScheduler(ctx context.Context, interval time.Duration) {
+	if m.tasks == nil {
+		log.Println("[WARN] Task store is not set, the scheduler is disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			m.runDueTasks(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runDueTasks moves every due task to its next run before running it, so a failing task is not repeated.
+func (m *Manager) runDueTasks(ctx context.Context, now time.Time) {
+	const op = "bot.Manager.runDueTasks"
+
+	tasks, err := m.tasks.SelectDueTasksFromDB(ctx, now.Unix())
+	if err != nil {
+		log.Println("[ERROR]", wrap.IfErr(op, err))
+		return
+	}
+
+	for _, task := range tasks {
+		missed := now.Sub(time.Unix(task.NextRunAt, 0)) > schedulerGrace
+
+		if task.Spec == "" {
+			err = m.tasks.DeleteTaskFromDB(ctx, task.ID)
+		} else if schedule, parseErr := cron.Parse(task.Spec); parseErr != nil {
+			err = errors.Join(parseErr, m.tasks.DeleteTaskFromDB(ctx, task.ID))
+		} else {
+			err = m.tasks.SetTaskNextRunInDB(ctx, task.ID, schedule.Next(now).Unix())
+		}
+		if err != nil {
+			log.Println("[ERROR]", wrap.IfErr(op, err))
+			continue
+		}
+
+		if missed && task.CatchUp == storage.TaskCatchUpSkip {
+			log.Printf("[INFO] Skipped missed task %s of %d\n", task.Key, task.UserID)
+			continue
+		}
+		m.runTask(ctx, task)
+	}
+}
+
+// runTask executes the command of the task on behalf of the user, the results are sent as new messages into the task chat.
+func (m *Manager) runTask(ctx context.Context, task storage.Task) {
+	pl := commands.Payload{
+		UserID:     task.UserID,
+		UserName:   task.UserName,
+		ChatID:     task.ChatID,
+		ThreadID:   int(task.ThreadID),
+		IsPrivate:  task.ChatID == task.UserID,
+		Command:    task.Command,
+		Scheduled:  true,
+		ResultChan: make(chan commands.Result),
+	}
+
+	prefix := strings.SplitN(pl.Command, " ", 2)[0]
+	reg, ok := m.handlers.get(prefix)
+	if !ok || !m.permitted(ctx, pl.UserID, reg.role) {
+		return
+	}
+
+	log.Printf("[VERB] %d: %s (task %s)\n", pl.UserID, pl.Command, task.Key)
+	resolve := func(context.Context, *commands.Payload) (commands.ExecuteFunc, bool) {
+		return reg.handler.Execute, true
+	}
+	m.dispatch(ctx, pl, telegram.Message{Chat: &telegram.Chat{ID: pl.ChatID}}, resolve)
+}
@@ -0,0 +1,191 @@
+package bot
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"mr-weasel/internal/commands"
+	"mr-weasel/internal/storage"
+)
+
+// memoryTasks is an in-memory TaskStore.
+type memoryTasks struct {
+	mu     sync.Mutex
+	lastID int64
+	tasks  map[int64]storage.Task
+}
+
+func (s *memoryTasks) UpsertTaskInDB(ctx context.Context, task storage.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, t := range s.tasks {
+		if t.UserID == task.UserID && t.Key == task.Key {
+			task.ID = id
+		}
+	}
+	if task.ID == 0 {
+		s.lastID++
+		task.ID = s.lastID
+	}
+	s.tasks[task.ID] = task
+	return nil
+}
+
+func (s *memoryTasks) SelectDueTasksFromDB(ctx context.Context, timestamp int64) ([]storage.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tasks []storage.Task
+	for _, task := range s.tasks {
+		if task.NextRunAt <= timestamp {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks, nil
+}
+
+func (s *memoryTasks) SetTaskNextRunInDB(ctx context.Context, taskID int64, timestamp int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task := s.tasks[taskID]
+	task.NextRunAt = timestamp
+	s.tasks[taskID] = task
+	return nil
+}
+
+func (s *memoryTasks) DeleteTaskFromDB(ctx context.Context, taskID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tasks, taskID)
+	return nil
+}
+
+func (s *memoryTasks) DeleteTaskByKeyFromDB(ctx context.Context, userID int64, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, task := range s.tasks {
+		if task.UserID == userID && task.Key == key {
+			delete(s.tasks, id)
+		}
+	}
+	return nil
+}
+
+// get returns the task of the user by its key.
+func (s *memoryTasks) get(userID int64, key string) (storage.Task, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, task := range s.tasks {
+		if task.UserID == userID && task.Key == key {
+			return task, true
+		}
+	}
+	return storage.Task{}, false
+}
+
+// tickCommand replies without changing the conversation state.
+type tickCommand struct {
+	echoCommand
+}
+
+func (tickCommand) Prefix() string { return "/tick" }
+
+func (tickCommand) Execute(ctx context.Context, pl commands.Payload) {
+	pl.ResultChan <- commands.Result{Text: "Tick."}
+}
+
+func TestManagerScheduleTask(t *testing.T) {
+	m, _, _ := newTestManager()
+	ctx := context.Background()
+
+	if err := m.ScheduleTask(ctx, storage.Task{Key: "tick", UserID: 7, ChatID: 7, Command: "/tick", Spec: "0 9 * * *"}); err == nil {
+		t.Errorf("actual no error, expected the scheduler to be disabled\n")
+	}
+
+	tasks := &memoryTasks{tasks: map[int64]storage.Task{}}
+	m.SetTaskStore(tasks)
+
+	invalid := []storage.Task{
+		{Key: "tick", UserID: 7, ChatID: 7, Command: "/tick", Spec: "0 25 * * *"},
+		{Key: "tick", UserID: 7, ChatID: 7, Command: "/tick"},
+		{Key: "tick", UserID: 7, ChatID: 7, Command: "tick", Spec: "@daily"},
+		{UserID: 7, ChatID: 7, Command: "/tick", Spec: "@daily"},
+	}
+	for _, task := range invalid {
+		if err := m.ScheduleTask(ctx, task); err == nil {
+			t.Errorf("actual no error, [%+v]\n", task)
+		}
+	}
+
+	// scheduling the same key again replaces the task
+	for _, spec := range []string{"0 9 * * *", "30 18 * * *"} {
+		if err := m.ScheduleTask(ctx, storage.Task{Key: "tick", UserID: 7, ChatID: 7, Command: "/tick", Spec: spec}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	task, ok := tasks.get(7, "tick")
+	next := time.Unix(task.NextRunAt, 0).UTC()
+	if !ok || len(tasks.tasks) != 1 || next.Hour() != 18 || next.Minute() != 30 || task.CatchUp != storage.TaskCatchUpOnce {
+		t.Errorf("actual [%+v], next run [%s]\n", tasks.tasks, next)
+	}
+
+	if err := m.UnscheduleTask(ctx, 7, "tick"); err != nil || len(tasks.tasks) != 0 {
+		t.Errorf("actual [%+v], error [%v]\n", tasks.tasks, err)
+	}
+}
+
+func TestManagerRunDueTasks(t *testing.T) {
+	m, client, states := newTestManager()
+	m.AddCommands(storage.RoleMember, tickCommand{})
+	tasks := &memoryTasks{tasks: map[int64]storage.Task{}}
+	m.SetTaskStore(tasks)
+
+	ctx := context.Background()
+	now := time.Date(2026, 10, 18, 9, 0, 30, 0, time.UTC)
+	missed := now.Add(-time.Hour).Unix()
+	for _, task := range []storage.Task{
+		{Key: "on-time", UserID: 7, ChatID: 7, Command: "/tick", Spec: "0 9 * * *", CatchUp: storage.TaskCatchUpSkip, NextRunAt: now.Add(-30 * time.Second).Unix()},
+		{Key: "missed-once", UserID: 8, ChatID: 8, Command: "/tick", Spec: "0 * * * *", CatchUp: storage.TaskCatchUpOnce, NextRunAt: missed},
+		{Key: "missed-skip", UserID: 9, ChatID: 9, Command: "/tick", Spec: "0 * * * *", CatchUp: storage.TaskCatchUpSkip, NextRunAt: missed},
+		{Key: "one-shot", UserID: 10, ChatID: 10, Command: "/tick", CatchUp: storage.TaskCatchUpOnce, NextRunAt: missed},
+		{Key: "one-shot-skip", UserID: 11, ChatID: 11, Command: "/tick", CatchUp: storage.TaskCatchUpSkip, NextRunAt: missed},
+		{Key: "later", UserID: 12, ChatID: 12, Command: "/tick", CatchUp: storage.TaskCatchUpOnce, NextRunAt: now.Add(time.Minute).Unix()},
+	} {
+		tasks.UpsertTaskInDB(ctx, task)
+	}
+
+	// the scheduled results do not end the user conversation
+	states.SetStateInDB(ctx, storage.State{ChatID: 7, UserID: 7, Step: "/echo text", Draft: "7"})
+
+	m.runDueTasks(ctx, now)
+	m.running.Wait()
+
+	for userID, expected := range map[int64]int{7: 1, 8: 1, 9: 0, 10: 1, 11: 0, 12: 0} {
+		if actual := client.sent(userID); len(actual) != expected {
+			t.Errorf("user [%d], actual [%+v], expected %d messages\n", userID, actual, expected)
+		} else if expected == 1 && actual[0].Text != "Tick." {
+			t.Errorf("user [%d], actual [%s]\n", userID, actual[0].Text)
+		}
+	}
+	if _, err := states.GetStateFromDB(ctx, 7, 7, 0); err != nil {
+		t.Errorf("actual error [%s]\n", err)
+	}
+
+	expected := map[string]int64{
+		"on-time":     time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC).Unix(),
+		"missed-once": time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC).Unix(),
+		"missed-skip": time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC).Unix(),
+		"later":       now.Add(time.Minute).Unix(),
+	}
+	if len(tasks.tasks) != len(expected) {
+		t.Errorf("actual [%+v], one-shot tasks are not deleted\n", tasks.tasks)
+	}
+	for _, task := range tasks.tasks {
+		if task.NextRunAt != expected[task.Key] {
+			t.Errorf("actual [%d], [%+v]\n", task.NextRunAt, task)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"mr-weasel/internal/commands"
+	"mr-weasel/internal/storage"
+)
+
+// StateStore persists conversation states, implemented by storage.StateStorage.
+type StateStore interface {
+	GetStateFromDB(ctx context.Context, chatID int64, userID int64, threadID int64) (storage.State, error)
+	SetStateInDB(ctx context.Context, state storage.State) error
+	DeleteStateFromDB(ctx context.Context, chatID int64, userID int64, threadID int64) error
+}
+
+// sessionKey identifies a conversation, so the same user can have parallel conversations in different chats and topics.
+type sessionKey struct {
+	chatID   int64
+	userID   int64
+	threadID int64
+}
+
+func newSessionKey(pl commands.Payload) sessionKey {
+	return sessionKey{chatID: pl.ChatID, userID: pl.UserID, threadID: int64(pl.ThreadID)}
+}
+
+// sessions keeps track of user conversations on top of the StateStore, the store has to be safe for concurrent use.
+// The updates of the same conversation are serialized with lock, so the next one sees the state left by the previous.
+type sessions struct {
+	store StateStore
+	mu    sync.Mutex
+	tails map[sessionKey]chan struct{} // released when the last update of the conversation unlocks
+}
+
+func newSessions(store StateStore) *sessions {
+	return &sessions{store: store, tails: map[sessionKey]chan struct{}{}}
+}
+
+// lock queues the update of the conversation, it can proceed once wait is closed and must call unlock when done.
+// The updates are let in the order they were queued, and unlock can be called more than once.
+func (s *sessions) lock(key sessionKey) (<-chan struct{}, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wait, done := s.tails[key], make(chan struct{})
+	if wait == nil {
+		wait = make(chan struct{})
+		close(wait)
+	}
+	s.tails[key] = done
+
+	var once sync.Once
+	return wait, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.tails[key] == done {
+				delete(s.tails, key)
+			}
+			close(done)
+		})
+	}
+}
+
+// get returns the active conversation state, ok is false if there is none.
+func (s *sessions) get(ctx context.Context, key sessionKey) (storage.State, bool, error) {
+	state, err := s.store.GetStateFromDB(ctx, key.chatID, key.userID, key.threadID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return state, false, nil
+	}
+	return state, err == nil, err
+}
+
+func (s *sessions) set(ctx context.Context, key sessionKey, result commands.Result) error {
+	draft, err := json.Marshal(result.Draft)
+	if err != nil {
+		return err
+	}
+	return s.store.SetStateInDB(ctx, storage.State{
+		ChatID:   key.chatID,
+		UserID:   key.userID,
+		ThreadID: key.threadID,
+		Step:     result.State,
+		Draft:    string(draft),
+	})
+}
+
+func (s *sessions) clear(ctx context.Context, key sessionKey) error {
+	return s.store.DeleteStateFromDB(ctx, key.chatID, key.userID, key.threadID)
+}
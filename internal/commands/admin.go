@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	st "mr-weasel/internal/storage"
+)
+
+type AdminCommand struct {
+	storage *st.UserStorage
+}
+
+func NewAdminCommand(storage *st.UserStorage) *AdminCommand {
+	return &AdminCommand{storage: storage}
+}
+
+func (AdminCommand) Prefix() string {
+	return "/admin"
+}
+
+func (AdminCommand) Description() string {
+	return "manage bot users"
+}
+
+const (
+	cmdAdminGet     = "get"
+	cmdAdminApprove = "approve"
+	cmdAdminBlock   = "block"
+)
+
+func (c *AdminCommand) Execute(ctx context.Context, pl Payload) {
+	args := splitCommand(pl.Command, c.Prefix())
+	switch safeGet(args, 0) {
+	case cmdAdminGet:
+		c.showUserDetails(ctx, pl, safeGetInt64(args, 1))
+	case cmdAdminApprove:
+		c.setUserRole(ctx, pl, safeGetInt64(args, 1), st.RoleMember)
+	case cmdAdminBlock:
+		c.setUserRole(ctx, pl, safeGetInt64(args, 1), st.RoleBlocked)
+	default:
+		c.showUserList(ctx, pl)
+	}
+}
+
+func (c *AdminCommand) Resume(ctx context.Context, pl Payload) {
+	// there are no conversation steps
+}
+
+// AccessRequest is sent to the admins when an unknown user tries to use the bot.
+func AccessRequest(user st.User) Result {
+	c := &AdminCommand{}
+	res := Result{Text: "🙋 <b>Access request</b>\n\n" + c.formatUserDetails(user)}
+	res.InlineMarkup.AddKeyboardButton("Approve", commandf(c, cmdAdminApprove, user.ID))
+	res.InlineMarkup.AddKeyboardButton("Block", commandf(c, cmdAdminBlock, user.ID))
+	return res
+}
+
+func (c *AdminCommand) formatRole(role string) string {
+	switch role {
+	case st.RoleAdmin:
+		return "👑"
+	case st.RoleMember:
+		return "✅"
+	case st.RolePending:
+		return "⏳"
+	default:
+		return "🚫"
+	}
+}
+
+func (c *AdminCommand) formatUserDetails(user st.User) string {
+	str := fmt.Sprintf("👤 <b>User:</b> %s\n", _es(user.Name))
+	str += fmt.Sprintf("🆔 <b>ID:</b> %d\n", user.ID)
+	str += fmt.Sprintf("%s <b>Role:</b> %s\n", c.formatRole(user.Role), user.Role)
+	str += fmt.Sprintf("📅 <b>Since:</b> %s\n", user.GetTimestamp())
+	return str
+}
+
+func (c *AdminCommand) showUserList(ctx context.Context, pl Payload) {
+	users, err := c.storage.SelectUsersFromDB(ctx)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	res := Result{Text: "Choose a user from the list below:"}
+	for i, v := range users {
+		res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("%s %s", c.formatRole(v.Role), v.Name), commandf(c, cmdAdminGet, v.ID))
+		if (i+1)%2 == 0 {
+			res.InlineMarkup.AddKeyboardRow()
+		}
+	}
+	pl.ResultChan <- res
+}
+
+func (c *AdminCommand) showUserDetails(ctx context.Context, pl Payload, userID int64) {
+	res := Result{}
+	user, err := c.storage.GetUserFromDB(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		res.Text = "User not found."
+	} else if err != nil {
+		res.Text, res.Error = "There is something wrong, please try again.", err
+	} else {
+		res.Text = c.formatUserDetails(user)
+		if user.Role == st.RolePending || user.Role == st.RoleBlocked {
+			res.InlineMarkup.AddKeyboardButton("Approve", commandf(c, cmdAdminApprove, user.ID))
+		}
+		if user.Role != st.RoleBlocked && user.ID != pl.UserID {
+			res.InlineMarkup.AddKeyboardButton("Block", commandf(c, cmdAdminBlock, user.ID))
+		}
+		res.InlineMarkup.AddKeyboardRow()
+	}
+	res.InlineMarkup.AddKeyboardButton("« Back to users", c.Prefix())
+	pl.ResultChan <- res
+}
+
+func (c *AdminCommand) setUserRole(ctx context.Context, pl Payload, userID int64, role string) {
+	if userID == pl.UserID {
+		pl.ResultChan <- Result{Text: "You cannot change your own role."}
+		return
+	}
+	if _, err := c.storage.SetUserRoleInDB(ctx, userID, role); err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	c.showUserDetails(ctx, pl, userID)
+}
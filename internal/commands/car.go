@@ -7,28 +7,20 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
 	"time"
 
+	"mr-weasel/internal/lib/chart"
 	st "mr-weasel/internal/storage"
 )
 
 type CarCommand struct {
-	storage      *st.CarStorage
-	draftCars    map[int64]*st.CarBase
-	draftFuel    map[int64]*st.FuelBase
-	draftService map[int64]*st.ServiceBase
-	draftLease   map[int64]*st.LeaseBase
+	storage   *st.CarStorage
+	scheduler Scheduler
 }
 
-func NewCarCommand(storage *st.CarStorage) *CarCommand {
-	c := &CarCommand{
-		storage:      storage,
-		draftCars:    make(map[int64]*st.CarBase),
-		draftFuel:    make(map[int64]*st.FuelBase),
-		draftService: make(map[int64]*st.ServiceBase),
-		draftLease:   make(map[int64]*st.LeaseBase),
-	}
-	return c
+func NewCarCommand(storage *st.CarStorage, scheduler Scheduler) *CarCommand {
+	return &CarCommand{storage: storage, scheduler: scheduler}
 }
 
 func (CarCommand) Prefix() string {
@@ -40,27 +32,160 @@ func (CarCommand) Description() string {
 }
 
 const (
-	cmdCarAdd           = "add"
-	cmdCarGet           = "get"
-	cmdCarUpd           = "upd"
-	cmdCarUpdName       = "upd_name"
-	cmdCarUpdYear       = "upd_year"
-	cmdCarUpdPlate      = "upd_plate"
-	cmdCarUpdPrice      = "upd_price"
-	cmdCarDelAsk        = "del"
-	cmdCarDelYes        = "del_yes"
-	cmdCarFuelAdd       = "fuel_add"
-	cmdCarFuelGet       = "fuel_get"
-	cmdCarFuelDelAsk    = "fuel_del"
-	cmdCarFuelDelYes    = "fuel_del_yes"
-	cmdCarServiceAdd    = "service_add"
-	cmdCarServiceGet    = "service_get"
-	cmdCarServiceDelAsk = "service_del"
-	cmdCarServiceDelYes = "service_del_yes"
-	cmdCarLeaseAdd      = "lease_add"
-	cmdCarLeaseGet      = "lease_get"
-	cmdCarLeaseDelAsk   = "lease_del"
-	cmdCarLeaseDelYes   = "lease_del_yes"
+	cmdCarAdd                   = "add"
+	cmdCarGet                   = "get"
+	cmdCarUpd                   = "upd"
+	cmdCarUpdName               = "upd_name"
+	cmdCarUpdYear               = "upd_year"
+	cmdCarUpdPlate              = "upd_plate"
+	cmdCarUpdPrice              = "upd_price"
+	cmdCarUpdResale             = "upd_resale"
+	cmdCarUpdDistance           = "upd_distance"
+	cmdCarUpdVolume             = "upd_volume"
+	cmdCarDelAsk                = "del"
+	cmdCarDelYes                = "del_yes"
+	cmdCarStats                 = "stats"
+	cmdCarTCO                   = "tco"
+	cmdCarChart                 = "chart"
+	cmdCarAudit                 = "audit"
+	cmdCarExport                = "export"
+	cmdCarImport                = "import"
+	cmdCarFuel                  = "fuel"
+	cmdCarFuelAdd               = "fuel_add"
+	cmdCarFuelGet               = "fuel_get"
+	cmdCarFuelUpd               = "fuel_upd"
+	cmdCarFuelUpdTimestamp      = "fuel_upd_timestamp"
+	cmdCarFuelUpdType           = "fuel_upd_type"
+	cmdCarFuelUpdLiters         = "fuel_upd_liters"
+	cmdCarFuelUpdKilometers     = "fuel_upd_kilometers"
+	cmdCarFuelUpdFullTank       = "fuel_upd_full_tank"
+	cmdCarFuelUpdEuros          = "fuel_upd_euros"
+	cmdCarFuelUpdPhoto          = "fuel_upd_photo"
+	cmdCarFuelPhoto             = "fuel_photo"
+	cmdCarFuelDelAsk            = "fuel_del"
+	cmdCarFuelDelYes            = "fuel_del_yes"
+	cmdCarServiceAdd            = "service_add"
+	cmdCarServiceGet            = "service_get"
+	cmdCarServiceUpd            = "service_upd"
+	cmdCarServiceUpdTimestamp   = "service_upd_timestamp"
+	cmdCarServiceUpdDescription = "service_upd_description"
+	cmdCarServiceUpdEuros       = "service_upd_euros"
+	cmdCarServiceUpdPhoto       = "service_upd_photo"
+	cmdCarServicePhoto          = "service_photo"
+	cmdCarServiceDelAsk         = "service_del"
+	cmdCarServiceDelYes         = "service_del_yes"
+	cmdCarLeaseAdd              = "lease_add"
+	cmdCarLeaseGet              = "lease_get"
+	cmdCarLeaseUpd              = "lease_upd"
+	cmdCarLeaseUpdTimestamp     = "lease_upd_timestamp"
+	cmdCarLeaseUpdDescription   = "lease_upd_description"
+	cmdCarLeaseUpdEuros         = "lease_upd_euros"
+	cmdCarLeaseUpdPhoto         = "lease_upd_photo"
+	cmdCarLeasePhoto            = "lease_photo"
+	cmdCarLeaseDelAsk           = "lease_del"
+	cmdCarLeaseDelYes           = "lease_del_yes"
+	cmdCarMaint                 = "maint"
+	cmdCarMaintGet              = "maint_get"
+	cmdCarMaintAdd              = "maint_add"
+	cmdCarMaintDone             = "maint_done"
+	cmdCarMaintSnooze           = "maint_snooze"
+	cmdCarMaintDelAsk           = "maint_del"
+	cmdCarMaintDelYes           = "maint_del_yes"
+	cmdCarMaintRemind           = "maint_remind"
+	cmdCarCurrency              = "currency"
+	cmdCarCurrencyAsk           = "currency_other"
+	cmdCarRates                 = "rates"
+	cmdCarRatesSet              = "rates_set"
+	cmdCarAccess                = "access"
+	cmdCarAccessAdd             = "access_add"
+	cmdCarAccessDel             = "access_del"
+	cmdCarDrivers               = "drivers"
+)
+
+const (
+	carStatsMonth = "month"
+	carStatsYear  = "year"
+)
+
+const (
+	carChartConsumption = "consumption"
+	carChartSpend       = "spend"
+)
+
+// carChartMonths limits the spend chart to the recent months.
+const carChartMonths = 12
+
+// Plausible ranges of the fuel receipts, the values outside are most likely typos and have to be confirmed.
+const (
+	carMinConsumption = 2.0  // L/100Km
+	carMaxConsumption = 30.0 // L/100Km
+	carMinFuelPrice   = 0.5  // EUR/L
+	carMaxFuelPrice   = 4.0  // EUR/L
+)
+
+const (
+	carFuelFullTankYes = "Yes"
+	carFuelFullTankNo  = "No"
+)
+
+const (
+	carFuelSaveYes = "fuel_save_yes"
+	carFuelSaveNo  = "fuel_save_no"
+)
+
+// carAuditLimit limits the suspicious receipts listed by the audit.
+const carAuditLimit = 10
+
+const (
+	stepCarAddName               = "add_name"
+	stepCarAddYear               = "add_year"
+	stepCarAddPlate              = "add_plate"
+	stepCarAddPrice              = "add_price"
+	stepCarUpdName               = "upd_name"
+	stepCarUpdYear               = "upd_year"
+	stepCarUpdPlate              = "upd_plate"
+	stepCarUpdPrice              = "upd_price"
+	stepCarUpdResale             = "upd_resale"
+	stepCarFuelTimestamp         = "fuel_timestamp"
+	stepCarFuelType              = "fuel_type"
+	stepCarFuelLiters            = "fuel_liters"
+	stepCarFuelFullTank          = "fuel_full_tank"
+	stepCarFuelKilometers        = "fuel_kilometers"
+	stepCarFuelEuros             = "fuel_euros"
+	stepCarFuelConfirm           = "fuel_confirm"
+	stepCarFuelQuick             = "fuel_quick"
+	stepCarFuelUpdTimestamp      = "fuel_upd_timestamp"
+	stepCarFuelUpdType           = "fuel_upd_type"
+	stepCarFuelUpdLiters         = "fuel_upd_liters"
+	stepCarFuelUpdKilometers     = "fuel_upd_kilometers"
+	stepCarFuelUpdFullTank       = "fuel_upd_full_tank"
+	stepCarFuelUpdEuros          = "fuel_upd_euros"
+	stepCarFuelUpdPhoto          = "fuel_upd_photo"
+	stepCarServiceTimestamp      = "service_timestamp"
+	stepCarServiceDescription    = "service_description"
+	stepCarServiceEuros          = "service_euros"
+	stepCarServiceUpdTimestamp   = "service_upd_timestamp"
+	stepCarServiceUpdDescription = "service_upd_description"
+	stepCarServiceUpdEuros       = "service_upd_euros"
+	stepCarServiceUpdPhoto       = "service_upd_photo"
+	stepCarLeaseTimestamp        = "lease_timestamp"
+	stepCarLeaseDescription      = "lease_description"
+	stepCarLeaseEuros            = "lease_euros"
+	stepCarLeaseUpdTimestamp     = "lease_upd_timestamp"
+	stepCarLeaseUpdDescription   = "lease_upd_description"
+	stepCarLeaseUpdEuros         = "lease_upd_euros"
+	stepCarLeaseUpdPhoto         = "lease_upd_photo"
+	stepCarImportFile            = "import_file"
+	stepCarImportConfirm         = "import_confirm"
+	stepCarMaintDescription      = "maint_description"
+	stepCarMaintKilometers       = "maint_kilometers"
+	stepCarMaintMonths           = "maint_months"
+	stepCarMaintLastTimestamp    = "maint_last_timestamp"
+	stepCarMaintLastKilometers   = "maint_last_kilometers"
+	stepCarMaintServiceEuros     = "maint_service_euros"
+	stepCarCurrency              = "currency"
+	stepCarRates                 = "rates"
+	stepCarAccessUser            = "access_user"
 )
 
 func (c *CarCommand) Execute(ctx context.Context, pl Payload) {
@@ -80,14 +205,56 @@ func (c *CarCommand) Execute(ctx context.Context, pl Payload) {
 		c.updateCarAskPlate(ctx, pl, safeGetInt64(args, 1))
 	case cmdCarUpdPrice:
 		c.updateCarAskPrice(ctx, pl, safeGetInt64(args, 1))
+	case cmdCarUpdResale:
+		c.updateCarAskResale(ctx, pl, safeGetInt64(args, 1))
+	case cmdCarUpdDistance:
+		c.updateCarToggleDistance(ctx, pl, safeGetInt64(args, 1))
+	case cmdCarUpdVolume:
+		c.updateCarToggleVolume(ctx, pl, safeGetInt64(args, 1))
 	case cmdCarDelAsk:
 		c.deleteCarAsk(ctx, pl, safeGetInt64(args, 1))
 	case cmdCarDelYes:
 		c.deleteCarConfirm(ctx, pl, safeGetInt64(args, 1))
+	case cmdCarStats:
+		c.showCarStats(ctx, pl, safeGetInt64(args, 1), safeGet(args, 2), safeGetInt64(args, 3))
+	case cmdCarTCO:
+		c.showCarTCO(ctx, pl, safeGetInt64(args, 1))
+	case cmdCarChart:
+		c.showCarChart(ctx, pl, safeGetInt64(args, 1), safeGet(args, 2))
+	case cmdCarAudit:
+		c.showCarAudit(ctx, pl, safeGetInt64(args, 1))
+	case cmdCarExport:
+		c.exportCarRecords(ctx, pl, safeGetInt64(args, 1), safeGet(args, 2))
+	case cmdCarImport:
+		c.importCarRecordsStart(ctx, pl, safeGetInt64(args, 1))
+	case cmdCarFuel:
+		if len(args) > 2 {
+			c.addFuelQuick(ctx, pl, safeGetInt64(args, 1), args[2:])
+		} else {
+			c.addFuelStart(ctx, pl, safeGetInt64(args, 1))
+		}
 	case cmdCarFuelAdd:
 		c.addFuelStart(ctx, pl, safeGetInt64(args, 1))
 	case cmdCarFuelGet:
 		c.showFuelDetails(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarFuelUpd:
+		c.showFuelUpdate(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarFuelUpdTimestamp:
+		c.updateFuelAskTimestamp(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarFuelUpdType:
+		c.updateFuelAskType(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarFuelUpdLiters:
+		c.updateFuelAskLiters(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarFuelUpdKilometers:
+		c.updateFuelAskKilometers(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarFuelUpdFullTank:
+		c.updateFuelAskFullTank(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarFuelUpdEuros:
+		c.updateFuelAskEuros(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarFuelUpdPhoto:
+		c.updateFuelAskPhoto(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarFuelPhoto:
+		c.showFuelPhoto(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
 	case cmdCarFuelDelAsk:
 		c.deleteFuelAsk(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
 	case cmdCarFuelDelYes:
@@ -96,6 +263,18 @@ func (c *CarCommand) Execute(ctx context.Context, pl Payload) {
 		c.addServiceStart(ctx, pl, safeGetInt64(args, 1))
 	case cmdCarServiceGet:
 		c.showServiceDetails(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarServiceUpd:
+		c.showServiceUpdate(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarServiceUpdTimestamp:
+		c.updateServiceAskTimestamp(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarServiceUpdDescription:
+		c.updateServiceAskDescription(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarServiceUpdEuros:
+		c.updateServiceAskEuros(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarServiceUpdPhoto:
+		c.updateServiceAskPhoto(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarServicePhoto:
+		c.showServicePhoto(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
 	case cmdCarServiceDelAsk:
 		c.deleteServiceAsk(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
 	case cmdCarServiceDelYes:
@@ -104,28 +283,188 @@ func (c *CarCommand) Execute(ctx context.Context, pl Payload) {
 		c.addLeaseStart(ctx, pl, safeGetInt64(args, 1))
 	case cmdCarLeaseGet:
 		c.showLeaseDetails(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarLeaseUpd:
+		c.showLeaseUpdate(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarLeaseUpdTimestamp:
+		c.updateLeaseAskTimestamp(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarLeaseUpdDescription:
+		c.updateLeaseAskDescription(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarLeaseUpdEuros:
+		c.updateLeaseAskEuros(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarLeaseUpdPhoto:
+		c.updateLeaseAskPhoto(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarLeasePhoto:
+		c.showLeasePhoto(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
 	case cmdCarLeaseDelAsk:
 		c.deleteLeaseAsk(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
 	case cmdCarLeaseDelYes:
 		c.deleteLeaseConfirm(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarMaint:
+		c.showMaintenanceList(ctx, pl, safeGetInt64(args, 1))
+	case cmdCarMaintGet:
+		c.showMaintenanceDetails(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarMaintAdd:
+		c.addMaintenanceStart(ctx, pl, safeGetInt64(args, 1), safeGet(args, 2))
+	case cmdCarMaintDone:
+		c.doneMaintenance(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarMaintSnooze:
+		c.snoozeMaintenance(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarMaintDelAsk:
+		c.deleteMaintenanceAsk(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarMaintDelYes:
+		c.deleteMaintenanceConfirm(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarMaintRemind:
+		c.remindMaintenance(ctx, pl)
+	case cmdCarCurrency:
+		if currency := safeGet(args, 1); currency != "" {
+			c.setCarCurrency(ctx, pl, currency)
+		} else {
+			c.showCarCurrency(ctx, pl)
+		}
+	case cmdCarCurrencyAsk:
+		c.setCarCurrencyAsk(ctx, pl)
+	case cmdCarRates:
+		c.showExchangeRates(ctx, pl)
+	case cmdCarRatesSet:
+		c.setExchangeRatesAsk(ctx, pl, args[1:])
+	case cmdCarAccess:
+		c.showCarAccess(ctx, pl, safeGetInt64(args, 1))
+	case cmdCarAccessAdd:
+		c.addCarAccessStart(ctx, pl, safeGetInt64(args, 1), safeGet(args, 2))
+	case cmdCarAccessDel:
+		c.deleteCarAccess(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case cmdCarDrivers:
+		c.showCarDrivers(ctx, pl, safeGetInt64(args, 1))
 	default:
 		c.showCarList(ctx, pl)
 	}
 }
 
+func (c *CarCommand) Resume(ctx context.Context, pl Payload) {
+	args := splitCommand(pl.State, c.Prefix())
+	switch safeGet(args, 0) {
+	case stepCarAddName:
+		resumeDraft(ctx, pl, c.addCarName)
+	case stepCarAddYear:
+		resumeDraft(ctx, pl, c.addCarYear)
+	case stepCarAddPlate:
+		resumeDraft(ctx, pl, c.addCarPlate)
+	case stepCarAddPrice:
+		resumeDraft(ctx, pl, c.addCarPriceAndSave)
+	case stepCarUpdName:
+		resumeDraft(ctx, pl, c.updateCarSaveName)
+	case stepCarUpdYear:
+		resumeDraft(ctx, pl, c.updateCarSaveYear)
+	case stepCarUpdPlate:
+		resumeDraft(ctx, pl, c.updateCarSavePlate)
+	case stepCarUpdPrice:
+		resumeDraft(ctx, pl, c.updateCarSavePrice)
+	case stepCarUpdResale:
+		resumeDraft(ctx, pl, c.updateCarSaveResale)
+	case stepCarFuelTimestamp:
+		resumeDraft(ctx, pl, withReceiptPhoto(fuelPhoto, c.addFuelTimestamp))
+	case stepCarFuelType:
+		resumeDraft(ctx, pl, withReceiptPhoto(fuelPhoto, c.addFuelType))
+	case stepCarFuelLiters:
+		resumeDraft(ctx, pl, withReceiptPhoto(fuelPhoto, c.addFuelLiters))
+	case stepCarFuelFullTank:
+		resumeDraft(ctx, pl, withReceiptPhoto(fuelPhoto, c.addFuelFullTank))
+	case stepCarFuelKilometers:
+		resumeDraft(ctx, pl, withReceiptPhoto(fuelPhoto, c.addFuelKilometers))
+	case stepCarFuelEuros:
+		resumeDraft(ctx, pl, withReceiptPhoto(fuelPhoto, c.addFuelEurosAndSave))
+	case stepCarFuelConfirm:
+		resumeDraft(ctx, pl, c.saveFuelConfirm)
+	case stepCarFuelQuick:
+		resumeDraft(ctx, pl, c.addFuelQuickConfirm)
+	case stepCarFuelUpdTimestamp:
+		resumeDraft(ctx, pl, c.updateFuelSaveTimestamp)
+	case stepCarFuelUpdType:
+		resumeDraft(ctx, pl, c.updateFuelSaveType)
+	case stepCarFuelUpdLiters:
+		resumeDraft(ctx, pl, c.updateFuelSaveLiters)
+	case stepCarFuelUpdKilometers:
+		resumeDraft(ctx, pl, c.updateFuelSaveKilometers)
+	case stepCarFuelUpdFullTank:
+		resumeDraft(ctx, pl, c.updateFuelSaveFullTank)
+	case stepCarFuelUpdEuros:
+		resumeDraft(ctx, pl, c.updateFuelSaveEuros)
+	case stepCarFuelUpdPhoto:
+		resumeDraft(ctx, pl, c.updateFuelSavePhoto)
+	case stepCarServiceTimestamp:
+		resumeDraft(ctx, pl, withReceiptPhoto(servicePhoto, c.addServiceTimestamp))
+	case stepCarServiceDescription:
+		resumeDraft(ctx, pl, withReceiptPhoto(servicePhoto, c.addServiceDescription))
+	case stepCarServiceEuros:
+		resumeDraft(ctx, pl, withReceiptPhoto(servicePhoto, c.addServiceEurosAndSave))
+	case stepCarServiceUpdTimestamp:
+		resumeDraft(ctx, pl, c.updateServiceSaveTimestamp)
+	case stepCarServiceUpdDescription:
+		resumeDraft(ctx, pl, c.updateServiceSaveDescription)
+	case stepCarServiceUpdEuros:
+		resumeDraft(ctx, pl, c.updateServiceSaveEuros)
+	case stepCarServiceUpdPhoto:
+		resumeDraft(ctx, pl, c.updateServiceSavePhoto)
+	case stepCarLeaseTimestamp:
+		resumeDraft(ctx, pl, withReceiptPhoto(leasePhoto, c.addLeaseTimestamp))
+	case stepCarLeaseDescription:
+		resumeDraft(ctx, pl, withReceiptPhoto(leasePhoto, c.addLeaseDescription))
+	case stepCarLeaseEuros:
+		resumeDraft(ctx, pl, withReceiptPhoto(leasePhoto, c.addLeaseEurosAndSave))
+	case stepCarLeaseUpdTimestamp:
+		resumeDraft(ctx, pl, c.updateLeaseSaveTimestamp)
+	case stepCarLeaseUpdDescription:
+		resumeDraft(ctx, pl, c.updateLeaseSaveDescription)
+	case stepCarLeaseUpdEuros:
+		resumeDraft(ctx, pl, c.updateLeaseSaveEuros)
+	case stepCarLeaseUpdPhoto:
+		resumeDraft(ctx, pl, c.updateLeaseSavePhoto)
+	case stepCarImportFile:
+		resumeDraft(ctx, pl, c.importCarRecordsFile)
+	case stepCarImportConfirm:
+		resumeDraft(ctx, pl, c.importCarRecordsConfirm)
+	case stepCarMaintDescription:
+		resumeDraft(ctx, pl, c.addMaintenanceDescription)
+	case stepCarMaintKilometers:
+		resumeDraft(ctx, pl, c.addMaintenanceKilometers)
+	case stepCarMaintMonths:
+		resumeDraft(ctx, pl, c.addMaintenanceMonths)
+	case stepCarMaintLastTimestamp:
+		resumeDraft(ctx, pl, c.addMaintenanceLastTimestamp)
+	case stepCarMaintLastKilometers:
+		resumeDraft(ctx, pl, c.addMaintenanceLastKilometersAndSave)
+	case stepCarMaintServiceEuros:
+		resumeDraft(ctx, pl, c.doneMaintenanceServiceEuros)
+	case stepCarCurrency:
+		c.setCarCurrency(ctx, pl, pl.Command)
+	case stepCarRates:
+		c.setExchangeRatesInput(ctx, pl)
+	case stepCarAccessUser:
+		c.addCarAccessUser(ctx, pl, safeGetInt64(args, 1), safeGet(args, 2))
+	}
+}
+
 func (c *CarCommand) formatCarDetails(car st.CarDetails) string {
 	str := fmt.Sprintf("🚘 <b>Car:</b> %s (%d)\n", _es(car.Name), car.Year)
 	if car.Price.Valid {
-		str += fmt.Sprintf("💲 <b>Price:</b> %d€\n", car.Price.Int64)
+		str += fmt.Sprintf("💲 <b>Price:</b> %s\n", c.formatPrice(car.Price.Int64, car.Currency))
 	} else {
 		str += fmt.Sprintf("💲 <b>Price:</b> 🚫\n")
 	}
-	str += fmt.Sprintf("📍 <b>Mileage:</b> %dKm\n", car.Kilometers)
+	if car.Resale.Valid {
+		str += fmt.Sprintf("💱 <b>Resale:</b> %s\n", c.formatPrice(car.Resale.Int64, car.Currency))
+	}
+	str += fmt.Sprintf("📍 <b>Mileage:</b> %s\n", c.formatDistance(car.DistanceUnit, car.Kilometers))
 	if car.Plate.Valid {
 		str += fmt.Sprintf("🧾 <b>Licence Plate:</b> %s\n", _es(car.Plate.String))
 	} else {
 		str += fmt.Sprintf("🧾 <b>Licence Plate:</b> 🚫\n")
 	}
+	if !car.IsOwner() {
+		str += fmt.Sprintf("👥 <b>Access:</b> %s, shared with you\n", c.formatCarRole(car.Role))
+	} else if car.Shares > 0 {
+		str += fmt.Sprintf("👥 <b>Shared:</b> with %d contacts\n", car.Shares)
+	}
 	return str
 }
 
@@ -141,8 +480,21 @@ func (c *CarCommand) showCarDetails(ctx context.Context, pl Payload, carID int64
 		res.InlineMarkup.AddKeyboardButton("Fuel", commandf(c, cmdCarFuelGet, carID))
 		res.InlineMarkup.AddKeyboardButton("Service", commandf(c, cmdCarServiceGet, carID))
 		res.InlineMarkup.AddKeyboardButton("Lease", commandf(c, cmdCarLeaseGet, carID))
+		res.InlineMarkup.AddKeyboardButton("Maintenance", commandf(c, cmdCarMaint, carID))
+		res.InlineMarkup.AddKeyboardRow()
+		res.InlineMarkup.AddKeyboardButton("Stats", commandf(c, cmdCarStats, carID, carStatsMonth, 0))
+		res.InlineMarkup.AddKeyboardButton("TCO", commandf(c, cmdCarTCO, carID))
+		res.InlineMarkup.AddKeyboardButton("Audit", commandf(c, cmdCarAudit, carID))
+		if car.IsOwner() {
+			res.InlineMarkup.AddKeyboardButton("Edit Car", commandf(c, cmdCarUpd, carID))
+		}
 		res.InlineMarkup.AddKeyboardRow()
-		res.InlineMarkup.AddKeyboardButton("Edit Car", commandf(c, cmdCarUpd, carID))
+		res.InlineMarkup.AddKeyboardButton("Export CSV", commandf(c, cmdCarExport, carID, carExportCSV))
+		res.InlineMarkup.AddKeyboardButton("Export XLSX", commandf(c, cmdCarExport, carID, carExportXLSX))
+		if car.CanEdit() {
+			res.InlineMarkup.AddKeyboardButton("Import", commandf(c, cmdCarImport, carID))
+		}
+		res.InlineMarkup.AddKeyboardButton("Sharing", commandf(c, cmdCarAccess, carID))
 		res.InlineMarkup.AddKeyboardRow()
 	}
 	res.InlineMarkup.AddKeyboardButton("« Back to my cars", c.Prefix())
@@ -158,96 +510,97 @@ func (c *CarCommand) showCarList(ctx context.Context, pl Payload) {
 
 	res := Result{Text: "Choose your car from the list below:"}
 	for i, v := range cars {
-		res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("%s (%d)", v.Name, v.Year), commandf(c, cmdCarGet, v.ID))
+		label := fmt.Sprintf("%s (%d)", v.Name, v.Year)
+		if !v.IsOwner() {
+			label += " 👥" // shared with the user
+		}
+		res.InlineMarkup.AddKeyboardButton(label, commandf(c, cmdCarGet, v.ID))
 		if (i+1)%2 == 0 {
 			res.InlineMarkup.AddKeyboardRow()
 		}
 	}
 	res.InlineMarkup.AddKeyboardRow()
 	res.InlineMarkup.AddKeyboardButton("« New Car »", commandf(c, cmdCarAdd, nil))
+	res.InlineMarkup.AddKeyboardRow()
+	res.InlineMarkup.AddKeyboardButton("Currency & Rates", commandf(c, cmdCarCurrency))
 	pl.ResultChan <- res
 }
 
-func (c *CarCommand) fetchDraftCarFromDB(ctx context.Context, userID int64, carID int64) error {
-	car, err := c.storage.GetCarFromDB(ctx, userID, carID)
-	if err == nil {
-		c.draftCars[userID] = &car.CarBase
-	}
-	return err
-}
-
-func (c *CarCommand) insertDraftCarIntoDB(ctx context.Context, userID int64) (int64, error) {
-	return c.storage.InsertCarIntoDB(ctx, *c.draftCars[userID])
-}
-
-func (c *CarCommand) updateDraftCarInDB(ctx context.Context, userID int64) (int64, error) {
-	return c.storage.UpdateCarInDB(ctx, *c.draftCars[userID])
+func (c *CarCommand) newDraftCar(userID int64) *st.CarBase {
+	return &st.CarBase{UserID: userID}
 }
 
-func (c *CarCommand) newDraftCar(userID int64) {
-	c.draftCars[userID] = &st.CarBase{UserID: userID}
+func (c *CarCommand) setDraftCarName(car *st.CarBase, input string) {
+	car.Name = input
 }
 
-func (c *CarCommand) setDraftCarName(userID int64, input string) {
-	c.draftCars[userID].Name = input
-}
-
-func (c *CarCommand) setDraftCarYear(userID int64, input string) error {
+func (c *CarCommand) setDraftCarYear(car *st.CarBase, input string) error {
 	year, err := strconv.Atoi(input)
-	c.draftCars[userID].Year = int64(year)
+	car.Year = int64(year)
 	return err
 }
 
-func (c *CarCommand) setDraftCarPlate(userID int64, input string) {
+func (c *CarCommand) setDraftCarPlate(car *st.CarBase, input string) {
 	if input == "/skip" {
-		c.draftCars[userID].Plate.Valid = false
+		car.Plate.Valid = false
 	} else {
-		c.draftCars[userID].Plate.Valid = true
-		c.draftCars[userID].Plate.String = input
+		car.Plate.Valid = true
+		car.Plate.String = input
 	}
 }
 
-func (c *CarCommand) setDraftCarPrice(userID int64, input string) error {
+func (c *CarCommand) setDraftCarPrice(car *st.CarBase, input string) error {
 	if input == "/skip" {
-		c.draftCars[userID].Price.Valid = false
+		car.Price.Valid = false
 		return nil
 	} else {
 		price, err := strconv.Atoi(input)
-		c.draftCars[userID].Price.Int64 = int64(price)
-		c.draftCars[userID].Price.Valid = true
+		car.Price.Int64 = int64(price)
+		car.Price.Valid = true
 		return err
 	}
 }
 
+func (c *CarCommand) setDraftCarResale(car *st.CarBase, input string) error {
+	if input == "/skip" {
+		car.Resale.Valid = false
+		return nil
+	}
+	resale, err := strconv.Atoi(input)
+	car.Resale.Int64 = int64(resale)
+	car.Resale.Valid = true
+	return err
+}
+
 func (c *CarCommand) addCarStart(ctx context.Context, pl Payload) {
-	c.newDraftCar(pl.UserID)
-	pl.ResultChan <- Result{Text: "Please choose a name for your car.", State: c.addCarName}
+	car := c.newDraftCar(pl.UserID)
+	pl.ResultChan <- Result{Text: "Please choose a name for your car.", State: statef(c, stepCarAddName), Draft: car}
 }
 
-func (c *CarCommand) addCarName(ctx context.Context, pl Payload) {
-	c.setDraftCarName(pl.UserID, pl.Command)
-	pl.ResultChan <- Result{Text: "What is the model year?", State: c.addCarYear}
+func (c *CarCommand) addCarName(ctx context.Context, pl Payload, car *st.CarBase) {
+	c.setDraftCarName(car, pl.Command)
+	pl.ResultChan <- Result{Text: "What is the model year?", State: statef(c, stepCarAddYear), Draft: car}
 }
 
-func (c *CarCommand) addCarYear(ctx context.Context, pl Payload) {
-	if err := c.setDraftCarYear(pl.UserID, pl.Command); err != nil {
-		pl.ResultChan <- Result{Text: "Please enter a valid number.", State: c.addCarYear}
+func (c *CarCommand) addCarYear(ctx context.Context, pl Payload, car *st.CarBase) {
+	if err := c.setDraftCarYear(car, pl.Command); err != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid number.", State: statef(c, stepCarAddYear), Draft: car}
 	} else {
-		pl.ResultChan <- Result{Text: "What is your plate number? /skip", State: c.addCarPlate}
+		pl.ResultChan <- Result{Text: "What is your plate number? /skip", State: statef(c, stepCarAddPlate), Draft: car}
 	}
 }
 
-func (c *CarCommand) addCarPlate(ctx context.Context, pl Payload) {
-	c.setDraftCarPlate(pl.UserID, pl.Command)
-	pl.ResultChan <- Result{Text: "What is the price? /skip", State: c.addCarPriceAndSave}
+func (c *CarCommand) addCarPlate(ctx context.Context, pl Payload, car *st.CarBase) {
+	c.setDraftCarPlate(car, pl.Command)
+	pl.ResultChan <- Result{Text: "What is the price? /skip", State: statef(c, stepCarAddPrice), Draft: car}
 }
 
-func (c *CarCommand) addCarPriceAndSave(ctx context.Context, pl Payload) {
-	if err := c.setDraftCarPrice(pl.UserID, pl.Command); err != nil {
-		pl.ResultChan <- Result{Text: "Please enter a valid number.", State: c.addCarPriceAndSave}
+func (c *CarCommand) addCarPriceAndSave(ctx context.Context, pl Payload, car *st.CarBase) {
+	if err := c.setDraftCarPrice(car, pl.Command); err != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid number.", State: statef(c, stepCarAddPrice), Draft: car}
 		return
 	}
-	carID, err := c.insertDraftCarIntoDB(ctx, pl.UserID)
+	carID, err := c.storage.InsertCarIntoDB(ctx, *car)
 	if err != nil {
 		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
 		return
@@ -257,9 +610,9 @@ func (c *CarCommand) addCarPriceAndSave(ctx context.Context, pl Payload) {
 
 func (c *CarCommand) showCarUpdate(ctx context.Context, pl Payload, carID int64) {
 	res := Result{}
-	car, err := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
-	if errors.Is(err, sql.ErrNoRows) {
-		res.Text = "Car not found."
+	car, err := c.getOwnedCar(ctx, pl.UserID, carID)
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, errCarNotOwner) {
+		res.Text = c.formatCarError(err)
 	} else if err != nil {
 		res.Text, res.Error = "There is something wrong, please try again.", err
 	} else {
@@ -270,103 +623,98 @@ func (c *CarCommand) showCarUpdate(ctx context.Context, pl Payload, carID int64)
 		res.InlineMarkup.AddKeyboardButton("Set Plate", commandf(c, cmdCarUpdPlate, carID))
 		res.InlineMarkup.AddKeyboardButton("Set Price", commandf(c, cmdCarUpdPrice, carID))
 		res.InlineMarkup.AddKeyboardRow()
+		res.InlineMarkup.AddKeyboardButton("Set Resale", commandf(c, cmdCarUpdResale, carID))
 		res.InlineMarkup.AddKeyboardButton("Delete Car", commandf(c, cmdCarDelAsk, carID))
 		res.InlineMarkup.AddKeyboardRow()
+		res.InlineMarkup.AddKeyboardButton("Distance: "+c.distanceName(car.DistanceUnit), commandf(c, cmdCarUpdDistance, carID))
+		res.InlineMarkup.AddKeyboardButton("Volume: "+c.volumeName(car.VolumeUnit), commandf(c, cmdCarUpdVolume, carID))
+		res.InlineMarkup.AddKeyboardRow()
 	}
 	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("« Back to %s (%d)", car.Name, car.Year), commandf(c, cmdCarGet, carID))
 	pl.ResultChan <- res
 }
 
-func (c *CarCommand) updateCarAskName(ctx context.Context, pl Payload, carID int64) {
-	if err := c.fetchDraftCarFromDB(ctx, pl.UserID, carID); err != nil {
-		pl.ResultChan <- Result{Text: "Car not found.", Error: err}
+func (c *CarCommand) updateCarAsk(ctx context.Context, pl Payload, carID int64, text string, step string) {
+	car, err := c.getOwnedCar(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
 	} else {
-		pl.ResultChan <- Result{Text: "What is the new car name?", State: c.updateCarSaveName}
+		pl.ResultChan <- Result{Text: text, State: statef(c, step), Draft: car.CarBase}
 	}
 }
 
+func (c *CarCommand) updateCarAskName(ctx context.Context, pl Payload, carID int64) {
+	c.updateCarAsk(ctx, pl, carID, "What is the new car name?", stepCarUpdName)
+}
+
 func (c *CarCommand) updateCarAskYear(ctx context.Context, pl Payload, carID int64) {
-	if err := c.fetchDraftCarFromDB(ctx, pl.UserID, carID); err != nil {
-		pl.ResultChan <- Result{Text: "Car not found.", Error: err}
-	} else {
-		pl.ResultChan <- Result{Text: "What is the new car year?", State: c.updateCarSaveYear}
-	}
+	c.updateCarAsk(ctx, pl, carID, "What is the new car year?", stepCarUpdYear)
 }
 
 func (c *CarCommand) updateCarAskPlate(ctx context.Context, pl Payload, carID int64) {
-	if err := c.fetchDraftCarFromDB(ctx, pl.UserID, carID); err != nil {
-		pl.ResultChan <- Result{Text: "Car not found.", Error: err}
-	} else {
-		pl.ResultChan <- Result{Text: "What is the new car plate? /skip", State: c.updateCarSavePlate}
-	}
+	c.updateCarAsk(ctx, pl, carID, "What is the new car plate? /skip", stepCarUpdPlate)
 }
 
 func (c *CarCommand) updateCarAskPrice(ctx context.Context, pl Payload, carID int64) {
-	if err := c.fetchDraftCarFromDB(ctx, pl.UserID, carID); err != nil {
-		pl.ResultChan <- Result{Text: "Car not found.", Error: err}
-	} else {
-		pl.ResultChan <- Result{Text: "What is the new car price? /skip", State: c.updateCarSavePrice}
-	}
+	c.updateCarAsk(ctx, pl, carID, "What is the new car price? /skip", stepCarUpdPrice)
 }
 
-func (c *CarCommand) updateCarSaveName(ctx context.Context, pl Payload) {
-	c.setDraftCarName(pl.UserID, pl.Command)
-	if _, err := c.updateDraftCarInDB(ctx, pl.UserID); err != nil {
-		pl.ResultChan <- Result{Text: "Update failed, try again.", Error: err}
-		return
-	}
-	res := Result{Text: "Car name has been successfully updated!"}
-	car := c.draftCars[pl.UserID]
-	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("« Back to %s (%d)", car.Name, car.Year), commandf(c, cmdCarGet, car.ID))
-	pl.ResultChan <- res
+func (c *CarCommand) updateCarAskResale(ctx context.Context, pl Payload, carID int64) {
+	c.updateCarAsk(ctx, pl, carID, "What is the expected resale value? /skip to estimate it", stepCarUpdResale)
 }
 
-func (c *CarCommand) updateCarSaveYear(ctx context.Context, pl Payload) {
-	if err := c.setDraftCarYear(pl.UserID, pl.Command); err != nil {
-		pl.ResultChan <- Result{Text: "Please enter a valid number.", State: c.updateCarSaveYear}
+func (c *CarCommand) updateCarSave(ctx context.Context, pl Payload, car *st.CarBase, text string) {
+	if car.UserID != pl.UserID {
+		pl.ResultChan <- Result{Text: c.formatCarError(errCarNotOwner)}
 		return
 	}
-	if _, err := c.updateDraftCarInDB(ctx, pl.UserID); err != nil {
+	if _, err := c.storage.UpdateCarInDB(ctx, *car); err != nil {
 		pl.ResultChan <- Result{Text: "Update failed, try again.", Error: err}
 		return
 	}
-	res := Result{Text: "Car year has been successfully updated!"}
-	car := c.draftCars[pl.UserID]
+	res := Result{Text: text}
 	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("« Back to %s (%d)", car.Name, car.Year), commandf(c, cmdCarGet, car.ID))
 	pl.ResultChan <- res
 }
 
-func (c *CarCommand) updateCarSavePlate(ctx context.Context, pl Payload) {
-	c.setDraftCarPlate(pl.UserID, pl.Command)
-	if _, err := c.updateDraftCarInDB(ctx, pl.UserID); err != nil {
-		pl.ResultChan <- Result{Text: "Update failed, try again.", Error: err}
+func (c *CarCommand) updateCarSaveName(ctx context.Context, pl Payload, car *st.CarBase) {
+	c.setDraftCarName(car, pl.Command)
+	c.updateCarSave(ctx, pl, car, "Car name has been successfully updated!")
+}
+
+func (c *CarCommand) updateCarSaveYear(ctx context.Context, pl Payload, car *st.CarBase) {
+	if err := c.setDraftCarYear(car, pl.Command); err != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid number.", State: statef(c, stepCarUpdYear), Draft: car}
 		return
 	}
-	res := Result{Text: "Car plate has been successfully updated!"}
-	car := c.draftCars[pl.UserID]
-	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("« Back to %s (%d)", car.Name, car.Year), commandf(c, cmdCarGet, car.ID))
-	pl.ResultChan <- res
+	c.updateCarSave(ctx, pl, car, "Car year has been successfully updated!")
+}
+
+func (c *CarCommand) updateCarSavePlate(ctx context.Context, pl Payload, car *st.CarBase) {
+	c.setDraftCarPlate(car, pl.Command)
+	c.updateCarSave(ctx, pl, car, "Car plate has been successfully updated!")
 }
 
-func (c *CarCommand) updateCarSavePrice(ctx context.Context, pl Payload) {
-	if c.setDraftCarPrice(pl.UserID, pl.Command) != nil {
-		pl.ResultChan <- Result{Text: "Please enter a valid whole number.", State: c.updateCarSavePrice}
+func (c *CarCommand) updateCarSavePrice(ctx context.Context, pl Payload, car *st.CarBase) {
+	if c.setDraftCarPrice(car, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid whole number.", State: statef(c, stepCarUpdPrice), Draft: car}
 		return
 	}
-	if _, err := c.updateDraftCarInDB(ctx, pl.UserID); err != nil {
-		pl.ResultChan <- Result{Text: "Update failed, try again.", Error: err}
+	c.updateCarSave(ctx, pl, car, "Car price has been successfully updated!")
+}
+
+func (c *CarCommand) updateCarSaveResale(ctx context.Context, pl Payload, car *st.CarBase) {
+	if c.setDraftCarResale(car, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid whole number.", State: statef(c, stepCarUpdResale), Draft: car}
 		return
 	}
-	res := Result{Text: "Car price has been successfully updated!"}
-	car := c.draftCars[pl.UserID]
-	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("« Back to %s (%d)", car.Name, car.Year), commandf(c, cmdCarGet, car.ID))
-	pl.ResultChan <- res
+	c.updateCarSave(ctx, pl, car, "Car resale value has been successfully updated!")
 }
 
 func (c *CarCommand) deleteCarAsk(ctx context.Context, pl Payload, carID int64) {
-	car, err := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
+	car, err := c.getOwnedCar(ctx, pl.UserID, carID)
 	if err != nil {
-		pl.ResultChan <- Result{Text: "Car not found.", Error: err}
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
 		return
 	}
 	res := Result{Text: fmt.Sprintf("Are you sure you want to delete %s (%d)?", _es(car.Name), car.Year)}
@@ -390,126 +738,785 @@ func (c *CarCommand) deleteCarConfirm(ctx context.Context, pl Payload, carID int
 	pl.ResultChan <- res
 }
 
-func (c *CarCommand) formatFuelDetails(fuel st.FuelDetails) string {
-	str := fmt.Sprintf("⛽ <b>Liters:</b> %.2fL (%s)\n", fuel.GetLiters(), fuel.Type)
-	str += fmt.Sprintf("💲 <b>Paid:</b> %.2f€ (%.2fEur/L)\n", fuel.GetEuro(), fuel.GetEurPerLiter())
-	str += fmt.Sprintf("📍 <b>Traveled:</b> %dKm (%.2fL/100Km)\n", fuel.KilometersR, fuel.GetLitersPerKilometer())
-	str += fmt.Sprintf("🏭 <b>Total:</b> %dKm\n", fuel.Kilometers)
+func (c *CarCommand) formatStatsPeriod(period string) string {
+	if t, err := time.Parse("2006-01", period); err == nil {
+		return t.Format("January 2006")
+	}
+	return period
+}
+
+// formatStatsChange returns the relative change to the previous period, e.g. " (+12%)".
+func (c *CarCommand) formatStatsChange(current float64, previous float64) string {
+	if previous == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%+.0f%%)", (current-previous)/previous*100)
+}
+
+func (c *CarCommand) formatCarStats(car st.CarDetails, stats st.FuelStats, prev *st.FuelStats) string {
+	str := fmt.Sprintf("📊 <b>%s</b>\n", c.formatStatsPeriod(stats.Period))
+	str += fmt.Sprintf("⛽ <b>%s:</b> %s (%d receipts)\n", c.volumeName(car.VolumeUnit), c.formatVolume(car.VolumeUnit, stats.Milliliters), stats.Receipts)
+	str += fmt.Sprintf("💲 <b>Paid:</b> %s (%s)\n", c.formatMoney(stats.GetAmount(), car.Currency), c.formatPerVolume(car.VolumeUnit, stats.GetAmountPerLiter(), car.Currency))
+	str += fmt.Sprintf("📍 <b>Traveled:</b> %s (%s)\n", c.formatDistance(car.DistanceUnit, stats.Kilometers), c.formatConsumption(car.CarBase, stats.GetLitersPerKilometer()))
+	str += fmt.Sprintf("🛣️ <b>Cost:</b> %s\n", c.formatPerDistance(car.DistanceUnit, stats.GetAmountPerKilometer(), car.Currency))
+	if stats.Best.Valid {
+		str += fmt.Sprintf("👍 <b>Best:</b> %s (%s)\n", c.formatConsumption(car.CarBase, stats.Best.Float64), time.Unix(stats.BestTimestamp, 0).UTC().Format("02 Jan 2006"))
+		str += fmt.Sprintf("👎 <b>Worst:</b> %s (%s)\n", c.formatConsumption(car.CarBase, stats.Worst.Float64), time.Unix(stats.WorstTimestamp, 0).UTC().Format("02 Jan 2006"))
+	}
+	if prev != nil {
+		str += fmt.Sprintf("\n<b>Compared to %s:</b>\n", c.formatStatsPeriod(prev.Period))
+		str += fmt.Sprintf("⛽ %s%s\n", c.formatVolume(car.VolumeUnit, prev.Milliliters), c.formatStatsChange(stats.GetLiters(), prev.GetLiters()))
+		str += fmt.Sprintf("💲 %s%s\n", c.formatMoney(prev.GetAmount(), car.Currency), c.formatStatsChange(stats.GetAmount(), prev.GetAmount()))
+		str += fmt.Sprintf("📍 %s%s\n", c.formatDistance(car.DistanceUnit, prev.Kilometers), c.formatStatsChange(float64(stats.Kilometers), float64(prev.Kilometers)))
+		consumption, prevConsumption := c.toConsumption(car.CarBase, stats.GetLitersPerKilometer()), c.toConsumption(car.CarBase, prev.GetLitersPerKilometer())
+		str += fmt.Sprintf("🔥 %s%s\n", c.formatConsumption(car.CarBase, prev.GetLitersPerKilometer()), c.formatStatsChange(consumption, prevConsumption))
+	}
+	return str
+}
+
+func (c *CarCommand) showCarStats(ctx context.Context, pl Payload, carID int64, period string, offset int64) {
+	format := st.FuelStatsMonthly
+	if period == carStatsYear {
+		format = st.FuelStatsYearly
+	} else {
+		period = carStatsMonth
+	}
+
+	res := Result{}
+	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
+	stats, err := c.storage.SelectFuelStatsFromDB(ctx, pl.UserID, carID, format, offset)
+	if err != nil {
+		res.Text, res.Error = "There is something wrong, please try again.", err
+	} else if len(stats) == 0 {
+		res.Text = "No fuel receipts found."
+	} else {
+		var prev *st.FuelStats
+		if len(stats) > 1 {
+			prev = &stats[1]
+		}
+		res.Text = c.formatCarStats(car, stats[0], prev)
+		res.InlineMarkup.AddKeyboardPagination(offset, stats[0].CountRows, commandf(c, cmdCarStats, carID, period))
+		res.InlineMarkup.AddKeyboardRow()
+	}
+	res.InlineMarkup.AddKeyboardButton("📈 Consumption", commandf(c, cmdCarChart, carID, carChartConsumption))
+	res.InlineMarkup.AddKeyboardButton("📊 Spend", commandf(c, cmdCarChart, carID, carChartSpend))
+	if car.Shares > 0 {
+		res.InlineMarkup.AddKeyboardButton("👥 Drivers", commandf(c, cmdCarDrivers, carID))
+	}
+	res.InlineMarkup.AddKeyboardRow()
+	if period == carStatsMonth {
+		res.InlineMarkup.AddKeyboardButton("• Monthly •", "-")
+		res.InlineMarkup.AddKeyboardButton("Yearly", commandf(c, cmdCarStats, carID, carStatsYear, 0))
+	} else {
+		res.InlineMarkup.AddKeyboardButton("Monthly", commandf(c, cmdCarStats, carID, carStatsMonth, 0))
+		res.InlineMarkup.AddKeyboardButton("• Yearly •", "-")
+	}
+	res.InlineMarkup.AddKeyboardRow()
+	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("« Back to %s (%d)", car.Name, car.Year), commandf(c, cmdCarGet, carID))
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) renderConsumptionChart(car st.CarDetails, fuels []st.FuelDetails) ([]byte, error) {
+	series := chart.Series{Name: c.consumptionSymbol(car.CarBase)}
+	labels := []string{}
+	// partial fills and the first full tank have no consumption of their own
+	for _, fuel := range fuels {
+		if fuel.KilometersC <= 0 {
+			continue
+		}
+		labels = append(labels, time.Unix(fuel.Timestamp, 0).UTC().Format("02.01.06"))
+		series.Values = append(series.Values, c.toConsumption(car.CarBase, fuel.GetLitersPerKilometer()))
+	}
+	return chart.Chart{
+		Title:  fmt.Sprintf("%s (%d) fuel consumption, %s", car.Name, car.Year, c.consumptionSymbol(car.CarBase)),
+		Labels: labels,
+		Series: []chart.Series{series},
+	}.Line()
+}
+
+func (c *CarCommand) renderSpendChart(car st.CarDetails, spend []st.CarSpend) ([]byte, error) {
+	fuel := chart.Series{Name: "Fuel"}
+	service := chart.Series{Name: "Service"}
+	lease := chart.Series{Name: "Lease"}
+	labels := []string{}
+	for _, v := range spend {
+		label := v.Period
+		if t, err := time.Parse("2006-01", v.Period); err == nil {
+			label = t.Format("Jan 06")
+		}
+		labels = append(labels, label)
+		fuel.Values = append(fuel.Values, float64(v.FuelCents)/100)
+		service.Values = append(service.Values, float64(v.ServiceCents)/100)
+		lease.Values = append(lease.Values, float64(v.LeaseCents)/100)
+	}
+	return chart.Chart{
+		Title:  fmt.Sprintf("%s (%d) monthly spend, %s", car.Name, car.Year, car.Currency),
+		Labels: labels,
+		Series: []chart.Series{fuel, service, lease},
+	}.Bars()
+}
+
+func (c *CarCommand) showCarChart(ctx context.Context, pl Payload, carID int64, kind string) {
+	car, err := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
+	if errors.Is(err, sql.ErrNoRows) {
+		pl.ResultChan <- Result{Text: "Car not found."}
+		return
+	} else if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	res := Result{}
+	switch kind {
+	case carChartSpend:
+		spend, err := c.storage.SelectCarSpendByMonthFromDB(ctx, pl.UserID, carID, carChartMonths)
+		if err != nil {
+			res.Text, res.Error = "There is something wrong, please try again.", err
+		} else if len(spend) == 0 {
+			res.Text = "No receipts found."
+		} else if res.Image, err = c.renderSpendChart(car, spend); err != nil {
+			res.Text, res.Error = "There is something wrong, please try again.", err
+		} else {
+			res.Text = fmt.Sprintf("📊 Monthly spend of %s (%d)", _es(car.Name), car.Year)
+		}
+	default:
+		fuels, err := c.storage.SelectFuelsFromDB(ctx, pl.UserID, carID)
+		if err != nil {
+			res.Text, res.Error = "There is something wrong, please try again.", err
+		} else if len(fuels) < 2 {
+			res.Text = "Not enough fuel receipts, at least two are needed."
+		} else if res.Image, err = c.renderConsumptionChart(car, fuels); err != nil {
+			res.Text, res.Error = "There is something wrong, please try again.", err
+		} else {
+			res.Text = fmt.Sprintf("📈 Fuel consumption of %s (%d)", _es(car.Name), car.Year)
+		}
+	}
+	pl.ResultChan <- res
+}
+
+// carDepreciationRate is the yearly loss of value used to estimate the resale price.
+const carDepreciationRate = 0.15
+
+// ownershipMonths counts the started months since the first receipt, at least one.
+func (c *CarCommand) ownershipMonths(first time.Time, now time.Time) int {
+	months := (now.Year()-first.Year())*12 + int(now.Month()-first.Month())
+	if now.Day() >= first.Day() {
+		months++
+	}
+	return max(months, 1)
+}
+
+// estimateResale depreciates the price by carDepreciationRate for every year of ownership.
+func (c *CarCommand) estimateResale(price int64, months int) int64 {
+	return int64(math.Round(float64(price) * math.Pow(1-carDepreciationRate, float64(months)/12)))
+}
+
+func (c *CarCommand) formatCarTCO(car st.CarDetails, costs st.CarCosts, now time.Time) string {
+	months := 0
+	if costs.FirstTimestamp > 0 {
+		months = c.ownershipMonths(time.Unix(costs.FirstTimestamp, 0).UTC(), now)
+	}
+
+	total := costs.GetAmount()
+	str := fmt.Sprintf("🚘 <b>Car:</b> %s (%d)\n", _es(car.Name), car.Year)
+	str += fmt.Sprintf("⛽ <b>Fuel:</b> %s\n", c.formatMoney(costs.GetFuelAmount(), car.Currency))
+	str += fmt.Sprintf("🛠️ <b>Service:</b> %s\n", c.formatMoney(costs.GetServiceAmount(), car.Currency))
+	str += fmt.Sprintf("🧾 <b>Lease:</b> %s\n", c.formatMoney(costs.GetLeaseAmount(), car.Currency))
+	if car.Price.Valid {
+		resale, source := car.Resale.Int64, "entered"
+		if !car.Resale.Valid {
+			resale, source = c.estimateResale(car.Price.Int64, months), "estimated"
+		}
+		depreciation := float64(car.Price.Int64 - resale)
+		total += depreciation
+		str += fmt.Sprintf("📉 <b>Depreciation:</b> %s (%s resale, %s)\n", c.formatMoney(depreciation, car.Currency), c.formatPrice(resale, car.Currency), source)
+	} else {
+		str += fmt.Sprintf("📉 <b>Depreciation:</b> 🚫\n")
+	}
+	str += fmt.Sprintf("💰 <b>Total:</b> %s\n", c.formatMoney(total, car.Currency))
+	if distance := c.toDistance(car.DistanceUnit, car.Kilometers); distance > 0 {
+		perDistance := c.formatMoney(total/float64(distance), car.Currency)
+		str += fmt.Sprintf("📍 <b>Per %s:</b> %s (%s)\n", c.distanceSymbol(car.DistanceUnit), perDistance, c.formatDistance(car.DistanceUnit, car.Kilometers))
+	}
+	if months > 0 {
+		str += fmt.Sprintf("📅 <b>Per Month:</b> %s (%d months)\n", c.formatMoney(total/float64(months), car.Currency), months)
+	}
+	return str
+}
+
+func (c *CarCommand) showCarTCO(ctx context.Context, pl Payload, carID int64) {
+	res := Result{}
+	car, err := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
+	if errors.Is(err, sql.ErrNoRows) {
+		pl.ResultChan <- Result{Text: "Car not found."}
+		return
+	} else if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	costs, err := c.storage.GetCarCostsFromDB(ctx, pl.UserID, carID)
+	if err != nil {
+		res.Text, res.Error = "There is something wrong, please try again.", err
+	} else {
+		res.Text = c.formatCarTCO(car, costs, time.Now().UTC())
+		if car.IsOwner() {
+			res.InlineMarkup.AddKeyboardButton("Set Resale", commandf(c, cmdCarUpdResale, carID))
+			res.InlineMarkup.AddKeyboardRow()
+		}
+	}
+	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("« Back to %s (%d)", car.Name, car.Year), commandf(c, cmdCarGet, carID))
+	pl.ResultChan <- res
+}
+
+// auditFuels lists the receipts with the unusual values, which have not been confirmed or came from the older versions.
+func (c *CarCommand) auditFuels(car st.CarDetails, fuels []st.FuelDetails, rates map[string]float64) ([]st.FuelDetails, []string) {
+	suspicious, issues := []st.FuelDetails{}, []string{}
+	for i, fuel := range fuels {
+		warnings := []string{}
+		if warning := c.checkFuelPrice(car, fuel.FuelBase, rates); warning != "" {
+			warnings = append(warnings, warning)
+		}
+		if i > 0 {
+			if warning := c.checkFuelDistance(car, fuel.FuelBase, fuels[i-1].FuelBase); warning != "" {
+				warnings = append(warnings, warning)
+			}
+		}
+		if len(warnings) > 0 {
+			suspicious = append(suspicious, fuel)
+			issues = append(issues, strings.Join(warnings, ", "))
+		}
+	}
+	return suspicious, issues
+}
+
+func (c *CarCommand) showCarAudit(ctx context.Context, pl Payload, carID int64) {
+	car, err := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "Car not found.", Error: err}
+		return
+	}
+	fuels, err := c.storage.SelectFuelsFromDB(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	rates, err := c.selectExchangeRates(ctx)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	res := Result{Text: fmt.Sprintf("🔎 <b>Audit:</b> %s (%d)\n\n", _es(car.Name), car.Year)}
+	suspicious, issues := c.auditFuels(car, fuels, rates)
+	if len(suspicious) == 0 {
+		res.Text += "No suspicious fuel receipts found."
+	} else {
+		res.Text += fmt.Sprintf("Found %d suspicious fuel receipts:\n", len(suspicious))
+	}
+	for i, fuel := range suspicious[:min(len(suspicious), carAuditLimit)] {
+		date := time.Unix(fuel.Timestamp, 0).UTC().Format("02.01.06")
+		res.Text += fmt.Sprintf("\n📅 <b>%s:</b> %s", date, issues[i])
+		if !car.CanEdit() {
+			continue
+		}
+		res.InlineMarkup.AddKeyboardButton("Edit "+date, commandf(c, cmdCarFuelUpd, carID, fuel.ID))
+		if (i+1)%2 == 0 {
+			res.InlineMarkup.AddKeyboardRow()
+		}
+	}
+	if len(suspicious) > carAuditLimit {
+		res.Text += fmt.Sprintf("\n\n...and %d more", len(suspicious)-carAuditLimit)
+	}
+	res.InlineMarkup.AddKeyboardRow()
+	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("« Back to %s (%d)", car.Name, car.Year), commandf(c, cmdCarGet, carID))
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) formatFuelDetails(car st.CarDetails, fuel st.FuelDetails) string {
+	traveled := c.formatDistance(car.DistanceUnit, fuel.KilometersR)
+	str := fmt.Sprintf("⛽ <b>%s:</b> %s (%s)\n", c.volumeName(car.VolumeUnit), c.formatVolume(car.VolumeUnit, fuel.Milliliters), fuel.Type)
+	str += fmt.Sprintf("💲 <b>Paid:</b> %s (%s)", c.formatMoney(fuel.GetAmount(), fuel.Currency), c.formatPerVolume(car.VolumeUnit, fuel.GetAmountPerLiter(), fuel.Currency))
+	if fuel.Currency != car.Currency {
+		str += fmt.Sprintf(" ≈ %s", c.formatMoney(float64(fuel.BaseCents)/100, car.Currency))
+	}
+	str += "\n"
+	if !fuel.FullTank {
+		str += fmt.Sprintf("📍 <b>Traveled:</b> %s (partial fill)\n", traveled)
+	} else if fuel.KilometersC > 0 && fuel.KilometersC != fuel.KilometersR {
+		consumption := c.formatConsumption(car.CarBase, fuel.GetLitersPerKilometer())
+		str += fmt.Sprintf("📍 <b>Traveled:</b> %s (%s over %s)\n", traveled, consumption, c.formatDistance(car.DistanceUnit, fuel.KilometersC))
+	} else if fuel.KilometersC > 0 {
+		str += fmt.Sprintf("📍 <b>Traveled:</b> %s (%s)\n", traveled, c.formatConsumption(car.CarBase, fuel.GetLitersPerKilometer()))
+	} else {
+		str += fmt.Sprintf("📍 <b>Traveled:</b> %s\n", traveled)
+	}
+	str += fmt.Sprintf("🏭 <b>Total:</b> %s\n", c.formatDistance(car.DistanceUnit, fuel.Kilometers))
+	if car.Shares > 0 {
+		str += fmt.Sprintf("👤 %s\n", _es(c.formatUserName(fuel.UserID, fuel.UserName)))
+	}
 	str += fmt.Sprintf("📅 %s\n", fuel.GetTimestamp())
 	return str
 }
 
 func (c *CarCommand) showFuelDetails(ctx context.Context, pl Payload, carID int64, offset int64) {
 	res := Result{}
+	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
 	fuel, err := c.storage.GetFuelFromDB(ctx, pl.UserID, carID, offset)
 	if errors.Is(err, sql.ErrNoRows) {
 		res.Text = "No fuel receipts found."
 	} else if err != nil {
 		res.Text, res.Error = "There is something wrong, please try again.", err
 	} else {
-		res.Text = c.formatFuelDetails(fuel)
+		res.Text = c.formatFuelDetails(car, fuel)
 		res.InlineMarkup.AddKeyboardPagination(offset, fuel.CountRows, commandf(c, cmdCarFuelGet, carID))
 		res.InlineMarkup.AddKeyboardRow()
-		res.InlineMarkup.AddKeyboardButton("Delete", commandf(c, cmdCarFuelDelAsk, carID, fuel.ID))
+		if fuel.Photo.Valid {
+			res.InlineMarkup.AddKeyboardButton("View Receipt", commandf(c, cmdCarFuelPhoto, carID, fuel.ID))
+		}
+		if car.CanEdit() {
+			res.InlineMarkup.AddKeyboardButton("Edit", commandf(c, cmdCarFuelUpd, carID, fuel.ID))
+			res.InlineMarkup.AddKeyboardButton("Delete", commandf(c, cmdCarFuelDelAsk, carID, fuel.ID))
+		}
+	}
+	if car.CanEdit() {
+		res.InlineMarkup.AddKeyboardButton("Add", commandf(c, cmdCarFuelAdd, carID))
+		res.InlineMarkup.AddKeyboardRow()
 	}
-	res.InlineMarkup.AddKeyboardButton("Add", commandf(c, cmdCarFuelAdd, carID))
-	res.InlineMarkup.AddKeyboardRow()
-	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
 	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("« Back to %s (%d)", car.Name, car.Year), commandf(c, cmdCarGet, carID))
 	pl.ResultChan <- res
 }
 
-func (c *CarCommand) insertDraftFuelIntoDB(ctx context.Context, userID int64) (int64, error) {
-	return c.storage.InsertFuelIntoDB(ctx, *c.draftFuel[userID])
-}
-
-func (c *CarCommand) newDraftFuel(userID int64, carID int64) {
-	c.draftFuel[userID] = &st.FuelBase{CarID: carID}
+func (c *CarCommand) newDraftFuel(userID int64, carID int64, currency string) *st.FuelBase {
+	return &st.FuelBase{CarID: carID, UserID: userID, Currency: currency, FullTank: true}
 }
 
-func (c *CarCommand) setDraftFuelTimestamp(userID int64, input string) error {
+func (c *CarCommand) setDraftFuelTimestamp(fuel *st.FuelBase, input string) error {
 	timestamp, err := strconv.Atoi(input)
-	c.draftFuel[userID].Timestamp = int64(timestamp)
+	fuel.Timestamp = int64(timestamp)
 	return err
 }
 
-func (c *CarCommand) setDraftFuelType(userID int64, input string) {
-	c.draftFuel[userID].Type = input
+func (c *CarCommand) setDraftFuelType(fuel *st.FuelBase, input string) {
+	fuel.Type = input
 }
 
-func (c *CarCommand) setDraftFuelLiters(userID int64, input string) error {
-	liters, err := strconv.ParseFloat(input, 64)
-	c.draftFuel[userID].Milliliters = int64(math.Round(liters * 1000))
+func (c *CarCommand) setDraftFuelLiters(car st.CarBase, fuel *st.FuelBase, input string) error {
+	milliliters, err := c.parseVolume(car.VolumeUnit, input)
+	fuel.Milliliters = milliliters
 	return err
 }
 
-func (c *CarCommand) setDraftFuelKilometers(userID int64, input string) error {
-	kilometers, err := strconv.Atoi(input)
-	c.draftFuel[userID].Kilometers = int64(kilometers)
+func (c *CarCommand) setDraftFuelFullTank(fuel *st.FuelBase, input string) error {
+	switch strings.ToLower(input) {
+	case "yes", "y", "1", "true":
+		fuel.FullTank = true
+	case "no", "n", "0", "false":
+		fuel.FullTank = false
+	default:
+		return errors.New("expected yes or no")
+	}
+	return nil
+}
+
+func (c *CarCommand) setDraftFuelKilometers(car st.CarBase, fuel *st.FuelBase, input string) error {
+	kilometers, err := c.parseDistance(car.DistanceUnit, input)
+	fuel.Kilometers = kilometers
 	return err
 }
 
-func (c *CarCommand) setDraftFuelEuros(userID int64, input string) error {
-	euro, err := strconv.ParseFloat(input, 64)
-	c.draftFuel[userID].Cents = int64(math.Round(euro * 100))
+// setDraftFuelEuros keeps the currency of the receipt unless the input has another one.
+func (c *CarCommand) setDraftFuelEuros(fuel *st.FuelBase, input string) error {
+	cents, currency, err := c.parseMoney(input, fuel.Currency)
+	fuel.Cents, fuel.Currency = cents, currency
 	return err
 }
 
+// checkFuelPrice warns about the unusual price per liter, usually a typo in the volume or the amount.
+// The price is compared in EUR, the receipts in the currencies without an exchange rate are not checked.
+func (c *CarCommand) checkFuelPrice(car st.CarDetails, fuel st.FuelBase, rates map[string]float64) string {
+	rate, ok := rates[fuel.Currency]
+	if fuel.Milliliters <= 0 || !ok {
+		return ""
+	}
+	if price := fuel.GetAmountPerLiter() / rate; price < carMinFuelPrice || price > carMaxFuelPrice {
+		return fmt.Sprintf("%s price is unusual", c.formatPerVolume(car.VolumeUnit, fuel.GetAmountPerLiter(), fuel.Currency))
+	}
+	return ""
+}
+
+// checkFuelDistance warns about the unusual consumption since the previous receipt, usually a typo in the mileage.
+func (c *CarCommand) checkFuelDistance(car st.CarDetails, fuel st.FuelBase, prev st.FuelBase) string {
+	distance := fuel.Kilometers - prev.Kilometers
+	if distance < 0 {
+		return fmt.Sprintf("odometer goes back by %s", c.formatDistance(car.DistanceUnit, -distance))
+	}
+	if distance == 0 {
+		return "no distance since the previous receipt"
+	}
+	// the consumption is only known between two full tanks
+	if !fuel.FullTank || !prev.FullTank {
+		return ""
+	}
+	if consumption := fuel.GetLiters() / float64(distance) * 100; consumption < carMinConsumption || consumption > carMaxConsumption {
+		return fmt.Sprintf("%s consumption is unusual", c.formatConsumption(car.CarBase, consumption))
+	}
+	return ""
+}
+
+// checkFuel validates the receipt against the neighbouring ones by timestamp.
+// The odometer going backwards is an error, the unusual values are returned as warnings.
+func (c *CarCommand) checkFuel(car st.CarDetails, fuel st.FuelBase, neighbours st.FuelNeighbours, rates map[string]float64) ([]string, error) {
+	if prev := neighbours.Prev; prev != nil && fuel.Kilometers < prev.Kilometers {
+		return nil, fmt.Errorf("the previous receipt on %s has %s", prev.GetTimestamp(), c.formatDistance(car.DistanceUnit, prev.Kilometers))
+	}
+	if next := neighbours.Next; next != nil && fuel.Kilometers > next.Kilometers {
+		return nil, fmt.Errorf("the next receipt on %s has %s", next.GetTimestamp(), c.formatDistance(car.DistanceUnit, next.Kilometers))
+	}
+
+	warnings := []string{}
+	if warning := c.checkFuelPrice(car, fuel, rates); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	if neighbours.Prev != nil {
+		if warning := c.checkFuelDistance(car, fuel, *neighbours.Prev); warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+	// the mileage of this receipt is also the start of the next one
+	if neighbours.Next != nil {
+		if warning := c.checkFuelDistance(car, *neighbours.Next, fuel); warning != "" {
+			warnings = append(warnings, warning+" for the next receipt")
+		}
+	}
+	return warnings, nil
+}
+
+// confirmFuel validates the new or the edited receipt, and asks to confirm the unusual values.
+// It returns true if the receipt can be saved right away.
+func (c *CarCommand) confirmFuel(ctx context.Context, pl Payload, fuel *st.FuelBase) bool {
+	car, err := c.storage.GetCarFromDB(ctx, pl.UserID, fuel.CarID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "Car not found.", Error: err}
+		return false
+	}
+	neighbours, err := c.storage.GetFuelNeighboursFromDB(ctx, pl.UserID, fuel.CarID, fuel.Timestamp, fuel.ID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return false
+	}
+	rates, err := c.selectExchangeRates(ctx)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return false
+	}
+
+	warnings, err := c.checkFuel(car, *fuel, neighbours, rates)
+	if err != nil {
+		res := Result{Text: fmt.Sprintf("The odometer can not go backwards, %s. Nothing has been saved.", err), ClearState: true}
+		c.addFuelBackButton(&res, fuel)
+		pl.ResultChan <- res
+		return false
+	}
+	if len(warnings) == 0 {
+		return true
+	}
+
+	text := "⚠️ Please double check the receipt:\n"
+	for _, warning := range warnings {
+		text += "\n• " + warning
+	}
+	res := Result{Text: text, State: statef(c, stepCarFuelConfirm), Draft: fuel}
+	res.InlineMarkup.AddKeyboardButton("Save anyway", carFuelSaveYes)
+	res.InlineMarkup.AddKeyboardButton("Cancel", carFuelSaveNo)
+	pl.ResultChan <- res
+	return false
+}
+
+func (c *CarCommand) saveFuelConfirm(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	switch pl.Command {
+	case carFuelSaveYes:
+		if fuel.ID != 0 {
+			c.updateFuelStore(ctx, pl, fuel)
+			return
+		}
+		res := Result{Text: "Receipt has been successfully saved!", ClearState: true}
+		if _, err := c.storage.InsertFuelIntoDB(ctx, *fuel); err != nil {
+			res.Text, res.Error = "There is something wrong, please try again.", err
+		}
+		c.addFuelBackButton(&res, fuel)
+		pl.ResultChan <- res
+	case carFuelSaveNo:
+		res := Result{Text: "Receipt has not been saved.", ClearState: true}
+		c.addFuelBackButton(&res, fuel)
+		pl.ResultChan <- res
+	default:
+		pl.ResultChan <- Result{Text: "Please confirm the receipt with the buttons above.", State: statef(c, stepCarFuelConfirm), Draft: fuel}
+	}
+}
+
+func (c *CarCommand) addFuelBackButton(res *Result, fuel *st.FuelBase) {
+	if fuel.ID != 0 {
+		res.InlineMarkup.AddKeyboardButton("« Back to the receipt", commandf(c, cmdCarFuelUpd, fuel.CarID, fuel.ID))
+	} else {
+		res.InlineMarkup.AddKeyboardButton("« Back to my receipts", commandf(c, cmdCarFuelGet, fuel.CarID))
+	}
+}
+
 func (c *CarCommand) addFuelStart(ctx context.Context, pl Payload, carID int64) {
-	c.newDraftFuel(pl.UserID, carID)
-	res := Result{Text: "Please pick a receipt date.", State: c.addFuelTimestamp}
+	car, err := c.getEditableCar(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+	fuel := c.newDraftFuel(pl.UserID, car.ID, car.Currency)
+	text := "Please pick a receipt date, or send the whole receipt in one line, e.g. " + carQuickFuelExample + "\n\n" + carReceiptPhotoHint
+	res := Result{Text: text, State: statef(c, stepCarFuelTimestamp), Draft: fuel}
 	res.InlineMarkup.AddKeyboardCalendar(time.Now().Year(), time.Now().Month())
 	pl.ResultChan <- res
 }
 
-func (c *CarCommand) addFuelTimestamp(ctx context.Context, pl Payload) {
+func (c *CarCommand) addFuelTimestamp(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	// the calendar sends one or two tokens, the one line receipt has at least the volume, the amount and the mileage
+	if args := strings.Fields(pl.Command); len(args) > 2 {
+		c.addFuelQuick(ctx, pl, fuel.CarID, args)
+		return
+	}
 	res := Result{}
 	if res.InlineMarkup.UpdateKeyboardCalendar(pl.Command) {
 		pl.ResultChan <- res // new month is selected
 		return
 	}
-	if c.setDraftFuelTimestamp(pl.UserID, pl.Command) != nil {
-		pl.ResultChan <- Result{Text: "Please pick a date from the calendar.", State: c.addFuelTimestamp}
+	if c.setDraftFuelTimestamp(fuel, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please pick a date from the calendar.", State: statef(c, stepCarFuelTimestamp), Draft: fuel}
 		return
 	}
-	res.Text = "Date: " + c.draftFuel[pl.UserID].GetTimestamp()
+	res.Text = "Date: " + fuel.GetTimestamp()
 	res.InlineMarkup.AddKeyboardRow() // remove calendar keyboard
 	pl.ResultChan <- res
-	res = Result{Text: "What is the fuel type?", State: c.addFuelType}
+	res = Result{Text: "What is the fuel type?", State: statef(c, stepCarFuelType), Draft: fuel}
 	pl.ResultChan <- res
 }
 
-func (c *CarCommand) addFuelType(ctx context.Context, pl Payload) {
-	c.setDraftFuelType(pl.UserID, pl.Command)
-	pl.ResultChan <- Result{Text: "What is the fuel amount in Liters?", State: c.addFuelLiters}
+func (c *CarCommand) addFuelType(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	c.setDraftFuelType(fuel, pl.Command)
+	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, fuel.CarID)
+	text := fmt.Sprintf("What is the fuel amount in %s?", c.volumeName(car.VolumeUnit))
+	pl.ResultChan <- Result{Text: text, State: statef(c, stepCarFuelLiters), Draft: fuel}
+}
+
+func (c *CarCommand) askFuelFullTank(text string, step string, fuel *st.FuelBase) Result {
+	res := Result{Text: text, State: statef(c, step), Draft: fuel}
+	res.ReplyMarkup.AddButton(carFuelFullTankYes)
+	res.ReplyMarkup.AddButton(carFuelFullTankNo)
+	res.ReplyMarkup.OneTimeKeyboard = true
+	res.ReplyMarkup.ResizeKeyboard = true
+	return res
 }
 
-func (c *CarCommand) addFuelLiters(ctx context.Context, pl Payload) {
-	if err := c.setDraftFuelLiters(pl.UserID, pl.Command); err != nil {
-		pl.ResultChan <- Result{Text: "Please enter a valid decimal number.", State: c.addFuelLiters}
+func (c *CarCommand) addFuelLiters(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, fuel.CarID)
+	if err := c.setDraftFuelLiters(car.CarBase, fuel, pl.Command); err != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid decimal number.", State: statef(c, stepCarFuelLiters), Draft: fuel}
 	} else {
-		pl.ResultChan <- Result{Text: "What is your total mileage now in Kilometers?", State: c.addFuelKilometers}
+		pl.ResultChan <- c.askFuelFullTank("Did you fill the tank up?", stepCarFuelFullTank, fuel)
 	}
 }
 
-func (c *CarCommand) addFuelKilometers(ctx context.Context, pl Payload) {
-	if err := c.setDraftFuelKilometers(pl.UserID, pl.Command); err != nil {
-		pl.ResultChan <- Result{Text: "Please enter a valid whole number.", State: c.addFuelKilometers}
-	} else {
-		pl.ResultChan <- Result{Text: "How much money did you spend in Euros?", State: c.addFuelEurosAndSave}
+func (c *CarCommand) addFuelFullTank(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	if err := c.setDraftFuelFullTank(fuel, pl.Command); err != nil {
+		pl.ResultChan <- c.askFuelFullTank("Please answer Yes or No.", stepCarFuelFullTank, fuel)
+		return
 	}
+	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, fuel.CarID)
+	text := fmt.Sprintf("What is your total mileage now in %s?", c.distanceName(car.DistanceUnit))
+	res := Result{Text: text, State: statef(c, stepCarFuelKilometers), Draft: fuel}
+	res.RemoveMarkup.RemoveDefault()
+	pl.ResultChan <- res
 }
 
-func (c *CarCommand) addFuelEurosAndSave(ctx context.Context, pl Payload) {
-	if err := c.setDraftFuelEuros(pl.UserID, pl.Command); err != nil {
-		pl.ResultChan <- Result{Text: "Please enter a valid decimal number.", State: c.addFuelEurosAndSave}
+func (c *CarCommand) addFuelKilometers(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, fuel.CarID)
+	if err := c.setDraftFuelKilometers(car.CarBase, fuel, pl.Command); err != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid whole number.", State: statef(c, stepCarFuelKilometers), Draft: fuel}
 		return
 	}
-	if _, err := c.insertDraftFuelIntoDB(ctx, pl.UserID); err != nil {
+	neighbours, err := c.storage.GetFuelNeighboursFromDB(ctx, pl.UserID, fuel.CarID, fuel.Timestamp, fuel.ID)
+	if err != nil {
 		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
 		return
 	}
-	c.showFuelDetails(ctx, pl, c.draftFuel[pl.UserID].CarID, 0)
+	if _, err := c.checkFuel(car, *fuel, neighbours, nil); err != nil {
+		text := fmt.Sprintf("The odometer can not go backwards, %s. Please enter a valid mileage.", err)
+		pl.ResultChan <- Result{Text: text, State: statef(c, stepCarFuelKilometers), Draft: fuel}
+		return
+	}
+	text := fmt.Sprintf("How much money did you spend in %s?", fuel.Currency)
+	pl.ResultChan <- Result{Text: text, State: statef(c, stepCarFuelEuros), Draft: fuel}
+}
+
+func (c *CarCommand) addFuelEurosAndSave(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	if err := c.setDraftFuelEuros(fuel, pl.Command); err != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid decimal number.", State: statef(c, stepCarFuelEuros), Draft: fuel}
+		return
+	}
+	if !c.confirmFuel(ctx, pl, fuel) {
+		return
+	}
+	if _, err := c.storage.InsertFuelIntoDB(ctx, *fuel); err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	c.showFuelDetails(ctx, pl, fuel.CarID, 0)
+}
+
+func (c *CarCommand) showFuelUpdate(ctx context.Context, pl Payload, carID int64, fuelID int64) {
+	res := Result{}
+	car, err := c.getEditableCar(ctx, pl.UserID, carID)
+	if err != nil {
+		res.Text, res.Error = c.formatCarError(err), err
+		res.InlineMarkup.AddKeyboardButton("« Back to my receipts", commandf(c, cmdCarFuelGet, carID))
+		pl.ResultChan <- res
+		return
+	}
+	fuel, err := c.storage.GetFuelByIDFromDB(ctx, pl.UserID, carID, fuelID)
+	if errors.Is(err, sql.ErrNoRows) {
+		res.Text = "Receipt not found."
+	} else if err != nil {
+		res.Text, res.Error = "There is something wrong, please try again.", err
+	} else {
+		res.Text = c.formatFuelDetails(car, fuel)
+		res.InlineMarkup.AddKeyboardButton("Set Date", commandf(c, cmdCarFuelUpdTimestamp, carID, fuelID))
+		res.InlineMarkup.AddKeyboardButton("Set Type", commandf(c, cmdCarFuelUpdType, carID, fuelID))
+		res.InlineMarkup.AddKeyboardRow()
+		res.InlineMarkup.AddKeyboardButton("Set "+c.volumeName(car.VolumeUnit), commandf(c, cmdCarFuelUpdLiters, carID, fuelID))
+		res.InlineMarkup.AddKeyboardButton("Set Odometer", commandf(c, cmdCarFuelUpdKilometers, carID, fuelID))
+		res.InlineMarkup.AddKeyboardButton("Set Amount", commandf(c, cmdCarFuelUpdEuros, carID, fuelID))
+		res.InlineMarkup.AddKeyboardRow()
+		res.InlineMarkup.AddKeyboardButton("Set Full Tank", commandf(c, cmdCarFuelUpdFullTank, carID, fuelID))
+		res.InlineMarkup.AddKeyboardButton("Set Photo", commandf(c, cmdCarFuelUpdPhoto, carID, fuelID))
+		res.InlineMarkup.AddKeyboardRow()
+	}
+	res.InlineMarkup.AddKeyboardButton("« Back to my receipts", commandf(c, cmdCarFuelGet, carID))
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) updateFuelAsk(ctx context.Context, pl Payload, carID int64, fuelID int64, text string, step string) {
+	if _, err := c.getEditableCar(ctx, pl.UserID, carID); err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+	fuel, err := c.storage.GetFuelByIDFromDB(ctx, pl.UserID, carID, fuelID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "Receipt not found.", Error: err}
+		return
+	}
+	res := Result{Text: text, State: statef(c, step), Draft: fuel.FuelBase}
+	if step == stepCarFuelUpdTimestamp {
+		dt := time.Unix(fuel.Timestamp, 0).UTC()
+		res.InlineMarkup.AddKeyboardCalendar(dt.Year(), dt.Month())
+	} else if step == stepCarFuelUpdFullTank {
+		res = c.askFuelFullTank(text, step, &fuel.FuelBase)
+	}
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) updateFuelAskTimestamp(ctx context.Context, pl Payload, carID int64, fuelID int64) {
+	c.updateFuelAsk(ctx, pl, carID, fuelID, "Please pick a new receipt date.", stepCarFuelUpdTimestamp)
+}
+
+func (c *CarCommand) updateFuelAskType(ctx context.Context, pl Payload, carID int64, fuelID int64) {
+	c.updateFuelAsk(ctx, pl, carID, fuelID, "What is the new fuel type?", stepCarFuelUpdType)
+}
+
+func (c *CarCommand) updateFuelAskLiters(ctx context.Context, pl Payload, carID int64, fuelID int64) {
+	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
+	text := fmt.Sprintf("What is the new fuel amount in %s?", c.volumeName(car.VolumeUnit))
+	c.updateFuelAsk(ctx, pl, carID, fuelID, text, stepCarFuelUpdLiters)
+}
+
+func (c *CarCommand) updateFuelAskKilometers(ctx context.Context, pl Payload, carID int64, fuelID int64) {
+	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
+	text := fmt.Sprintf("What is the new total mileage in %s?", c.distanceName(car.DistanceUnit))
+	c.updateFuelAsk(ctx, pl, carID, fuelID, text, stepCarFuelUpdKilometers)
+}
+
+func (c *CarCommand) updateFuelAskFullTank(ctx context.Context, pl Payload, carID int64, fuelID int64) {
+	c.updateFuelAsk(ctx, pl, carID, fuelID, "Did you fill the tank up?", stepCarFuelUpdFullTank)
+}
+
+func (c *CarCommand) updateFuelAskEuros(ctx context.Context, pl Payload, carID int64, fuelID int64) {
+	fuel, _ := c.storage.GetFuelByIDFromDB(ctx, pl.UserID, carID, fuelID)
+	text := fmt.Sprintf("How much money did you spend in %s?", fuel.Currency)
+	c.updateFuelAsk(ctx, pl, carID, fuelID, text, stepCarFuelUpdEuros)
+}
+
+func (c *CarCommand) updateFuelSave(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	if c.confirmFuel(ctx, pl, fuel) {
+		c.updateFuelStore(ctx, pl, fuel)
+	}
+}
+
+func (c *CarCommand) updateFuelStore(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	affected, err := c.storage.UpdateFuelInDB(ctx, pl.UserID, *fuel)
+	if err != nil || affected != 1 {
+		pl.ResultChan <- Result{Text: "Update failed, try again.", Error: err}
+		return
+	}
+	res := Result{Text: "Receipt has been successfully updated!", ClearState: true}
+	res.InlineMarkup.AddKeyboardButton("« Back to the receipt", commandf(c, cmdCarFuelUpd, fuel.CarID, fuel.ID))
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) updateFuelSaveTimestamp(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	res := Result{}
+	if res.InlineMarkup.UpdateKeyboardCalendar(pl.Command) {
+		pl.ResultChan <- res // new month is selected
+		return
+	}
+	if c.setDraftFuelTimestamp(fuel, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please pick a date from the calendar.", State: statef(c, stepCarFuelUpdTimestamp), Draft: fuel}
+		return
+	}
+	c.updateFuelSave(ctx, pl, fuel)
+}
+
+func (c *CarCommand) updateFuelSaveType(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	c.setDraftFuelType(fuel, pl.Command)
+	c.updateFuelSave(ctx, pl, fuel)
+}
+
+func (c *CarCommand) updateFuelSaveLiters(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, fuel.CarID)
+	if c.setDraftFuelLiters(car.CarBase, fuel, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid decimal number.", State: statef(c, stepCarFuelUpdLiters), Draft: fuel}
+		return
+	}
+	c.updateFuelSave(ctx, pl, fuel)
+}
+
+func (c *CarCommand) updateFuelSaveKilometers(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, fuel.CarID)
+	if c.setDraftFuelKilometers(car.CarBase, fuel, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid whole number.", State: statef(c, stepCarFuelUpdKilometers), Draft: fuel}
+		return
+	}
+	c.updateFuelSave(ctx, pl, fuel)
+}
+
+func (c *CarCommand) updateFuelSaveFullTank(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	if c.setDraftFuelFullTank(fuel, pl.Command) != nil {
+		pl.ResultChan <- c.askFuelFullTank("Please answer Yes or No.", stepCarFuelUpdFullTank, fuel)
+		return
+	}
+	c.updateFuelSave(ctx, pl, fuel)
+}
+
+func (c *CarCommand) updateFuelSaveEuros(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	if c.setDraftFuelEuros(fuel, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid decimal number.", State: statef(c, stepCarFuelUpdEuros), Draft: fuel}
+		return
+	}
+	c.updateFuelSave(ctx, pl, fuel)
 }
 
 func (c *CarCommand) deleteFuelAsk(ctx context.Context, pl Payload, carID int64, fuelID int64) {
@@ -534,96 +1541,210 @@ func (c *CarCommand) deleteFuelConfirm(ctx context.Context, pl Payload, carID in
 	pl.ResultChan <- res
 }
 
-func (c *CarCommand) formatServiceDetails(service st.ServiceDetails) string {
+func (c *CarCommand) formatServiceDetails(car st.CarDetails, service st.ServiceDetails) string {
 	str := fmt.Sprintf("🛠️ %s\n", _es(service.Description))
-	str += fmt.Sprintf("💲 <b>Paid:</b> %.2f€\n", service.GetEuro())
+	str += fmt.Sprintf("💲 <b>Paid:</b> %s", c.formatMoney(service.GetAmount(), service.Currency))
+	if service.Currency != car.Currency {
+		str += fmt.Sprintf(" ≈ %s", c.formatMoney(float64(service.BaseCents)/100, car.Currency))
+	}
+	str += "\n"
+	if car.Shares > 0 {
+		str += fmt.Sprintf("👤 %s\n", _es(c.formatUserName(service.UserID, service.UserName)))
+	}
 	str += fmt.Sprintf("📅 %s\n", service.GetTimestamp())
 	return str
 }
 
 func (c *CarCommand) showServiceDetails(ctx context.Context, pl Payload, carID int64, offset int64) {
 	res := Result{}
+	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
 	service, err := c.storage.GetServiceFromDB(ctx, pl.UserID, carID, offset)
 	if errors.Is(err, sql.ErrNoRows) {
 		res.Text = "No service receipts found."
 	} else if err != nil {
 		res.Text, res.Error = "There is something wrong, please try again.", err
 	} else {
-		res.Text = c.formatServiceDetails(service)
+		res.Text = c.formatServiceDetails(car, service)
 		res.InlineMarkup.AddKeyboardPagination(offset, service.CountRows, commandf(c, cmdCarServiceGet, carID))
 		res.InlineMarkup.AddKeyboardRow()
-		res.InlineMarkup.AddKeyboardButton("Delete", commandf(c, cmdCarServiceDelAsk, carID, service.ID))
+		if service.Photo.Valid {
+			res.InlineMarkup.AddKeyboardButton("View Receipt", commandf(c, cmdCarServicePhoto, carID, service.ID))
+		}
+		if car.CanEdit() {
+			res.InlineMarkup.AddKeyboardButton("Edit", commandf(c, cmdCarServiceUpd, carID, service.ID))
+			res.InlineMarkup.AddKeyboardButton("Delete", commandf(c, cmdCarServiceDelAsk, carID, service.ID))
+		}
+	}
+	if car.CanEdit() {
+		res.InlineMarkup.AddKeyboardButton("Add", commandf(c, cmdCarServiceAdd, carID))
+		res.InlineMarkup.AddKeyboardRow()
 	}
-	res.InlineMarkup.AddKeyboardButton("Add", commandf(c, cmdCarServiceAdd, carID))
-	res.InlineMarkup.AddKeyboardRow()
-	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
 	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("« Back to %s (%d)", car.Name, car.Year), commandf(c, cmdCarGet, carID))
 	pl.ResultChan <- res
 }
 
-func (c *CarCommand) insertDraftServiceIntoDB(ctx context.Context, userID int64) (int64, error) {
-	return c.storage.InsertServiceIntoDB(ctx, *c.draftService[userID])
-}
-
-func (c *CarCommand) newDraftService(userID int64, carID int64) {
-	c.draftService[userID] = &st.ServiceBase{CarID: carID}
+func (c *CarCommand) newDraftService(userID int64, carID int64, currency string) *st.ServiceBase {
+	return &st.ServiceBase{CarID: carID, UserID: userID, Currency: currency}
 }
 
-func (c *CarCommand) setDraftServiceTimestamp(userID int64, input string) error {
+func (c *CarCommand) setDraftServiceTimestamp(service *st.ServiceBase, input string) error {
 	timestamp, err := strconv.Atoi(input)
-	c.draftService[userID].Timestamp = int64(timestamp)
+	service.Timestamp = int64(timestamp)
 	return err
 }
 
-func (c *CarCommand) setDraftServiceDescription(userID int64, input string) {
-	c.draftService[userID].Description = input
+func (c *CarCommand) setDraftServiceDescription(service *st.ServiceBase, input string) {
+	service.Description = input
 }
 
-func (c *CarCommand) setDraftServiceEuros(userID int64, input string) error {
-	euro, err := strconv.ParseFloat(input, 64)
-	c.draftService[userID].Cents = int64(math.Round(euro * 100))
+// setDraftServiceEuros keeps the currency of the receipt unless the input has another one.
+func (c *CarCommand) setDraftServiceEuros(service *st.ServiceBase, input string) error {
+	cents, currency, err := c.parseMoney(input, service.Currency)
+	service.Cents, service.Currency = cents, currency
 	return err
 }
 
 func (c *CarCommand) addServiceStart(ctx context.Context, pl Payload, carID int64) {
-	c.newDraftService(pl.UserID, carID)
-	res := Result{Text: "Please pick a receipt date.", State: c.addServiceTimestamp}
+	car, err := c.getEditableCar(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+	service := c.newDraftService(pl.UserID, car.ID, car.Currency)
+	res := Result{Text: "Please pick a receipt date.\n\n" + carReceiptPhotoHint, State: statef(c, stepCarServiceTimestamp), Draft: service}
 	res.InlineMarkup.AddKeyboardCalendar(time.Now().Year(), time.Now().Month())
 	pl.ResultChan <- res
 }
 
-func (c *CarCommand) addServiceTimestamp(ctx context.Context, pl Payload) {
+func (c *CarCommand) addServiceTimestamp(ctx context.Context, pl Payload, service *st.ServiceBase) {
 	res := Result{}
 	if res.InlineMarkup.UpdateKeyboardCalendar(pl.Command) {
 		pl.ResultChan <- res // new month is selected
 		return
 	}
-	if c.setDraftServiceTimestamp(pl.UserID, pl.Command) != nil {
-		pl.ResultChan <- Result{Text: "Please pick a date from the calendar.", State: c.addServiceTimestamp}
+	if c.setDraftServiceTimestamp(service, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please pick a date from the calendar.", State: statef(c, stepCarServiceTimestamp), Draft: service}
 		return
 	}
-	res.Text = "Date: " + c.draftService[pl.UserID].GetTimestamp()
+	res.Text = "Date: " + service.GetTimestamp()
 	res.InlineMarkup.AddKeyboardRow() // remove calendar keyboard
 	pl.ResultChan <- res
-	res = Result{Text: "Provide service description.", State: c.addServiceDescription}
+	res = Result{Text: "Provide service description.", State: statef(c, stepCarServiceDescription), Draft: service}
 	pl.ResultChan <- res
 }
 
-func (c *CarCommand) addServiceDescription(ctx context.Context, pl Payload) {
-	c.setDraftServiceDescription(pl.UserID, pl.Command)
-	pl.ResultChan <- Result{Text: "How much money did you spend in Euros?", State: c.addServiceEurosAndSave}
+func (c *CarCommand) addServiceDescription(ctx context.Context, pl Payload, service *st.ServiceBase) {
+	c.setDraftServiceDescription(service, pl.Command)
+	text := fmt.Sprintf("How much money did you spend in %s?", service.Currency)
+	pl.ResultChan <- Result{Text: text, State: statef(c, stepCarServiceEuros), Draft: service}
 }
 
-func (c *CarCommand) addServiceEurosAndSave(ctx context.Context, pl Payload) {
-	if err := c.setDraftServiceEuros(pl.UserID, pl.Command); err != nil {
-		pl.ResultChan <- Result{Text: "Please enter a valid decimal number.", State: c.addServiceEurosAndSave}
+func (c *CarCommand) addServiceEurosAndSave(ctx context.Context, pl Payload, service *st.ServiceBase) {
+	if err := c.setDraftServiceEuros(service, pl.Command); err != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid decimal number.", State: statef(c, stepCarServiceEuros), Draft: service}
 		return
 	}
-	if _, err := c.insertDraftServiceIntoDB(ctx, pl.UserID); err != nil {
+	if _, err := c.storage.InsertServiceIntoDB(ctx, *service); err != nil {
 		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
 		return
 	}
-	c.showServiceDetails(ctx, pl, c.draftService[pl.UserID].CarID, 0)
+	c.showServiceDetails(ctx, pl, service.CarID, 0)
+}
+
+func (c *CarCommand) showServiceUpdate(ctx context.Context, pl Payload, carID int64, serviceID int64) {
+	res := Result{}
+	car, err := c.getEditableCar(ctx, pl.UserID, carID)
+	if err != nil {
+		res.Text, res.Error = c.formatCarError(err), err
+		res.InlineMarkup.AddKeyboardButton("« Back to my receipts", commandf(c, cmdCarServiceGet, carID))
+		pl.ResultChan <- res
+		return
+	}
+	service, err := c.storage.GetServiceByIDFromDB(ctx, pl.UserID, carID, serviceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		res.Text = "Receipt not found."
+	} else if err != nil {
+		res.Text, res.Error = "There is something wrong, please try again.", err
+	} else {
+		res.Text = c.formatServiceDetails(car, service)
+		res.InlineMarkup.AddKeyboardButton("Set Date", commandf(c, cmdCarServiceUpdTimestamp, carID, serviceID))
+		res.InlineMarkup.AddKeyboardButton("Set Description", commandf(c, cmdCarServiceUpdDescription, carID, serviceID))
+		res.InlineMarkup.AddKeyboardButton("Set Amount", commandf(c, cmdCarServiceUpdEuros, carID, serviceID))
+		res.InlineMarkup.AddKeyboardRow()
+		res.InlineMarkup.AddKeyboardButton("Set Photo", commandf(c, cmdCarServiceUpdPhoto, carID, serviceID))
+		res.InlineMarkup.AddKeyboardRow()
+	}
+	res.InlineMarkup.AddKeyboardButton("« Back to my receipts", commandf(c, cmdCarServiceGet, carID))
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) updateServiceAsk(ctx context.Context, pl Payload, carID int64, serviceID int64, text string, step string) {
+	if _, err := c.getEditableCar(ctx, pl.UserID, carID); err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+	service, err := c.storage.GetServiceByIDFromDB(ctx, pl.UserID, carID, serviceID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "Receipt not found.", Error: err}
+		return
+	}
+	res := Result{Text: text, State: statef(c, step), Draft: service.ServiceBase}
+	if step == stepCarServiceUpdTimestamp {
+		dt := time.Unix(service.Timestamp, 0).UTC()
+		res.InlineMarkup.AddKeyboardCalendar(dt.Year(), dt.Month())
+	}
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) updateServiceAskTimestamp(ctx context.Context, pl Payload, carID int64, serviceID int64) {
+	c.updateServiceAsk(ctx, pl, carID, serviceID, "Please pick a new receipt date.", stepCarServiceUpdTimestamp)
+}
+
+func (c *CarCommand) updateServiceAskDescription(ctx context.Context, pl Payload, carID int64, serviceID int64) {
+	c.updateServiceAsk(ctx, pl, carID, serviceID, "Provide the new service description.", stepCarServiceUpdDescription)
+}
+
+func (c *CarCommand) updateServiceAskEuros(ctx context.Context, pl Payload, carID int64, serviceID int64) {
+	service, _ := c.storage.GetServiceByIDFromDB(ctx, pl.UserID, carID, serviceID)
+	text := fmt.Sprintf("How much money did you spend in %s?", service.Currency)
+	c.updateServiceAsk(ctx, pl, carID, serviceID, text, stepCarServiceUpdEuros)
+}
+
+func (c *CarCommand) updateServiceSave(ctx context.Context, pl Payload, service *st.ServiceBase) {
+	affected, err := c.storage.UpdateServiceInDB(ctx, pl.UserID, *service)
+	if err != nil || affected != 1 {
+		pl.ResultChan <- Result{Text: "Update failed, try again.", Error: err}
+		return
+	}
+	res := Result{Text: "Receipt has been successfully updated!", ClearState: true}
+	res.InlineMarkup.AddKeyboardButton("« Back to the receipt", commandf(c, cmdCarServiceUpd, service.CarID, service.ID))
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) updateServiceSaveTimestamp(ctx context.Context, pl Payload, service *st.ServiceBase) {
+	res := Result{}
+	if res.InlineMarkup.UpdateKeyboardCalendar(pl.Command) {
+		pl.ResultChan <- res // new month is selected
+		return
+	}
+	if c.setDraftServiceTimestamp(service, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please pick a date from the calendar.", State: statef(c, stepCarServiceUpdTimestamp), Draft: service}
+		return
+	}
+	c.updateServiceSave(ctx, pl, service)
+}
+
+func (c *CarCommand) updateServiceSaveDescription(ctx context.Context, pl Payload, service *st.ServiceBase) {
+	c.setDraftServiceDescription(service, pl.Command)
+	c.updateServiceSave(ctx, pl, service)
+}
+
+func (c *CarCommand) updateServiceSaveEuros(ctx context.Context, pl Payload, service *st.ServiceBase) {
+	if c.setDraftServiceEuros(service, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid decimal number.", State: statef(c, stepCarServiceUpdEuros), Draft: service}
+		return
+	}
+	c.updateServiceSave(ctx, pl, service)
 }
 
 func (c *CarCommand) deleteServiceAsk(ctx context.Context, pl Payload, carID int64, serviceID int64) {
@@ -648,103 +1769,217 @@ func (c *CarCommand) deleteServiceConfirm(ctx context.Context, pl Payload, carID
 	pl.ResultChan <- res
 }
 
-func (c *CarCommand) formatLeaseDetails(lease st.LeaseDetails) string {
-	str := fmt.Sprintf("💲 <b>Paid:</b> %.2f€ (%.2f€ RT)\n", lease.GetEuro(), lease.GetEuroRT())
+func (c *CarCommand) formatLeaseDetails(car st.CarDetails, lease st.LeaseDetails) string {
+	str := fmt.Sprintf("💲 <b>Paid:</b> %s", c.formatMoney(lease.GetAmount(), lease.Currency))
+	if lease.Currency != car.Currency {
+		str += fmt.Sprintf(" ≈ %s", c.formatMoney(float64(lease.BaseCents)/100, car.Currency))
+	}
+	str += fmt.Sprintf(" (%s RT)\n", c.formatMoney(lease.GetBaseAmountRT(), car.Currency))
 	if lease.Description.Valid {
 		str += fmt.Sprintf("🛠️ %s\n", _es(lease.Description.String))
 	}
+	if car.Shares > 0 {
+		str += fmt.Sprintf("👤 %s\n", _es(c.formatUserName(lease.UserID, lease.UserName)))
+	}
 	str += fmt.Sprintf("📅 %s\n", lease.GetTimestamp())
 	return str
 }
 
 func (c *CarCommand) showLeaseDetails(ctx context.Context, pl Payload, carID int64, offset int64) {
 	res := Result{}
+	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
 	lease, err := c.storage.GetLeaseFromDB(ctx, pl.UserID, carID, offset)
 	if errors.Is(err, sql.ErrNoRows) {
 		res.Text = "No lease receipts found."
 	} else if err != nil {
 		res.Text, res.Error = "There is something wrong, please try again.", err
 	} else {
-		res.Text = c.formatLeaseDetails(lease)
+		res.Text = c.formatLeaseDetails(car, lease)
 		res.InlineMarkup.AddKeyboardPagination(offset, lease.CountRows, commandf(c, cmdCarLeaseGet, carID))
 		res.InlineMarkup.AddKeyboardRow()
-		res.InlineMarkup.AddKeyboardButton("Delete", commandf(c, cmdCarLeaseDelAsk, carID, lease.ID))
+		if lease.Photo.Valid {
+			res.InlineMarkup.AddKeyboardButton("View Receipt", commandf(c, cmdCarLeasePhoto, carID, lease.ID))
+		}
+		if car.CanEdit() {
+			res.InlineMarkup.AddKeyboardButton("Edit", commandf(c, cmdCarLeaseUpd, carID, lease.ID))
+			res.InlineMarkup.AddKeyboardButton("Delete", commandf(c, cmdCarLeaseDelAsk, carID, lease.ID))
+		}
+	}
+	if car.CanEdit() {
+		res.InlineMarkup.AddKeyboardButton("Add", commandf(c, cmdCarLeaseAdd, carID))
+		res.InlineMarkup.AddKeyboardRow()
 	}
-	res.InlineMarkup.AddKeyboardButton("Add", commandf(c, cmdCarLeaseAdd, carID))
-	res.InlineMarkup.AddKeyboardRow()
-	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
 	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("« Back to %s (%d)", car.Name, car.Year), commandf(c, cmdCarGet, carID))
 	pl.ResultChan <- res
 }
 
-func (c *CarCommand) insertDraftLeaseIntoDB(ctx context.Context, userID int64) (int64, error) {
-	return c.storage.InsertLeaseIntoDB(ctx, *c.draftLease[userID])
-}
-
-func (c *CarCommand) newDraftLease(userID int64, carID int64) {
-	c.draftLease[userID] = &st.LeaseBase{CarID: carID}
+func (c *CarCommand) newDraftLease(userID int64, carID int64, currency string) *st.LeaseBase {
+	return &st.LeaseBase{CarID: carID, UserID: userID, Currency: currency}
 }
 
-func (c *CarCommand) setDraftLeaseTimestamp(userID int64, input string) error {
+func (c *CarCommand) setDraftLeaseTimestamp(lease *st.LeaseBase, input string) error {
 	timestamp, err := strconv.Atoi(input)
-	c.draftLease[userID].Timestamp = int64(timestamp)
+	lease.Timestamp = int64(timestamp)
 	return err
 }
 
-func (c *CarCommand) setDraftLeaseDescription(userID int64, input string) {
+func (c *CarCommand) setDraftLeaseDescription(lease *st.LeaseBase, input string) {
 	if input == "/skip" {
-		c.draftLease[userID].Description.Valid = false
+		lease.Description.Valid = false
 	} else {
-		c.draftLease[userID].Description.Valid = true
-		c.draftLease[userID].Description.String = input
+		lease.Description.Valid = true
+		lease.Description.String = input
 	}
 }
 
-func (c *CarCommand) setDraftLeaseEuros(userID int64, input string) error {
-	euro, err := strconv.ParseFloat(input, 64)
-	c.draftLease[userID].Cents = int64(math.Round(euro * 100))
+// setDraftLeaseEuros keeps the currency of the receipt unless the input has another one.
+func (c *CarCommand) setDraftLeaseEuros(lease *st.LeaseBase, input string) error {
+	cents, currency, err := c.parseMoney(input, lease.Currency)
+	lease.Cents, lease.Currency = cents, currency
 	return err
 }
 
 func (c *CarCommand) addLeaseStart(ctx context.Context, pl Payload, carID int64) {
-	c.newDraftLease(pl.UserID, carID)
-	res := Result{Text: "Please pick a receipt date.", State: c.addLeaseTimestamp}
+	car, err := c.getEditableCar(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+	lease := c.newDraftLease(pl.UserID, car.ID, car.Currency)
+	res := Result{Text: "Please pick a receipt date.\n\n" + carReceiptPhotoHint, State: statef(c, stepCarLeaseTimestamp), Draft: lease}
 	res.InlineMarkup.AddKeyboardCalendar(time.Now().Year(), time.Now().Month())
 	pl.ResultChan <- res
 }
 
-func (c *CarCommand) addLeaseTimestamp(ctx context.Context, pl Payload) {
+func (c *CarCommand) addLeaseTimestamp(ctx context.Context, pl Payload, lease *st.LeaseBase) {
 	res := Result{}
 	if res.InlineMarkup.UpdateKeyboardCalendar(pl.Command) {
 		pl.ResultChan <- res // new month is selected
 		return
 	}
-	if c.setDraftLeaseTimestamp(pl.UserID, pl.Command) != nil {
-		pl.ResultChan <- Result{Text: "Please pick a date from the calendar.", State: c.addLeaseTimestamp}
+	if c.setDraftLeaseTimestamp(lease, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please pick a date from the calendar.", State: statef(c, stepCarLeaseTimestamp), Draft: lease}
 		return
 	}
-	res.Text = "Date: " + c.draftLease[pl.UserID].GetTimestamp()
+	res.Text = "Date: " + lease.GetTimestamp()
 	res.InlineMarkup.AddKeyboardRow() // remove calendar keyboard
 	pl.ResultChan <- res
-	res = Result{Text: "Provide lease description. /skip", State: c.addLeaseDescription}
+	res = Result{Text: "Provide lease description. /skip", State: statef(c, stepCarLeaseDescription), Draft: lease}
 	pl.ResultChan <- res
 }
 
-func (c *CarCommand) addLeaseDescription(ctx context.Context, pl Payload) {
-	c.setDraftLeaseDescription(pl.UserID, pl.Command)
-	pl.ResultChan <- Result{Text: "How much money did you spend in Euros?", State: c.addLeaseEurosAndSave}
+func (c *CarCommand) addLeaseDescription(ctx context.Context, pl Payload, lease *st.LeaseBase) {
+	c.setDraftLeaseDescription(lease, pl.Command)
+	text := fmt.Sprintf("How much money did you spend in %s?", lease.Currency)
+	pl.ResultChan <- Result{Text: text, State: statef(c, stepCarLeaseEuros), Draft: lease}
 }
 
-func (c *CarCommand) addLeaseEurosAndSave(ctx context.Context, pl Payload) {
-	if err := c.setDraftLeaseEuros(pl.UserID, pl.Command); err != nil {
-		pl.ResultChan <- Result{Text: "Please enter a valid decimal number.", State: c.addLeaseEurosAndSave}
+func (c *CarCommand) addLeaseEurosAndSave(ctx context.Context, pl Payload, lease *st.LeaseBase) {
+	if err := c.setDraftLeaseEuros(lease, pl.Command); err != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid decimal number.", State: statef(c, stepCarLeaseEuros), Draft: lease}
 		return
 	}
-	if _, err := c.insertDraftLeaseIntoDB(ctx, pl.UserID); err != nil {
+	if _, err := c.storage.InsertLeaseIntoDB(ctx, *lease); err != nil {
 		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
 		return
 	}
-	c.showLeaseDetails(ctx, pl, c.draftLease[pl.UserID].CarID, 0)
+	c.showLeaseDetails(ctx, pl, lease.CarID, 0)
+}
+
+func (c *CarCommand) showLeaseUpdate(ctx context.Context, pl Payload, carID int64, leaseID int64) {
+	res := Result{}
+	car, err := c.getEditableCar(ctx, pl.UserID, carID)
+	if err != nil {
+		res.Text, res.Error = c.formatCarError(err), err
+		res.InlineMarkup.AddKeyboardButton("« Back to my receipts", commandf(c, cmdCarLeaseGet, carID))
+		pl.ResultChan <- res
+		return
+	}
+	lease, err := c.storage.GetLeaseByIDFromDB(ctx, pl.UserID, carID, leaseID)
+	if errors.Is(err, sql.ErrNoRows) {
+		res.Text = "Receipt not found."
+	} else if err != nil {
+		res.Text, res.Error = "There is something wrong, please try again.", err
+	} else {
+		res.Text = c.formatLeaseDetails(car, lease)
+		res.InlineMarkup.AddKeyboardButton("Set Date", commandf(c, cmdCarLeaseUpdTimestamp, carID, leaseID))
+		res.InlineMarkup.AddKeyboardButton("Set Description", commandf(c, cmdCarLeaseUpdDescription, carID, leaseID))
+		res.InlineMarkup.AddKeyboardButton("Set Amount", commandf(c, cmdCarLeaseUpdEuros, carID, leaseID))
+		res.InlineMarkup.AddKeyboardRow()
+		res.InlineMarkup.AddKeyboardButton("Set Photo", commandf(c, cmdCarLeaseUpdPhoto, carID, leaseID))
+		res.InlineMarkup.AddKeyboardRow()
+	}
+	res.InlineMarkup.AddKeyboardButton("« Back to my receipts", commandf(c, cmdCarLeaseGet, carID))
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) updateLeaseAsk(ctx context.Context, pl Payload, carID int64, leaseID int64, text string, step string) {
+	if _, err := c.getEditableCar(ctx, pl.UserID, carID); err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+	lease, err := c.storage.GetLeaseByIDFromDB(ctx, pl.UserID, carID, leaseID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "Receipt not found.", Error: err}
+		return
+	}
+	res := Result{Text: text, State: statef(c, step), Draft: lease.LeaseBase}
+	if step == stepCarLeaseUpdTimestamp {
+		dt := time.Unix(lease.Timestamp, 0).UTC()
+		res.InlineMarkup.AddKeyboardCalendar(dt.Year(), dt.Month())
+	}
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) updateLeaseAskTimestamp(ctx context.Context, pl Payload, carID int64, leaseID int64) {
+	c.updateLeaseAsk(ctx, pl, carID, leaseID, "Please pick a new receipt date.", stepCarLeaseUpdTimestamp)
+}
+
+func (c *CarCommand) updateLeaseAskDescription(ctx context.Context, pl Payload, carID int64, leaseID int64) {
+	c.updateLeaseAsk(ctx, pl, carID, leaseID, "Provide the new lease description. /skip", stepCarLeaseUpdDescription)
+}
+
+func (c *CarCommand) updateLeaseAskEuros(ctx context.Context, pl Payload, carID int64, leaseID int64) {
+	lease, _ := c.storage.GetLeaseByIDFromDB(ctx, pl.UserID, carID, leaseID)
+	text := fmt.Sprintf("How much money did you spend in %s?", lease.Currency)
+	c.updateLeaseAsk(ctx, pl, carID, leaseID, text, stepCarLeaseUpdEuros)
+}
+
+func (c *CarCommand) updateLeaseSave(ctx context.Context, pl Payload, lease *st.LeaseBase) {
+	affected, err := c.storage.UpdateLeaseInDB(ctx, pl.UserID, *lease)
+	if err != nil || affected != 1 {
+		pl.ResultChan <- Result{Text: "Update failed, try again.", Error: err}
+		return
+	}
+	res := Result{Text: "Receipt has been successfully updated!", ClearState: true}
+	res.InlineMarkup.AddKeyboardButton("« Back to the receipt", commandf(c, cmdCarLeaseUpd, lease.CarID, lease.ID))
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) updateLeaseSaveTimestamp(ctx context.Context, pl Payload, lease *st.LeaseBase) {
+	res := Result{}
+	if res.InlineMarkup.UpdateKeyboardCalendar(pl.Command) {
+		pl.ResultChan <- res // new month is selected
+		return
+	}
+	if c.setDraftLeaseTimestamp(lease, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please pick a date from the calendar.", State: statef(c, stepCarLeaseUpdTimestamp), Draft: lease}
+		return
+	}
+	c.updateLeaseSave(ctx, pl, lease)
+}
+
+func (c *CarCommand) updateLeaseSaveDescription(ctx context.Context, pl Payload, lease *st.LeaseBase) {
+	c.setDraftLeaseDescription(lease, pl.Command)
+	c.updateLeaseSave(ctx, pl, lease)
+}
+
+func (c *CarCommand) updateLeaseSaveEuros(ctx context.Context, pl Payload, lease *st.LeaseBase) {
+	if c.setDraftLeaseEuros(lease, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid decimal number.", State: statef(c, stepCarLeaseUpdEuros), Draft: lease}
+		return
+	}
+	c.updateLeaseSave(ctx, pl, lease)
 }
 
 func (c *CarCommand) deleteLeaseAsk(ctx context.Context, pl Payload, carID int64, leaseID int64) {
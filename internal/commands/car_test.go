@@ -1,6 +1,13 @@
 package commands
 
-import "testing"
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	st "mr-weasel/internal/storage"
+)
 
 func TestNewDraftCar(t *testing.T) {
 	t.Run("NewDraftCarName", func(t *testing.T) {
@@ -13,11 +20,11 @@ func TestNewDraftCar(t *testing.T) {
 			{UserID: 1, Input: "Lexus", Expected: "Lexus"},
 			{UserID: 2, Input: "", Expected: ""},
 		}
-		c := NewCarCommand(nil)
+		c := NewCarCommand(nil, nil)
 		for _, test := range tests {
-			c.newDraftCar(test.UserID)
-			c.setDraftCarName(test.UserID, test.Input)
-			actual := c.draftCars[test.UserID].Name
+			car := c.newDraftCar(test.UserID)
+			c.setDraftCarName(car, test.Input)
+			actual := car.Name
 			if actual != test.Expected {
 				t.Errorf("actual [%s], [%+v]\n", actual, test)
 			}
@@ -34,14 +41,14 @@ func TestNewDraftCar(t *testing.T) {
 			{UserID: 0, Input: "2023", Expected: 2023, Error: false},
 			{UserID: 1, Input: "2o23", Expected: 0, Error: true},
 		}
-		c := NewCarCommand(nil)
+		c := NewCarCommand(nil, nil)
 		for _, test := range tests {
-			c.newDraftCar(test.UserID)
-			err := c.setDraftCarYear(test.UserID, test.Input)
+			car := c.newDraftCar(test.UserID)
+			err := c.setDraftCarYear(car, test.Input)
 			if test.Error && err == nil {
 				t.Errorf("missing err [%+v]\n", test)
 			}
-			actual := c.draftCars[test.UserID].Year
+			actual := car.Year
 			if actual != test.Expected {
 				t.Errorf("actual [%d], [%+v]\n", actual, test)
 			}
@@ -59,11 +66,11 @@ func TestNewDraftCar(t *testing.T) {
 			{UserID: 1, Input: "", Expected: "", IsNull: false},
 			{UserID: 2, Input: "FZ", Expected: "FZ", IsNull: false},
 		}
-		c := NewCarCommand(nil)
+		c := NewCarCommand(nil, nil)
 		for _, test := range tests {
-			c.newDraftCar(test.UserID)
-			c.setDraftCarPlate(test.UserID, test.Input)
-			actual := c.draftCars[test.UserID].Plate
+			car := c.newDraftCar(test.UserID)
+			c.setDraftCarPlate(car, test.Input)
+			actual := car.Plate
 			if actual.Valid && test.IsNull {
 				t.Errorf("actual [%+v], [%+v]\n", actual, test)
 			}
@@ -72,4 +79,301 @@ func TestNewDraftCar(t *testing.T) {
 			}
 		}
 	})
+	t.Run("NewDraftCarResale", func(t *testing.T) {
+		tests := []struct {
+			UserID   int64
+			Input    string
+			Expected int64
+			IsNull   bool
+			Error    bool
+		}{
+			{UserID: 0, Input: "/skip", Expected: 0, IsNull: true, Error: false},
+			{UserID: 1, Input: "9500", Expected: 9500, IsNull: false, Error: false},
+			{UserID: 2, Input: "9.5k", Expected: 0, IsNull: false, Error: true},
+		}
+		c := NewCarCommand(nil, nil)
+		for _, test := range tests {
+			car := c.newDraftCar(test.UserID)
+			err := c.setDraftCarResale(car, test.Input)
+			if test.Error != (err != nil) {
+				t.Errorf("actual err [%v], [%+v]\n", err, test)
+			}
+			actual := car.Resale
+			if actual.Valid == test.IsNull || actual.Int64 != test.Expected {
+				t.Errorf("actual [%+v], [%+v]\n", actual, test)
+			}
+		}
+	})
+}
+
+func TestCarOwnership(t *testing.T) {
+	tests := []struct {
+		First    string
+		Now      string
+		Price    int64
+		Months   int
+		Expected int64
+	}{
+		{First: "2026-10-01", Now: "2026-10-18", Price: 20000, Months: 1, Expected: 19731},
+		{First: "2025-10-18", Now: "2026-10-18", Price: 20000, Months: 13, Expected: 16771},
+		{First: "2024-10-20", Now: "2026-10-18", Price: 20000, Months: 24, Expected: 14450},
+	}
+	c := NewCarCommand(nil, nil)
+	for _, test := range tests {
+		first, _ := time.Parse("2006-01-02", test.First)
+		now, _ := time.Parse("2006-01-02", test.Now)
+		months := c.ownershipMonths(first, now)
+		if months != test.Months {
+			t.Errorf("actual months [%d], [%+v]\n", months, test)
+		}
+		if actual := c.estimateResale(test.Price, months); actual != test.Expected {
+			t.Errorf("actual resale [%d], [%+v]\n", actual, test)
+		}
+	}
+}
+
+func TestParseCarRecords(t *testing.T) {
+	tests := []struct {
+		Input    string
+		Fuels    int
+		Services int
+		Leases   int
+		Errors   []string
+	}{
+		{
+			Input:    "record,date,fuel_type,liters,kilometers,euros,description\nfuel,2026-09-01,A95,35.5,1000,70.00,\nservice,2026-09-02,,,,120,Oil change\nlease,2026-09-03,,,,250,\n",
+			Fuels:    1,
+			Services: 1,
+			Leases:   1,
+		},
+		{
+			Input: "\xef\xbb\xbfrecord;date;euros;liters;kilometers;fuel_type\nfuel;2026-09-01;70,50;35,5;1000;Diesel\n",
+			Fuels: 1,
+		},
+		{
+			Input:  "record,date,fuel_type,liters,kilometers,euros,description\nfuel,01.09.2026,A95,35,1000,70,\nservice,2026-09-02,,,,120,\ntrip,2026-09-03,,,,10,\nfuel,2026-09-04,A95,-1,1000,70,\n",
+			Errors: []string{"line 2: date must be in YYYY-MM-DD format", "line 3: description is empty", "line 4: record must be one of fuel, service or lease", "line 5: liters must be a positive decimal number"},
+		},
+		{
+			Input:  "date,euros\n2026-09-01,10\n",
+			Errors: []string{"column \"record\" is missing, expected columns: record,date,fuel_type,liters,kilometers,amount,currency,description,full_tank"},
+		},
+	}
+	c := NewCarCommand(nil, nil)
+	for _, test := range tests {
+		records, errs := c.parseCarRecords(1, 1, "EUR", []byte(test.Input))
+		if strings.Join(errs, "\n") != strings.Join(test.Errors, "\n") {
+			t.Errorf("actual errors [%v], [%+v]\n", errs, test)
+			continue
+		}
+		if len(records.Fuels) != test.Fuels || len(records.Services) != test.Services || len(records.Leases) != test.Leases {
+			t.Errorf("actual [%+v], [%+v]\n", records, test)
+		}
+	}
+
+	records, _ := c.parseCarRecords(1, 1, "EUR", []byte(tests[1].Input))
+	fuel := records.Fuels[0]
+	if fuel.CarID != 1 || fuel.Type != "Diesel" || fuel.Milliliters != 35500 || fuel.Cents != 7050 || fuel.Kilometers != 1000 || fuel.Currency != "EUR" {
+		t.Errorf("actual [%+v]\n", fuel)
+	}
+}
+
+func TestCheckFuel(t *testing.T) {
+	prev := &st.FuelBase{ID: 1, Timestamp: 1, Milliliters: 40000, Kilometers: 1000, Cents: 6000, FullTank: true}
+	next := &st.FuelBase{ID: 3, Timestamp: 3, Milliliters: 40000, Kilometers: 2100, Cents: 6000, FullTank: true}
+	tests := []struct {
+		Fuel       st.FuelBase
+		Neighbours st.FuelNeighbours
+		Warnings   []string
+		Error      bool
+	}{
+		{Fuel: st.FuelBase{Currency: "EUR", Milliliters: 40000, Kilometers: 1500, Cents: 6000, FullTank: true}, Neighbours: st.FuelNeighbours{Prev: prev, Next: next}},
+		{Fuel: st.FuelBase{Currency: "EUR", Milliliters: 40000, Kilometers: 500, Cents: 6000, FullTank: true}, Neighbours: st.FuelNeighbours{}},
+		{Fuel: st.FuelBase{Currency: "EUR", Milliliters: 40000, Kilometers: 900, Cents: 6000, FullTank: true}, Neighbours: st.FuelNeighbours{Prev: prev}, Error: true},
+		{Fuel: st.FuelBase{Currency: "EUR", Milliliters: 40000, Kilometers: 2200, Cents: 6000, FullTank: true}, Neighbours: st.FuelNeighbours{Prev: prev, Next: next}, Error: true},
+		{Fuel: st.FuelBase{Currency: "EUR", Milliliters: 4000, Kilometers: 1500, Cents: 6000, FullTank: true}, Neighbours: st.FuelNeighbours{Prev: prev}, Warnings: []string{"15.00€/L price is unusual", "0.80L/100Km consumption is unusual"}},
+		{Fuel: st.FuelBase{Currency: "EUR", Milliliters: 40000, Kilometers: 1100, Cents: 6000, FullTank: true}, Neighbours: st.FuelNeighbours{Prev: prev}, Warnings: []string{"40.00L/100Km consumption is unusual"}},
+		{Fuel: st.FuelBase{Currency: "EUR", Milliliters: 40000, Kilometers: 2090, Cents: 6000, FullTank: true}, Neighbours: st.FuelNeighbours{Prev: prev, Next: next}, Warnings: []string{"400.00L/100Km consumption is unusual for the next receipt"}},
+		{Fuel: st.FuelBase{Currency: "EUR", Milliliters: 40000, Kilometers: 1000, Cents: 6000, FullTank: true}, Neighbours: st.FuelNeighbours{Prev: prev}, Warnings: []string{"no distance since the previous receipt"}},
+	}
+	car := st.CarDetails{Currency: "EUR"}
+	rates := map[string]float64{"EUR": 1, "CHF": 0.94}
+	c := NewCarCommand(nil, nil)
+	for _, test := range tests {
+		warnings, err := c.checkFuel(car, test.Fuel, test.Neighbours, rates)
+		if test.Error != (err != nil) {
+			t.Errorf("actual error [%v], [%+v]\n", err, test)
+		}
+		if strings.Join(warnings, "\n") != strings.Join(test.Warnings, "\n") {
+			t.Errorf("actual warnings [%v], [%+v]\n", warnings, test)
+		}
+	}
+}
+
+func TestCheckMaintenance(t *testing.T) {
+	last := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	oil := st.MaintenanceBase{Kilometers: sql.NullInt64{Int64: 15000, Valid: true}, Months: sql.NullInt64{Int64: 12, Valid: true}, LastKilometers: 100000, LastTimestamp: last}
+	inspection := st.MaintenanceBase{Months: sql.NullInt64{Int64: 24, Valid: true}, LastTimestamp: last}
+	tests := []struct {
+		Maintenance st.MaintenanceBase
+		Kilometers  int64
+		Now         string
+		Expected    int
+	}{
+		{Maintenance: oil, Kilometers: 105000, Now: "2026-06-01", Expected: carMaintOK},
+		{Maintenance: oil, Kilometers: 114500, Now: "2026-06-01", Expected: carMaintDue},
+		{Maintenance: oil, Kilometers: 115000, Now: "2026-06-01", Expected: carMaintOverdue},
+		{Maintenance: oil, Kilometers: 105000, Now: "2026-12-25", Expected: carMaintDue},
+		{Maintenance: oil, Kilometers: 105000, Now: "2027-01-01", Expected: carMaintOverdue},
+		{Maintenance: oil, Kilometers: 114500, Now: "2027-02-01", Expected: carMaintOverdue},
+		{Maintenance: inspection, Kilometers: 500000, Now: "2027-06-01", Expected: carMaintOK},
+		{Maintenance: inspection, Kilometers: 0, Now: "2028-01-02", Expected: carMaintOverdue},
+	}
+	c := NewCarCommand(nil, nil)
+	for _, test := range tests {
+		now, _ := time.Parse("2006-01-02", test.Now)
+		maint := st.MaintenanceDetails{MaintenanceBase: test.Maintenance, CarKilometers: test.Kilometers}
+		if actual := c.checkMaintenance(maint, now); actual != test.Expected {
+			t.Errorf("actual [%d], [%+v]\n", actual, test)
+		}
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		Input    string
+		Cents    int64
+		Currency string
+		Error    bool
+	}{
+		{Input: "45.50", Cents: 4550, Currency: "EUR"},
+		{Input: "45,5", Cents: 4550, Currency: "EUR"},
+		{Input: "45.50 chf", Cents: 4550, Currency: "CHF"},
+		{Input: "CHF 12", Cents: 1200, Currency: "CHF"},
+		{Input: "£12.01", Cents: 1201, Currency: "GBP"},
+		{Input: "12$", Cents: 1200, Currency: "USD"},
+		{Input: "CHF 12 EUR", Error: true},
+		{Input: "12 francs", Error: true},
+		{Input: "", Error: true},
+	}
+	c := NewCarCommand(nil, nil)
+	for _, test := range tests {
+		cents, currency, err := c.parseMoney(test.Input, "EUR")
+		if test.Error != (err != nil) {
+			t.Errorf("actual error [%v], [%+v]\n", err, test)
+			continue
+		}
+		if !test.Error && (cents != test.Cents || currency != test.Currency) {
+			t.Errorf("actual [%d %s], [%+v]\n", cents, currency, test)
+		}
+	}
+}
+
+func TestParseExchangeRates(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Rates  int
+		Errors []string
+	}{
+		{Input: "CHF 0.94\nusd=1.08\n\nGBP, 0.86\n", Rates: 3},
+		{Input: "currency;rate\nCHF;0,94\n", Rates: 1},
+		{Input: "CHF 0.94", Rates: 1},
+		{Input: "CHF 0.94\nEUR 1\nSEK -1\nFrancs 1\nCHF\n", Rates: 1, Errors: []string{
+			"line 2: EUR is the reference currency, its rate is always 1",
+			"line 3: rate must be a positive decimal number",
+			"line 4: currency must be a three letter code",
+			"line 5: expected a currency and a rate",
+		}},
+		{Input: "\n", Errors: []string{"no rates found"}},
+	}
+	c := NewCarCommand(nil, nil)
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		rates, errs := c.parseExchangeRates([]byte(test.Input), now)
+		if len(rates) != test.Rates || strings.Join(errs, "\n") != strings.Join(test.Errors, "\n") {
+			t.Errorf("actual [%+v] errors [%v], [%+v]\n", rates, errs, test)
+		}
+	}
+}
+
+func TestCarUnits(t *testing.T) {
+	metric := st.CarBase{}
+	imperial := st.CarBase{DistanceUnit: st.DistanceMiles, VolumeUnit: st.VolumeGallons}
+	mixed := st.CarBase{DistanceUnit: st.DistanceMiles, VolumeUnit: st.VolumeLiters}
+
+	c := NewCarCommand(nil, nil)
+	if actual := c.formatDistance(imperial.DistanceUnit, 1609); actual != "1000mi" {
+		t.Errorf("actual distance [%s]\n", actual)
+	}
+	if actual := c.formatVolume(imperial.VolumeUnit, 37854); actual != "10.00gal" {
+		t.Errorf("actual volume [%s]\n", actual)
+	}
+	if actual, _ := c.parseDistance(imperial.DistanceUnit, "1000"); actual != 1609 {
+		t.Errorf("actual kilometers [%d]\n", actual)
+	}
+	if actual, _ := c.parseVolume(imperial.VolumeUnit, "10"); actual != 37854 {
+		t.Errorf("actual milliliters [%d]\n", actual)
+	}
+	if actual, _ := c.parseVolume(metric.VolumeUnit, "35.5"); actual != 35500 {
+		t.Errorf("actual milliliters [%d]\n", actual)
+	}
+
+	tests := []struct {
+		Car      st.CarBase
+		Expected string
+	}{
+		{Car: metric, Expected: "7.84L/100Km"},
+		{Car: mixed, Expected: "7.84L/100Km"},
+		{Car: imperial, Expected: "30.00MPG"},
+	}
+	for _, test := range tests {
+		if actual := c.formatConsumption(test.Car, 7.8405); actual != test.Expected {
+			t.Errorf("actual [%s], [%+v]\n", actual, test)
+		}
+	}
+	if actual := c.toConsumption(imperial, 0); actual != 0 {
+		t.Errorf("actual unknown consumption [%f]\n", actual)
+	}
+	if actual := c.formatPerVolume(imperial.VolumeUnit, 1, "USD"); actual != "3.79$/gal" {
+		t.Errorf("actual price [%s]\n", actual)
+	}
+}
+
+func TestParseQuickFuel(t *testing.T) {
+	now := time.Date(2026, 10, 18, 15, 30, 0, 0, time.UTC)
+	today := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC).Unix()
+	tests := []struct {
+		Car      st.CarBase
+		Input    string
+		Expected st.FuelBase
+		Error    bool
+	}{
+		{Input: "45.2 80.91 123456", Expected: st.FuelBase{Currency: "EUR", Timestamp: today, Milliliters: 45200, Cents: 8091, Kilometers: 123456, FullTank: true}},
+		{Input: "45.2L 1.79€/L 123456km diesel yesterday", Expected: st.FuelBase{Currency: "EUR", Timestamp: today - 86400, Type: "diesel", Milliliters: 45200, Cents: 8091, Kilometers: 123456, FullTank: true}},
+		{Input: "123456km 80.91€ 1.79€/L Super Plus 2026-10-01 partial", Expected: st.FuelBase{Currency: "EUR", Timestamp: today - 17*86400, Type: "Super Plus", Milliliters: 45201, Cents: 8091, Kilometers: 123456}},
+		{Input: "1,79/l 45,2 123456 01.10.2026", Expected: st.FuelBase{Currency: "EUR", Timestamp: today - 17*86400, Milliliters: 45200, Cents: 8091, Kilometers: 123456, FullTank: true}},
+		{Input: "40 60chf 1000", Expected: st.FuelBase{Currency: "CHF", Timestamp: today, Milliliters: 40000, Cents: 6000, Kilometers: 1000, FullTank: true}},
+		{Car: st.CarBase{DistanceUnit: st.DistanceMiles, VolumeUnit: st.VolumeGallons}, Input: "10 $40 1000", Expected: st.FuelBase{Currency: "USD", Timestamp: today, Milliliters: 37854, Cents: 4000, Kilometers: 1609, FullTank: true}},
+		{Input: "45.2 80.91 CHF 123456", Expected: st.FuelBase{Currency: "CHF", Timestamp: today, Milliliters: 45200, Cents: 8091, Kilometers: 123456, FullTank: true}},
+		{Input: "gbp 1.79/l 45.2 123456 LPG", Expected: st.FuelBase{Currency: "GBP", Timestamp: today, Type: "LPG", Milliliters: 45200, Cents: 8091, Kilometers: 123456, FullTank: true}},
+		{Input: "45.2 80.91 123456 gas", Expected: st.FuelBase{Currency: "EUR", Timestamp: today, Type: "gas", Milliliters: 45200, Cents: 8091, Kilometers: 123456, FullTank: true}},
+		{Input: "45.2 80.91 123456 e85", Expected: st.FuelBase{Currency: "EUR", Timestamp: today, Type: "e85", Milliliters: 45200, Cents: 8091, Kilometers: 123456, FullTank: true}},
+		{Input: "45.2 80.91 123456 SEK", Expected: st.FuelBase{Currency: "SEK", Timestamp: today, Milliliters: 45200, Cents: 8091, Kilometers: 123456, FullTank: true}},
+		{Input: "45.2 80.91", Error: true},
+		{Input: "45.2L 123456km", Error: true},
+		{Input: "45.2 80.91 123456 7", Error: true},
+		{Input: "45.2 80.91 123456.5", Error: true},
+		{Input: "45.2 1.79€/km 123456", Error: true},
+	}
+	c := NewCarCommand(nil, nil)
+	for _, test := range tests {
+		fuel := c.newDraftFuel(0, 0, "EUR")
+		err := c.parseQuickFuel(test.Car, fuel, strings.Split(test.Input, " "), append(carCurrencies, "SEK"), now)
+		if test.Error != (err != nil) {
+			t.Errorf("actual error [%v], [%+v]\n", err, test)
+		}
+		if !test.Error && *fuel != test.Expected {
+			t.Errorf("actual [%+v], [%+v]\n", *fuel, test)
+		}
+	}
 }
@@ -0,0 +1,281 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	st "mr-weasel/internal/storage"
+	"mr-weasel/internal/utils"
+)
+
+// carCurrencies are offered as buttons, any other ISO 4217 code can be typed.
+var carCurrencies = []string{"EUR", "CHF", "GBP", "PLN", "USD"}
+
+var carCurrencySymbols = map[string]string{
+	"EUR": "€",
+	"GBP": "£",
+	"USD": "$",
+}
+
+var (
+	carCurrencyRegexp = regexp.MustCompile(`^[A-Z]{3}$`)
+	carMoneyRegexp    = regexp.MustCompile(`^([A-Z]{3})?\s*(-?\d+(?:[.,]\d+)?)\s*([A-Z]{3})?$`)
+)
+
+// carRatesMaxErrors limits the invalid lines listed when the rates are updated.
+const carRatesMaxErrors = 10
+
+const carRatesAdminOnly = "Only the admins can update the exchange rates, they are shared by all users."
+
+// formatMoney formats the amount with the currency symbol if it has one, or with the code, e.g. "45.50€" or "45.50 CHF".
+func (c *CarCommand) formatMoney(amount float64, currency string) string {
+	if symbol, ok := carCurrencySymbols[currency]; ok {
+		return fmt.Sprintf("%.2f%s", amount, symbol)
+	}
+	return fmt.Sprintf("%.2f %s", amount, currency)
+}
+
+// formatPrice formats the whole amount like formatMoney, e.g. "15000€".
+func (c *CarCommand) formatPrice(amount int64, currency string) string {
+	if symbol, ok := carCurrencySymbols[currency]; ok {
+		return fmt.Sprintf("%d%s", amount, symbol)
+	}
+	return fmt.Sprintf("%d %s", amount, currency)
+}
+
+// parseCurrency accepts the ISO 4217 codes in any case, and the symbols of carCurrencySymbols.
+func (c *CarCommand) parseCurrency(input string) (string, error) {
+	input = strings.ToUpper(strings.TrimSpace(input))
+	for code, symbol := range carCurrencySymbols {
+		if input == symbol {
+			return code, nil
+		}
+	}
+	if !carCurrencyRegexp.MatchString(input) {
+		return "", errors.New("currency must be a three letter code")
+	}
+	return input, nil
+}
+
+// parseMoney reads the amount in cents with an optional currency before or after it, e.g. "45.50", "45,50 chf" or "£12".
+// The currency is returned as is if the input has none.
+func (c *CarCommand) parseMoney(input string, currency string) (int64, string, error) {
+	input = strings.ToUpper(strings.TrimSpace(input))
+	for code, symbol := range carCurrencySymbols {
+		input = strings.Replace(input, symbol, code, 1)
+	}
+	m := carMoneyRegexp.FindStringSubmatch(input)
+	if m == nil || m[1] != "" && m[3] != "" {
+		return 0, currency, errors.New("amount must be a decimal number")
+	}
+	if m[1] != "" {
+		currency = m[1]
+	} else if m[3] != "" {
+		currency = m[3]
+	}
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(m[2], ",", "."), 64)
+	return int64(math.Round(amount * 100)), currency, err
+}
+
+// parseExchangeRates reads one "currency rate" pair per line, separated by spaces, commas, semicolons or "=".
+// The header line of the csv files is skipped, the rates are the amount of the currency worth 1 EUR.
+func (c *CarCommand) parseExchangeRates(data []byte, now time.Time) ([]st.ExchangeRate, []string) {
+	rates, errs := []st.ExchangeRate{}, []string{}
+
+	text := strings.TrimPrefix(string(data), "\xef\xbb\xbf") // excel adds utf-8 bom
+	for i, line := range strings.Split(text, "\n") {
+		separators := " \t=,;"
+		if strings.Contains(line, ";") {
+			separators = " \t=;" // decimal commas
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return strings.ContainsRune(separators, r)
+		})
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			errs = append(errs, fmt.Sprintf("line %d: expected a currency and a rate", i+1))
+			continue
+		}
+
+		rate, err := strconv.ParseFloat(strings.ReplaceAll(fields[1], ",", "."), 64)
+		if err != nil && i == 0 {
+			continue // header
+		}
+		currency, errCurrency := c.parseCurrency(fields[0])
+		switch {
+		case errCurrency != nil:
+			errs = append(errs, fmt.Sprintf("line %d: %s", i+1, errCurrency))
+		case currency == st.BaseCurrency:
+			errs = append(errs, fmt.Sprintf("line %d: %s is the reference currency, its rate is always 1", i+1, st.BaseCurrency))
+		case err != nil || rate <= 0:
+			errs = append(errs, fmt.Sprintf("line %d: rate must be a positive decimal number", i+1))
+		default:
+			rates = append(rates, st.ExchangeRate{Currency: currency, Rate: rate, Timestamp: now.Unix()})
+		}
+	}
+
+	if len(rates) == 0 && len(errs) == 0 {
+		errs = append(errs, "no rates found")
+	}
+	return rates, errs
+}
+
+func (c *CarCommand) showCarCurrency(ctx context.Context, pl Payload) {
+	currency, err := c.storage.GetCarCurrencyFromDB(ctx, pl.UserID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	text := fmt.Sprintf("💱 <b>Base currency:</b> %s\n\n", currency)
+	text += "The totals, the stats and the car prices are shown in the base currency, "
+	text += "the receipts paid in other currencies are converted with the exchange rates.\n\n"
+	text += "Add the currency code to the amount of such receipts, e.g. <code>45.50 CHF</code>."
+	res := Result{Text: text}
+	for _, v := range carCurrencies {
+		if v == currency {
+			res.InlineMarkup.AddKeyboardButton("• "+v+" •", "-")
+		} else {
+			res.InlineMarkup.AddKeyboardButton(v, commandf(c, cmdCarCurrency, v))
+		}
+	}
+	res.InlineMarkup.AddKeyboardRow()
+	res.InlineMarkup.AddKeyboardButton("Other", commandf(c, cmdCarCurrencyAsk))
+	res.InlineMarkup.AddKeyboardButton("Exchange Rates", commandf(c, cmdCarRates))
+	res.InlineMarkup.AddKeyboardRow()
+	res.InlineMarkup.AddKeyboardButton("« Back to my cars", c.Prefix())
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) setCarCurrencyAsk(ctx context.Context, pl Payload) {
+	pl.ResultChan <- Result{Text: "What is your base currency? e.g. SEK", State: statef(c, stepCarCurrency)}
+}
+
+func (c *CarCommand) setCarCurrency(ctx context.Context, pl Payload, input string) {
+	currency, err := c.parseCurrency(input)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid currency code.", State: statef(c, stepCarCurrency)}
+		return
+	}
+	if err := c.storage.SetCarCurrencyInDB(ctx, pl.UserID, currency); err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	res := Result{Text: fmt.Sprintf("Base currency has been successfully set to %s!", currency), ClearState: true}
+	if _, err := c.storage.GetExchangeRateFromDB(ctx, currency); err != nil && currency != st.BaseCurrency {
+		res.Text += fmt.Sprintf("\n\n⚠️ There is no exchange rate for %s yet, the receipts are converted 1:1.", currency)
+	}
+	res.InlineMarkup.AddKeyboardButton("Exchange Rates", commandf(c, cmdCarRates))
+	res.InlineMarkup.AddKeyboardButton("« Back to my cars", c.Prefix())
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) formatExchangeRates(rates []st.ExchangeRate, missing []string) string {
+	str := fmt.Sprintf("💱 <b>Exchange rates</b> for 1 %s:\n", st.BaseCurrency)
+	if len(rates) == 0 {
+		str += "\nNo rates yet.\n"
+	}
+	for _, r := range rates {
+		str += fmt.Sprintf("\n<b>%s:</b> %.4f (%s)", r.Currency, r.Rate, r.GetTimestamp())
+	}
+	if len(missing) > 0 {
+		str += fmt.Sprintf("\n\n⚠️ No rates for %s, the receipts are converted 1:1.", strings.Join(missing, ", "))
+	}
+	return str
+}
+
+func (c *CarCommand) showExchangeRates(ctx context.Context, pl Payload) {
+	rates, err := c.storage.SelectExchangeRatesFromDB(ctx)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	missing, err := c.storage.SelectMissingCurrenciesFromDB(ctx, pl.UserID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	res := Result{Text: c.formatExchangeRates(rates, missing)}
+	if pl.IsAdmin {
+		res.InlineMarkup.AddKeyboardButton("Update Rates", commandf(c, cmdCarRatesSet))
+		res.InlineMarkup.AddKeyboardRow()
+	}
+	res.InlineMarkup.AddKeyboardButton("« Back to currency", commandf(c, cmdCarCurrency))
+	pl.ResultChan <- res
+}
+
+// setExchangeRatesAsk asks for the rates, unless they are given with the command, e.g. "/car rates_set CHF 0.94".
+// The rates are shared by all users, only the admins can change them.
+func (c *CarCommand) setExchangeRatesAsk(ctx context.Context, pl Payload, args []string) {
+	if !pl.IsAdmin {
+		pl.ResultChan <- Result{Text: carRatesAdminOnly}
+		return
+	}
+	if len(args) > 0 {
+		c.setExchangeRates(ctx, pl, []byte(strings.Join(args, " ")))
+		return
+	}
+	text := fmt.Sprintf("Please send the rates for 1 %s, one currency per line, e.g. <code>CHF 0.94</code>.\n\n", st.BaseCurrency)
+	text += "A CSV file with the <code>currency,rate</code> columns can be uploaded as well."
+	pl.ResultChan <- Result{Text: text, State: statef(c, stepCarRates)}
+}
+
+func (c *CarCommand) setExchangeRatesInput(ctx context.Context, pl Payload) {
+	if !pl.IsAdmin {
+		pl.ResultChan <- Result{Text: carRatesAdminOnly, ClearState: true}
+		return
+	}
+	if pl.FileURL == "" {
+		c.setExchangeRates(ctx, pl, []byte(pl.Command))
+		return
+	}
+	data, err := utils.DownloadBytes(ctx, pl.FileURL, carImportMaxBytes)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "Unable to download the file, please try again.", State: statef(c, stepCarRates), Error: err}
+		return
+	}
+	c.setExchangeRates(ctx, pl, data)
+}
+
+func (c *CarCommand) setExchangeRates(ctx context.Context, pl Payload, data []byte) {
+	rates, errs := c.parseExchangeRates(data, time.Now().UTC())
+	if len(errs) > 0 {
+		text := fmt.Sprintf("Found %d invalid lines, please fix them and send the rates again:\n", len(errs))
+		for _, e := range errs[:min(len(errs), carRatesMaxErrors)] {
+			text += "\n" + _es(e)
+		}
+		pl.ResultChan <- Result{Text: text, State: statef(c, stepCarRates)}
+		return
+	}
+	if err := c.storage.UpsertExchangeRatesIntoDB(ctx, rates); err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, nothing has been updated.", Error: err}
+		return
+	}
+
+	res := Result{Text: fmt.Sprintf("%d exchange rates have been successfully updated!", len(rates)), ClearState: true}
+	res.InlineMarkup.AddKeyboardButton("« Back to exchange rates", commandf(c, cmdCarRates))
+	pl.ResultChan <- res
+}
+
+// selectExchangeRates returns the rates of all currencies by code, BaseCurrency included.
+func (c *CarCommand) selectExchangeRates(ctx context.Context) (map[string]float64, error) {
+	rates, err := c.storage.SelectExchangeRatesFromDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byCurrency := map[string]float64{st.BaseCurrency: 1}
+	for _, r := range rates {
+		byCurrency[r.Currency] = r.Rate
+	}
+	return byCurrency, nil
+}
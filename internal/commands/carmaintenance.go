@@ -0,0 +1,510 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	st "mr-weasel/internal/storage"
+)
+
+const (
+	carMaintOK = iota
+	carMaintDue
+	carMaintOverdue
+)
+
+// The maintenance is due soon within these limits, and the reminders start.
+const (
+	carMaintSoonKilometers = 1000
+	carMaintSoonDays       = 14
+)
+
+// Reminders are sent by a daily task of the user, scheduled with the first plan.
+// The owner gets the task too when an editor adds the plan, as the reminders of a shared car go to whoever's task runs first.
+const (
+	carMaintTaskKey  = "car_maint_remind"
+	carMaintTaskSpec = "0 9 * * *"
+)
+
+const (
+	carMaintRemindEvery = 3*24*time.Hour - time.Hour // every third daily run, until the maintenance is done or snoozed
+	carMaintSnooze      = 7 * 24 * time.Hour
+)
+
+const carMaintCustom = "custom"
+
+type carMaintPreset struct {
+	Key         string
+	Description string
+	Kilometers  int64
+	Months      int64
+}
+
+var carMaintPresets = []carMaintPreset{
+	{Key: "oil", Description: "Oil change", Kilometers: 15000, Months: 12},
+	{Key: "inspection", Description: "Inspection", Months: 24},
+	{Key: "tyres", Description: "Seasonal tyres", Months: 6},
+}
+
+// checkMaintenance returns whether the maintenance is due, the earlier of the mileage and the date wins.
+func (c *CarCommand) checkMaintenance(maint st.MaintenanceDetails, now time.Time) int {
+	status := carMaintOK
+	if maint.Kilometers.Valid {
+		left := maint.GetDueKilometers() - maint.CarKilometers
+		if left <= 0 {
+			return carMaintOverdue
+		} else if left <= carMaintSoonKilometers {
+			status = carMaintDue
+		}
+	}
+	if maint.Months.Valid {
+		due := maint.GetDueTime()
+		if !now.Before(due) {
+			return carMaintOverdue
+		} else if due.Sub(now) <= carMaintSoonDays*24*time.Hour {
+			status = carMaintDue
+		}
+	}
+	return status
+}
+
+func (c *CarCommand) formatMaintenanceStatus(status int) string {
+	switch status {
+	case carMaintOverdue:
+		return "🔴"
+	case carMaintDue:
+		return "🟡"
+	default:
+		return "🟢"
+	}
+}
+
+func (c *CarCommand) formatMaintenanceInterval(unit string, maint st.MaintenanceBase) string {
+	switch {
+	case maint.Kilometers.Valid && maint.Months.Valid:
+		return fmt.Sprintf("%s or %d months", c.formatDistance(unit, maint.Kilometers.Int64), maint.Months.Int64)
+	case maint.Kilometers.Valid:
+		return c.formatDistance(unit, maint.Kilometers.Int64)
+	default:
+		return fmt.Sprintf("%d months", maint.Months.Int64)
+	}
+}
+
+func (c *CarCommand) formatMaintenanceDetails(maint st.MaintenanceDetails, now time.Time) string {
+	str := fmt.Sprintf("%s <b>%s</b>\n", c.formatMaintenanceStatus(c.checkMaintenance(maint, now)), _es(maint.Description))
+	str += fmt.Sprintf("🔁 <b>Every:</b> %s\n", c.formatMaintenanceInterval(maint.CarDistance, maint.MaintenanceBase))
+	str += fmt.Sprintf("✅ <b>Last done:</b> %s", maint.GetLastTimestamp())
+	if maint.Kilometers.Valid {
+		str += " at " + c.formatDistance(maint.CarDistance, maint.LastKilometers)
+	}
+	str += "\n"
+	if maint.Kilometers.Valid {
+		due, left := c.formatDistance(maint.CarDistance, maint.GetDueKilometers()), maint.GetDueKilometers()-maint.CarKilometers
+		if left > 0 {
+			str += fmt.Sprintf("📍 <b>Due at:</b> %s (%s left)\n", due, c.formatDistance(maint.CarDistance, left))
+		} else {
+			str += fmt.Sprintf("📍 <b>Due at:</b> %s (%s overdue)\n", due, c.formatDistance(maint.CarDistance, -left))
+		}
+	}
+	if maint.Months.Valid {
+		due := maint.GetDueTime()
+		days := int64(due.Sub(now).Hours() / 24)
+		if due.After(now) {
+			str += fmt.Sprintf("📅 <b>Due on:</b> %s (%d days left)\n", due.Format("Monday, 02 January 2006"), days)
+		} else {
+			str += fmt.Sprintf("📅 <b>Due on:</b> %s (%d days overdue)\n", due.Format("Monday, 02 January 2006"), -days)
+		}
+	}
+	if maint.SnoozedUntil > now.Unix() {
+		str += fmt.Sprintf("💤 <b>Snoozed until:</b> %s\n", time.Unix(maint.SnoozedUntil, 0).UTC().Format("Monday, 02 January 2006"))
+	}
+	return str
+}
+
+// remindMaintenance is run by the scheduled task, and reminds the user about the due and overdue maintenance.
+func (c *CarCommand) remindMaintenance(ctx context.Context, pl Payload) {
+	now := time.Now()
+	maints, err := c.storage.SelectMaintenancesToRemindFromDB(ctx, pl.UserID, now.Unix(), now.Add(-carMaintRemindEvery).Unix())
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	reminded := 0
+	for _, maint := range maints {
+		if c.checkMaintenance(maint, now) == carMaintOK {
+			continue
+		}
+		maint.Reminded = now.Unix()
+		if _, err := c.storage.UpdateMaintenanceInDB(ctx, pl.UserID, maint.MaintenanceBase); err != nil {
+			pl.ResultChan <- Result{Error: err}
+			continue
+		}
+
+		// every reminder keeps its own buttons
+		res := Result{Text: fmt.Sprintf("🔧 <b>Maintenance reminder:</b> %s (%d)\n\n", _es(maint.CarName), maint.CarYear), NewMessage: true}
+		res.Text += c.formatMaintenanceDetails(maint, now)
+		res.InlineMarkup.AddKeyboardButton("Done → log service", commandf(c, cmdCarMaintDone, maint.CarID, maint.ID))
+		res.InlineMarkup.AddKeyboardButton("Snooze 1 week", commandf(c, cmdCarMaintSnooze, maint.CarID, maint.ID))
+		pl.ResultChan <- res
+		reminded++
+	}
+
+	// the daily runs stay silent
+	if reminded == 0 && !pl.Scheduled {
+		pl.ResultChan <- Result{Text: "No maintenance is due."}
+	}
+}
+
+func (c *CarCommand) showMaintenanceList(ctx context.Context, pl Payload, carID int64) {
+	car, err := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
+	if errors.Is(err, sql.ErrNoRows) {
+		pl.ResultChan <- Result{Text: "Car not found."}
+		return
+	} else if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	maints, err := c.storage.SelectMaintenancesFromDB(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	res := Result{Text: fmt.Sprintf("🔧 <b>Maintenance plans:</b> %s (%d)\n", _es(car.Name), car.Year)}
+	if len(maints) == 0 {
+		res.Text += "\nNo plans yet, add the first one."
+	}
+	now := time.Now()
+	for _, maint := range maints {
+		label := fmt.Sprintf("%s %s", c.formatMaintenanceStatus(c.checkMaintenance(maint, now)), maint.Description)
+		res.InlineMarkup.AddKeyboardButton(label, commandf(c, cmdCarMaintGet, carID, maint.ID))
+		res.InlineMarkup.AddKeyboardRow()
+	}
+	if car.CanEdit() {
+		res.InlineMarkup.AddKeyboardButton("Add", commandf(c, cmdCarMaintAdd, carID))
+		res.InlineMarkup.AddKeyboardRow()
+	}
+	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("« Back to %s (%d)", car.Name, car.Year), commandf(c, cmdCarGet, carID))
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) showMaintenanceDetails(ctx context.Context, pl Payload, carID int64, maintID int64) {
+	res := Result{}
+	maint, err := c.storage.GetMaintenanceFromDB(ctx, pl.UserID, carID, maintID)
+	if errors.Is(err, sql.ErrNoRows) {
+		res.Text = "Maintenance plan not found."
+	} else if err != nil {
+		res.Text, res.Error = "There is something wrong, please try again.", err
+	} else {
+		res.Text = c.formatMaintenanceDetails(maint, time.Now())
+		if car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, carID); car.CanEdit() {
+			res.InlineMarkup.AddKeyboardButton("Done", commandf(c, cmdCarMaintDone, carID, maintID))
+			res.InlineMarkup.AddKeyboardButton("Snooze", commandf(c, cmdCarMaintSnooze, carID, maintID))
+			res.InlineMarkup.AddKeyboardButton("Delete", commandf(c, cmdCarMaintDelAsk, carID, maintID))
+			res.InlineMarkup.AddKeyboardRow()
+		}
+	}
+	res.InlineMarkup.AddKeyboardButton("« Back to my plans", commandf(c, cmdCarMaint, carID))
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) newDraftMaintenance(carID int64) *st.MaintenanceBase {
+	return &st.MaintenanceBase{CarID: carID}
+}
+
+func (c *CarCommand) setDraftMaintenanceDescription(maint *st.MaintenanceBase, input string) {
+	maint.Description = input
+}
+
+func (c *CarCommand) setDraftMaintenanceKilometers(car st.CarBase, maint *st.MaintenanceBase, input string) error {
+	if input == "/skip" {
+		maint.Kilometers.Valid = false
+		return nil
+	}
+	kilometers, err := c.parseDistance(car.DistanceUnit, input)
+	if err == nil && kilometers <= 0 {
+		err = errors.New("interval must be positive")
+	}
+	maint.Kilometers.Int64 = kilometers
+	maint.Kilometers.Valid = true
+	return err
+}
+
+func (c *CarCommand) setDraftMaintenanceMonths(maint *st.MaintenanceBase, input string) error {
+	if input == "/skip" {
+		maint.Months.Valid = false
+		return nil
+	}
+	months, err := strconv.Atoi(input)
+	if err == nil && months <= 0 {
+		err = errors.New("interval must be positive")
+	}
+	maint.Months.Int64 = int64(months)
+	maint.Months.Valid = true
+	return err
+}
+
+func (c *CarCommand) setDraftMaintenanceLastTimestamp(maint *st.MaintenanceBase, input string) error {
+	timestamp, err := strconv.Atoi(input)
+	maint.LastTimestamp = int64(timestamp)
+	return err
+}
+
+func (c *CarCommand) setDraftMaintenanceLastKilometers(car st.CarBase, maint *st.MaintenanceBase, input string) error {
+	kilometers, err := c.parseDistance(car.DistanceUnit, input)
+	maint.LastKilometers = kilometers
+	return err
+}
+
+func (c *CarCommand) askMaintenanceLastTimestamp(maint *st.MaintenanceBase) Result {
+	res := Result{Text: "When was it done the last time? Please pick a date.", State: statef(c, stepCarMaintLastTimestamp), Draft: maint}
+	res.InlineMarkup.AddKeyboardCalendar(time.Now().Year(), time.Now().Month())
+	return res
+}
+
+func (c *CarCommand) addMaintenanceStart(ctx context.Context, pl Payload, carID int64, preset string) {
+	car, err := c.getEditableCar(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+
+	maint := c.newDraftMaintenance(carID)
+	if preset == carMaintCustom {
+		pl.ResultChan <- Result{Text: "Provide maintenance description.", State: statef(c, stepCarMaintDescription), Draft: maint}
+		return
+	}
+	for _, p := range carMaintPresets {
+		if p.Key == preset {
+			maint.Description = p.Description
+			maint.Kilometers = sql.NullInt64{Int64: p.Kilometers, Valid: p.Kilometers > 0}
+			maint.Months = sql.NullInt64{Int64: p.Months, Valid: p.Months > 0}
+			pl.ResultChan <- c.askMaintenanceLastTimestamp(maint)
+			return
+		}
+	}
+
+	res := Result{Text: "Choose the maintenance plan:"}
+	for _, p := range carMaintPresets {
+		label := fmt.Sprintf("%s (%s)", p.Description, c.formatMaintenanceInterval(car.DistanceUnit, st.MaintenanceBase{
+			Kilometers: sql.NullInt64{Int64: p.Kilometers, Valid: p.Kilometers > 0},
+			Months:     sql.NullInt64{Int64: p.Months, Valid: p.Months > 0},
+		}))
+		res.InlineMarkup.AddKeyboardButton(label, commandf(c, cmdCarMaintAdd, carID, p.Key))
+		res.InlineMarkup.AddKeyboardRow()
+	}
+	res.InlineMarkup.AddKeyboardButton("Custom", commandf(c, cmdCarMaintAdd, carID, carMaintCustom))
+	res.InlineMarkup.AddKeyboardRow()
+	res.InlineMarkup.AddKeyboardButton("« Back to my plans", commandf(c, cmdCarMaint, carID))
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) addMaintenanceDescription(ctx context.Context, pl Payload, maint *st.MaintenanceBase) {
+	c.setDraftMaintenanceDescription(maint, pl.Command)
+	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, maint.CarID)
+	text := fmt.Sprintf("Every how many %s is it due? /skip", c.distanceSymbol(car.DistanceUnit))
+	pl.ResultChan <- Result{Text: text, State: statef(c, stepCarMaintKilometers), Draft: maint}
+}
+
+func (c *CarCommand) addMaintenanceKilometers(ctx context.Context, pl Payload, maint *st.MaintenanceBase) {
+	car, _ := c.storage.GetCarFromDB(ctx, pl.UserID, maint.CarID)
+	if err := c.setDraftMaintenanceKilometers(car.CarBase, maint, pl.Command); err != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid number.", State: statef(c, stepCarMaintKilometers), Draft: maint}
+		return
+	}
+	if maint.Kilometers.Valid {
+		pl.ResultChan <- Result{Text: "Every how many months is it due? /skip", State: statef(c, stepCarMaintMonths), Draft: maint}
+	} else {
+		pl.ResultChan <- Result{Text: "Every how many months is it due?", State: statef(c, stepCarMaintMonths), Draft: maint}
+	}
+}
+
+func (c *CarCommand) addMaintenanceMonths(ctx context.Context, pl Payload, maint *st.MaintenanceBase) {
+	if err := c.setDraftMaintenanceMonths(maint, pl.Command); err != nil || !maint.Kilometers.Valid && !maint.Months.Valid {
+		pl.ResultChan <- Result{Text: "Please enter a valid number.", State: statef(c, stepCarMaintMonths), Draft: maint}
+		return
+	}
+	pl.ResultChan <- c.askMaintenanceLastTimestamp(maint)
+}
+
+func (c *CarCommand) addMaintenanceLastTimestamp(ctx context.Context, pl Payload, maint *st.MaintenanceBase) {
+	res := Result{}
+	if res.InlineMarkup.UpdateKeyboardCalendar(pl.Command) {
+		pl.ResultChan <- res // new month is selected
+		return
+	}
+	if c.setDraftMaintenanceLastTimestamp(maint, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please pick a date from the calendar.", State: statef(c, stepCarMaintLastTimestamp), Draft: maint}
+		return
+	}
+	res.Text = "Last done: " + maint.GetLastTimestamp()
+	res.InlineMarkup.AddKeyboardRow() // remove calendar keyboard
+	pl.ResultChan <- res
+
+	if !maint.Kilometers.Valid {
+		c.addMaintenanceSave(ctx, pl, maint)
+		return
+	}
+	pl.ResultChan <- Result{Text: "What was the mileage then? /skip to use the current one", State: statef(c, stepCarMaintLastKilometers), Draft: maint}
+}
+
+func (c *CarCommand) addMaintenanceLastKilometersAndSave(ctx context.Context, pl Payload, maint *st.MaintenanceBase) {
+	car, err := c.storage.GetCarFromDB(ctx, pl.UserID, maint.CarID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	if pl.Command == "/skip" {
+		maint.LastKilometers = car.Kilometers
+	} else if err := c.setDraftMaintenanceLastKilometers(car.CarBase, maint, pl.Command); err != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid number.", State: statef(c, stepCarMaintLastKilometers), Draft: maint}
+		return
+	}
+	c.addMaintenanceSave(ctx, pl, maint)
+}
+
+func (c *CarCommand) addMaintenanceSave(ctx context.Context, pl Payload, maint *st.MaintenanceBase) {
+	car, err := c.getEditableCar(ctx, pl.UserID, maint.CarID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+	if _, err := c.storage.InsertMaintenanceIntoDB(ctx, *maint); err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	task := st.Task{
+		Key:      carMaintTaskKey,
+		UserID:   pl.UserID,
+		UserName: pl.UserName,
+		ChatID:   pl.ChatID,
+		ThreadID: int64(pl.ThreadID),
+		Command:  commandf(c, cmdCarMaintRemind),
+		Spec:     carMaintTaskSpec,
+		CatchUp:  st.TaskCatchUpOnce,
+	}
+	if err := c.scheduler.ScheduleTask(ctx, task); err != nil {
+		pl.ResultChan <- Result{Text: "The plan is saved, but the reminders could not be scheduled.", Error: err}
+	} else if err := c.scheduleOwnerMaintenance(ctx, pl, car); err != nil {
+		pl.ResultChan <- Result{Text: "The plan is saved, but the reminders of the owner could not be scheduled.", Error: err}
+	}
+	c.showMaintenanceList(ctx, pl, maint.CarID)
+}
+
+// scheduleOwnerMaintenance schedules the reminders into the private chat of the owner, if the plan added by an editor is the first one of the owner.
+// The existing task is kept, so the owner still gets the reminders where they asked for them.
+func (c *CarCommand) scheduleOwnerMaintenance(ctx context.Context, pl Payload, car st.CarDetails) error {
+	if car.UserID == pl.UserID {
+		return nil
+	}
+	count, err := c.storage.CountMaintenancesFromDB(ctx, car.UserID)
+	if err != nil || count != 1 {
+		return err
+	}
+	task := st.Task{
+		Key:     carMaintTaskKey,
+		UserID:  car.UserID,
+		ChatID:  car.UserID,
+		Command: commandf(c, cmdCarMaintRemind),
+		Spec:    carMaintTaskSpec,
+		CatchUp: st.TaskCatchUpOnce,
+	}
+	return c.scheduler.ScheduleTask(ctx, task)
+}
+
+// doneMaintenance restarts the plan from today and the current mileage, and asks for the price to log the service.
+func (c *CarCommand) doneMaintenance(ctx context.Context, pl Payload, carID int64, maintID int64) {
+	maint, err := c.storage.GetMaintenanceFromDB(ctx, pl.UserID, carID, maintID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "Maintenance plan not found.", Error: err}
+		return
+	}
+	car, err := c.getEditableCar(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	maint.LastTimestamp = today.Unix()
+	maint.LastKilometers = maint.CarKilometers
+	maint.SnoozedUntil, maint.Reminded = 0, 0
+	if _, err := c.storage.UpdateMaintenanceInDB(ctx, pl.UserID, maint.MaintenanceBase); err != nil {
+		pl.ResultChan <- Result{Text: "Update failed, try again.", Error: err}
+		return
+	}
+
+	res := Result{Text: fmt.Sprintf("✅ %s is done, the plan starts over.", _es(maint.Description))}
+	res.InlineMarkup.AddKeyboardRow() // remove keyboard
+	pl.ResultChan <- res
+
+	service := c.newDraftService(pl.UserID, carID, car.Currency)
+	service.Timestamp = today.Unix()
+	service.Description = maint.Description
+	text := fmt.Sprintf("How much money did you spend in %s? /skip", service.Currency)
+	pl.ResultChan <- Result{Text: text, State: statef(c, stepCarMaintServiceEuros), Draft: service}
+}
+
+func (c *CarCommand) doneMaintenanceServiceEuros(ctx context.Context, pl Payload, service *st.ServiceBase) {
+	if pl.Command == "/skip" {
+		res := Result{Text: "Service has not been logged."}
+		res.InlineMarkup.AddKeyboardButton("« Back to my plans", commandf(c, cmdCarMaint, service.CarID))
+		pl.ResultChan <- res
+		return
+	}
+	c.addServiceEurosAndSave(ctx, pl, service)
+}
+
+func (c *CarCommand) snoozeMaintenance(ctx context.Context, pl Payload, carID int64, maintID int64) {
+	maint, err := c.storage.GetMaintenanceFromDB(ctx, pl.UserID, carID, maintID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "Maintenance plan not found.", Error: err}
+		return
+	}
+	if _, err := c.getEditableCar(ctx, pl.UserID, carID); err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+
+	maint.SnoozedUntil = time.Now().Add(carMaintSnooze).Unix()
+	if _, err := c.storage.UpdateMaintenanceInDB(ctx, pl.UserID, maint.MaintenanceBase); err != nil {
+		pl.ResultChan <- Result{Text: "Update failed, try again.", Error: err}
+		return
+	}
+
+	res := Result{Text: fmt.Sprintf("💤 %s is snoozed for a week.", _es(maint.Description)), ClearState: true}
+	res.InlineMarkup.AddKeyboardButton("« Back to my plans", commandf(c, cmdCarMaint, carID))
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) deleteMaintenanceAsk(ctx context.Context, pl Payload, carID int64, maintID int64) {
+	res := Result{Text: "Are you sure you want to delete the selected maintenance plan?"}
+	res.InlineMarkup.AddKeyboardButton("Yes, delete the plan", commandf(c, cmdCarMaintDelYes, carID, maintID))
+	res.InlineMarkup.AddKeyboardRow()
+	res.InlineMarkup.AddKeyboardButton("Nope, nevermind", commandf(c, cmdCarMaintGet, carID, maintID))
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) deleteMaintenanceConfirm(ctx context.Context, pl Payload, carID int64, maintID int64) {
+	res := Result{}
+	affected, err := c.storage.DeleteMaintenanceFromDB(ctx, pl.UserID, maintID)
+	if err != nil || affected != 1 {
+		res.Text, res.Error = "Maintenance plan not found.", err
+	} else {
+		res.Text = "Maintenance plan has been successfully deleted!"
+		if count, err := c.storage.CountMaintenancesFromDB(ctx, pl.UserID); err != nil {
+			res.Error = err
+		} else if count == 0 {
+			res.Error = c.scheduler.UnscheduleTask(ctx, pl.UserID, carMaintTaskKey)
+		}
+	}
+	res.InlineMarkup.AddKeyboardButton("« Back to my plans", commandf(c, cmdCarMaint, carID))
+	pl.ResultChan <- res
+}
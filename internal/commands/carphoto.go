@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	st "mr-weasel/internal/storage"
+)
+
+// setDraftPhoto keeps the telegram file id of the receipt photo, /skip removes the photo.
+func (c *CarCommand) setDraftPhoto(photo *sql.NullString, fileID string, input string) error {
+	if input == "/skip" {
+		photo.Valid = false
+		return nil
+	}
+	if fileID == "" {
+		return errors.New("photo is missing")
+	}
+	photo.String, photo.Valid = fileID, true
+	return nil
+}
+
+// carReceiptPhotoHint is shown when the receipts are added, the photo can be attached to the receipt at any step.
+const carReceiptPhotoHint = "📎 You can send a photo of the paper receipt at any step, with the answer as the caption."
+
+// withReceiptPhoto attaches the photo sent during the add wizard to the draft, and passes the caption to the step as the answer.
+// The photo without a caption keeps the step, so the question above can still be answered.
+func withReceiptPhoto[T any](photo func(*T) *sql.NullString, step func(context.Context, Payload, *T)) func(context.Context, Payload, *T) {
+	return func(ctx context.Context, pl Payload, draft *T) {
+		if pl.FileID == "" {
+			step(ctx, pl, draft)
+			return
+		}
+		*photo(draft) = sql.NullString{String: pl.FileID, Valid: true}
+		if pl.Command == "" {
+			pl.ResultChan <- Result{Text: "The photo is attached to the receipt, please answer the question above.", State: pl.State, Draft: draft}
+			return
+		}
+		step(ctx, pl, draft)
+	}
+}
+
+func fuelPhoto(fuel *st.FuelBase) *sql.NullString          { return &fuel.Photo }
+func servicePhoto(service *st.ServiceBase) *sql.NullString { return &service.Photo }
+func leasePhoto(lease *st.LeaseBase) *sql.NullString       { return &lease.Photo }
+
+func (c *CarCommand) showFuelPhoto(ctx context.Context, pl Payload, carID int64, fuelID int64) {
+	fuel, err := c.storage.GetFuelByIDFromDB(ctx, pl.UserID, carID, fuelID)
+	if err != nil || !fuel.Photo.Valid {
+		pl.ResultChan <- Result{Text: "Receipt photo not found.", Error: err}
+		return
+	}
+	text := fmt.Sprintf("⛽ %s, %s", c.formatMoney(fuel.GetAmount(), fuel.Currency), fuel.GetTimestamp())
+	pl.ResultChan <- Result{Text: text, Photo: fuel.Photo.String}
+}
+
+func (c *CarCommand) updateFuelAskPhoto(ctx context.Context, pl Payload, carID int64, fuelID int64) {
+	c.updateFuelAsk(ctx, pl, carID, fuelID, "Please send a photo of the paper receipt. /skip to remove it", stepCarFuelUpdPhoto)
+}
+
+func (c *CarCommand) updateFuelSavePhoto(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	if c.setDraftPhoto(&fuel.Photo, pl.FileID, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please send the receipt as a photo.", State: statef(c, stepCarFuelUpdPhoto), Draft: fuel}
+		return
+	}
+	c.updateFuelStore(ctx, pl, fuel) // nothing to confirm, the values are not changed
+}
+
+func (c *CarCommand) showServicePhoto(ctx context.Context, pl Payload, carID int64, serviceID int64) {
+	service, err := c.storage.GetServiceByIDFromDB(ctx, pl.UserID, carID, serviceID)
+	if err != nil || !service.Photo.Valid {
+		pl.ResultChan <- Result{Text: "Receipt photo not found.", Error: err}
+		return
+	}
+	text := fmt.Sprintf("🛠️ %s, %s", _es(service.Description), service.GetTimestamp())
+	pl.ResultChan <- Result{Text: text, Photo: service.Photo.String}
+}
+
+func (c *CarCommand) updateServiceAskPhoto(ctx context.Context, pl Payload, carID int64, serviceID int64) {
+	c.updateServiceAsk(ctx, pl, carID, serviceID, "Please send a photo of the paper receipt. /skip to remove it", stepCarServiceUpdPhoto)
+}
+
+func (c *CarCommand) updateServiceSavePhoto(ctx context.Context, pl Payload, service *st.ServiceBase) {
+	if c.setDraftPhoto(&service.Photo, pl.FileID, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please send the receipt as a photo.", State: statef(c, stepCarServiceUpdPhoto), Draft: service}
+		return
+	}
+	c.updateServiceSave(ctx, pl, service)
+}
+
+func (c *CarCommand) showLeasePhoto(ctx context.Context, pl Payload, carID int64, leaseID int64) {
+	lease, err := c.storage.GetLeaseByIDFromDB(ctx, pl.UserID, carID, leaseID)
+	if err != nil || !lease.Photo.Valid {
+		pl.ResultChan <- Result{Text: "Receipt photo not found.", Error: err}
+		return
+	}
+	text := fmt.Sprintf("🧾 %s, %s", c.formatMoney(lease.GetAmount(), lease.Currency), lease.GetTimestamp())
+	pl.ResultChan <- Result{Text: text, Photo: lease.Photo.String}
+}
+
+func (c *CarCommand) updateLeaseAskPhoto(ctx context.Context, pl Payload, carID int64, leaseID int64) {
+	c.updateLeaseAsk(ctx, pl, carID, leaseID, "Please send a photo of the paper receipt. /skip to remove it", stepCarLeaseUpdPhoto)
+}
+
+func (c *CarCommand) updateLeaseSavePhoto(ctx context.Context, pl Payload, lease *st.LeaseBase) {
+	if c.setDraftPhoto(&lease.Photo, pl.FileID, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please send the receipt as a photo.", State: statef(c, stepCarLeaseUpdPhoto), Draft: lease}
+		return
+	}
+	c.updateLeaseSave(ctx, pl, lease)
+}
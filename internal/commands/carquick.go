@@ -0,0 +1,239 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	st "mr-weasel/internal/storage"
+)
+
+// Answers of the quick fuel entry card.
+const (
+	carFuelQuickSave = "fuel_quick_save"
+	carFuelQuickEdit = "fuel_quick_edit"
+)
+
+// carQuickFuelExample is shown with the prompts and the parsing errors.
+const carQuickFuelExample = "<code>45.2L 1.79€/L 123456km diesel yesterday</code>"
+
+var (
+	carQuickVolumeRegexp   = regexp.MustCompile(`^(\d+(?:[.,]\d+)?)(l|gal)$`)
+	carQuickDistanceRegexp = regexp.MustCompile(`^(\d+)(km|mi)$`)
+	carQuickNumberRegexp   = regexp.MustCompile(`^\d+(?:[.,]\d+)?$`)
+)
+
+// parseQuickFuel fills the draft from the one line receipt, e.g. "45.2L 1.79€/L 123456km diesel yesterday" or "45.2 80.91 CHF 123456".
+// The tokens with units can go in any order, the plain numbers are the volume, the amount and the mileage in the units of the car.
+// A standalone currency code applies to the amount and the price if it is one of the known currencies,
+// other words like "gas" or "e85" are the fuel type.
+// The amount is computed from the price per volume if it is missing, and the volume from the amount.
+// The date is today by default and the fuel type is left empty if the line has none.
+func (c *CarCommand) parseQuickFuel(car st.CarBase, fuel *st.FuelBase, args []string, currencies []string, now time.Time) error {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	fuel.Timestamp = today.Unix()
+
+	var perVolume int64 // cents per unit of priceUnit
+	var priceUnit string
+	var hasVolume, hasAmount, hasDistance bool
+	numbers, types := []string{}, []string{}
+	for _, arg := range args {
+		token := strings.ToLower(arg)
+		switch {
+		case token == "":
+			continue
+		case token == "today":
+			fuel.Timestamp = today.Unix()
+		case token == "yesterday":
+			fuel.Timestamp = today.AddDate(0, 0, -1).Unix()
+		case token == "full":
+			fuel.FullTank = true
+		case token == "partial":
+			fuel.FullTank = false
+		case carQuickVolumeRegexp.MatchString(token):
+			m := carQuickVolumeRegexp.FindStringSubmatch(token)
+			if err := c.setDraftFuelLiters(st.CarBase{VolumeUnit: m[2]}, fuel, strings.ReplaceAll(m[1], ",", ".")); err != nil {
+				return fmt.Errorf("%s is not a valid volume", arg)
+			}
+			hasVolume = true
+		case carQuickDistanceRegexp.MatchString(token):
+			m := carQuickDistanceRegexp.FindStringSubmatch(token)
+			if err := c.setDraftFuelKilometers(st.CarBase{DistanceUnit: m[2]}, fuel, m[1]); err != nil {
+				return fmt.Errorf("%s is not a valid mileage", arg)
+			}
+			hasDistance = true
+		case carQuickNumberRegexp.MatchString(token):
+			numbers = append(numbers, strings.ReplaceAll(token, ",", "."))
+		case strings.Contains(token, "/"):
+			price, unit, _ := strings.Cut(token, "/")
+			if unit != st.VolumeLiters && unit != st.VolumeGallons {
+				return fmt.Errorf("%s is not a valid price, expected per L or per gal", arg)
+			}
+			cents, currency, err := c.parseMoney(price, fuel.Currency)
+			if err != nil || cents <= 0 {
+				return fmt.Errorf("%s is not a valid price", arg)
+			}
+			perVolume, priceUnit, fuel.Currency = cents, unit, currency
+		default:
+			if date, err := c.parseQuickDate(token); err == nil {
+				fuel.Timestamp = date.Unix()
+			} else if cents, currency, err := c.parseMoney(arg, fuel.Currency); err == nil {
+				fuel.Cents, fuel.Currency = cents, currency
+				hasAmount = true
+			} else if currency, err := c.parseCurrency(arg); err == nil && slices.Contains(currencies, currency) {
+				fuel.Currency = currency
+			} else {
+				types = append(types, arg)
+			}
+		}
+	}
+
+	// the amount has no slot if the price is known, it is computed below
+	for _, number := range numbers {
+		var err error
+		switch {
+		case !hasVolume && !(perVolume > 0 && hasAmount):
+			err = c.setDraftFuelLiters(car, fuel, number)
+			hasVolume = true
+		case !hasAmount && perVolume == 0:
+			err = c.setDraftFuelEuros(fuel, number)
+			hasAmount = true
+		case !hasDistance:
+			err = c.setDraftFuelKilometers(car, fuel, number)
+			hasDistance = true
+		default:
+			return fmt.Errorf("%s is unexpected", number)
+		}
+		if err != nil {
+			return fmt.Errorf("%s is not a valid number", number)
+		}
+	}
+
+	if perVolume > 0 && hasVolume && !hasAmount {
+		fuel.Cents = int64(math.Round(float64(perVolume) * c.toVolume(priceUnit, fuel.Milliliters)))
+		hasAmount = true
+	} else if perVolume > 0 && hasAmount && !hasVolume {
+		volume := float64(fuel.Cents) / float64(perVolume)
+		if priceUnit == st.VolumeGallons {
+			volume *= litersPerGallon
+		}
+		fuel.Milliliters = int64(math.Round(volume * 1000))
+		hasVolume = true
+	}
+	if len(types) > 0 {
+		c.setDraftFuelType(fuel, strings.Join(types, " "))
+	}
+
+	switch {
+	case !hasVolume || fuel.Milliliters <= 0:
+		return errors.New("the volume is missing")
+	case !hasAmount || fuel.Cents <= 0:
+		return errors.New("the amount is missing")
+	case !hasDistance:
+		return errors.New("the mileage is missing")
+	}
+	return nil
+}
+
+// parseQuickDate reads the dates like "2024-05-17" or "17.05.2024", the shorter ones would be ambiguous with the volume.
+func (c *CarCommand) parseQuickDate(input string) (time.Time, error) {
+	date, err := time.Parse(time.DateOnly, input)
+	if err != nil {
+		date, err = time.Parse("2.1.2006", input)
+	}
+	return date, err
+}
+
+func (c *CarCommand) formatQuickFuel(car st.CarDetails, fuel st.FuelBase) string {
+	str := fmt.Sprintf("⛽ <b>%s:</b> %s (%s)\n", c.volumeName(car.VolumeUnit), c.formatVolume(car.VolumeUnit, fuel.Milliliters), _es(fuel.Type))
+	str += fmt.Sprintf("💲 <b>Paid:</b> %s (%s)\n", c.formatMoney(fuel.GetAmount(), fuel.Currency), c.formatPerVolume(car.VolumeUnit, fuel.GetAmountPerLiter(), fuel.Currency))
+	if fuel.FullTank {
+		str += fmt.Sprintf("🏭 <b>Total:</b> %s\n", c.formatDistance(car.DistanceUnit, fuel.Kilometers))
+	} else {
+		str += fmt.Sprintf("🏭 <b>Total:</b> %s (partial fill)\n", c.formatDistance(car.DistanceUnit, fuel.Kilometers))
+	}
+	str += fmt.Sprintf("📅 %s\n", fuel.GetTimestamp())
+	return str
+}
+
+// addFuelQuick parses the one line receipt into a new draft and shows it to confirm, the fuel type defaults to the last one of the car.
+func (c *CarCommand) addFuelQuick(ctx context.Context, pl Payload, carID int64, args []string) {
+	car, err := c.getEditableCar(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+
+	currencies, err := c.knownCurrencies(ctx, car.Currency)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	fuel := c.newDraftFuel(pl.UserID, car.ID, car.Currency)
+	fuel.Photo = sql.NullString{String: pl.FileID, Valid: pl.FileID != ""} // the line can be the caption of the receipt photo
+	err = c.parseQuickFuel(car.CarBase, fuel, args, currencies, time.Now().UTC())
+	if err == nil && fuel.Type == "" {
+		last, err := c.storage.GetFuelFromDB(ctx, pl.UserID, car.ID, 0)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+			return
+		}
+		c.setDraftFuelType(fuel, last.Type)
+	}
+	if err == nil && fuel.Type == "" {
+		err = errors.New("the fuel type is missing")
+	}
+	if err != nil {
+		text := fmt.Sprintf("Unable to read the receipt, %s. Please send it again, e.g. %s", err, carQuickFuelExample)
+		draft := c.newDraftFuel(pl.UserID, car.ID, car.Currency)
+		draft.Photo = fuel.Photo
+		pl.ResultChan <- Result{Text: text, State: statef(c, stepCarFuelTimestamp), Draft: draft}
+		return
+	}
+
+	res := Result{Text: c.formatQuickFuel(car, *fuel), State: statef(c, stepCarFuelQuick), Draft: fuel}
+	res.InlineMarkup.AddKeyboardButton("Save", carFuelQuickSave)
+	res.InlineMarkup.AddKeyboardButton("Edit", carFuelQuickEdit)
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) addFuelQuickConfirm(ctx context.Context, pl Payload, fuel *st.FuelBase) {
+	switch pl.Command {
+	case carFuelQuickSave:
+		if !c.confirmFuel(ctx, pl, fuel) {
+			return
+		}
+		res := Result{Text: "Receipt has been successfully saved!", ClearState: true}
+		if _, err := c.storage.InsertFuelIntoDB(ctx, *fuel); err != nil {
+			res.Text, res.Error = "There is something wrong, please try again.", err
+		}
+		c.addFuelBackButton(&res, fuel)
+		pl.ResultChan <- res
+	case carFuelQuickEdit:
+		res := Result{Text: "Please pick a receipt date, or send the corrected receipt in one line.", State: statef(c, stepCarFuelTimestamp), Draft: fuel}
+		res.InlineMarkup.AddKeyboardCalendar(time.Now().Year(), time.Now().Month())
+		pl.ResultChan <- res
+	default:
+		pl.ResultChan <- Result{Text: "Please confirm the receipt with the buttons above.", State: statef(c, stepCarFuelQuick), Draft: fuel}
+	}
+}
+
+// knownCurrencies returns the currencies offered as buttons, the ones with the exchange rates, and the currency of the car.
+func (c *CarCommand) knownCurrencies(ctx context.Context, currency string) ([]string, error) {
+	rates, err := c.storage.SelectExchangeRatesFromDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	currencies := append(slices.Clone(carCurrencies), st.BaseCurrency, currency)
+	for _, rate := range rates {
+		currencies = append(currencies, rate.Currency)
+	}
+	return currencies, nil
+}
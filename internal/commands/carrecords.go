@@ -0,0 +1,457 @@
+package commands
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"mr-weasel/internal/lib/xlsx"
+	st "mr-weasel/internal/storage"
+	"mr-weasel/internal/utils"
+)
+
+const (
+	carRecordFuel    = "fuel"
+	carRecordService = "service"
+	carRecordLease   = "lease"
+)
+
+const (
+	carExportCSV  = "csv"
+	carExportXLSX = "xlsx"
+)
+
+const (
+	carImportYes = "import_yes"
+	carImportNo  = "import_no"
+)
+
+const (
+	carImportMaxBytes  = 1 << 20
+	carImportMaxRows   = 5000
+	carImportMaxErrors = 10
+)
+
+// carRecordsHeader is the first row of the exported files, and the columns expected in the imported ones.
+// The liters and the kilometers do not depend on the units of the car, the older files have "euros" instead of "amount".
+var carRecordsHeader = []string{"record", "date", "fuel_type", "liters", "kilometers", "amount", "currency", "description", "full_tank"}
+
+var fileNameRegexp = regexp.MustCompile(`[^\pL\pN]+`)
+
+type carImport struct {
+	CarID   int64
+	Records st.CarRecords
+}
+
+// carRecordKey identifies the same receipt in the imported file and in the database, the service and the lease have no mileage.
+type carRecordKey struct {
+	Record     string
+	Timestamp  int64
+	Kilometers int64
+	Cents      int64
+}
+
+func (c *CarCommand) formatCarRecords(fuels []st.FuelDetails, services []st.ServiceDetails, leases []st.LeaseDetails) [][]string {
+	type record struct {
+		timestamp int64
+		row       []string
+	}
+
+	date := func(timestamp int64) string {
+		return time.Unix(timestamp, 0).UTC().Format(time.DateOnly)
+	}
+	amount := func(cents int64) string {
+		return strconv.FormatFloat(float64(cents)/100, 'f', 2, 64)
+	}
+
+	records := []record{}
+	for _, f := range fuels {
+		liters := strconv.FormatFloat(f.GetLiters(), 'f', -1, 64)
+		fullTank := "yes"
+		if !f.FullTank {
+			fullTank = "no"
+		}
+		row := []string{carRecordFuel, date(f.Timestamp), f.Type, liters, fmt.Sprint(f.Kilometers), amount(f.Cents), f.Currency, "", fullTank}
+		records = append(records, record{f.Timestamp, row})
+	}
+	for _, s := range services {
+		row := []string{carRecordService, date(s.Timestamp), "", "", "", amount(s.Cents), s.Currency, s.Description, ""}
+		records = append(records, record{s.Timestamp, row})
+	}
+	for _, l := range leases {
+		row := []string{carRecordLease, date(l.Timestamp), "", "", "", amount(l.Cents), l.Currency, l.Description.String, ""}
+		records = append(records, record{l.Timestamp, row})
+	}
+
+	slices.SortStableFunc(records, func(a, b record) int {
+		return cmp.Compare(a.timestamp, b.timestamp)
+	})
+
+	rows := [][]string{carRecordsHeader}
+	for _, r := range records {
+		rows = append(rows, r.row)
+	}
+	return rows
+}
+
+func (c *CarCommand) exportCarRecords(ctx context.Context, pl Payload, carID int64, format string) {
+	car, err := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "Car not found.", Error: err}
+		return
+	}
+
+	fuels, err := c.storage.SelectFuelsFromDB(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	services, err := c.storage.SelectServicesFromDB(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	leases, err := c.storage.SelectLeasesFromDB(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	rows := c.formatCarRecords(fuels, services, leases)
+	name := strings.Trim(fileNameRegexp.ReplaceAllString(fmt.Sprintf("%s %d", car.Name, car.Year), "_"), "_")
+
+	buf := new(bytes.Buffer)
+	if format == carExportXLSX {
+		name += ".xlsx"
+		err = xlsx.Write(buf, car.Name, rows)
+	} else {
+		name += ".csv"
+		w := csv.NewWriter(buf)
+		w.WriteAll(rows)
+		err = w.Error()
+	}
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	text := fmt.Sprintf("📤 %d fuel, %d service and %d lease receipts of %s (%d)", len(fuels), len(services), len(leases), _es(car.Name), car.Year)
+	pl.ResultChan <- Result{Text: text, Document: &Document{Name: name, Data: buf.Bytes()}}
+}
+
+// parseCarRecords validates the csv rows, and returns the receipts or the errors with line numbers.
+// Both "," and ";" separators are accepted, as well as decimal commas. The rows without a currency are in the given one.
+func (c *CarCommand) parseCarRecords(userID int64, carID int64, currency string, data []byte) (st.CarRecords, []string) {
+	records := st.CarRecords{}
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // excel adds utf-8 bom
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		r.Comma = ';'
+	}
+
+	rows, err := r.ReadAll()
+	if err != nil {
+		return records, []string{err.Error()}
+	}
+	if len(rows) < 2 {
+		return records, []string{"the file has no rows"}
+	}
+	if len(rows) > carImportMaxRows+1 {
+		return records, []string{fmt.Sprintf("the file has more than %d rows", carImportMaxRows)}
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if i, ok := columns["euros"]; ok {
+		columns["amount"] = i
+	}
+	for _, name := range []string{"record", "date", "amount"} {
+		if _, ok := columns[name]; !ok {
+			return records, []string{fmt.Sprintf("column %q is missing, expected columns: %s", name, strings.Join(carRecordsHeader, ","))}
+		}
+	}
+
+	errs := []string{}
+	for i, row := range rows[1:] {
+		get := func(name string) string {
+			if j, ok := columns[name]; ok && j < len(row) {
+				return strings.TrimSpace(row[j])
+			}
+			return ""
+		}
+		number := func(name string) string {
+			return strings.ReplaceAll(get(name), ",", ".")
+		}
+
+		if err := c.parseCarRecord(userID, carID, currency, get, number, &records); err != nil {
+			errs = append(errs, fmt.Sprintf("line %d: %s", i+2, err))
+		}
+	}
+
+	return records, errs
+}
+
+func (c *CarCommand) parseCarRecord(userID int64, carID int64, currency string, get func(string) string, number func(string) string, records *st.CarRecords) error {
+	date, err := time.Parse(time.DateOnly, get("date"))
+	if err != nil {
+		return errors.New("date must be in YYYY-MM-DD format")
+	}
+	timestamp := strconv.FormatInt(date.Unix(), 10)
+	if code := get("currency"); code != "" {
+		if currency, err = c.parseCurrency(code); err != nil {
+			return err
+		}
+	}
+
+	switch strings.ToLower(get("record")) {
+	case carRecordFuel:
+		fuel := c.newDraftFuel(userID, carID, currency)
+		c.setDraftFuelTimestamp(fuel, timestamp)
+		c.setDraftFuelType(fuel, get("fuel_type"))
+		if fuel.Type == "" {
+			return errors.New("fuel_type is empty")
+		}
+		if c.setDraftFuelLiters(st.CarBase{}, fuel, number("liters")) != nil || fuel.Milliliters <= 0 {
+			return errors.New("liters must be a positive decimal number")
+		}
+		if c.setDraftFuelKilometers(st.CarBase{}, fuel, number("kilometers")) != nil || fuel.Kilometers < 0 {
+			return errors.New("kilometers must be a whole number")
+		}
+		if c.setDraftFuelEuros(fuel, number("amount")) != nil || fuel.Cents < 0 {
+			return errors.New("amount must be a decimal number")
+		}
+		// the files without the column are full tanks
+		if fullTank := get("full_tank"); fullTank != "" && c.setDraftFuelFullTank(fuel, fullTank) != nil {
+			return errors.New("full_tank must be yes or no")
+		}
+		records.Fuels = append(records.Fuels, *fuel)
+	case carRecordService:
+		service := c.newDraftService(userID, carID, currency)
+		c.setDraftServiceTimestamp(service, timestamp)
+		c.setDraftServiceDescription(service, get("description"))
+		if service.Description == "" {
+			return errors.New("description is empty")
+		}
+		if c.setDraftServiceEuros(service, number("amount")) != nil || service.Cents < 0 {
+			return errors.New("amount must be a decimal number")
+		}
+		records.Services = append(records.Services, *service)
+	case carRecordLease:
+		lease := c.newDraftLease(userID, carID, currency)
+		c.setDraftLeaseTimestamp(lease, timestamp)
+		if description := get("description"); description != "" {
+			c.setDraftLeaseDescription(lease, description)
+		} else {
+			c.setDraftLeaseDescription(lease, "/skip")
+		}
+		if c.setDraftLeaseEuros(lease, number("amount")) != nil || lease.Cents < 0 {
+			return errors.New("amount must be a decimal number")
+		}
+		records.Leases = append(records.Leases, *lease)
+	default:
+		return fmt.Errorf("record must be one of %s, %s or %s", carRecordFuel, carRecordService, carRecordLease)
+	}
+
+	return nil
+}
+
+// skipExistingCarRecords drops the receipts which already exist, or repeat in the file, and returns how many were dropped.
+func (c *CarCommand) skipExistingCarRecords(ctx context.Context, userID int64, carID int64, records st.CarRecords) (st.CarRecords, int, error) {
+	fuels, err := c.storage.SelectFuelsFromDB(ctx, userID, carID)
+	if err != nil {
+		return records, 0, err
+	}
+	services, err := c.storage.SelectServicesFromDB(ctx, userID, carID)
+	if err != nil {
+		return records, 0, err
+	}
+	leases, err := c.storage.SelectLeasesFromDB(ctx, userID, carID)
+	if err != nil {
+		return records, 0, err
+	}
+
+	seen := map[carRecordKey]bool{}
+	for _, f := range fuels {
+		seen[carRecordKey{carRecordFuel, f.Timestamp, f.Kilometers, f.Cents}] = true
+	}
+	for _, s := range services {
+		seen[carRecordKey{carRecordService, s.Timestamp, 0, s.Cents}] = true
+	}
+	for _, l := range leases {
+		seen[carRecordKey{carRecordLease, l.Timestamp, 0, l.Cents}] = true
+	}
+
+	skipped := 0
+	isNew := func(key carRecordKey) bool {
+		if seen[key] {
+			skipped++
+			return false
+		}
+		seen[key] = true
+		return true
+	}
+	result := st.CarRecords{}
+	for _, f := range records.Fuels {
+		if isNew(carRecordKey{carRecordFuel, f.Timestamp, f.Kilometers, f.Cents}) {
+			result.Fuels = append(result.Fuels, f)
+		}
+	}
+	for _, s := range records.Services {
+		if isNew(carRecordKey{carRecordService, s.Timestamp, 0, s.Cents}) {
+			result.Services = append(result.Services, s)
+		}
+	}
+	for _, l := range records.Leases {
+		if isNew(carRecordKey{carRecordLease, l.Timestamp, 0, l.Cents}) {
+			result.Leases = append(result.Leases, l)
+		}
+	}
+	return result, skipped, nil
+}
+
+// formatAmounts sums the amounts by currency, e.g. "70.00€ + 12.00 CHF".
+func (c *CarCommand) formatAmounts(cents map[string]int64) string {
+	if len(cents) == 0 {
+		return c.formatMoney(0, st.BaseCurrency)
+	}
+	amounts := []string{}
+	for _, currency := range slices.Sorted(maps.Keys(cents)) {
+		amounts = append(amounts, c.formatMoney(float64(cents[currency])/100, currency))
+	}
+	return strings.Join(amounts, " + ")
+}
+
+func (c *CarCommand) formatCarImport(car st.CarDetails, records st.CarRecords, skipped int) string {
+	var liters int64
+	fuelCents, serviceCents, leaseCents := map[string]int64{}, map[string]int64{}, map[string]int64{}
+	var first, last int64
+	period := func(timestamp int64) {
+		if first == 0 || timestamp < first {
+			first = timestamp
+		}
+		last = max(last, timestamp)
+	}
+	for _, f := range records.Fuels {
+		liters, fuelCents[f.Currency] = liters+f.Milliliters, fuelCents[f.Currency]+f.Cents
+		period(f.Timestamp)
+	}
+	for _, s := range records.Services {
+		serviceCents[s.Currency] += s.Cents
+		period(s.Timestamp)
+	}
+	for _, l := range records.Leases {
+		leaseCents[l.Currency] += l.Cents
+		period(l.Timestamp)
+	}
+
+	str := fmt.Sprintf("📥 <b>Import into:</b> %s (%d)\n", _es(car.Name), car.Year)
+	str += fmt.Sprintf("⛽ <b>Fuel:</b> %d receipts, %s, %s\n", len(records.Fuels), c.formatVolume(car.VolumeUnit, liters), c.formatAmounts(fuelCents))
+	str += fmt.Sprintf("🛠️ <b>Service:</b> %d receipts, %s\n", len(records.Services), c.formatAmounts(serviceCents))
+	str += fmt.Sprintf("🧾 <b>Lease:</b> %d receipts, %s\n", len(records.Leases), c.formatAmounts(leaseCents))
+	str += fmt.Sprintf("📅 %s - %s\n", time.Unix(first, 0).UTC().Format("02 Jan 2006"), time.Unix(last, 0).UTC().Format("02 Jan 2006"))
+	if skipped > 0 {
+		str += fmt.Sprintf("⏭️ <b>Skipped:</b> %d receipts already exist\n", skipped)
+	}
+	str += "\nNothing has been saved yet, import the receipts?"
+	return str
+}
+
+func (c *CarCommand) importCarRecordsStart(ctx context.Context, pl Payload, carID int64) {
+	car, err := c.getEditableCar(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+	text := fmt.Sprintf("Please upload a CSV file with the receipts of %s (%d).\n\n", _es(car.Name), car.Year)
+	text += fmt.Sprintf("Expected columns: <code>%s</code>\n", strings.Join(carRecordsHeader, ","))
+	text += fmt.Sprintf("Dates are in YYYY-MM-DD format, liters and kilometers are metric, the rows without a currency are in %s. ", car.Currency)
+	text += "The exported files can be imported as is."
+	pl.ResultChan <- Result{Text: text, State: statef(c, stepCarImportFile), Draft: carImport{CarID: carID}}
+}
+
+func (c *CarCommand) importCarRecordsFile(ctx context.Context, pl Payload, draft *carImport) {
+	if pl.FileURL == "" {
+		pl.ResultChan <- Result{Text: "Please upload a CSV file.", State: statef(c, stepCarImportFile), Draft: draft}
+		return
+	}
+
+	car, err := c.getEditableCar(ctx, pl.UserID, draft.CarID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+
+	data, err := utils.DownloadBytes(ctx, pl.FileURL, carImportMaxBytes)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "Unable to download the file, please try again.", State: statef(c, stepCarImportFile), Draft: draft, Error: err}
+		return
+	}
+
+	records, errs := c.parseCarRecords(pl.UserID, draft.CarID, car.Currency, data)
+	if len(errs) > 0 {
+		text := fmt.Sprintf("Found %d invalid rows, please fix them and upload the file again:\n", len(errs))
+		for _, e := range errs[:min(len(errs), carImportMaxErrors)] {
+			text += "\n" + _es(e)
+		}
+		pl.ResultChan <- Result{Text: text, State: statef(c, stepCarImportFile), Draft: draft}
+		return
+	}
+
+	records, skipped, err := c.skipExistingCarRecords(ctx, pl.UserID, draft.CarID, records)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	if len(records.Fuels)+len(records.Services)+len(records.Leases) == 0 {
+		res := Result{Text: fmt.Sprintf("All the %d receipts already exist, nothing to import.", skipped), ClearState: true}
+		res.InlineMarkup.AddKeyboardButton("« Back to my car", commandf(c, cmdCarGet, draft.CarID))
+		pl.ResultChan <- res
+		return
+	}
+
+	draft.Records = records
+	res := Result{Text: c.formatCarImport(car, records, skipped), State: statef(c, stepCarImportConfirm), Draft: draft}
+	res.InlineMarkup.AddKeyboardButton("Yes, import", carImportYes)
+	res.InlineMarkup.AddKeyboardButton("Cancel", carImportNo)
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) importCarRecordsConfirm(ctx context.Context, pl Payload, draft *carImport) {
+	if pl.FileURL != "" {
+		c.importCarRecordsFile(ctx, pl, draft) // another file has been uploaded instead
+		return
+	}
+
+	res := Result{ClearState: true}
+	switch pl.Command {
+	case carImportYes:
+		if count, err := c.storage.InsertCarRecordsIntoDB(ctx, draft.Records); err != nil {
+			res.Text, res.Error = "There is something wrong, nothing has been imported.", err
+		} else {
+			res.Text = fmt.Sprintf("%d receipts have been successfully imported!", count)
+		}
+	case carImportNo:
+		res.Text = "Import has been cancelled."
+	default:
+		pl.ResultChan <- Result{Text: "Please confirm the import with the buttons above.", State: statef(c, stepCarImportConfirm), Draft: draft}
+		return
+	}
+	res.InlineMarkup.AddKeyboardButton("« Back to my car", commandf(c, cmdCarGet, draft.CarID))
+	pl.ResultChan <- res
+}
@@ -0,0 +1,210 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	st "mr-weasel/internal/storage"
+)
+
+var (
+	errCarReadOnly = errors.New("car is shared read-only")
+	errCarNotOwner = errors.New("car is owned by another user")
+)
+
+// getEditableCar returns the car if the user can change its receipts and maintenance plans, as the owner or an editor.
+func (c *CarCommand) getEditableCar(ctx context.Context, userID int64, carID int64) (st.CarDetails, error) {
+	car, err := c.storage.GetCarFromDB(ctx, userID, carID)
+	if err == nil && !car.CanEdit() {
+		err = errCarReadOnly
+	}
+	return car, err
+}
+
+// getOwnedCar returns the car if the user owns it, only the owner can change or share the car itself.
+func (c *CarCommand) getOwnedCar(ctx context.Context, userID int64, carID int64) (st.CarDetails, error) {
+	car, err := c.storage.GetCarFromDB(ctx, userID, carID)
+	if err == nil && !car.IsOwner() {
+		err = errCarNotOwner
+	}
+	return car, err
+}
+
+func (c *CarCommand) formatCarError(err error) string {
+	switch {
+	case errors.Is(err, errCarReadOnly):
+		return "You can only view this car, ask the owner for the editor access."
+	case errors.Is(err, errCarNotOwner):
+		return "Only the owner can change the car."
+	}
+	return "Car not found."
+}
+
+func (c *CarCommand) formatCarRole(role string) string {
+	switch role {
+	case st.CarRoleOwner:
+		return "Owner"
+	case st.CarRoleEditor:
+		return "Editor"
+	}
+	return "Viewer"
+}
+
+// formatUserName falls back to the user ID, the contacts are only known by name after they start the bot.
+func (c *CarCommand) formatUserName(userID int64, name string) string {
+	if name == "" {
+		return fmt.Sprintf("User %d", userID)
+	}
+	return name
+}
+
+func (c *CarCommand) showCarAccess(ctx context.Context, pl Payload, carID int64) {
+	car, err := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "Car not found.", Error: err}
+		return
+	}
+
+	res := Result{Text: fmt.Sprintf("👥 <b>Sharing:</b> %s (%d)\n\n", _es(car.Name), car.Year)}
+	if !car.IsOwner() {
+		res.Text += fmt.Sprintf("The car is shared with you, your access is %s.", c.formatCarRole(car.Role))
+		res.InlineMarkup.AddKeyboardButton("Leave", commandf(c, cmdCarAccessDel, carID, pl.UserID))
+		res.InlineMarkup.AddKeyboardRow()
+		res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("« Back to %s (%d)", car.Name, car.Year), commandf(c, cmdCarGet, carID))
+		pl.ResultChan <- res
+		return
+	}
+
+	access, err := c.storage.SelectCarAccessFromDB(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	if len(access) == 0 {
+		res.Text += "The car is not shared yet.\n"
+	}
+	for _, a := range access {
+		name := c.formatUserName(a.UserID, a.Name)
+		res.Text += fmt.Sprintf("👤 %s (%s)\n", _es(name), c.formatCarRole(a.Role))
+		res.InlineMarkup.AddKeyboardButton("Revoke "+name, commandf(c, cmdCarAccessDel, carID, a.UserID))
+		res.InlineMarkup.AddKeyboardRow()
+	}
+	res.Text += "\nThe editors can add the receipts and the maintenance plans, the viewers can only see them. "
+	res.Text += "Share the car again to change the access."
+	if pl.IsPrivate {
+		res.InlineMarkup.AddKeyboardButton("Share as Editor", commandf(c, cmdCarAccessAdd, carID, st.CarRoleEditor))
+		res.InlineMarkup.AddKeyboardButton("Share as Viewer", commandf(c, cmdCarAccessAdd, carID, st.CarRoleViewer))
+		res.InlineMarkup.AddKeyboardRow()
+	}
+	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("« Back to %s (%d)", car.Name, car.Year), commandf(c, cmdCarGet, carID))
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) addCarAccessStart(ctx context.Context, pl Payload, carID int64, role string) {
+	if _, err := c.getOwnedCar(ctx, pl.UserID, carID); err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+	if role != st.CarRoleEditor {
+		role = st.CarRoleViewer
+	}
+
+	res := Result{
+		Text:  "Select the contact with whom you would like to share the car. Use the button below the keyboard.",
+		State: statef(c, stepCarAccessUser, carID, role),
+	}
+	res.ReplyMarkup.AddRequestUserButton()
+	res.ReplyMarkup.AddKeyboardRow()
+	res.ReplyMarkup.AddButton("Close")
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) addCarAccessUser(ctx context.Context, pl Payload, carID int64, role string) {
+	if pl.Command == "Close" {
+		res := Result{Text: "Done!"}
+		res.RemoveMarkup.RemoveDefault()
+		pl.ResultChan <- res
+		return
+	}
+
+	accessUserID, err := strconv.ParseInt(pl.Command, 10, 64)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "You need to select the contact with button below.", State: statef(c, stepCarAccessUser, carID, role)}
+		return
+	}
+	if accessUserID == pl.UserID {
+		pl.ResultChan <- Result{Text: "You already own the car, please select another contact.", State: statef(c, stepCarAccessUser, carID, role)}
+		return
+	}
+
+	access := st.CarAccess{CarID: carID, UserID: accessUserID, Role: role}
+	if _, err := c.storage.UpsertCarAccessIntoDB(ctx, pl.UserID, access); err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", State: statef(c, stepCarAccessUser, carID, role), Error: err}
+		return
+	}
+
+	res := Result{Text: fmt.Sprintf("The car has been successfully shared as %s! The contact has to start the bot to see it.", c.formatCarRole(role))}
+	res.RemoveMarkup.RemoveDefault()
+	pl.ResultChan <- res
+	c.showCarAccess(ctx, pl, carID)
+}
+
+// deleteCarAccess revokes the access of the user, the owner revokes the others and the others can leave.
+func (c *CarCommand) deleteCarAccess(ctx context.Context, pl Payload, carID int64, accessUserID int64) {
+	res := Result{}
+	affected, err := c.storage.DeleteCarAccessFromDB(ctx, pl.UserID, carID, accessUserID)
+	if err != nil || affected != 1 {
+		res.Text, res.Error = "Access not found.", err
+		res.InlineMarkup.AddKeyboardButton("« Back to my cars", c.Prefix())
+	} else if accessUserID == pl.UserID {
+		res.Text = "You have left the car."
+		res.InlineMarkup.AddKeyboardButton("« Back to my cars", c.Prefix())
+	} else {
+		res.Text = "Access has been successfully revoked!"
+		res.InlineMarkup.AddKeyboardButton("« Back to sharing", commandf(c, cmdCarAccess, carID))
+	}
+	pl.ResultChan <- res
+}
+
+func (c *CarCommand) formatCarDrivers(car st.CarDetails, drivers []st.CarDriverSpend) string {
+	total := 0.0
+	for _, d := range drivers {
+		total += d.GetAmount()
+	}
+
+	str := fmt.Sprintf("👥 <b>Drivers:</b> %s (%d)\n", _es(car.Name), car.Year)
+	for _, d := range drivers {
+		share := 0.0
+		if total > 0 {
+			share = d.GetAmount() / total * 100
+		}
+		str += fmt.Sprintf("\n👤 <b>%s:</b> %s (%.0f%%, %d receipts)\n", _es(c.formatUserName(d.UserID, d.Name)), c.formatMoney(d.GetAmount(), car.Currency), share, d.Receipts)
+		str += fmt.Sprintf("⛽ %s (%s)\n", c.formatMoney(float64(d.FuelCents)/100, car.Currency), c.formatVolume(car.VolumeUnit, d.Milliliters))
+		str += fmt.Sprintf("🛠️ %s\n", c.formatMoney(float64(d.ServiceCents)/100, car.Currency))
+		str += fmt.Sprintf("🧾 %s\n", c.formatMoney(float64(d.LeaseCents)/100, car.Currency))
+	}
+	return str
+}
+
+func (c *CarCommand) showCarDrivers(ctx context.Context, pl Payload, carID int64) {
+	car, err := c.storage.GetCarFromDB(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "Car not found.", Error: err}
+		return
+	}
+
+	res := Result{}
+	drivers, err := c.storage.SelectCarSpendByUserFromDB(ctx, pl.UserID, carID)
+	if err != nil {
+		res.Text, res.Error = "There is something wrong, please try again.", err
+	} else if len(drivers) == 0 {
+		res.Text = "No receipts found."
+	} else {
+		res.Text = c.formatCarDrivers(car, drivers)
+	}
+	res.InlineMarkup.AddKeyboardButton("« Back to stats", commandf(c, cmdCarStats, carID, carStatsMonth, 0))
+	pl.ResultChan <- res
+}
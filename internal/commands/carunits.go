@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	st "mr-weasel/internal/storage"
+)
+
+// The receipts are stored in kilometers and milliliters, the miles and the US gallons are only used for the input and the output.
+const (
+	kilometersPerMile = 1.609344
+	litersPerGallon   = 3.785411784
+)
+
+func (c *CarCommand) distanceSymbol(unit string) string {
+	if unit == st.DistanceMiles {
+		return "mi"
+	}
+	return "Km"
+}
+
+func (c *CarCommand) distanceName(unit string) string {
+	if unit == st.DistanceMiles {
+		return "Miles"
+	}
+	return "Kilometers"
+}
+
+func (c *CarCommand) volumeSymbol(unit string) string {
+	if unit == st.VolumeGallons {
+		return "gal"
+	}
+	return "L"
+}
+
+func (c *CarCommand) volumeName(unit string) string {
+	if unit == st.VolumeGallons {
+		return "Gallons"
+	}
+	return "Liters"
+}
+
+// toDistance converts the kilometers into the unit, rounded to the whole number.
+func (c *CarCommand) toDistance(unit string, kilometers int64) int64 {
+	if unit == st.DistanceMiles {
+		return int64(math.Round(float64(kilometers) / kilometersPerMile))
+	}
+	return kilometers
+}
+
+func (c *CarCommand) toVolume(unit string, milliliters int64) float64 {
+	if unit == st.VolumeGallons {
+		return float64(milliliters) / 1000 / litersPerGallon
+	}
+	return float64(milliliters) / 1000
+}
+
+func (c *CarCommand) formatDistance(unit string, kilometers int64) string {
+	return fmt.Sprintf("%d%s", c.toDistance(unit, kilometers), c.distanceSymbol(unit))
+}
+
+func (c *CarCommand) formatVolume(unit string, milliliters int64) string {
+	return fmt.Sprintf("%.2f%s", c.toVolume(unit, milliliters), c.volumeSymbol(unit))
+}
+
+// parseDistance reads the whole number in the unit, and returns it in kilometers.
+func (c *CarCommand) parseDistance(unit string, input string) (int64, error) {
+	distance, err := strconv.Atoi(input)
+	if unit == st.DistanceMiles {
+		return int64(math.Round(float64(distance) * kilometersPerMile)), err
+	}
+	return int64(distance), err
+}
+
+// parseVolume reads the decimal number in the unit, and returns it in milliliters.
+func (c *CarCommand) parseVolume(unit string, input string) (int64, error) {
+	volume, err := strconv.ParseFloat(input, 64)
+	if unit == st.VolumeGallons {
+		volume *= litersPerGallon
+	}
+	return int64(math.Round(volume * 1000)), err
+}
+
+// isMPG reports whether the consumption of the car is shown in miles per gallon instead of L/100Km.
+func (c *CarCommand) isMPG(car st.CarBase) bool {
+	return car.DistanceUnit == st.DistanceMiles && car.VolumeUnit == st.VolumeGallons
+}
+
+func (c *CarCommand) consumptionSymbol(car st.CarBase) string {
+	if c.isMPG(car) {
+		return "MPG"
+	}
+	return "L/100Km"
+}
+
+// toConsumption converts L/100Km into the consumption unit of the car, 0 stays 0 as the unknown consumption.
+func (c *CarCommand) toConsumption(car st.CarBase, litersPer100 float64) float64 {
+	if c.isMPG(car) && litersPer100 > 0 {
+		return 100 * litersPerGallon / kilometersPerMile / litersPer100
+	}
+	return litersPer100
+}
+
+func (c *CarCommand) formatConsumption(car st.CarBase, litersPer100 float64) string {
+	return fmt.Sprintf("%.2f%s", c.toConsumption(car, litersPer100), c.consumptionSymbol(car))
+}
+
+// formatPerVolume formats the price per liter in the volume unit, e.g. "1.79€/L".
+func (c *CarCommand) formatPerVolume(unit string, perLiter float64, currency string) string {
+	if unit == st.VolumeGallons {
+		perLiter *= litersPerGallon
+	}
+	return c.formatMoney(perLiter, currency) + "/" + c.volumeSymbol(unit)
+}
+
+// formatPerDistance formats the cost per kilometer in the distance unit, e.g. "0.12€/Km".
+func (c *CarCommand) formatPerDistance(unit string, perKilometer float64, currency string) string {
+	if unit == st.DistanceMiles {
+		perKilometer *= kilometersPerMile
+	}
+	return c.formatMoney(perKilometer, currency) + "/" + c.distanceSymbol(unit)
+}
+
+// updateCarToggleDistance switches the car between kilometers and miles, the receipts are not changed.
+func (c *CarCommand) updateCarToggleDistance(ctx context.Context, pl Payload, carID int64) {
+	car, err := c.getOwnedCar(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+	if car.DistanceUnit == st.DistanceMiles {
+		car.DistanceUnit = st.DistanceKilometers
+	} else {
+		car.DistanceUnit = st.DistanceMiles
+	}
+	text := fmt.Sprintf("Car distances are now in %s!", c.distanceName(car.DistanceUnit))
+	c.updateCarSave(ctx, pl, &car.CarBase, text)
+}
+
+// updateCarToggleVolume switches the car between liters and gallons, the receipts are not changed.
+func (c *CarCommand) updateCarToggleVolume(ctx context.Context, pl Payload, carID int64) {
+	car, err := c.getOwnedCar(ctx, pl.UserID, carID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: c.formatCarError(err), Error: err}
+		return
+	}
+	if car.VolumeUnit == st.VolumeGallons {
+		car.VolumeUnit = st.VolumeLiters
+	} else {
+		car.VolumeUnit = st.VolumeGallons
+	}
+	text := fmt.Sprintf("Car fuel amounts are now in %s!", c.volumeName(car.VolumeUnit))
+	c.updateCarSave(ctx, pl, &car.CarBase, text)
+}
@@ -5,28 +5,29 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
-	"mr-weasel/internal/lib/queue"
+	"mr-weasel/internal/queue"
 	st "mr-weasel/internal/storage"
 	"mr-weasel/internal/utils"
+	"mr-weasel/internal/worker"
 )
 
 type ChangeVoiceCommand struct {
-	storage   *st.RvcStorage
-	queue     *queue.Queue
-	separator *utils.AudioSeparator
-	changer   *utils.VoiceChanger
+	storage *st.RvcStorage
+	queue   *queue.Queue
+	runner  worker.Runner
 }
 
-func NewChangeVoiceCommand(storage *st.RvcStorage, queue *queue.Queue, separator *utils.AudioSeparator, changer *utils.VoiceChanger) *ChangeVoiceCommand {
+func NewChangeVoiceCommand(storage *st.RvcStorage, queue *queue.Queue, runner worker.Runner) *ChangeVoiceCommand {
 	return &ChangeVoiceCommand{
-		storage:   storage,
-		queue:     queue,
-		separator: separator,
-		changer:   changer,
+		storage: storage,
+		queue:   queue,
+		runner:  runner,
 	}
 }
 
@@ -38,6 +39,11 @@ func (ChangeVoiceCommand) Description() string {
 	return "train and change voices"
 }
 
+func (c *ChangeVoiceCommand) Requirements() []utils.Requirement {
+	requirements := []utils.Requirement{utils.RequireBinary("yt-dlp"), utils.RequireBinary("ffmpeg")}
+	return append(requirements, c.runner.Requirements()...)
+}
+
 const (
 	cmdChangeVoiceExperimentGet = "experiment_get"
 	cmdChangeVoiceModelGet      = "model_get"
@@ -58,6 +64,13 @@ const (
 	cmdChangeVoiceStart         = "start"
 )
 
+const (
+	stepChangeVoiceAudioSource  = "audio_source"
+	stepChangeVoiceModelName    = "model_name"
+	stepChangeVoiceModelDataset = "model_dataset"
+	stepChangeVoiceAccessUser   = "access_user"
+)
+
 func (c *ChangeVoiceCommand) Execute(ctx context.Context, pl Payload) {
 	args := splitCommand(pl.Command, c.Prefix())
 	switch safeGet(args, 0) {
@@ -100,6 +113,20 @@ func (c *ChangeVoiceCommand) Execute(ctx context.Context, pl Payload) {
 	}
 }
 
+func (c *ChangeVoiceCommand) Resume(ctx context.Context, pl Payload) {
+	args := splitCommand(pl.State, c.Prefix())
+	switch safeGet(args, 0) {
+	case stepChangeVoiceAudioSource:
+		c.setExperimentAudioSource(ctx, pl, safeGetInt64(args, 1))
+	case stepChangeVoiceModelName:
+		c.addModelNameAndSave(ctx, pl, safeGetInt64(args, 1))
+	case stepChangeVoiceModelDataset:
+		c.addModelDatasetFile(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	case stepChangeVoiceAccessUser:
+		c.addAccessUser(ctx, pl, safeGetInt64(args, 1), safeGetInt64(args, 2))
+	}
+}
+
 func (c *ChangeVoiceCommand) newExperiment(ctx context.Context, pl Payload) {
 	experimentID, err := c.storage.InsertNewExperimentIntoDB(ctx, pl.UserID)
 	if err != nil {
@@ -196,7 +223,7 @@ func (c *ChangeVoiceCommand) showModelDetails(ctx context.Context, pl Payload, e
 func (c *ChangeVoiceCommand) selectAudio(ctx context.Context, pl Payload, experimentID int64) {
 	res := Result{
 		Text:  "Send me the a YouTube link, a song file, or record a new voice message!",
-		State: func(ctx context.Context, pl Payload) { c.setExperimentAudioSource(ctx, pl, experimentID) },
+		State: statef(c, stepChangeVoiceAudioSource, experimentID),
 	}
 	res.InlineMarkup.AddKeyboardButton("« Back", commandf(c, cmdChangeVoiceExperimentGet, experimentID))
 	pl.ResultChan <- res
@@ -215,7 +242,7 @@ func (c *ChangeVoiceCommand) setExperimentAudioSource(ctx context.Context, pl Pa
 	} else if err != nil {
 		res = Result{
 			Text:  "Whoops, download failed, try again :c",
-			State: func(ctx context.Context, pl Payload) { c.setExperimentAudioSource(ctx, pl, experimentID) },
+			State: statef(c, stepChangeVoiceAudioSource, experimentID),
 			Error: err,
 		}
 		res.InlineMarkup.AddKeyboardRow()
@@ -283,7 +310,7 @@ func (c *ChangeVoiceCommand) setExperimentTranspose(ctx context.Context, pl Payl
 func (c *ChangeVoiceCommand) addModelStart(ctx context.Context, pl Payload, experimentID int64) {
 	pl.ResultChan <- Result{
 		Text:  "Let's create a new voice model. How should we name it?",
-		State: func(ctx context.Context, pl Payload) { c.addModelNameAndSave(ctx, pl, experimentID) },
+		State: statef(c, stepChangeVoiceModelName, experimentID),
 	}
 }
 
@@ -300,7 +327,7 @@ func (c *ChangeVoiceCommand) addModelNameAndSave(ctx context.Context, pl Payload
 		msg += fmt.Sprintf("When you are ready, just send /done command!")
 		pl.ResultChan <- Result{
 			Text:  msg,
-			State: func(ctx context.Context, pl Payload) { c.addModelDatasetFile(ctx, pl, experimentID, modelID) },
+			State: statef(c, stepChangeVoiceModelDataset, experimentID, modelID),
 		}
 	}
 }
@@ -315,16 +342,16 @@ func (c *ChangeVoiceCommand) addModelDatasetFile(ctx context.Context, pl Payload
 	if err != nil {
 		pl.ResultChan <- Result{
 			Text:  "Whoops, download failed, try again :c",
-			State: func(ctx context.Context, pl Payload) { c.addModelDatasetFile(ctx, pl, experimentID, modelID) },
+			State: statef(c, stepChangeVoiceModelDataset, experimentID, modelID),
 			Error: err,
 		}
 	} else {
-		// Move downloaded file to the datasets directory
-		os.MkdirAll(filepath.Join(c.changer.PathDatasets, fmt.Sprint(modelID)), os.ModePerm)
-		utils.MoveCrossDevice(downloadedFile.Path, filepath.Join(c.changer.PathDatasets, fmt.Sprint(modelID), filepath.Base(downloadedFile.Path)))
+		// Move downloaded file to the datasets directory, it is sent to the worker before training
+		os.MkdirAll(utils.GetDatasetFolderPath(modelID), os.ModePerm)
+		utils.MoveCrossDevice(downloadedFile.Path, filepath.Join(utils.GetDatasetFolderPath(modelID), filepath.Base(downloadedFile.Path)))
 		pl.ResultChan <- Result{
 			Text:  fmt.Sprintf("<b>%s</b> has been imported!", _es(downloadedFile.Name)),
-			State: func(ctx context.Context, pl Payload) { c.addModelDatasetFile(ctx, pl, experimentID, modelID) },
+			State: statef(c, stepChangeVoiceModelDataset, experimentID, modelID),
 		}
 	}
 }
@@ -332,7 +359,7 @@ func (c *ChangeVoiceCommand) addModelDatasetFile(ctx context.Context, pl Payload
 func (c *ChangeVoiceCommand) addAccessStart(ctx context.Context, pl Payload, experimentID int64, modelID int64) {
 	res := Result{
 		Text:  "Select the contact with whom you would like to share the selected model. Use the button below the keyboard.",
-		State: func(ctx context.Context, pl Payload) { c.addAccessUser(ctx, pl, experimentID, modelID) },
+		State: statef(c, stepChangeVoiceAccessUser, experimentID, modelID),
 	}
 	res.ReplyMarkup.AddRequestUserButton()
 	res.ReplyMarkup.AddKeyboardRow()
@@ -352,7 +379,7 @@ func (c *ChangeVoiceCommand) addAccessUser(ctx context.Context, pl Payload, expe
 	if err != nil {
 		pl.ResultChan <- Result{
 			Text:  "You need to select the contact with button below.",
-			State: func(ctx context.Context, pl Payload) { c.addAccessUser(ctx, pl, experimentID, modelID) },
+			State: statef(c, stepChangeVoiceAccessUser, experimentID, modelID),
 			Error: err,
 		}
 		return
@@ -362,7 +389,7 @@ func (c *ChangeVoiceCommand) addAccessUser(ctx context.Context, pl Payload, expe
 	if err != nil {
 		pl.ResultChan <- Result{
 			Text:  "There is something wrong, please try again.",
-			State: func(ctx context.Context, pl Payload) { c.addAccessUser(ctx, pl, experimentID, modelID) },
+			State: statef(c, stepChangeVoiceAccessUser, experimentID, modelID),
 			Error: err,
 		}
 	}
@@ -380,15 +407,29 @@ func (c *ChangeVoiceCommand) deleteModelAsk(ctx context.Context, pl Payload, exp
 
 func (c *ChangeVoiceCommand) deleteModelConfirm(ctx context.Context, pl Payload, experimentID int64, modelID int64) {
 	res := Result{}
+	res.InlineMarkup.AddKeyboardButton("« Back to my models", commandf(c, cmdChangeVoiceModelGet, experimentID))
 	affected, err := c.storage.DeleteModelFromDB(ctx, pl.UserID, modelID)
 	if err != nil || affected != 1 {
 		res.Text, res.Error = "Model not found.", err
-	} else {
-		res.Text = "Model has been successfully deleted!"
-		c.changer.DeleteAll(modelID)
+		pl.ResultChan <- res
+		return
 	}
-	res.InlineMarkup.AddKeyboardButton("« Back to my models", commandf(c, cmdChangeVoiceModelGet, experimentID))
+
+	res.Text = "Model has been successfully deleted!"
 	pl.ResultChan <- res
+
+	// the trained model is removed by the worker on a best-effort basis, without holding the execution
+	os.RemoveAll(utils.GetDatasetFolderPath(modelID))
+	job := worker.NewJob(worker.KindDelete, map[string]string{"model_id": fmt.Sprint(modelID)}, nil)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		defer cancel()
+		_, release, err := c.runner.Run(ctx, job, nil, func(string) {})
+		release()
+		if err != nil {
+			log.Printf("[ERROR] Unable to delete model %d on the worker: %s\n", modelID, err)
+		}
+	}()
 }
 
 func (c *ChangeVoiceCommand) deleteAccessConfirm(ctx context.Context, pl Payload, experimentID int64, modelID int64) {
@@ -419,119 +460,158 @@ func (c *ChangeVoiceCommand) startProcessing(ctx context.Context, pl Payload, ex
 	res.InlineMarkup.AddKeyboardButton("Cancel", cancelf(ctx))
 	pl.ResultChan <- res
 
-	if c.queue.Lock(ctx) {
-		defer c.queue.Unlock()
-		c.processExperiment(ctx, pl, experiment)
-	} else {
-		res = Result{}
-		res.InlineMarkup.AddKeyboardButton("Retry", commandf(c, cmdChangeVoiceStart, experimentID))
-		pl.ResultChan <- res
-		if !errors.Is(ctx.Err(), context.Canceled) {
-			pl.ResultChan <- Result{Text: "There are too many queued jobs, please wait."}
-		}
+	ticket := waitQueue(ctx, pl, c.queue, commandf(c, cmdChangeVoiceStart, experimentID))
+	if ticket == nil {
+		return
 	}
+	defer func() { c.queue.Done(ticket, err) }()
+
+	err = c.processExperiment(ctx, pl, experiment)
 }
 
-func (c *ChangeVoiceCommand) processExperiment(ctx context.Context, pl Payload, experiment st.RvcExperimentDetails) {
-	res := Result{}
-	res.InlineMarkup.AddKeyboardButton("Starting...", "-")
-	res.InlineMarkup.AddKeyboardRow()
-	res.InlineMarkup.AddKeyboardButton("Cancel", cancelf(ctx))
-	pl.ResultChan <- res
+func (c *ChangeVoiceCommand) processExperiment(ctx context.Context, pl Payload, experiment st.RvcExperimentDetails) error {
+	progress := func(status string) {
+		res := Result{}
+		res.InlineMarkup.AddKeyboardButton(status, "-")
+		res.InlineMarkup.AddKeyboardRow()
+		res.InlineMarkup.AddKeyboardButton("Cancel", cancelf(ctx))
+		pl.ResultChan <- res
+	}
+
+	progress("Starting...")
 
 	audioFile, err := utils.GetDownloadedFile(experiment.Audio.String)
 	if err != nil {
 		c.showExperimentDetails(ctx, pl, experiment.ID)
 		pl.ResultChan <- Result{Text: "There is a problem with audio file, please try to reupload.", Error: err}
-		return
+		return err
 	}
 
-	var uvrFiles utils.AudioSeparatorResult
+	musicPath, voicePath := "", audioFile.Path
+
+	// the artifacts are removed once the audio is sent, or right away if it is not
+	releases := []func(){}
+	defer func() { releaseAll(releases)() }()
 
 	if experiment.SeparateUVR.Bool {
-		res = Result{}
-		res.InlineMarkup.AddKeyboardButton("Splitting audio...", "-")
-		res.InlineMarkup.AddKeyboardRow()
-		res.InlineMarkup.AddKeyboardButton("Cancel", cancelf(ctx))
-		pl.ResultChan <- res
+		inputs := map[string]string{"audio": audioFile.Path}
+		job := worker.NewJob(worker.KindSeparate, map[string]string{"name": audioFile.Name}, inputs)
 
-		uvrFiles, err = c.separator.Run(ctx, audioFile)
+		artifacts, release, err := c.runner.Run(ctx, job, inputs, progress)
+		releases = append(releases, release)
 		if errors.Is(err, context.Canceled) {
 			c.showExperimentDetails(context.WithoutCancel(ctx), pl, experiment.ID)
-			return
+			return err
 		} else if err != nil {
 			c.showExperimentDetails(ctx, pl, experiment.ID)
 			pl.ResultChan <- Result{Text: "There is a problem with audio separation, please try again.", Error: err}
-			return
+			return err
 		}
-	}
 
-	if !c.changer.IsTrained(experiment.ModelID.Int64) {
-		res = Result{}
-		res.InlineMarkup.AddKeyboardButton("Training new model...", "-")
-		res.InlineMarkup.AddKeyboardRow()
-		res.InlineMarkup.AddKeyboardButton("Cancel", cancelf(ctx))
-		pl.ResultChan <- res
-
-		err = c.changer.RunTrain(ctx, experiment)
-		if errors.Is(err, context.Canceled) {
-			c.showExperimentDetails(context.WithoutCancel(ctx), pl, experiment.ID)
-			return
-		} else if err != nil {
-			c.showExperimentDetails(ctx, pl, experiment.ID)
-			pl.ResultChan <- Result{Text: "There is a problem with model training, please try again.", Error: err}
-			return
-		}
+		musicPath, voicePath = artifacts["music"].Path, artifacts["voice"].Path
 	}
 
-	var inferFile utils.VoiceChangerResult
+	// the worker skips training when the model is already trained
+	inputs, err := datasetInputs(experiment.ModelID.Int64)
+	if err != nil {
+		c.showExperimentDetails(ctx, pl, experiment.ID)
+		pl.ResultChan <- Result{Text: "There is a problem with model dataset, please try again.", Error: err}
+		return err
+	}
 
-	res = Result{}
-	res.InlineMarkup.AddKeyboardButton("Changing voice...", "-")
-	res.InlineMarkup.AddKeyboardRow()
-	res.InlineMarkup.AddKeyboardButton("Cancel", cancelf(ctx))
-	pl.ResultChan <- res
+	job := worker.NewJob(worker.KindTrain, map[string]string{"model_id": fmt.Sprint(experiment.ModelID.Int64)}, inputs)
 
-	if experiment.SeparateUVR.Bool {
-		inferFile, err = c.changer.RunInfer(ctx, experiment, uvrFiles.VoicePath)
-	} else {
-		inferFile, err = c.changer.RunInfer(ctx, experiment, audioFile.Path)
+	_, release, err := c.runner.Run(ctx, job, inputs, progress)
+	releases = append(releases, release)
+	if errors.Is(err, context.Canceled) {
+		c.showExperimentDetails(context.WithoutCancel(ctx), pl, experiment.ID)
+		return err
+	} else if err != nil {
+		c.showExperimentDetails(ctx, pl, experiment.ID)
+		pl.ResultChan <- Result{Text: "There is a problem with model training, please try again.", Error: err}
+		return err
 	}
 
+	inputs = map[string]string{"voice": voicePath}
+	job = worker.NewJob(worker.KindInfer, map[string]string{
+		"model_id":   fmt.Sprint(experiment.ModelID.Int64),
+		"model_name": experiment.ModelName.String,
+		"transpose":  fmt.Sprint(experiment.Transpose.Int64),
+		"name":       audioFile.Name,
+	}, inputs)
+
+	artifacts, release, err := c.runner.Run(ctx, job, inputs, progress)
+	releases = append(releases, release)
 	if errors.Is(err, context.Canceled) {
 		c.showExperimentDetails(context.WithoutCancel(ctx), pl, experiment.ID)
-		return
+		return err
 	} else if err != nil {
 		c.showExperimentDetails(ctx, pl, experiment.ID)
 		pl.ResultChan <- Result{Text: "There is a problem with model infer, please try again.", Error: err}
-		return
+		return err
 	}
 
+	inferFile := artifacts["voice"]
+
 	if experiment.SeparateUVR.Bool {
-		mixFile, err := c.changer.RunMix(ctx, uvrFiles.MusicPath, inferFile.Path)
+		inputs = map[string]string{"music": musicPath, "voice": inferFile.Path}
+		job = worker.NewJob(worker.KindMix, nil, inputs)
+
+		artifacts, release, err := c.runner.Run(ctx, job, inputs, progress)
+		releases = append(releases, release)
 		if err != nil {
 			c.showExperimentDetails(ctx, pl, experiment.ID)
 			pl.ResultChan <- Result{
-				Audio: map[string]string{
-					// uvrFiles.MusicName: uvrFiles.MusicPath,
-					// uvrFiles.VoiceName: uvrFiles.VoicePath,
-					inferFile.Name: inferFile.Path,
-				},
-				Error: err,
+				Audio:   map[string]string{inferFile.Name: inferFile.Path},
+				Release: releaseAll(releases),
+				Error:   err,
 			}
+			releases = nil
+			return err
 		} else {
+			mixFile := artifacts["mix"]
 			c.showExperimentDetails(ctx, pl, experiment.ID)
 			pl.ResultChan <- Result{
 				Audio: map[string]string{
-					// uvrFiles.MusicName:     uvrFiles.MusicPath,
-					// uvrFiles.VoiceName:     uvrFiles.VoicePath,
 					inferFile.Name: inferFile.Path,
 					mixFile.Name:   mixFile.Path,
 				},
+				Release: releaseAll(releases),
 			}
+			releases = nil
 		}
 	} else {
 		c.showExperimentDetails(ctx, pl, experiment.ID)
-		pl.ResultChan <- Result{Audio: map[string]string{inferFile.Name: inferFile.Path}}
+		pl.ResultChan <- Result{Audio: map[string]string{inferFile.Name: inferFile.Path}, Release: releaseAll(releases)}
+		releases = nil
+	}
+	return nil
+}
+
+// releaseAll combines the release funcs of the jobs, see worker.Runner.
+func releaseAll(releases []func()) func() {
+	return func() {
+		for _, release := range releases {
+			release()
+		}
+	}
+}
+
+// datasetInputs returns the uploaded voice samples of the model as the train job inputs.
+func datasetInputs(modelID int64) (map[string]string, error) {
+	inputs := make(map[string]string)
+
+	entries, err := os.ReadDir(utils.GetDatasetFolderPath(modelID))
+	if errors.Is(err, os.ErrNotExist) {
+		return inputs, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for i, entry := range entries {
+		if !entry.IsDir() {
+			inputs[fmt.Sprintf("dataset_%d", i)] = filepath.Join(utils.GetDatasetFolderPath(modelID), entry.Name())
+		}
 	}
+	return inputs, nil
 }
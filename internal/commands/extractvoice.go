@@ -6,17 +6,18 @@ import (
 	"fmt"
 	"strings"
 
-	"mr-weasel/internal/lib/queue"
+	"mr-weasel/internal/queue"
 	"mr-weasel/internal/utils"
+	"mr-weasel/internal/worker"
 )
 
 type ExtractVoiceCommand struct {
-	queue     *queue.Queue
-	separator *utils.AudioSeparator
+	queue  *queue.Queue
+	runner worker.Runner
 }
 
-func NewExtractVoiceCommand(queue *queue.Queue, separator *utils.AudioSeparator) *ExtractVoiceCommand {
-	return &ExtractVoiceCommand{queue: queue, separator: separator}
+func NewExtractVoiceCommand(queue *queue.Queue, runner worker.Runner) *ExtractVoiceCommand {
+	return &ExtractVoiceCommand{queue: queue, runner: runner}
 }
 
 func (ExtractVoiceCommand) Prefix() string {
@@ -27,17 +28,34 @@ func (ExtractVoiceCommand) Description() string {
 	return "separate voice and music"
 }
 
+func (c *ExtractVoiceCommand) Requirements() []utils.Requirement {
+	requirements := []utils.Requirement{utils.RequireBinary("yt-dlp"), utils.RequireBinary("ffmpeg")}
+	return append(requirements, c.runner.Requirements()...)
+}
+
 const (
 	cmdExtractVoiceStart = "start"
 )
 
+const (
+	stepExtractVoiceDownload = "download"
+)
+
 func (c *ExtractVoiceCommand) Execute(ctx context.Context, pl Payload) {
 	args := splitCommand(pl.Command, c.Prefix())
 	switch safeGet(args, 0) {
 	case cmdExtractVoiceStart:
 		c.startProcessing(ctx, pl, strings.Join(args[1:], " "))
 	default:
-		pl.ResultChan <- Result{Text: "Sure! Send me a YouTube link or song file!", State: c.downloadSong}
+		pl.ResultChan <- Result{Text: "Sure! Send me a YouTube link or song file!", State: statef(c, stepExtractVoiceDownload)}
+	}
+}
+
+func (c *ExtractVoiceCommand) Resume(ctx context.Context, pl Payload) {
+	args := splitCommand(pl.State, c.Prefix())
+	switch safeGet(args, 0) {
+	case stepExtractVoiceDownload:
+		c.downloadSong(ctx, pl)
 	}
 }
 
@@ -50,16 +68,16 @@ func (c *ExtractVoiceCommand) downloadSong(ctx context.Context, pl Payload) {
 
 	downloadedFile, err := utils.Download(ctx, pl.FileURL, pl.Command)
 	if errors.Is(err, context.Canceled) {
-		res = Result{Text: "Download cancelled, you can send another song.", State: c.downloadSong, Error: err}
+		res = Result{Text: "Download cancelled, you can send another song.", State: statef(c, stepExtractVoiceDownload), Error: err}
 		res.InlineMarkup.AddKeyboardRow()
 		pl.ResultChan <- res
 	} else if err != nil {
-		res = Result{Text: "Whoops, download failed, try again :c", State: c.downloadSong, Error: err}
+		res = Result{Text: "Whoops, download failed, try again :c", State: statef(c, stepExtractVoiceDownload), Error: err}
 		res.InlineMarkup.AddKeyboardRow()
 		pl.ResultChan <- res
 	} else {
 		res = Result{Text: fmt.Sprintf("📂 %s\n", _es(downloadedFile.Name))}
-		res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("Start Processing %s", c.separator.Mode), commandf(c, cmdExtractVoiceStart, downloadedFile.ID))
+		res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("Start Processing %s", c.runner.Name()), commandf(c, cmdExtractVoiceStart, downloadedFile.ID))
 		pl.ResultChan <- res
 	}
 }
@@ -76,51 +94,57 @@ func (c *ExtractVoiceCommand) startProcessing(ctx context.Context, pl Payload, u
 		res := Result{}
 		res.InlineMarkup.AddKeyboardButton("Error", "-")
 		pl.ResultChan <- res
-		pl.ResultChan <- Result{Text: "Whoops, file not available, try uploading again? :c", State: c.downloadSong, Error: err}
+		pl.ResultChan <- Result{Text: "Whoops, file not available, try uploading again? :c", State: statef(c, stepExtractVoiceDownload), Error: err}
 		return
 	}
 
-	if c.queue.Lock(ctx) {
-		defer c.queue.Unlock()
-		c.processFile(ctx, pl, downloadedFile)
-	} else {
-		res = Result{}
-		res.InlineMarkup.AddKeyboardButton("Retry", commandf(c, cmdExtractVoiceStart, uniqueID))
-		pl.ResultChan <- res
-		if !errors.Is(ctx.Err(), context.Canceled) {
-			pl.ResultChan <- Result{Text: "There are too many queued jobs, please wait."}
-		}
+	ticket := waitQueue(ctx, pl, c.queue, commandf(c, cmdExtractVoiceStart, uniqueID))
+	if ticket == nil {
+		return
 	}
+	defer func() { c.queue.Done(ticket, err) }()
+
+	err = c.processFile(ctx, pl, downloadedFile)
 }
 
-func (c *ExtractVoiceCommand) processFile(ctx context.Context, pl Payload, downloadedFile utils.DownloadedFile) {
-	res := Result{}
-	res.InlineMarkup.AddKeyboardButton("Python goes brrr...", "-")
-	res.InlineMarkup.AddKeyboardRow()
-	res.InlineMarkup.AddKeyboardButton("Cancel", cancelf(ctx))
-	pl.ResultChan <- res
+func (c *ExtractVoiceCommand) processFile(ctx context.Context, pl Payload, downloadedFile utils.DownloadedFile) error {
+	progress := func(status string) {
+		res := Result{}
+		res.InlineMarkup.AddKeyboardButton(status, "-")
+		res.InlineMarkup.AddKeyboardRow()
+		res.InlineMarkup.AddKeyboardButton("Cancel", cancelf(ctx))
+		pl.ResultChan <- res
+	}
 
-	resFiles, err := c.separator.Run(ctx, downloadedFile)
+	progress("Python goes brrr...")
+
+	inputs := map[string]string{"audio": downloadedFile.Path}
+	job := worker.NewJob(worker.KindSeparate, map[string]string{"name": downloadedFile.Name}, inputs)
+
+	artifacts, release, err := c.runner.Run(ctx, job, inputs, progress)
 	if errors.Is(err, context.Canceled) {
-		res = Result{}
+		res := Result{}
 		res.InlineMarkup.AddKeyboardButton("Retry", commandf(c, cmdExtractVoiceStart, downloadedFile.ID))
 		pl.ResultChan <- res
-		return
+		return err
 	} else if err != nil {
-		res = Result{}
+		res := Result{}
 		res.InlineMarkup.AddKeyboardButton("Retry", commandf(c, cmdExtractVoiceStart, downloadedFile.ID))
 		pl.ResultChan <- res
 		pl.ResultChan <- Result{Text: "Whoops, python script failed, try again :c", Error: err}
+		return err
 	}
 
-	res = Result{}
+	res := Result{}
 	res.InlineMarkup.AddKeyboardButton("Done!", "-")
 	pl.ResultChan <- res
 
 	pl.ResultChan <- Result{
 		Audio: map[string]string{
-			resFiles.MusicName: resFiles.MusicPath,
-			resFiles.VoiceName: resFiles.VoicePath,
+			artifacts["music"].Name: artifacts["music"].Path,
+			artifacts["voice"].Name: artifacts["voice"].Path,
 		},
+		Release: release,
 	}
+	return nil
 }
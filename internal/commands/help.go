@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// CommandCatalog lists the commands registered in the bot, implemented by bot.Manager.
+type CommandCatalog interface {
+	ListCommands() []CommandInfo
+}
+
+type HelpCommand struct {
+	catalog CommandCatalog
+}
+
+func NewHelpCommand(catalog CommandCatalog) *HelpCommand {
+	return &HelpCommand{catalog: catalog}
+}
+
+func (HelpCommand) Prefix() string {
+	return "/help"
+}
+
+func (HelpCommand) Description() string {
+	return "list available commands"
+}
+
+func (c *HelpCommand) Execute(ctx context.Context, pl Payload) {
+	var available, disabled string
+	for _, info := range c.catalog.ListCommands() {
+		line := fmt.Sprintf("%s - %s", info.Prefix, _es(info.Description))
+		if info.Role != "" && info.Role != "member" {
+			line += fmt.Sprintf(" (%s)", info.Role)
+		}
+		if len(info.Missing) == 0 {
+			available += line + "\n"
+		} else {
+			disabled += fmt.Sprintf("%s\n🚫 missing %s\n", line, _es(strings.Join(info.Missing, ", ")))
+		}
+	}
+
+	text := "<b>Available commands:</b>\n" + available
+	if disabled != "" {
+		text += "\n<b>Disabled commands:</b>\n" + disabled
+	}
+	pl.ResultChan <- Result{Text: text}
+}
+
+func (c *HelpCommand) Resume(ctx context.Context, pl Payload) {
+	// there are no conversation steps
+}
@@ -8,19 +8,16 @@ import (
 	"strconv"
 	"time"
 
+	"mr-weasel/internal/lib/chart"
 	st "mr-weasel/internal/storage"
 )
 
 type HolidayCommand struct {
-	storage       *st.HolidayStorage
-	draftHolidays map[int64]*st.HolidayBase
+	storage *st.HolidayStorage
 }
 
 func NewHolidayCommand(storage *st.HolidayStorage) *HolidayCommand {
-	return &HolidayCommand{
-		storage:       storage,
-		draftHolidays: make(map[int64]*st.HolidayBase),
-	}
+	return &HolidayCommand{storage: storage}
 }
 
 func (HolidayCommand) Prefix() string {
@@ -36,6 +33,25 @@ const (
 	cmdHolidayGet    = "get"
 	cmdHolidayDelAsk = "del"
 	cmdHolidayDelYes = "del_yes"
+	cmdHolidayChart  = "chart"
+
+	cmdHolidayAllowance    = "allowance"
+	cmdHolidayAllowanceSet = "allowance_set"
+	cmdHolidayPublic       = "public"
+	cmdHolidayPublicAdd    = "public_add"
+	cmdHolidayPublicDel    = "public_del"
+)
+
+const (
+	stepHolidayStartDate = "start_date"
+	stepHolidayEndDate   = "end_date"
+	stepHolidayDays      = "days"
+
+	stepHolidayAllowanceDays        = "allowance_days"
+	stepHolidayAllowanceCarryDays   = "allowance_carry_days"
+	stepHolidayAllowanceCarryMonths = "allowance_carry_months"
+	stepHolidayPublicDate           = "public_date"
+	stepHolidayPublicName           = "public_name"
 )
 
 func (c *HolidayCommand) Execute(ctx context.Context, pl Payload) {
@@ -49,11 +65,45 @@ func (c *HolidayCommand) Execute(ctx context.Context, pl Payload) {
 		c.deleteHolidayAsk(ctx, pl, safeGetInt64(args, 1))
 	case cmdHolidayDelYes:
 		c.deleteHolidayConfirm(ctx, pl, safeGetInt64(args, 1))
+	case cmdHolidayChart:
+		c.showHolidayChart(ctx, pl)
+	case cmdHolidayAllowance:
+		c.showHolidayAllowance(ctx, pl)
+	case cmdHolidayAllowanceSet:
+		c.addHolidayAllowanceStart(ctx, pl, safeGetInt64(args, 1))
+	case cmdHolidayPublic:
+		c.showPublicHolidays(ctx, pl, safeGetInt64(args, 1))
+	case cmdHolidayPublicAdd:
+		c.addPublicHolidayStart(ctx, pl)
+	case cmdHolidayPublicDel:
+		c.deletePublicHoliday(ctx, pl, safeGetInt64(args, 1))
 	default:
 		c.showHolodayDaysByYear(ctx, pl)
 	}
 }
 
+func (c *HolidayCommand) Resume(ctx context.Context, pl Payload) {
+	args := splitCommand(pl.State, c.Prefix())
+	switch safeGet(args, 0) {
+	case stepHolidayStartDate:
+		resumeDraft(ctx, pl, c.addHolidayStartDate)
+	case stepHolidayEndDate:
+		resumeDraft(ctx, pl, c.addHolidayEndDate)
+	case stepHolidayDays:
+		resumeDraft(ctx, pl, c.addHolidayDaysAndSave)
+	case stepHolidayAllowanceDays:
+		resumeDraft(ctx, pl, c.addHolidayAllowanceDays)
+	case stepHolidayAllowanceCarryDays:
+		resumeDraft(ctx, pl, c.addHolidayAllowanceCarryDays)
+	case stepHolidayAllowanceCarryMonths:
+		resumeDraft(ctx, pl, c.addHolidayAllowanceCarryMonths)
+	case stepHolidayPublicDate:
+		resumeDraft(ctx, pl, c.addPublicHolidayDate)
+	case stepHolidayPublicName:
+		resumeDraft(ctx, pl, c.addPublicHolidayNameAndSave)
+	}
+}
+
 func (c *HolidayCommand) formatHolidayDetails(holiday st.HolidayDetails) string {
 	html := fmt.Sprintf("📅 <b>Start:</b> %s\n", holiday.GetStartTimestamp())
 	html += fmt.Sprintf("📅 <b>End:</b> %s\n", holiday.GetEndTimestamp())
@@ -80,98 +130,148 @@ func (c *HolidayCommand) showHolidayDetails(ctx context.Context, pl Payload, off
 	pl.ResultChan <- res
 }
 
+// showHolodayDaysByYear shows the allowance, the used, the planned and the remaining days of every year.
 func (c *HolidayCommand) showHolodayDaysByYear(ctx context.Context, pl Payload) {
 	res := Result{}
-	holidays, err := c.storage.SelectHolidayDaysByYearFromDB(ctx, pl.UserID)
+	holidays, err := c.storage.SelectHolidaysFromDB(ctx, pl.UserID)
 	if err != nil {
-		res.Text, res.Error = "There is something wrong, please try again.", err
-	} else if len(holidays) == 0 {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	allowances, err := c.storage.SelectHolidayAllowancesFromDB(ctx, pl.UserID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	balances := c.calcHolidayBalances(allowances, holidays, time.Now())
+	if len(holidays) == 0 && len(balances) == 0 {
 		res.Text = "Holidays not found, add one?"
 		res.InlineMarkup.AddKeyboardButton("Add", commandf(c, cmdHolidayAdd))
 	} else {
 		res.Text = "Holiday days by year:"
 		res.InlineMarkup.AddKeyboardButton("Manage", commandf(c, cmdHolidayGet))
-		for _, v := range holidays {
-			res.Text += fmt.Sprintf("\n<b>%d</b> - %d offline days", v.Year, v.Days)
+		res.InlineMarkup.AddKeyboardButton("Chart", commandf(c, cmdHolidayChart))
+		for _, b := range balances {
+			res.Text += "\n" + c.formatHolidayBalance(b)
 		}
 	}
+	if len(allowances) == 0 {
+		res.Text += "\n\nSet the allowance to see the remaining days."
+	}
+	res.InlineMarkup.AddKeyboardRow()
+	res.InlineMarkup.AddKeyboardButton("Allowance", commandf(c, cmdHolidayAllowance))
+	res.InlineMarkup.AddKeyboardButton("Public Holidays", commandf(c, cmdHolidayPublic))
 	pl.ResultChan <- res
 }
 
-func (c *HolidayCommand) insertDraftHolidayIntoDB(ctx context.Context, userID int64) (int64, error) {
-	return c.storage.InsertHolidayIntoDB(ctx, *c.draftHolidays[userID])
+func (c *HolidayCommand) renderHolidayChart(holidays []st.HolidayDaysByYear) ([]byte, error) {
+	series := chart.Series{Name: "Days"}
+	labels := []string{}
+	for _, v := range holidays {
+		labels = append(labels, fmt.Sprint(v.Year))
+		series.Values = append(series.Values, float64(v.Days))
+	}
+	return chart.Chart{Title: "Holiday days used per year", Labels: labels, Series: []chart.Series{series}}.Bars()
 }
 
-func (c *HolidayCommand) newDraftHoliday(userID int64) {
-	c.draftHolidays[userID] = &st.HolidayBase{UserID: userID}
+func (c *HolidayCommand) showHolidayChart(ctx context.Context, pl Payload) {
+	res := Result{}
+	holidays, err := c.storage.SelectHolidayDaysByYearFromDB(ctx, pl.UserID)
+	if err != nil {
+		res.Text, res.Error = "There is something wrong, please try again.", err
+	} else if len(holidays) == 0 {
+		res.Text = "Holidays not found, add one?"
+	} else if res.Image, err = c.renderHolidayChart(holidays); err != nil {
+		res.Text, res.Error = "There is something wrong, please try again.", err
+	} else {
+		res.Text = "🌴 Holiday days by year"
+	}
+	pl.ResultChan <- res
 }
 
-func (c *HolidayCommand) setDraftHolidayStartDate(userID int64, input string) error {
+func (c *HolidayCommand) newDraftHoliday(userID int64) *st.HolidayBase {
+	return &st.HolidayBase{UserID: userID}
+}
+
+func (c *HolidayCommand) setDraftHolidayStartDate(holiday *st.HolidayBase, input string) error {
 	timestamp, err := strconv.Atoi(input)
-	c.draftHolidays[userID].Start = int64(timestamp)
+	holiday.Start = int64(timestamp)
 	return err
 }
 
-func (c *HolidayCommand) setDraftHolidayEndDate(userID int64, input string) error {
+func (c *HolidayCommand) setDraftHolidayEndDate(holiday *st.HolidayBase, input string) error {
 	timestamp, err := strconv.Atoi(input)
-	c.draftHolidays[userID].End = int64(timestamp)
+	holiday.End = int64(timestamp)
 	return err
 }
 
-func (c *HolidayCommand) setDraftHolidayDays(userID int64, input string) error {
+// setDraftHolidayDays keeps the suggested number of the working days on /skip.
+func (c *HolidayCommand) setDraftHolidayDays(holiday *st.HolidayBase, input string) error {
+	if input == "/skip" {
+		return nil
+	}
 	days, err := strconv.Atoi(input)
-	c.draftHolidays[userID].Days = int64(days)
+	holiday.Days = int64(days)
 	return err
 }
 
 func (c *HolidayCommand) addHolidayStart(ctx context.Context, pl Payload) {
-	c.newDraftHoliday(pl.UserID)
-	res := Result{Text: "Please pick holiday start date.", State: c.addHolidayStartDate}
+	holiday := c.newDraftHoliday(pl.UserID)
+	res := Result{Text: "Please pick holiday start date.", State: statef(c, stepHolidayStartDate), Draft: holiday}
 	res.InlineMarkup.AddKeyboardCalendar(time.Now().Year(), time.Now().Month())
 	pl.ResultChan <- res
 }
 
-func (c *HolidayCommand) addHolidayStartDate(ctx context.Context, pl Payload) {
+func (c *HolidayCommand) addHolidayStartDate(ctx context.Context, pl Payload, holiday *st.HolidayBase) {
 	res := Result{}
 	if res.InlineMarkup.UpdateKeyboardCalendar(pl.Command) {
 		pl.ResultChan <- res // new month is selected
 		return
 	}
-	if c.setDraftHolidayStartDate(pl.UserID, pl.Command) != nil {
-		pl.ResultChan <- Result{Text: "Please pick a date from the calendar.", State: c.addHolidayStartDate}
+	if c.setDraftHolidayStartDate(holiday, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please pick a date from the calendar.", State: statef(c, stepHolidayStartDate), Draft: holiday}
 		return
 	}
-	res.Text = "Start: " + c.draftHolidays[pl.UserID].GetStartTimestamp()
+	res.Text = "Start: " + holiday.GetStartTimestamp()
 	res.InlineMarkup.AddKeyboardRow() // remove calendar keyboard
 	pl.ResultChan <- res
-	res = Result{Text: "Please pick holiday end date.", State: c.addHolidayEndDate}
+	res = Result{Text: "Please pick holiday end date.", State: statef(c, stepHolidayEndDate), Draft: holiday}
 	res.InlineMarkup.AddKeyboardCalendar(time.Now().Year(), time.Now().Month())
 	pl.ResultChan <- res
 }
 
-func (c *HolidayCommand) addHolidayEndDate(ctx context.Context, pl Payload) {
+func (c *HolidayCommand) addHolidayEndDate(ctx context.Context, pl Payload, holiday *st.HolidayBase) {
 	res := Result{}
 	if res.InlineMarkup.UpdateKeyboardCalendar(pl.Command) {
 		pl.ResultChan <- res
 		return
 	}
-	if c.setDraftHolidayEndDate(pl.UserID, pl.Command) != nil {
+	if c.setDraftHolidayEndDate(holiday, pl.Command) != nil {
 		pl.ResultChan <- res
 		return
 	}
-	res.Text = "End: " + c.draftHolidays[pl.UserID].GetEndTimestamp()
+	publics, err := c.storage.SelectPublicHolidaysFromDB(ctx, pl.UserID, holiday.Start, holiday.End)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	holiday.Days = c.countHolidayWorkingDays(holiday.Start, holiday.End, publics)
+
+	res.Text = "End: " + holiday.GetEndTimestamp()
 	res.InlineMarkup.AddKeyboardRow() // remove calendar keyboard
 	pl.ResultChan <- res
-	res = Result{Text: "Enter number of working days.", State: c.addHolidayDaysAndSave}
+	text := fmt.Sprintf("Enter number of working days. /skip to use %d without the weekends and the public holidays", holiday.Days)
+	res = Result{Text: text, State: statef(c, stepHolidayDays), Draft: holiday}
 	pl.ResultChan <- res
 }
 
-func (c *HolidayCommand) addHolidayDaysAndSave(ctx context.Context, pl Payload) {
-	if c.setDraftHolidayDays(pl.UserID, pl.Command) != nil {
-		pl.ResultChan <- Result{Text: "Please enter a valid whole number.", State: c.addHolidayDaysAndSave}
+func (c *HolidayCommand) addHolidayDaysAndSave(ctx context.Context, pl Payload, holiday *st.HolidayBase) {
+	if c.setDraftHolidayDays(holiday, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid whole number.", State: statef(c, stepHolidayDays), Draft: holiday}
 		return
 	}
-	_, err := c.insertDraftHolidayIntoDB(ctx, pl.UserID)
+	_, err := c.storage.InsertHolidayIntoDB(ctx, *holiday)
 	if err != nil {
 		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
 		return
@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	st "mr-weasel/internal/storage"
+)
+
+func TestCalcHolidayBalances(t *testing.T) {
+	date := func(year int, month time.Month, day int) int64 {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix()
+	}
+	allowances := []st.HolidayAllowance{
+		{Year: 2025, Days: 25, CarryDays: 5, CarryMonths: sql.NullInt64{Int64: 3, Valid: true}},
+		{Year: 2026, Days: 28},
+	}
+	holidays := []st.HolidayBase{
+		{Start: date(2024, 8, 1), Days: 10},
+		{Start: date(2025, 7, 1), Days: 15},
+		{Start: date(2026, 2, 2), Days: 2},
+		{Start: date(2026, 7, 1), Days: 10},
+	}
+	tests := []struct {
+		Now      time.Time
+		Expected []holidayBalance
+	}{
+		{
+			// the carried over days can still be used until the end of March
+			Now: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+			Expected: []holidayBalance{
+				{Year: 2024, Used: 10},
+				{Year: 2025, Allowance: 25, Used: 15},
+				{Year: 2026, Allowance: 28, Carried: 5, Expiring: 3, ExpiresOn: time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC), Used: 2, Planned: 10},
+			},
+		},
+		{
+			// the carried over days not used until April are lost
+			Now: time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC),
+			Expected: []holidayBalance{
+				{Year: 2024, Used: 10},
+				{Year: 2025, Allowance: 25, Used: 15},
+				{Year: 2026, Allowance: 28, Carried: 2, Used: 12},
+			},
+		},
+		{
+			// the allowance stays the same for the next years, nothing is carried over from 2026
+			Now: time.Date(2027, 1, 10, 0, 0, 0, 0, time.UTC),
+			Expected: []holidayBalance{
+				{Year: 2024, Used: 10},
+				{Year: 2025, Allowance: 25, Used: 15},
+				{Year: 2026, Allowance: 28, Carried: 2, Used: 12},
+				{Year: 2027, Allowance: 28},
+			},
+		},
+	}
+	c := NewHolidayCommand(nil)
+	for _, test := range tests {
+		actual := c.calcHolidayBalances(allowances, holidays, test.Now)
+		if len(actual) != len(test.Expected) {
+			t.Fatalf("actual [%+v], expected [%+v]\n", actual, test.Expected)
+		}
+		for i := range actual {
+			if actual[i] != test.Expected[i] {
+				t.Errorf("actual [%+v], expected [%+v]\n", actual[i], test.Expected[i])
+			}
+		}
+	}
+	if remaining := c.calcHolidayBalances(allowances, holidays, tests[0].Now)[2].Remaining(); remaining != 21 {
+		t.Errorf("actual remaining [%d], expected [21]\n", remaining)
+	}
+}
+
+func TestCountHolidayWorkingDays(t *testing.T) {
+	date := func(day int) int64 {
+		return time.Date(2026, 12, day, 0, 0, 0, 0, time.UTC).Unix()
+	}
+	publics := []st.PublicHoliday{{Timestamp: date(25), Name: "Christmas"}, {Timestamp: date(26), Name: "Boxing Day"}}
+	tests := []struct {
+		Start    int64
+		End      int64
+		Expected int64
+	}{
+		{Start: date(21), End: date(21), Expected: 1},
+		{Start: date(21), End: date(27), Expected: 4},
+		{Start: date(19), End: date(20), Expected: 0},
+		{Start: date(21), End: date(20), Expected: 0},
+	}
+	c := NewHolidayCommand(nil)
+	for _, test := range tests {
+		if actual := c.countHolidayWorkingDays(test.Start, test.End, publics); actual != test.Expected {
+			t.Errorf("actual [%d], [%+v]\n", actual, test)
+		}
+	}
+}
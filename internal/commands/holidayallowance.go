@@ -0,0 +1,343 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	st "mr-weasel/internal/storage"
+)
+
+// holidayBalance is the holiday days of the year, the planned ones start in the future.
+type holidayBalance struct {
+	Year      int64
+	Allowance int64
+	Carried   int64     // carried over from the previous year, without the expired days
+	Expiring  int64     // carried over days which expire if not used until ExpiresOn
+	ExpiresOn time.Time // last day the carried over days can be used
+	Used      int64
+	Planned   int64
+}
+
+func (b holidayBalance) Remaining() int64 {
+	return b.Allowance + b.Carried - b.Used - b.Planned
+}
+
+// findHolidayAllowance returns the allowance set for the year or the latest one before it, the allowances are sorted by year.
+func (c *HolidayCommand) findHolidayAllowance(allowances []st.HolidayAllowance, year int64) (st.HolidayAllowance, bool) {
+	found, ok := st.HolidayAllowance{}, false
+	for _, a := range allowances {
+		if a.Year > year {
+			break
+		}
+		found, ok = a, true
+	}
+	return found, ok
+}
+
+// calcHolidayBalances goes through the years in order, the unused days of the year are carried over to the next one.
+// The carried over days are used first, and the ones not used before the expiry are lost.
+func (c *HolidayCommand) calcHolidayBalances(allowances []st.HolidayAllowance, holidays []st.HolidayBase, now time.Time) []holidayBalance {
+	yearOf := func(ts int64) int64 {
+		return int64(time.Unix(ts, 0).UTC().Year())
+	}
+	if len(allowances) == 0 && len(holidays) == 0 {
+		return []holidayBalance{}
+	}
+
+	first, last := int64(now.Year()), int64(now.Year())
+	if len(allowances) > 0 {
+		first = min(first, allowances[0].Year)
+	} else {
+		last = 0 // no need to show the current year without the allowance
+	}
+	for _, h := range holidays {
+		first, last = min(first, yearOf(h.Start)), max(last, yearOf(h.Start))
+	}
+
+	balances := []holidayBalance{}
+	var prev holidayBalance
+	for year := first; year <= last; year++ {
+		b := holidayBalance{Year: year}
+		allowance, ok := c.findHolidayAllowance(allowances, year)
+		if ok {
+			b.Allowance = allowance.Days
+		}
+
+		carry := int64(0)
+		if prevAllowance, ok := c.findHolidayAllowance(allowances, year-1); ok {
+			carry = min(max(prev.Remaining(), 0), prevAllowance.CarryDays)
+			if carry > 0 && prevAllowance.CarryMonths.Valid {
+				expiry := time.Date(int(year), time.Month(1+prevAllowance.CarryMonths.Int64), 1, 0, 0, 0, 0, time.UTC)
+				taken := int64(0)
+				for _, h := range holidays {
+					if yearOf(h.Start) == year && h.Start < expiry.Unix() {
+						taken += h.Days
+					}
+				}
+				if taken < carry && now.Before(expiry) {
+					b.Expiring, b.ExpiresOn = carry-taken, expiry.AddDate(0, 0, -1)
+				} else if taken < carry {
+					carry = taken
+				}
+			}
+		}
+		b.Carried = carry
+
+		for _, h := range holidays {
+			if yearOf(h.Start) != year {
+				continue
+			}
+			if h.Start > now.Unix() {
+				b.Planned += h.Days
+			} else {
+				b.Used += h.Days
+			}
+		}
+
+		if b.Allowance != 0 || b.Carried != 0 || b.Used != 0 || b.Planned != 0 {
+			balances = append(balances, b)
+		}
+		prev = b
+	}
+	return balances
+}
+
+func (c *HolidayCommand) formatHolidayBalance(b holidayBalance) string {
+	if b.Allowance == 0 && b.Carried == 0 {
+		return fmt.Sprintf("<b>%d</b> - %d used, %d planned days", b.Year, b.Used, b.Planned)
+	}
+	str := fmt.Sprintf("<b>%d</b> - %d days", b.Year, b.Allowance+b.Carried)
+	if b.Carried > 0 {
+		str += fmt.Sprintf(" (%d carried over)", b.Carried)
+	}
+	str += fmt.Sprintf(", %d used, %d planned, %d remaining", b.Used, b.Planned, b.Remaining())
+	if b.Expiring > 0 {
+		str += fmt.Sprintf("\n⚠️ %d carried over days expire after %s", b.Expiring, b.ExpiresOn.Format("Monday, 02 January 2006"))
+	}
+	return str
+}
+
+func (c *HolidayCommand) formatHolidayAllowance(a st.HolidayAllowance) string {
+	str := fmt.Sprintf("<b>%d</b> - %d days", a.Year, a.Days)
+	switch {
+	case a.CarryDays == 0:
+		str += ", nothing is carried over"
+	case a.CarryMonths.Valid:
+		str += fmt.Sprintf(", up to %d days are carried over for %d months", a.CarryDays, a.CarryMonths.Int64)
+	default:
+		str += fmt.Sprintf(", up to %d days are carried over", a.CarryDays)
+	}
+	return str
+}
+
+func (c *HolidayCommand) showHolidayAllowance(ctx context.Context, pl Payload) {
+	allowances, err := c.storage.SelectHolidayAllowancesFromDB(ctx, pl.UserID)
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	res := Result{Text: "🌴 <b>Holiday allowance:</b>\n"}
+	if len(allowances) == 0 {
+		res.Text += "\nNo allowance yet, set the number of holiday days you have every year."
+	}
+	for _, a := range allowances {
+		res.Text += "\n" + c.formatHolidayAllowance(a)
+	}
+	year := time.Now().Year()
+	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("Set %d", year), commandf(c, cmdHolidayAllowanceSet, year))
+	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("Set %d", year+1), commandf(c, cmdHolidayAllowanceSet, year+1))
+	res.InlineMarkup.AddKeyboardRow()
+	res.InlineMarkup.AddKeyboardButton("« Back", commandf(c))
+	pl.ResultChan <- res
+}
+
+func (c *HolidayCommand) newDraftHolidayAllowance(userID int64, year int64) *st.HolidayAllowance {
+	return &st.HolidayAllowance{UserID: userID, Year: year}
+}
+
+func (c *HolidayCommand) setDraftHolidayAllowanceDays(allowance *st.HolidayAllowance, input string) error {
+	days, err := strconv.Atoi(input)
+	if err == nil && days < 0 {
+		err = errors.New("days must not be negative")
+	}
+	allowance.Days = int64(days)
+	return err
+}
+
+func (c *HolidayCommand) setDraftHolidayAllowanceCarryDays(allowance *st.HolidayAllowance, input string) error {
+	days, err := strconv.Atoi(input)
+	if err == nil && days < 0 {
+		err = errors.New("days must not be negative")
+	}
+	allowance.CarryDays = int64(days)
+	return err
+}
+
+func (c *HolidayCommand) setDraftHolidayAllowanceCarryMonths(allowance *st.HolidayAllowance, input string) error {
+	if input == "/skip" {
+		allowance.CarryMonths.Valid = false
+		return nil
+	}
+	months, err := strconv.Atoi(input)
+	if err == nil && (months <= 0 || months > 12) {
+		err = errors.New("months must be between 1 and 12")
+	}
+	allowance.CarryMonths.Int64 = int64(months)
+	allowance.CarryMonths.Valid = true
+	return err
+}
+
+func (c *HolidayCommand) addHolidayAllowanceStart(ctx context.Context, pl Payload, year int64) {
+	if year <= 0 {
+		year = int64(time.Now().Year())
+	}
+	allowance := c.newDraftHolidayAllowance(pl.UserID, year)
+	text := fmt.Sprintf("How many holiday days do you have in %d? It stays the same for the next years until changed.", year)
+	pl.ResultChan <- Result{Text: text, State: statef(c, stepHolidayAllowanceDays), Draft: allowance}
+}
+
+func (c *HolidayCommand) addHolidayAllowanceDays(ctx context.Context, pl Payload, allowance *st.HolidayAllowance) {
+	if c.setDraftHolidayAllowanceDays(allowance, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid whole number.", State: statef(c, stepHolidayAllowanceDays), Draft: allowance}
+		return
+	}
+	text := "How many unused days can be carried over to the next year? 0 if none."
+	pl.ResultChan <- Result{Text: text, State: statef(c, stepHolidayAllowanceCarryDays), Draft: allowance}
+}
+
+func (c *HolidayCommand) addHolidayAllowanceCarryDays(ctx context.Context, pl Payload, allowance *st.HolidayAllowance) {
+	if c.setDraftHolidayAllowanceCarryDays(allowance, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please enter a valid whole number.", State: statef(c, stepHolidayAllowanceCarryDays), Draft: allowance}
+		return
+	}
+	if allowance.CarryDays == 0 {
+		c.addHolidayAllowanceSave(ctx, pl, allowance)
+		return
+	}
+	text := "For how many months of the next year can the carried over days be used? /skip if they never expire"
+	pl.ResultChan <- Result{Text: text, State: statef(c, stepHolidayAllowanceCarryMonths), Draft: allowance}
+}
+
+func (c *HolidayCommand) addHolidayAllowanceCarryMonths(ctx context.Context, pl Payload, allowance *st.HolidayAllowance) {
+	if c.setDraftHolidayAllowanceCarryMonths(allowance, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please enter a number of months from 1 to 12.", State: statef(c, stepHolidayAllowanceCarryMonths), Draft: allowance}
+		return
+	}
+	c.addHolidayAllowanceSave(ctx, pl, allowance)
+}
+
+func (c *HolidayCommand) addHolidayAllowanceSave(ctx context.Context, pl Payload, allowance *st.HolidayAllowance) {
+	if err := c.storage.UpsertHolidayAllowanceIntoDB(ctx, *allowance); err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	c.showHolidayAllowance(ctx, pl)
+}
+
+// countHolidayWorkingDays counts the days from start to end, both included, except the weekends and the public holidays.
+func (c *HolidayCommand) countHolidayWorkingDays(start int64, end int64, publics []st.PublicHoliday) int64 {
+	skip := map[int64]bool{}
+	for _, p := range publics {
+		skip[p.Timestamp] = true
+	}
+	days := int64(0)
+	for dt := time.Unix(start, 0).UTC(); dt.Unix() <= end; dt = dt.AddDate(0, 0, 1) {
+		if dt.Weekday() != time.Saturday && dt.Weekday() != time.Sunday && !skip[dt.Unix()] {
+			days++
+		}
+	}
+	return days
+}
+
+func (c *HolidayCommand) showPublicHolidays(ctx context.Context, pl Payload, year int64) {
+	if year <= 0 {
+		year = int64(time.Now().Year())
+	}
+	from := time.Date(int(year), 1, 1, 0, 0, 0, 0, time.UTC)
+	publics, err := c.storage.SelectPublicHolidaysFromDB(ctx, pl.UserID, from.Unix(), from.AddDate(1, 0, -1).Unix())
+	if err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+
+	res := Result{Text: fmt.Sprintf("🎉 <b>Public holidays:</b> %d\n", year)}
+	if len(publics) == 0 {
+		res.Text += "\nNo public holidays yet, they are not counted as the working days of the holidays."
+	}
+	for _, p := range publics {
+		date := time.Unix(p.Timestamp, 0).UTC().Format("02.01")
+		res.Text += fmt.Sprintf("\n<b>%s</b> - %s", p.GetTimestamp(), _es(p.Name))
+		res.InlineMarkup.AddKeyboardButton("Delete "+date, commandf(c, cmdHolidayPublicDel, p.ID))
+		res.InlineMarkup.AddKeyboardRow()
+	}
+	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("« %d", year-1), commandf(c, cmdHolidayPublic, year-1))
+	res.InlineMarkup.AddKeyboardButton("Add", commandf(c, cmdHolidayPublicAdd))
+	res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("%d »", year+1), commandf(c, cmdHolidayPublic, year+1))
+	res.InlineMarkup.AddKeyboardRow()
+	res.InlineMarkup.AddKeyboardButton("« Back", commandf(c))
+	pl.ResultChan <- res
+}
+
+func (c *HolidayCommand) setDraftPublicHolidayDate(holiday *st.PublicHoliday, input string) error {
+	timestamp, err := strconv.Atoi(input)
+	holiday.Timestamp = int64(timestamp)
+	return err
+}
+
+func (c *HolidayCommand) setDraftPublicHolidayName(holiday *st.PublicHoliday, input string) error {
+	holiday.Name = strings.TrimSpace(input)
+	if holiday.Name == "" {
+		return errors.New("name must not be empty")
+	}
+	return nil
+}
+
+func (c *HolidayCommand) addPublicHolidayStart(ctx context.Context, pl Payload) {
+	holiday := &st.PublicHoliday{UserID: pl.UserID}
+	res := Result{Text: "Please pick the public holiday date.", State: statef(c, stepHolidayPublicDate), Draft: holiday}
+	res.InlineMarkup.AddKeyboardCalendar(time.Now().Year(), time.Now().Month())
+	pl.ResultChan <- res
+}
+
+func (c *HolidayCommand) addPublicHolidayDate(ctx context.Context, pl Payload, holiday *st.PublicHoliday) {
+	res := Result{}
+	if res.InlineMarkup.UpdateKeyboardCalendar(pl.Command) {
+		pl.ResultChan <- res // new month is selected
+		return
+	}
+	if c.setDraftPublicHolidayDate(holiday, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please pick a date from the calendar.", State: statef(c, stepHolidayPublicDate), Draft: holiday}
+		return
+	}
+	res.Text = "Date: " + holiday.GetTimestamp()
+	res.InlineMarkup.AddKeyboardRow() // remove calendar keyboard
+	pl.ResultChan <- res
+	pl.ResultChan <- Result{Text: "What is the name of the public holiday?", State: statef(c, stepHolidayPublicName), Draft: holiday}
+}
+
+func (c *HolidayCommand) addPublicHolidayNameAndSave(ctx context.Context, pl Payload, holiday *st.PublicHoliday) {
+	if c.setDraftPublicHolidayName(holiday, pl.Command) != nil {
+		pl.ResultChan <- Result{Text: "Please enter a name.", State: statef(c, stepHolidayPublicName), Draft: holiday}
+		return
+	}
+	if err := c.storage.UpsertPublicHolidayIntoDB(ctx, *holiday); err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	c.showPublicHolidays(ctx, pl, int64(time.Unix(holiday.Timestamp, 0).UTC().Year()))
+}
+
+func (c *HolidayCommand) deletePublicHoliday(ctx context.Context, pl Payload, holidayID int64) {
+	res := Result{Text: "Public holiday has been successfully deleted!"}
+	affected, err := c.storage.DeletePublicHolidayFromDB(ctx, pl.UserID, holidayID)
+	if err != nil || affected != 1 {
+		res.Text, res.Error = "Public holiday not found.", err
+	}
+	res.InlineMarkup.AddKeyboardButton("« Back to public holidays", commandf(c, cmdHolidayPublic))
+	pl.ResultChan <- res
+}
@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Chain applies the middlewares to the execution, the first one being the outermost.
+func Chain(next ExecuteFunc, middlewares ...Middleware) ExecuteFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		next = middlewares[i](next)
+	}
+	return next
+}
+
+// Recover stops a panic in the command from crashing the bot, and reports it as an error result.
+func Recover() Middleware {
+	return func(next ExecuteFunc) ExecuteFunc {
+		return func(ctx context.Context, pl Payload) {
+			defer func() {
+				if r := recover(); r != nil {
+					err := fmt.Errorf("commands.Recover: panic: %v\n%s", r, debug.Stack())
+					pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+				}
+			}()
+			next(ctx, pl)
+		}
+	}
+}
+
+// Logger logs every execution with its duration.
+func Logger(logger *slog.Logger) Middleware {
+	return func(next ExecuteFunc) ExecuteFunc {
+		return func(ctx context.Context, pl Payload) {
+			start := time.Now()
+			defer func() {
+				logger.Info("command executed",
+					"user_id", pl.UserID,
+					"chat_id", pl.ChatID,
+					"command", pl.Command,
+					"state", pl.State,
+					"duration", time.Since(start),
+				)
+			}()
+			next(ctx, pl)
+		}
+	}
+}
+
+type bucket struct {
+	tokens   float64
+	last     time.Time
+	notified bool
+}
+
+// RateLimit allows each user up to burst executions at once, refilled with rate executions per second.
+// The user is warned once when the limit is hit, further executions are dropped silently until refilled.
+func RateLimit(rate float64, burst int) Middleware {
+	var mu sync.Mutex
+	buckets := make(map[int64]*bucket)
+
+	// allow takes a token from the user bucket, notify is true for the first rejected execution
+	allow := func(userID int64) (ok bool, notify bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now := time.Now()
+		b, found := buckets[userID]
+		if !found {
+			b = &bucket{tokens: float64(burst), last: now}
+			buckets[userID] = b
+		}
+
+		b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+		b.last = now
+
+		if b.tokens < 1 {
+			notify, b.notified = !b.notified, true
+			return false, notify
+		}
+
+		b.tokens--
+		b.notified = false
+		return true, false
+	}
+
+	return func(next ExecuteFunc) ExecuteFunc {
+		return func(ctx context.Context, pl Payload) {
+			ok, notify := allow(pl.UserID)
+			if ok {
+				next(ctx, pl)
+			} else if notify {
+				// keep the conversation going, the input can be sent again
+				pl.ResultChan <- Result{Text: "Too many requests, please slow down.", State: pl.State, Draft: pl.Draft}
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"context"
+	"testing"
+)
+
+// runMiddleware executes the command wrapped with the middleware, and collects its results.
+func runMiddleware(mw Middleware, next ExecuteFunc, pl Payload) []Result {
+	pl.ResultChan = make(chan Result)
+	go func() {
+		defer close(pl.ResultChan)
+		mw(next)(context.Background(), pl)
+	}()
+
+	var results []Result
+	for res := range pl.ResultChan {
+		results = append(results, res)
+	}
+	return results
+}
+
+func okCommand(ctx context.Context, pl Payload) {
+	pl.ResultChan <- Result{Text: "ok"}
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next ExecuteFunc) ExecuteFunc {
+			return func(ctx context.Context, pl Payload) {
+				order = append(order, name)
+				next(ctx, pl)
+			}
+		}
+	}
+
+	Chain(func(ctx context.Context, pl Payload) { order = append(order, "cmd") }, trace("a"), trace("b"))(context.Background(), Payload{})
+
+	if len(order) != 3 || order[0] != "a" || order[1] != "b" || order[2] != "cmd" {
+		t.Errorf("actual [%v], expected [a b cmd]\n", order)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	panicCommand := func(ctx context.Context, pl Payload) {
+		pl.ResultChan <- Result{Text: "before"}
+		panic("boom")
+	}
+
+	results := runMiddleware(Recover(), panicCommand, Payload{})
+	if len(results) != 2 || results[1].Error == nil || results[1].Text != "There is something wrong, please try again." {
+		t.Errorf("actual [%+v]\n", results)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	mw := RateLimit(0, 2) // no refill
+
+	tests := []struct {
+		userID   int64
+		expected string
+	}{
+		{1, "ok"},
+		{1, "ok"},
+		{1, "Too many requests, please slow down."},
+		{1, ""}, // notified once only
+		{2, "ok"},
+	}
+
+	for _, tc := range tests {
+		results := runMiddleware(mw, okCommand, Payload{UserID: tc.userID})
+		actual := ""
+		if len(results) == 1 {
+			actual = results[0].Text
+		}
+		if actual != tc.expected || len(results) > 1 {
+			t.Errorf("actual [%+v], [%+v]\n", results, tc)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package commands
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -24,6 +25,20 @@ func commandf(h Handler, args ...any) string {
 	return cmd
 }
 
+func statef(h Handler, step string, args ...any) string {
+	return commandf(h, append([]any{step}, args...)...)
+}
+
+// resumeDraft decodes the draft saved with the conversation state, and continues the step with it.
+func resumeDraft[T any](ctx context.Context, pl Payload, step func(context.Context, Payload, *T)) {
+	draft := new(T)
+	if err := json.Unmarshal(pl.Draft, draft); err != nil {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+		return
+	}
+	step(ctx, pl, draft)
+}
+
 func cancelf(ctx context.Context) string {
 	return fmt.Sprintf("%s %s", CmdCancel, ctx.Value("contextID"))
 }
@@ -16,14 +16,26 @@ func (PingCommand) Description() string {
 	return "answer with pong"
 }
 
-func (PingCommand) Execute(ctx context.Context, pl Payload) {
+const (
+	stepPingName = "name"
+)
+
+func (c PingCommand) Execute(ctx context.Context, pl Payload) {
 	if pl.Command == "/ping me" {
-		pl.ResultChan <- Result{Text: "What is your name?", State: personalized}
+		pl.ResultChan <- Result{Text: "What is your name?", State: statef(c, stepPingName)}
 	} else {
 		pl.ResultChan <- Result{Text: "pong!"}
 	}
 }
 
+func (c PingCommand) Resume(ctx context.Context, pl Payload) {
+	args := splitCommand(pl.State, c.Prefix())
+	switch safeGet(args, 0) {
+	case stepPingName:
+		personalized(ctx, pl)
+	}
+}
+
 func personalized(ctx context.Context, pl Payload) {
 	pl.ResultChan <- Result{Text: "Pong to " + _es(pl.Command) + "!"}
 }
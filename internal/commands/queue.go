@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"mr-weasel/internal/queue"
+	st "mr-weasel/internal/storage"
+)
+
+// waitQueue enqueues the command as a job, and shows the place in the queue until the job is started.
+// The command is executed again to resume the job after a restart, so it has to start the processing by itself.
+// Returns nil if the job could not be started, the user gets a retry button in that case.
+func waitQueue(ctx context.Context, pl Payload, q *queue.Queue, command string) *queue.Ticket {
+	job := st.Job{UserID: pl.UserID, UserName: pl.UserName, ChatID: pl.ChatID, ThreadID: int64(pl.ThreadID), Command: command}
+
+	ticket, err := q.Enqueue(ctx, job)
+	if err == nil {
+		err = q.Wait(ctx, ticket, func(position int) {
+			res := Result{}
+			res.InlineMarkup.AddKeyboardButton(fmt.Sprintf("You are #%d in queue", position), "-")
+			res.InlineMarkup.AddKeyboardRow()
+			res.InlineMarkup.AddKeyboardButton("Cancel", cancelf(ctx))
+			pl.ResultChan <- res
+		})
+		if err == nil {
+			return ticket
+		}
+	}
+
+	res := Result{}
+	res.InlineMarkup.AddKeyboardButton("Retry", command)
+	pl.ResultChan <- res
+
+	if errors.Is(err, queue.ErrQueueFull) {
+		pl.ResultChan <- Result{Text: "There are too many queued jobs, please wait."}
+	} else if !errors.Is(err, context.Canceled) {
+		pl.ResultChan <- Result{Text: "There is something wrong, please try again.", Error: err}
+	}
+	return nil
+}
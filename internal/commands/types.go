@@ -2,8 +2,11 @@ package commands
 
 import (
 	"context"
+	"encoding/json"
 	"html"
 	"mr-weasel/internal/lib/telegram"
+	st "mr-weasel/internal/storage"
+	"mr-weasel/internal/utils"
 )
 
 var _es = html.EscapeString
@@ -12,28 +15,71 @@ const CmdCancel = "/cancel"
 
 type ExecuteFunc = func(context.Context, Payload)
 
+// Middleware wraps the execution of a command, see middleware.go for the available ones.
+type Middleware func(ExecuteFunc) ExecuteFunc
+
 type Handler interface {
 	Prefix() string
 	Description() string
 	Execute(context.Context, Payload)
+	Resume(context.Context, Payload)
+}
+
+// Requirer is implemented by the handlers which depend on external tools, the handler is disabled if any of them is missing.
+type Requirer interface {
+	Requirements() []utils.Requirement
+}
+
+// Scheduler runs the commands later on behalf of the user, implemented by bot.Manager.
+// The results of the scheduled executions are sent into the chat of the task.
+type Scheduler interface {
+	ScheduleTask(ctx context.Context, task st.Task) error
+	UnscheduleTask(ctx context.Context, userID int64, key string) error
+}
+
+// CommandInfo describes a registered command for /help.
+type CommandInfo struct {
+	Prefix      string
+	Description string
+	Role        string   // role required to use the command
+	Missing     []string // missing requirements of the disabled command
 }
 
 type Payload struct {
 	UserID     int64
 	UserName   string
+	ChatID     int64
+	MessageID  int // message which triggered the execution
+	ThreadID   int // forum topic, 0 outside of topics
 	IsPrivate  bool
+	IsAdmin    bool // admin role, always false if the roles are not enforced
 	Command    string
 	FileURL    string
+	FileID     string          // photo sent by the user, it can be sent again by the id without downloading
+	State      string          // step being resumed, see Result.State
+	Scheduled  bool            // executed by the scheduler, not by the user
+	Draft      json.RawMessage // draft saved together with the state
 	ResultChan chan Result
 }
 
+type Document struct {
+	Name string
+	Data []byte
+}
+
 type Result struct {
 	Text         string
-	State        ExecuteFunc
+	State        string // step to resume on the next user input, built with statef
+	Draft        any    // json encoded and saved together with the state
 	InlineMarkup telegram.InlineKeyboardMarkup
 	ReplyMarkup  telegram.ReplyKeyboardMarkup
 	RemoveMarkup telegram.ReplyKeyboardRemove
 	Audio        map[string]string
+	Release      func()    // called once the result is sent, e.g. to remove the Audio files
+	Image        []byte    // png image sent as a new photo message, the Text is its caption
+	Document     *Document // file sent as a new document message, the Text is its caption
+	Photo        string    // telegram file id sent again as a new photo message, the Text is its caption
 	ClearState   bool
+	NewMessage   bool // sent as a new message even if the previous response has an inline keyboard
 	Error        error
 }
@@ -23,8 +23,24 @@ func (YTMP3Command) Description() string {
 	return "youtube to mp3"
 }
 
+func (YTMP3Command) Requirements() []utils.Requirement {
+	return []utils.Requirement{utils.RequireBinary("yt-dlp"), utils.RequireBinary("ffmpeg")}
+}
+
+const (
+	stepYTMP3Download = "download"
+)
+
 func (c *YTMP3Command) Execute(ctx context.Context, pl Payload) {
-	pl.ResultChan <- Result{Text: "Sure! Send me the YouTube link!", State: c.downloadSong}
+	pl.ResultChan <- Result{Text: "Sure! Send me the YouTube link!", State: statef(c, stepYTMP3Download)}
+}
+
+func (c *YTMP3Command) Resume(ctx context.Context, pl Payload) {
+	args := splitCommand(pl.State, c.Prefix())
+	switch safeGet(args, 0) {
+	case stepYTMP3Download:
+		c.downloadSong(ctx, pl)
+	}
 }
 
 func (c *YTMP3Command) downloadSong(ctx context.Context, pl Payload) {
@@ -36,7 +52,7 @@ func (c *YTMP3Command) downloadSong(ctx context.Context, pl Payload) {
 
 	downloadedFile, err := utils.Download(ctx, pl.Command, "")
 	if err != nil {
-		res = Result{State: c.downloadSong, Error: err}
+		res = Result{State: statef(c, stepYTMP3Download), Error: err}
 		if !errors.Is(err, context.Canceled) {
 			res.Text = "Whoops, download failed, try again :c"
 		}
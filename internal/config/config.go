@@ -4,27 +4,68 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+
+	"mr-weasel/internal/lib/telegram"
 
 	_ "github.com/joho/godotenv/autoload"
 )
 
 type Config struct {
 	Debug         bool
-	RTXMode       bool
 	TGToken       string
+	TGAPIURL      string
 	DBDriver      string
 	DBString      string
 	QueuePool     int
 	QueueParallel int
+	UpdatesMode   string
+	WebhookURL    string
+	WebhookListen string
+	WebhookSecret string
+	AdminID       int64
+	AllowUsers    []int64
+	DenyUsers     []int64
+	RateLimit     float64
+	RateBurst     int
+	WorkerMode    string
+	WorkerListen  string
+	WorkerToken   string
+	Tools         ToolsConfig
+}
+
+// ToolsConfig locates the audio tools, empty paths are resolved next to the executable.
+type ToolsConfig struct {
+	SeparatorPath string
+	RVCPath       string
+	RVCPython     string
+}
+
+// WorkerConfig configures the remote worker process.
+type WorkerConfig struct {
+	Debug       bool
+	WorkerURL   string
+	WorkerToken string
+	Tools       ToolsConfig
 }
 
 func GetConfig() Config {
 	config := Config{
 		Debug:    getenv("DEBUG", false) == "1",
-		RTXMode:  getenv("RTX_MODE", false) == "on",
 		TGToken:  getenv("TG_TOKEN", true),
+		TGAPIURL: getenv("TG_API_URL", false),
 		DBDriver: getenv("DB_DRIVER", true),
 		DBString: getenv("DB_STRING", true),
+
+		UpdatesMode:   getenv("UPDATES_MODE", false),
+		WebhookURL:    getenv("WEBHOOK_URL", false),
+		WebhookListen: getenv("WEBHOOK_LISTEN", false),
+		WebhookSecret: getenv("WEBHOOK_SECRET", false),
+
+		WorkerMode:   getenv("WORKER_MODE", false),
+		WorkerListen: getenv("WORKER_LISTEN", false),
+		WorkerToken:  getenv("WORKER_TOKEN", false),
+		Tools:        getToolsConfig(),
 	}
 
 	var err error
@@ -39,9 +80,92 @@ func GetConfig() Config {
 		panic(fmt.Sprintf("config: invalid QUEUE_PARALLEL value %s", err.Error()))
 	}
 
+	if adminID := getenv("ADMIN_ID", false); adminID != "" {
+		config.AdminID, err = strconv.ParseInt(adminID, 10, 64)
+		if err != nil {
+			panic(fmt.Sprintf("config: invalid ADMIN_ID value %s", err.Error()))
+		}
+	}
+
+	config.AllowUsers, err = parseIDs(getenv("ALLOW_USERS", false))
+	if err != nil {
+		panic(fmt.Sprintf("config: invalid ALLOW_USERS value %s", err.Error()))
+	}
+
+	config.DenyUsers, err = parseIDs(getenv("DENY_USERS", false))
+	if err != nil {
+		panic(fmt.Sprintf("config: invalid DENY_USERS value %s", err.Error()))
+	}
+
+	rateLimit := getenvDefault("RATE_LIMIT", "1")
+	config.RateLimit, err = strconv.ParseFloat(rateLimit, 64)
+	if err != nil || config.RateLimit <= 0 {
+		panic(fmt.Sprintf("config: invalid RATE_LIMIT value %s", rateLimit))
+	}
+
+	rateBurst := getenvDefault("RATE_BURST", "10")
+	config.RateBurst, err = strconv.Atoi(rateBurst)
+	if err != nil || config.RateBurst <= 0 {
+		panic(fmt.Sprintf("config: invalid RATE_BURST value %s", rateBurst))
+	}
+
+	if config.TGAPIURL == "" {
+		config.TGAPIURL = telegram.DefaultAPIURL
+	}
+
+	switch config.UpdatesMode {
+	case "":
+		config.UpdatesMode = "polling"
+	case "polling":
+	case "webhook":
+		if config.WebhookURL == "" {
+			panic("config: WEBHOOK_URL variable is required in webhook mode")
+		}
+		if config.WebhookSecret == "" {
+			panic("config: WEBHOOK_SECRET variable is required in webhook mode")
+		}
+		if config.WebhookListen == "" {
+			config.WebhookListen = ":8080"
+		}
+	default:
+		panic(fmt.Sprintf("config: invalid UPDATES_MODE value %s", config.UpdatesMode))
+	}
+
+	switch config.WorkerMode {
+	case "":
+		config.WorkerMode = "local"
+	case "local":
+	case "remote":
+		if config.WorkerToken == "" {
+			panic("config: WORKER_TOKEN variable is required in remote worker mode")
+		}
+		if config.WorkerListen == "" {
+			config.WorkerListen = ":8081"
+		}
+	default:
+		panic(fmt.Sprintf("config: invalid WORKER_MODE value %s", config.WorkerMode))
+	}
+
 	return config
 }
 
+func GetWorkerConfig() WorkerConfig {
+	return WorkerConfig{
+		Debug:       getenv("DEBUG", false) == "1",
+		WorkerURL:   strings.TrimSuffix(getenv("WORKER_URL", true), "/"),
+		WorkerToken: getenv("WORKER_TOKEN", true),
+		Tools:       getToolsConfig(),
+	}
+}
+
+func getToolsConfig() ToolsConfig {
+	return ToolsConfig{
+		SeparatorPath: getenv("AUDIO_SEPARATOR_PATH", false),
+		RVCPath:       getenv("RVC_PATH", false),
+		RVCPython:     getenv("RVC_PYTHON", false),
+	}
+}
+
 func getenv(key string, required bool) string {
 	value := os.Getenv(key)
 	if value == "" && required {
@@ -49,3 +173,27 @@ func getenv(key string, required bool) string {
 	}
 	return value
 }
+
+func getenvDefault(key string, value string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return value
+}
+
+// parseIDs parses a comma separated list of telegram ids.
+func parseIDs(value string) ([]int64, error) {
+	var ids []int64
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
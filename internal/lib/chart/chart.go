@@ -0,0 +1,283 @@
+// Package chart renders simple line and bar charts as PNG images.
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	width        = 800
+	height       = 480
+	marginLeft   = 70
+	marginRight  = 20
+	marginTop    = 60
+	marginBottom = 40
+	gridLines    = 5
+)
+
+var (
+	colorBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	colorText       = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	colorGrid       = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+	colorAxis       = color.RGBA{0x99, 0x99, 0x99, 0xff}
+)
+
+// palette is used for the series in order.
+var palette = []color.RGBA{
+	{0x1f, 0x77, 0xb4, 0xff},
+	{0xff, 0x7f, 0x0e, 0xff},
+	{0x2c, 0xa0, 0x2c, 0xff},
+	{0xd6, 0x27, 0x28, 0xff},
+	{0x94, 0x67, 0xbd, 0xff},
+}
+
+type Series struct {
+	Name   string
+	Values []float64 // one value per label, NaN for the missing ones
+}
+
+// Chart is drawn with the basic ASCII font, other characters are not rendered.
+type Chart struct {
+	Title  string
+	Labels []string // x axis labels
+	Series []Series
+}
+
+// Line renders the series as lines with a dot for every value.
+func (c Chart) Line() ([]byte, error) {
+	yMax := 0.0
+	for _, s := range c.Series {
+		for _, v := range s.Values {
+			if !math.IsNaN(v) {
+				yMax = max(yMax, v)
+			}
+		}
+	}
+
+	img, plot := c.canvas(yMax)
+	for i, s := range c.Series {
+		clr := palette[i%len(palette)]
+		prev := image.Point{}
+		hasPrev := false
+		for j, v := range s.Values {
+			if math.IsNaN(v) {
+				hasPrev = false
+				continue
+			}
+			p := image.Point{X: plot.x(j, len(c.Labels)), Y: plot.y(v)}
+			if hasPrev {
+				drawLine(img, prev, p, clr)
+			}
+			fillRect(img, image.Rect(p.X-3, p.Y-3, p.X+4, p.Y+4), clr)
+			prev, hasPrev = p, true
+		}
+	}
+
+	return encode(img)
+}
+
+// Bars renders the series as bars, stacked on top of each other.
+func (c Chart) Bars() ([]byte, error) {
+	yMax := 0.0
+	for j := range c.Labels {
+		yMax = max(yMax, c.sum(j))
+	}
+
+	img, plot := c.canvas(yMax)
+	barWidth := max(plot.width()/max(len(c.Labels), 1)*2/3, 1)
+	for j := range c.Labels {
+		x := plot.x(j, len(c.Labels))
+		bottom := 0.0
+		for i, s := range c.Series {
+			if j >= len(s.Values) || math.IsNaN(s.Values[j]) || s.Values[j] <= 0 {
+				continue
+			}
+			top := bottom + s.Values[j]
+			fillRect(img, image.Rect(x-barWidth/2, plot.y(top), x+barWidth/2, plot.y(bottom)), palette[i%len(palette)])
+			bottom = top
+		}
+	}
+
+	return encode(img)
+}
+
+func (c Chart) sum(j int) float64 {
+	total := 0.0
+	for _, s := range c.Series {
+		if j < len(s.Values) && !math.IsNaN(s.Values[j]) && s.Values[j] > 0 {
+			total += s.Values[j]
+		}
+	}
+	return total
+}
+
+// area is the plotting area of the chart with the y axis scale.
+type area struct {
+	rect image.Rectangle
+	yMax float64
+}
+
+func (a area) width() int {
+	return a.rect.Dx()
+}
+
+// x returns the center of the slot of the label j out of n.
+func (a area) x(j int, n int) int {
+	return a.rect.Min.X + (2*j+1)*a.rect.Dx()/(2*max(n, 1))
+}
+
+func (a area) y(v float64) int {
+	return a.rect.Max.Y - int(math.Round(v/a.yMax*float64(a.rect.Dy())))
+}
+
+// canvas draws the background, title, legend, grid and axis labels.
+func (c Chart) canvas(yMax float64) (*image.RGBA, area) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{colorBackground}, image.Point{}, draw.Src)
+
+	step := niceStep(yMax / gridLines)
+	plot := area{
+		rect: image.Rect(marginLeft, marginTop, width-marginRight, height-marginBottom),
+		yMax: step * gridLines,
+	}
+
+	drawText(img, c.Title, (width-textWidth(c.Title))/2, 20, colorText)
+
+	// legend is only needed when there are several series
+	if len(c.Series) > 1 {
+		x := marginLeft
+		for i, s := range c.Series {
+			fillRect(img, image.Rect(x, 32, x+10, 42), palette[i%len(palette)])
+			drawText(img, s.Name, x+14, 41, colorText)
+			x += textWidth(s.Name) + 30
+		}
+	}
+
+	for i := 0; i <= gridLines; i++ {
+		v := step * float64(i)
+		y := plot.y(v)
+		clr := colorGrid
+		if i == 0 {
+			clr = colorAxis
+		}
+		fillRect(img, image.Rect(plot.rect.Min.X, y, plot.rect.Max.X, y+1), clr)
+		label := formatValue(v)
+		drawText(img, label, plot.rect.Min.X-textWidth(label)-6, y+4, colorText)
+	}
+
+	// skip the labels which would overlap each other
+	n := len(c.Labels)
+	labelWidth := 0
+	for _, label := range c.Labels {
+		labelWidth = max(labelWidth, textWidth(label)+10)
+	}
+	every := 1
+	if n > 0 {
+		every = max(int(math.Ceil(float64(labelWidth*n)/float64(plot.width()))), 1)
+	}
+	for j, label := range c.Labels {
+		if j%every != 0 {
+			continue
+		}
+		x := plot.x(j, n)
+		drawText(img, label, x-textWidth(label)/2, plot.rect.Max.Y+18, colorText)
+	}
+
+	return img, plot
+}
+
+// niceStep rounds the grid step up to 1, 2 or 5 times a power of ten.
+func niceStep(raw float64) float64 {
+	if raw <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*magnitude {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func formatValue(v float64) string {
+	if v == math.Trunc(v) {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+func textWidth(s string) int {
+	return font.MeasureString(basicfont.Face7x13, s).Round()
+}
+
+func drawText(img *image.RGBA, s string, x int, y int, clr color.Color) {
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(clr),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(s)
+}
+
+func fillRect(img *image.RGBA, r image.Rectangle, clr color.Color) {
+	draw.Draw(img, r.Canon(), &image.Uniform{clr}, image.Point{}, draw.Src)
+}
+
+// drawLine draws a 2px wide line with the Bresenham's algorithm.
+func drawLine(img *image.RGBA, a image.Point, b image.Point, clr color.Color) {
+	dx, dy := abs(b.X-a.X), -abs(b.Y-a.Y)
+	sx, sy := sign(b.X-a.X), sign(b.Y-a.Y)
+	e := dx + dy
+	for {
+		fillRect(img, image.Rect(a.X, a.Y, a.X+2, a.Y+2), clr)
+		if a == b {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			a.X += sx
+		}
+		if e2 <= dx {
+			e += dx
+			a.Y += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func sign(v int) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
+
+func encode(img image.Image) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,52 @@
+package chart
+
+import (
+	"bytes"
+	"image/png"
+	"math"
+	"testing"
+)
+
+func TestNiceStep(t *testing.T) {
+	tests := []struct {
+		Input    float64
+		Expected float64
+	}{
+		{Input: 0, Expected: 1},
+		{Input: 0.7, Expected: 1},
+		{Input: 1.3, Expected: 2},
+		{Input: 34, Expected: 50},
+		{Input: 120, Expected: 200},
+		{Input: 600, Expected: 1000},
+	}
+	for _, test := range tests {
+		if actual := niceStep(test.Input); actual != test.Expected {
+			t.Errorf("actual [%v], [%+v]\n", actual, test)
+		}
+	}
+}
+
+func TestChartRender(t *testing.T) {
+	c := Chart{
+		Title:  "Monthly spend",
+		Labels: []string{"Jan 26", "Feb 26", "Mar 26"},
+		Series: []Series{
+			{Name: "Fuel", Values: []float64{120, 95.5, math.NaN()}},
+			{Name: "Service", Values: []float64{0, 300, 40}},
+		},
+	}
+
+	for name, render := range map[string]func() ([]byte, error){"Line": c.Line, "Bars": c.Bars} {
+		data, err := render()
+		if err != nil {
+			t.Fatalf("%s: actual error [%s]\n", name, err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: actual error [%s]\n", name, err)
+		}
+		if img.Bounds().Dx() != width || img.Bounds().Dy() != height {
+			t.Errorf("%s: actual bounds [%v]\n", name, img.Bounds())
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		Spec     string
+		Now      string
+		Expected string
+	}{
+		{Spec: "* * * * *", Now: "2026-10-18 09:13:45", Expected: "2026-10-18 09:14:00"},
+		{Spec: "0 9 * * *", Now: "2026-10-18 09:00:00", Expected: "2026-10-19 09:00:00"},
+		{Spec: "@hourly", Now: "2026-10-18 23:30:00", Expected: "2026-10-19 00:00:00"},
+		{Spec: "*/15 8-10 * * *", Now: "2026-10-18 10:50:00", Expected: "2026-10-19 08:00:00"},
+		{Spec: "30 6 * * 1-5", Now: "2026-10-17 12:00:00", Expected: "2026-10-19 06:30:00"},
+		{Spec: "0 0 * * 7", Now: "2026-10-18 12:00:00", Expected: "2026-10-25 00:00:00"},
+		{Spec: "0 0 31 * *", Now: "2026-10-31 00:00:00", Expected: "2026-12-31 00:00:00"},
+		{Spec: "0 0 29 2 *", Now: "2026-10-18 00:00:00", Expected: "2028-02-29 00:00:00"},
+		{Spec: "0 0 1,15 * 1", Now: "2026-10-18 00:00:00", Expected: "2026-10-19 00:00:00"},
+		{Spec: "5/20 * * * *", Now: "2026-10-18 09:46:00", Expected: "2026-10-18 10:05:00"},
+	}
+	for _, test := range tests {
+		s, err := Parse(test.Spec)
+		if err != nil {
+			t.Errorf("actual error [%s], [%+v]\n", err, test)
+			continue
+		}
+		now, _ := time.Parse(time.DateTime, test.Now)
+		if actual := s.Next(now).Format(time.DateTime); actual != test.Expected {
+			t.Errorf("actual [%s], [%+v]\n", actual, test)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *", "0 0 30 2 *"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("actual no error, [%s]\n", spec)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package telegram
+
+import "context"
+
+// API is the set of Bot API methods used by the bot, implemented by Client.
+type API interface {
+	GetMe(ctx context.Context, cfg GetMeConfig) (User, error)
+	SetMyCommands(ctx context.Context, cfg SetMyCommandsConfig) (bool, error)
+	SetWebhook(ctx context.Context, cfg SetWebhookConfig) (bool, error)
+	DeleteWebhook(ctx context.Context, cfg DeleteWebhookConfig) (bool, error)
+	GetUpdatesChan(ctx context.Context, cfg GetUpdatesConfig, chanSize int) <-chan Update
+	GetWebhookChan(ctx context.Context, addr string, path string, secret string, chanSize int) (<-chan Update, error)
+	GetFileURL(ctx context.Context, cfg GetFileConfig) (string, error)
+	SendMessage(ctx context.Context, cfg SendMessageConfig) (Message, error)
+	SendPhoto(ctx context.Context, cfg SendPhotoConfig, attach map[string]string) (Message, error)
+	SendDocument(ctx context.Context, cfg SendDocumentConfig, attach map[string]string) (Message, error)
+	SendMediaGroup(ctx context.Context, cfg SendMediaGroupConfig, attach map[string]string) ([]Message, error)
+	EditMessageText(ctx context.Context, cfg EditMessageTextConfig) (Message, error)
+	AnswerCallbackQuery(ctx context.Context, cfg AnswerCallbackQueryConfig) (bool, error)
+}
+
+var _ API = (*Client)(nil)
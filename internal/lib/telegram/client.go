@@ -17,19 +17,29 @@ import (
 	"mr-weasel/internal/lib/wrap"
 )
 
-const apiEndpoint = "https://api.telegram.org/bot%s/%s"
-const apiFileEndpoint = "https://api.telegram.org/file/bot%s/%s"
+// DefaultAPIURL is the base URL of the public Bot API server.
+const DefaultAPIURL = "https://api.telegram.org"
+
+const apiEndpoint = "%s/bot%s/%s"
+const apiFileEndpoint = "%s/file/bot%s/%s"
 
 type Client struct {
 	Me      User
 	hclient *http.Client
+	apiURL  string
 	token   string
 }
 
 func Connect(token string) (*Client, error) {
+	return ConnectWithURL(token, DefaultAPIURL)
+}
+
+// ConnectWithURL connects to the Bot API served at apiURL, e.g. a local Bot API server or a fake one in tests.
+func ConnectWithURL(token string, apiURL string) (*Client, error) {
 	const op = "telegram.Client.Connect"
 	client := &Client{
 		hclient: &http.Client{Timeout: 100 * time.Second},
+		apiURL:  strings.TrimSuffix(apiURL, "/"),
 		token:   token,
 	}
 	me, err := client.GetMe(context.Background(), GetMeConfig{})
@@ -70,6 +80,20 @@ func (c *Client) SendAudio(ctx context.Context, cfg SendAudioConfig, attach map[
 	return value, wrap.IfErr(op, err)
 }
 
+// Use this method to send photos. On success, the sent Message is returned.
+func (c *Client) SendPhoto(ctx context.Context, cfg SendPhotoConfig, attach map[string]string) (Message, error) {
+	const op = "telegram.Client.SendPhoto"
+	value, err := executeMethod[Message](ctx, c, cfg, attach)
+	return value, wrap.IfErr(op, err)
+}
+
+// Use this method to send general files. On success, the sent Message is returned. Bots can currently send files of any type of up to 50 MB in size.
+func (c *Client) SendDocument(ctx context.Context, cfg SendDocumentConfig, attach map[string]string) (Message, error) {
+	const op = "telegram.Client.SendDocument"
+	value, err := executeMethod[Message](ctx, c, cfg, attach)
+	return value, wrap.IfErr(op, err)
+}
+
 // Use this method to send a group of photos, videos, documents or audios as an album. Documents and audio files can be only grouped in an album with messages of the same type. On success, an array of Messages that were sent is returned.
 func (c *Client) SendMediaGroup(ctx context.Context, cfg SendMediaGroupConfig, attach map[string]string) ([]Message, error) {
 	const op = "telegram.Client.SendMediaGroup"
@@ -105,7 +129,7 @@ func (c *Client) GetFile(ctx context.Context, cfg GetFileConfig) (File, error) {
 func (c *Client) GetFileURL(ctx context.Context, cfg GetFileConfig) (string, error) {
 	const op = "telegram.Client.GetFileURL"
 	file, err := c.GetFile(ctx, cfg)
-	fileURL := fmt.Sprintf(apiFileEndpoint, c.token, file.FilePath)
+	fileURL := fmt.Sprintf(apiFileEndpoint, c.apiURL, c.token, file.FilePath)
 	return fileURL, wrap.IfErr(op, err)
 }
 
@@ -116,6 +140,27 @@ func (c *Client) SetMyCommands(ctx context.Context, cfg SetMyCommandsConfig) (bo
 	return value, wrap.IfErr(op, err)
 }
 
+// Use this method to specify a URL and receive incoming updates via an outgoing webhook. Returns True on success.
+func (c *Client) SetWebhook(ctx context.Context, cfg SetWebhookConfig) (bool, error) {
+	const op = "telegram.Client.SetWebhook"
+	value, err := executeMethod[bool](ctx, c, cfg, nil)
+	return value, wrap.IfErr(op, err)
+}
+
+// Use this method to remove webhook integration if you decide to switch back to getUpdates. Returns True on success.
+func (c *Client) DeleteWebhook(ctx context.Context, cfg DeleteWebhookConfig) (bool, error) {
+	const op = "telegram.Client.DeleteWebhook"
+	value, err := executeMethod[bool](ctx, c, cfg, nil)
+	return value, wrap.IfErr(op, err)
+}
+
+// Use this method to get current webhook status. On success, returns a WebhookInfo object. If the bot is using getUpdates, will return an object with the url field empty.
+func (c *Client) GetWebhookInfo(ctx context.Context, cfg GetWebhookInfoConfig) (WebhookInfo, error) {
+	const op = "telegram.Client.GetWebhookInfo"
+	value, err := executeMethod[WebhookInfo](ctx, c, cfg, nil)
+	return value, wrap.IfErr(op, err)
+}
+
 // Use this method to receive incoming updates using long polling. Starts a background goroutine, and returns a Channel with Update objects.
 func (c *Client) GetUpdatesChan(ctx context.Context, cfg GetUpdatesConfig, chanSize int) <-chan Update {
 	ch := make(chan Update, chanSize)
@@ -172,7 +217,13 @@ func writeMultipart(body *bytes.Buffer, cfg Config, attach map[string]string) (s
 	}
 
 	for fieldName, fieldValue := range raw {
-		writer.WriteField(fieldName, string(fieldValue))
+		// strings are sent as is, other values stay JSON-serialized
+		var str string
+		if json.Unmarshal(fieldValue, &str) == nil {
+			writer.WriteField(fieldName, str)
+		} else {
+			writer.WriteField(fieldName, string(fieldValue))
+		}
 	}
 
 	for partName, partPath := range attach {
@@ -216,7 +267,7 @@ func executeMethod[T any](ctx context.Context, client *Client, cfg Config, attac
 
 	log.Printf("[DEBUG] Request %s %s %+v %+v\b", contentType, cfg.Method(), cfg, attach)
 
-	url := fmt.Sprintf(apiEndpoint, client.token, cfg.Method())
+	url := fmt.Sprintf(apiEndpoint, client.apiURL, client.token, cfg.Method())
 	res, err := client.makeRequest(ctx, url, contentType, body)
 	if err != nil {
 		return value, err
@@ -96,6 +96,54 @@ func (SendAudioConfig) Method() string {
 	return "sendAudio"
 }
 
+type SendPhotoConfig struct {
+	// Unique identifier for the target chat or username of the target channel.
+	ChatID int64 `json:"chat_id"`
+	// Optional. Unique identifier for the target message thread (topic) of the forum; for forum supergroups only.
+	MessageThreadID int64 `json:"message_thread_id,omitempty"`
+	// Photo to send.
+	// Pass a file_id as String to send a photo that exists on the Telegram servers (recommended),
+	// pass an HTTP URL as a String for Telegram to get a photo from the Internet,
+	// or upload a new photo using multipart/form-data.
+	Photo string `json:"photo"`
+	// Optional. Photo caption, 0-1024 characters after entities parsing.
+	Caption string `json:"caption,omitempty"`
+	// Optional. Mode for parsing entities in the photo caption.
+	ParseMode string `json:"parse_mode,omitempty"`
+	// Optional. Sends the message silently. Users will receive a notification with no sound.
+	DisableNotification bool `json:"disable_notification,omitempty"`
+	// Optional. Additional interface options. A JSON-serialized object for an inline keyboard, custom reply keyboard, instructions to remove reply keyboard or to force a reply from the user.
+	ReplyMarkup ReplyMarkup `json:"reply_markup,omitempty"`
+}
+
+func (SendPhotoConfig) Method() string {
+	return "sendPhoto"
+}
+
+type SendDocumentConfig struct {
+	// Unique identifier for the target chat or username of the target channel.
+	ChatID int64 `json:"chat_id"`
+	// Optional. Unique identifier for the target message thread (topic) of the forum; for forum supergroups only.
+	MessageThreadID int64 `json:"message_thread_id,omitempty"`
+	// File to send.
+	// Pass a file_id as String to send a file that exists on the Telegram servers (recommended),
+	// pass an HTTP URL as a String for Telegram to get a file from the Internet,
+	// or upload a new one using multipart/form-data.
+	Document string `json:"document"`
+	// Optional. Document caption, 0-1024 characters after entities parsing.
+	Caption string `json:"caption,omitempty"`
+	// Optional. Mode for parsing entities in the document caption.
+	ParseMode string `json:"parse_mode,omitempty"`
+	// Optional. Sends the message silently. Users will receive a notification with no sound.
+	DisableNotification bool `json:"disable_notification,omitempty"`
+	// Optional. Additional interface options. A JSON-serialized object for an inline keyboard, custom reply keyboard, instructions to remove reply keyboard or to force a reply from the user.
+	ReplyMarkup ReplyMarkup `json:"reply_markup,omitempty"`
+}
+
+func (SendDocumentConfig) Method() string {
+	return "sendDocument"
+}
+
 type SendMediaGroupConfig struct {
 	// Unique identifier for the target chat or username of the target channel.
 	ChatID int64 `json:"chat_id"`
@@ -178,3 +226,38 @@ type SetMyCommandsConfig struct {
 func (SetMyCommandsConfig) Method() string {
 	return "setMyCommands"
 }
+
+type SetWebhookConfig struct {
+	// HTTPS URL to send updates to. Use an empty string to remove webhook integration.
+	URL string `json:"url"`
+	// Optional. The fixed IP address which will be used to send webhook requests instead of the IP address resolved through DNS.
+	IPAddress string `json:"ip_address,omitempty"`
+	// Optional. The maximum allowed number of simultaneous HTTPS connections to the webhook for update delivery, 1-100. Defaults to 40.
+	MaxConnections int `json:"max_connections,omitempty"`
+	// Optional. A JSON-serialized list of the update types you want your bot to receive. For example, specify [“message”, “edited_channel_post”, “callback_query”] to only receive updates of these types.
+	AllowedUpdates []string `json:"allowed_updates,omitempty"`
+	// Optional. Pass True to drop all pending updates.
+	DropPendingUpdates bool `json:"drop_pending_updates,omitempty"`
+	// Optional. A secret token to be sent in a header “X-Telegram-Bot-Api-Secret-Token” in every webhook request, 1-256 characters. Only characters A-Z, a-z, 0-9, _ and - are allowed.
+	SecretToken string `json:"secret_token,omitempty"`
+}
+
+func (SetWebhookConfig) Method() string {
+	return "setWebhook"
+}
+
+type DeleteWebhookConfig struct {
+	// Optional. Pass True to drop all pending updates.
+	DropPendingUpdates bool `json:"drop_pending_updates,omitempty"`
+}
+
+func (DeleteWebhookConfig) Method() string {
+	return "deleteWebhook"
+}
+
+type GetWebhookInfoConfig struct {
+}
+
+func (GetWebhookInfoConfig) Method() string {
+	return "getWebhookInfo"
+}
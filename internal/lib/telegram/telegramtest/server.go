@@ -0,0 +1,366 @@
+// Package telegramtest provides a fake Bot API server for end to end tests of the bot.
+package telegramtest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mr-weasel/internal/lib/telegram"
+)
+
+// Call is a Bot API request made by the bot.
+type Call struct {
+	Method string                     // Bot API method, e.g. sendMessage
+	Params map[string]json.RawMessage // JSON-serialized method parameters
+	Files  []string                   // names of the attached files
+	Data   map[string][]byte          // contents of the attached files by name
+	Result telegram.Message           // message sent or edited by the request, if any
+}
+
+// Text returns the text of the message sent or edited by the request.
+func (c Call) Text() string {
+	return c.Result.Text
+}
+
+// Button finds the inline keyboard button with the text on the message sent or edited by the request.
+func (c Call) Button(text string) (telegram.InlineKeyboardButton, bool) {
+	if c.Result.ReplyMarkup == nil {
+		return telegram.InlineKeyboardButton{}, false
+	}
+	for _, row := range c.Result.ReplyMarkup.InlineKeyboard {
+		for _, button := range row {
+			if button.Text == text {
+				return button, true
+			}
+		}
+	}
+	return telegram.InlineKeyboardButton{}, false
+}
+
+// Server is a fake Bot API server, which serves queued updates to getUpdates and records the requests made by the bot.
+type Server struct {
+	*httptest.Server
+	Me telegram.User // user returned by getMe
+
+	mu       sync.Mutex
+	lastID   int                      // last message id
+	updateID int                      // last update id
+	queryID  int                      // last callback query id
+	chats    map[int64]telegram.Chat  // chats seen in updates
+	messages map[int]telegram.Message // messages by id
+	files    map[string][]byte        // files served for download by file id
+	calls    []Call                   // all recorded requests
+	updates  chan telegram.Update     // updates waiting for getUpdates
+	replies  chan Call                // requests which send or edit messages
+}
+
+func NewServer() *Server {
+	s := &Server{
+		Me:       telegram.User{ID: 1, IsBot: true, FirstName: "Weasel", Username: "weasel_bot"},
+		chats:    make(map[int64]telegram.Chat),
+		messages: make(map[int]telegram.Message),
+		files:    make(map[string][]byte),
+		updates:  make(chan telegram.Update, 100),
+		replies:  make(chan Call, 1000),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// SendUpdate queues the update for the next getUpdates request.
+func (s *Server) SendUpdate(update telegram.Update) {
+	s.mu.Lock()
+	s.updateID++
+	update.UpdateID = s.updateID
+	s.mu.Unlock()
+	s.updates <- update
+}
+
+// SendText sends a text message from the user to the bot in a private chat.
+func (s *Server) SendText(user telegram.User, text string) {
+	s.SendMessage(user, telegram.Chat{ID: user.ID, Type: "private"}, text)
+}
+
+// SendMessage sends a text message from the user to the chat.
+func (s *Server) SendMessage(user telegram.User, chat telegram.Chat, text string) {
+	s.mu.Lock()
+	s.lastID++
+	s.chats[chat.ID] = chat
+	message := telegram.Message{MessageID: s.lastID, From: &user, Date: int(time.Now().Unix()), Chat: &chat, Text: text}
+	s.mu.Unlock()
+
+	if strings.HasPrefix(text, "/") {
+		command := strings.SplitN(text, " ", 2)[0]
+		message.Entities = []telegram.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	}
+
+	s.SendUpdate(telegram.Update{Message: &message})
+}
+
+// SendDocument uploads the file and sends it from the user to the bot in a private chat.
+func (s *Server) SendDocument(user telegram.User, fileName string, data []byte) {
+	chat := telegram.Chat{ID: user.ID, Type: "private"}
+
+	s.mu.Lock()
+	s.lastID++
+	fileID := "document" + strconv.Itoa(s.lastID)
+	s.files[fileID] = data
+	s.chats[chat.ID] = chat
+	message := telegram.Message{MessageID: s.lastID, From: &user, Date: int(time.Now().Unix()), Chat: &chat}
+	message.Document = &telegram.Document{FileID: fileID, FileUniqueID: fileID, FileName: fileName, FileSize: int64(len(data))}
+	s.mu.Unlock()
+
+	s.SendUpdate(telegram.Update{Message: &message})
+}
+
+// SendPhoto sends a photo with the caption from the user to the bot in a private chat, and returns the file id of the photo.
+func (s *Server) SendPhoto(user telegram.User, caption string) string {
+	chat := telegram.Chat{ID: user.ID, Type: "private"}
+
+	s.mu.Lock()
+	s.lastID++
+	fileID := "photo" + strconv.Itoa(s.lastID)
+	s.chats[chat.ID] = chat
+	message := telegram.Message{MessageID: s.lastID, From: &user, Date: int(time.Now().Unix()), Chat: &chat, Caption: caption}
+	message.Photo = []telegram.PhotoSize{
+		{FileID: fileID + "_small", FileUniqueID: fileID + "_small", Width: 90, Height: 160},
+		{FileID: fileID, FileUniqueID: fileID, Width: 720, Height: 1280},
+	}
+	s.mu.Unlock()
+
+	s.SendUpdate(telegram.Update{Message: &message})
+	return fileID
+}
+
+// SendUserShared sends the contact picked with the request user button from the user to the bot in a private chat.
+func (s *Server) SendUserShared(user telegram.User, sharedUserID int64) {
+	chat := telegram.Chat{ID: user.ID, Type: "private"}
+
+	s.mu.Lock()
+	s.lastID++
+	s.chats[chat.ID] = chat
+	message := telegram.Message{MessageID: s.lastID, From: &user, Date: int(time.Now().Unix()), Chat: &chat}
+	message.UserShared = &telegram.UserShared{UserID: sharedUserID}
+	s.mu.Unlock()
+
+	s.SendUpdate(telegram.Update{Message: &message})
+}
+
+// PressButton sends a callback query from the user, as if the button with data was pressed on the message.
+func (s *Server) PressButton(user telegram.User, message telegram.Message, data string) {
+	s.mu.Lock()
+	s.queryID++
+	id := s.queryID
+	if stored, ok := s.messages[message.MessageID]; ok {
+		message = stored
+	}
+	s.mu.Unlock()
+
+	s.SendUpdate(telegram.Update{CallbackQuery: &telegram.CallbackQuery{
+		ID:      strconv.Itoa(id),
+		From:    &user,
+		Message: &message,
+		Data:    data,
+	}})
+}
+
+// Calls returns the recorded requests of the method.
+func (s *Server) Calls(method string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []Call
+	for _, call := range s.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// NextReply waits for the next request which sends or edits a message, and fails the test after 5 seconds.
+func (s *Server) NextReply(t testing.TB) Call {
+	t.Helper()
+	select {
+	case call := <-s.replies:
+		return call
+	case <-time.After(5 * time.Second):
+		t.Fatal("telegramtest: timeout waiting for the bot reply")
+		return Call{}
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	// requests have /bot<token>/<method> path, downloads have /file/bot<token>/<file_path> path
+	split := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(split) == 4 && split[0] == "file" {
+		s.mu.Lock()
+		data, ok := s.files[split[3]]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		w.Write(data)
+		return
+	}
+	if len(split) != 2 || !strings.HasPrefix(split[0], "bot") {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	call := Call{Method: split[1], Params: make(map[string]json.RawMessage)}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		// form fields hold JSON-serialized values, except for plain strings
+		for name, values := range r.MultipartForm.Value {
+			if json.Valid([]byte(values[0])) {
+				call.Params[name] = json.RawMessage(values[0])
+			} else {
+				call.Params[name], _ = json.Marshal(values[0])
+			}
+		}
+		call.Data = make(map[string][]byte)
+		for name, headers := range r.MultipartForm.File {
+			call.Files = append(call.Files, name)
+			if file, err := headers[0].Open(); err == nil {
+				call.Data[name], _ = io.ReadAll(file)
+				file.Close()
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&call.Params); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var result any
+	switch call.Method {
+	case "getMe":
+		result = s.Me
+	case "getUpdates":
+		result = s.getUpdates(r)
+	case "sendMessage", "sendAudio", "sendPhoto", "sendDocument":
+		call.Result = s.storeMessage(call, 0)
+		result = call.Result
+	case "editMessageText":
+		var messageID int
+		json.Unmarshal(call.Params["message_id"], &messageID)
+		call.Result = s.storeMessage(call, messageID)
+		result = call.Result
+	case "sendMediaGroup":
+		var media []json.RawMessage
+		json.Unmarshal(call.Params["media"], &media)
+		messages := make([]telegram.Message, 0, len(media))
+		for range media {
+			messages = append(messages, s.storeMessage(call, 0))
+		}
+		if len(messages) > 0 {
+			call.Result = messages[0]
+		}
+		result = messages
+	case "getFile":
+		var fileID string
+		json.Unmarshal(call.Params["file_id"], &fileID)
+		result = telegram.File{FileID: fileID, FileUniqueID: fileID, FilePath: "files/" + fileID}
+	case "answerCallbackQuery", "setMyCommands", "setWebhook", "deleteWebhook":
+		result = true
+	default:
+		writeError(w, http.StatusNotFound, "Not Found: method not found")
+		return
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	s.mu.Unlock()
+
+	switch call.Method {
+	case "sendMessage", "sendAudio", "sendPhoto", "sendDocument", "editMessageText", "sendMediaGroup":
+		s.replies <- call
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(telegram.APIResponse{Ok: true, Result: data})
+}
+
+// getUpdates waits for the queued updates until the long polling timeout.
+func (s *Server) getUpdates(r *http.Request) []telegram.Update {
+	updates := []telegram.Update{}
+
+	select {
+	case update := <-s.updates:
+		updates = append(updates, update)
+	case <-r.Context().Done():
+		return updates
+	case <-time.After(time.Second):
+		return updates
+	}
+
+	for {
+		select {
+		case update := <-s.updates:
+			updates = append(updates, update)
+		default:
+			return updates
+		}
+	}
+}
+
+// storeMessage saves the message sent by the bot, or edits the existing one if messageID is set.
+func (s *Server) storeMessage(call Call, messageID int) telegram.Message {
+	var chatID int64
+	var text, caption string
+	var markup telegram.InlineKeyboardMarkup
+	json.Unmarshal(call.Params["chat_id"], &chatID)
+	json.Unmarshal(call.Params["text"], &text)
+	json.Unmarshal(call.Params["caption"], &caption)
+	json.Unmarshal(call.Params["reply_markup"], &markup)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chat, ok := s.chats[chatID]
+	if !ok {
+		chat = telegram.Chat{ID: chatID, Type: "private"}
+	}
+
+	message, ok := s.messages[messageID]
+	if !ok {
+		s.lastID++
+		message = telegram.Message{MessageID: s.lastID, From: &s.Me, Date: int(time.Now().Unix()), Chat: &chat}
+	}
+
+	message.Text = text
+	message.Caption = caption
+	switch call.Method {
+	case "sendPhoto":
+		message.Photo = []telegram.PhotoSize{{FileID: "photo", FileUniqueID: "photo"}}
+	case "sendDocument":
+		message.Document = &telegram.Document{FileID: "document", FileUniqueID: "document"}
+	}
+	message.ReplyMarkup = nil
+	if markup.InlineKeyboard != nil {
+		message.ReplyMarkup = &markup
+	}
+
+	s.messages[message.MessageID] = message
+	return message
+}
+
+func writeError(w http.ResponseWriter, code int, description string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(telegram.APIResponse{Ok: false, ErrorCode: code, Description: description})
+}
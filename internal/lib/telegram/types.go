@@ -43,6 +43,28 @@ type Update struct {
 	CallbackQuery *CallbackQuery `json:"callback_query,omitempty"`
 }
 
+// Describes the current status of a webhook.
+type WebhookInfo struct {
+	// Webhook URL, may be empty if webhook is not set up.
+	URL string `json:"url"`
+	// True, if a custom certificate was provided for webhook certificate checks.
+	HasCustomCertificate bool `json:"has_custom_certificate"`
+	// Number of updates awaiting delivery.
+	PendingUpdateCount int `json:"pending_update_count"`
+	// Optional. Currently used webhook IP address.
+	IPAddress string `json:"ip_address,omitempty"`
+	// Optional. Unix time for the most recent error that happened when trying to deliver an update via webhook.
+	LastErrorDate int64 `json:"last_error_date,omitempty"`
+	// Optional. Error message in human-readable format for the most recent error that happened when trying to deliver an update via webhook.
+	LastErrorMessage string `json:"last_error_message,omitempty"`
+	// Optional. Unix time of the most recent error that happened when trying to synchronize available updates with Telegram datacenters.
+	LastSynchronizationErrorDate int64 `json:"last_synchronization_error_date,omitempty"`
+	// Optional. The maximum allowed number of simultaneous HTTPS connections to the webhook for update delivery.
+	MaxConnections int `json:"max_connections,omitempty"`
+	// Optional. A list of update types the bot is subscribed to. Defaults to all update types except chat_member.
+	AllowedUpdates []string `json:"allowed_updates,omitempty"`
+}
+
 // This object represents a Telegram user or bot.
 type User struct {
 	// Unique identifier for this user or bot.
@@ -83,12 +105,16 @@ type Chat struct {
 type Message struct {
 	// Unique message identifier inside this chat.
 	MessageID int `json:"message_id"`
+	// Optional. Unique identifier of a message thread to which the message belongs; for supergroups only.
+	MessageThreadID int `json:"message_thread_id,omitempty"`
 	// Optional. Sender of the message; empty for messages sent to channels. For backward compatibility, the field contains a fake sender user in non-channel chats, if the message was sent on behalf of a chat.
 	From *User `json:"from,omitempty"`
 	// Date the message was sent in Unix time.
 	Date int `json:"date"`
 	// Conversation the message belongs to.
 	Chat *Chat `json:"chat"`
+	// Optional. True, if the message is sent to a forum topic.
+	IsTopicMessage bool `json:"is_topic_message,omitempty"`
 	// Optional. For replies, the original message. Note that the Message object in this field will not contain further reply_to_message fields even if it itself is a reply.
 	ReplyToMessage *Message `json:"reply_to_message,omitempty"`
 	// Optional. For text messages, the actual UTF-8 text of the message.
@@ -97,6 +123,12 @@ type Message struct {
 	Entities []MessageEntity `json:"entities,omitempty"`
 	// Optional. Message is an audio file, information about the file.
 	Audio *Audio `json:"audio,omitempty"`
+	// Optional. Message is a general file, information about the file.
+	Document *Document `json:"document,omitempty"`
+	// Optional. Message is a photo, available sizes of the photo.
+	Photo []PhotoSize `json:"photo,omitempty"`
+	// Optional. Caption for the animation, audio, document, photo, video or voice.
+	Caption string `json:"caption,omitempty"`
 	// Optional. Message is a voice message, information about the file.
 	Voice *Voice `json:"voice,omitempty"`
 	// Optional. Service message: a user was shared with the bot.
@@ -160,6 +192,20 @@ type Audio struct {
 	Thumbnail *PhotoSize `json:"thumbnail,omitempty"`
 }
 
+// This object represents a general file (as opposed to photos, voice messages and audio files).
+type Document struct {
+	// Identifier for this file, which can be used to download or reuse the file.
+	FileID string `json:"file_id"`
+	// Unique identifier for this file, which is supposed to be the same over time and for different bots. Can't be used to download or reuse the file.
+	FileUniqueID string `json:"file_unique_id"`
+	// Optional. Original filename as defined by sender.
+	FileName string `json:"file_name,omitempty"`
+	// Optional. MIME type of the file as defined by sender.
+	MimeType string `json:"mime_type,omitempty"`
+	// Optional. File size in bytes.
+	FileSize int64 `json:"file_size,omitempty"`
+}
+
 // This object represents a voice note.
 type Voice struct {
 	// Identifier for this file, which can be used to download or reuse the file.
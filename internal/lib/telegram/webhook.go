@@ -0,0 +1,120 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// WebhookHandler receives updates sent by the Bot API to the webhook URL and forwards them into a channel.
+type WebhookHandler struct {
+	secret  string
+	updates chan<- Update
+	done    chan struct{}
+	mu      sync.RWMutex // held by the handlers while they send, so the channel is closed after them
+	closed  bool
+}
+
+// NewWebhookHandler panics on the empty secret, the requests without the header would be accepted otherwise.
+func NewWebhookHandler(secret string, updates chan<- Update) *WebhookHandler {
+	if secret == "" {
+		panic("telegram: webhook secret is required")
+	}
+	return &WebhookHandler{secret: secret, updates: updates, done: make(chan struct{})}
+}
+
+// Close makes the pending and the new requests fail, and closes the updates channel once no handler can send to it.
+func (h *WebhookHandler) Close() {
+	close(h.done)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	close(h.updates)
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Bot API sends the secret_token from setWebhook with every request
+	token := r.Header.Get(secretTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.secret)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var update Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	select {
+	case h.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	case <-h.done:
+		// Bot API will redeliver the update later
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// Use this method to receive incoming updates using an outgoing webhook. Starts an HTTP server on addr in a background goroutine, and returns a Channel with Update objects.
+// The address is bound before returning, so the listen errors are reported to the caller, e.g. a port already in use.
+// The webhook itself has to be registered with SetWebhook, the server only listens for the requests forwarded by the reverse proxy.
+func (c *Client) GetWebhookChan(ctx context.Context, addr string, path string, secret string, chanSize int) (<-chan Update, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Update, chanSize)
+
+	handler := NewWebhookHandler(secret, ch)
+	mux := http.NewServeMux()
+	mux.Handle(path, handler)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	// the server stops when ctx is cancelled or when it fails, and the updates channel is closed in both cases
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		log.Printf("[INFO] Goroutine GetWebhookChan started on %s%s\n", ln.Addr(), path)
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println("[ERROR]", err)
+		}
+		cancel()
+	}()
+
+	go func() {
+		<-ctx.Done()
+		// the blocked handlers return first, Shutdown does not cancel their requests
+		handler.Close()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			server.Close()
+		}
+		log.Println("[INFO] Goroutine GetWebhookChan closed")
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,109 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	tests := []struct {
+		Method   string
+		Secret   string
+		Body     string
+		Expected int
+	}{
+		{Method: "POST", Secret: "s3cret", Body: `{"update_id":1}`, Expected: http.StatusOK},
+		{Method: "POST", Secret: "wrong", Body: `{"update_id":2}`, Expected: http.StatusUnauthorized},
+		{Method: "POST", Secret: "", Body: `{"update_id":3}`, Expected: http.StatusUnauthorized},
+		{Method: "POST", Secret: "s3cret", Body: `{`, Expected: http.StatusBadRequest},
+		{Method: "GET", Secret: "s3cret", Body: ``, Expected: http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		ch := make(chan Update, 1)
+		h := NewWebhookHandler("s3cret", ch)
+
+		req := httptest.NewRequest(test.Method, "/webhook", strings.NewReader(test.Body))
+		req.Header.Set(secretTokenHeader, test.Secret)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != test.Expected {
+			t.Fatalf("actual [%d], [%+v]\n", rec.Code, test)
+		}
+		if test.Expected == http.StatusOK {
+			if update := <-ch; update.UpdateID != 1 {
+				t.Fatalf("update does not match, actual [%+v], [%+v]\n", update, test)
+			}
+		} else if len(ch) != 0 {
+			t.Fatalf("unexpected update forwarded [%+v]\n", test)
+		}
+	}
+}
+
+func TestWebhookHandlerClose(t *testing.T) {
+	ch := make(chan Update) // nobody reads, the handler is blocked on send
+	h := NewWebhookHandler("s3cret", ch)
+
+	codes := make(chan int)
+	go func() {
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader([]byte(`{"update_id":1}`)))
+		req.Header.Set(secretTokenHeader, "s3cret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		codes <- rec.Code
+	}()
+
+	h.Close()
+	if code := <-codes; code != http.StatusServiceUnavailable {
+		t.Fatalf("actual [%d], expected [%d]\n", code, http.StatusServiceUnavailable)
+	}
+	if _, ok := <-ch; ok {
+		t.Fatalf("channel is not closed\n")
+	}
+
+	// the late requests after the channel is closed do not panic
+	req := httptest.NewRequest("POST", "/webhook", strings.NewReader(`{"update_id":2}`))
+	req.Header.Set(secretTokenHeader, "s3cret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("actual [%d], expected [%d]\n", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestWebhookHandlerEmptySecret(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic on the empty secret\n")
+		}
+	}()
+	NewWebhookHandler("", make(chan Update))
+}
+
+func TestGetWebhookChanListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// the port is already in use
+	if _, err := (&Client{}).GetWebhookChan(context.Background(), ln.Addr().String(), "/", "s3cret", 1); err == nil {
+		t.Fatalf("expected the listen error\n")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := (&Client{}).GetWebhookChan(ctx, "127.0.0.1:0", "/", "s3cret", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Fatalf("channel is not closed\n")
+	}
+}
@@ -0,0 +1,81 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestColumn(t *testing.T) {
+	tests := []struct {
+		Input    int
+		Expected string
+	}{
+		{Input: 0, Expected: "A"},
+		{Input: 25, Expected: "Z"},
+		{Input: 26, Expected: "AA"},
+		{Input: 27, Expected: "AB"},
+		{Input: 701, Expected: "ZZ"},
+		{Input: 702, Expected: "AAA"},
+	}
+	for _, test := range tests {
+		if actual := column(test.Input); actual != test.Expected {
+			t.Errorf("actual [%s], [%+v]\n", actual, test)
+		}
+	}
+}
+
+func TestSheetName(t *testing.T) {
+	tests := []struct {
+		Input    string
+		Expected string
+	}{
+		{Input: "Golf", Expected: "Golf"},
+		{Input: "Golf 1.6/TDI", Expected: "Golf 1.6 TDI"},
+		{Input: `a:b\c?d*e[f]`, Expected: "a b c d e f"},
+		{Input: "'Golf'", Expected: "Golf"},
+		{Input: "Volkswagen Golf Variant 1.6 TDI BlueMotion", Expected: "Volkswagen Golf Variant 1.6 TDI"},
+		{Input: "Škoda Octavia Combi 2.0 TDI Scout 4x4", Expected: "Škoda Octavia Combi 2.0 TDI Sco"},
+		{Input: "/", Expected: "Sheet1"},
+	}
+	for _, test := range tests {
+		if actual := sheetName(test.Input); actual != test.Expected {
+			t.Errorf("actual [%s], [%+v]\n", actual, test)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	buf := new(bytes.Buffer)
+	rows := [][]string{{"record", "euros"}, {"fuel", "70.50"}, {"service", "NaN"}, {"lease", "<b>&"}}
+	if err := Write(buf, "Golf", rows); err != nil {
+		t.Fatalf("actual error [%s]\n", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("actual error [%s]\n", err)
+	}
+
+	var sheet string
+	for _, f := range zr.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			r, _ := f.Open()
+			data, _ := io.ReadAll(r)
+			sheet = string(data)
+		}
+	}
+
+	for _, expected := range []string{
+		`<c r="A1" t="inlineStr"><is><t>record</t></is></c>`,
+		`<c r="B2"><v>70.50</v></c>`,
+		`<c r="B3" t="inlineStr"><is><t>NaN</t></is></c>`,
+		`<t>&lt;b&gt;&amp;</t>`,
+	} {
+		if !strings.Contains(sheet, expected) {
+			t.Errorf("actual [%s], expected [%s]\n", sheet, expected)
+		}
+	}
+}
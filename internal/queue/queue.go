@@ -0,0 +1,254 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"mr-weasel/internal/lib/wrap"
+	"mr-weasel/internal/storage"
+)
+
+// ErrQueueFull is returned by Enqueue when there are too many queued jobs.
+var ErrQueueFull = errors.New("queue is full")
+
+// Store persists the jobs, implemented by storage.JobStorage.
+type Store interface {
+	InsertJobIntoDB(ctx context.Context, job storage.Job) (int64, error)
+	SelectJobsByStatusFromDB(ctx context.Context, statuses ...string) ([]storage.Job, error)
+	SetJobStatusInDB(ctx context.Context, jobID int64, status string, errMsg string, timestamp int64) error
+}
+
+// Queue runs up to parallel jobs at once, and accepts up to pool jobs including the running ones.
+// Jobs are started in FIFO order, interleaved between users, so a user with many jobs does not block the others.
+type Queue struct {
+	store    Store
+	pool     int
+	parallel int
+
+	mu       sync.Mutex
+	tickets  []*Ticket       // queued and running jobs ordered by id
+	restored []storage.Job   // jobs interrupted by the restart, waiting to be enqueued again
+	running  int             // number of running tickets
+	changed  chan struct{}   // closed and replaced on every change
+	lifetime context.Context // jobs are kept queued in the database when it is done
+}
+
+// Ticket is a place of the job in the queue.
+type Ticket struct {
+	job     storage.Job
+	running bool
+}
+
+func (t *Ticket) JobID() int64 {
+	return t.job.ID
+}
+
+func NewQueue(store Store, pool int, parallel int) *Queue {
+	return &Queue{
+		store:    store,
+		pool:     pool,
+		parallel: parallel,
+		changed:  make(chan struct{}),
+		lifetime: context.Background(),
+	}
+}
+
+// Restore returns the jobs interrupted by the previous shutdown, they have to be executed again to be resumed.
+// When the same job is enqueued again, it keeps its original place in the queue.
+// The jobs interrupted when ctx is done are left queued in the database, and are restored on the next start.
+func (q *Queue) Restore(ctx context.Context) ([]storage.Job, error) {
+	const op = "queue.Queue.Restore"
+
+	jobs, err := q.store.SelectJobsByStatusFromDB(ctx, storage.JobQueued, storage.JobRunning)
+	if err != nil {
+		return nil, wrap.IfErr(op, err)
+	}
+
+	// jobs which are not enqueued again are considered cancelled
+	for _, job := range jobs {
+		if err := q.store.SetJobStatusInDB(ctx, job.ID, storage.JobCancelled, "interrupted by restart", time.Now().Unix()); err != nil {
+			return nil, wrap.IfErr(op, err)
+		}
+	}
+
+	q.mu.Lock()
+	q.restored = jobs
+	q.lifetime = ctx
+	q.mu.Unlock()
+
+	return jobs, nil
+}
+
+// Enqueue adds the job to the queue, the ticket has to be released with Done.
+func (q *Queue) Enqueue(ctx context.Context, job storage.Job) (*Ticket, error) {
+	const op = "queue.Queue.Enqueue"
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.tickets) >= q.pool {
+		return nil, ErrQueueFull
+	}
+
+	job.Status = storage.JobQueued
+	job.CreatedAt = time.Now().Unix()
+
+	if restored, ok := q.adopt(job); ok {
+		job = restored
+		if err := q.store.SetJobStatusInDB(ctx, job.ID, storage.JobQueued, "", job.CreatedAt); err != nil {
+			return nil, wrap.IfErr(op, err)
+		}
+	} else {
+		id, err := q.store.InsertJobIntoDB(ctx, job)
+		if err != nil {
+			return nil, wrap.IfErr(op, err)
+		}
+		job.ID = id
+	}
+
+	ticket := &Ticket{job: job}
+	i := sort.Search(len(q.tickets), func(i int) bool { return q.tickets[i].job.ID > job.ID })
+	q.tickets = append(q.tickets[:i], append([]*Ticket{ticket}, q.tickets[i:]...)...)
+
+	q.schedule()
+	return ticket, nil
+}
+
+// Wait blocks until the job is started, position is called with the place in the queue every time it changes.
+// If ctx is done first, the job is cancelled and removed from the queue.
+func (q *Queue) Wait(ctx context.Context, ticket *Ticket, position func(int)) error {
+	last := 0
+	for {
+		q.mu.Lock()
+		if ticket.running {
+			q.mu.Unlock()
+			return nil
+		}
+		pos := q.position(ticket)
+		changed := q.changed
+		q.mu.Unlock()
+
+		if pos != last {
+			position(pos)
+			last = pos
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			q.Done(ticket, ctx.Err())
+			return ctx.Err()
+		}
+	}
+}
+
+// Done removes the job from the queue, and records its outcome.
+func (q *Queue) Done(ticket *Ticket, err error) {
+	const op = "queue.Queue.Done"
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.index(ticket)
+	if i < 0 {
+		return
+	}
+	q.tickets = append(q.tickets[:i], q.tickets[i+1:]...)
+	if ticket.running {
+		q.running--
+	}
+
+	status, errMsg := storage.JobSucceeded, ""
+	if errors.Is(err, context.Canceled) {
+		status = storage.JobCancelled
+	} else if err != nil {
+		status, errMsg = storage.JobFailed, err.Error()
+	}
+
+	// on shutdown the job stays queued or running, and is restored on the next start
+	if q.lifetime.Err() == nil {
+		if err := q.store.SetJobStatusInDB(context.Background(), ticket.job.ID, status, errMsg, time.Now().Unix()); err != nil {
+			log.Println("[ERROR]", wrap.IfErr(op, err))
+		}
+	}
+
+	q.schedule()
+}
+
+// schedule starts the next jobs while there are free slots, the caller holds the lock.
+func (q *Queue) schedule() {
+	const op = "queue.Queue.schedule"
+
+	// nothing is started on shutdown, so the queued jobs are restored in their order
+	for q.running < q.parallel && q.lifetime.Err() == nil {
+		queued := q.queued()
+		if len(queued) == 0 {
+			break
+		}
+
+		ticket := queued[0]
+		ticket.running = true
+		q.running++
+
+		if err := q.store.SetJobStatusInDB(context.Background(), ticket.job.ID, storage.JobRunning, "", time.Now().Unix()); err != nil {
+			log.Println("[ERROR]", wrap.IfErr(op, err))
+		}
+	}
+
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// queued returns the waiting tickets in the order they are started.
+// Jobs are ordered by their rank first, so users with many jobs take turns with the others.
+// The rank is the number of the user jobs still in the queue ahead of the ticket, so it goes down as they are done.
+func (q *Queue) queued() []*Ticket {
+	queued := make([]*Ticket, 0, len(q.tickets)-q.running)
+	ranks := make(map[*Ticket]int, len(q.tickets))
+	users := make(map[int64]int)
+	for _, t := range q.tickets {
+		ranks[t] = users[t.job.UserID]
+		users[t.job.UserID]++
+		if !t.running {
+			queued = append(queued, t)
+		}
+	}
+
+	// tickets are ordered by id already, the stable sort keeps FIFO within the same rank
+	sort.SliceStable(queued, func(i, j int) bool { return ranks[queued[i]] < ranks[queued[j]] })
+	return queued
+}
+
+// position returns the 1-based place of the ticket among the waiting ones.
+func (q *Queue) position(ticket *Ticket) int {
+	for i, t := range q.queued() {
+		if t == ticket {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func (q *Queue) index(ticket *Ticket) int {
+	for i, t := range q.tickets {
+		if t == ticket {
+			return i
+		}
+	}
+	return -1
+}
+
+// adopt finds the same job interrupted by the restart, the caller holds the lock.
+func (q *Queue) adopt(job storage.Job) (storage.Job, bool) {
+	for i, r := range q.restored {
+		if r.UserID == job.UserID && r.ChatID == job.ChatID && r.ThreadID == job.ThreadID && r.Command == job.Command {
+			q.restored = append(q.restored[:i], q.restored[i+1:]...)
+			return r, true
+		}
+	}
+	return storage.Job{}, false
+}
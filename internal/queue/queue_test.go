@@ -0,0 +1,232 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"mr-weasel/internal/storage"
+)
+
+type memoryJobs struct {
+	mu   sync.Mutex
+	jobs map[int64]storage.Job
+	next int64
+}
+
+func newMemoryJobs() *memoryJobs {
+	return &memoryJobs{jobs: make(map[int64]storage.Job)}
+}
+
+func (s *memoryJobs) InsertJobIntoDB(ctx context.Context, job storage.Job) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	job.ID = s.next
+	s.jobs[job.ID] = job
+	return job.ID, nil
+}
+
+func (s *memoryJobs) SelectJobsByStatusFromDB(ctx context.Context, statuses ...string) ([]storage.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []storage.Job
+	for id := int64(1); id <= s.next; id++ {
+		for _, status := range statuses {
+			if job, ok := s.jobs[id]; ok && job.Status == status {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+	return jobs, nil
+}
+
+func (s *memoryJobs) SetJobStatusInDB(ctx context.Context, jobID int64, status string, errMsg string, timestamp int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[jobID]
+	job.Status = status
+	s.jobs[jobID] = job
+	return nil
+}
+
+func (s *memoryJobs) status(jobID int64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[jobID].Status
+}
+
+func enqueue(t *testing.T, q *Queue, userID int64, command string) *Ticket {
+	t.Helper()
+	ticket, err := q.Enqueue(context.Background(), storage.Job{UserID: userID, ChatID: userID, Command: command})
+	if err != nil {
+		t.Fatalf("actual error [%s]\n", err)
+	}
+	return ticket
+}
+
+func TestQueueFairness(t *testing.T) {
+	q := NewQueue(newMemoryJobs(), 10, 1)
+
+	running := enqueue(t, q, 1, "a1")
+	a2 := enqueue(t, q, 1, "a2")
+	a3 := enqueue(t, q, 1, "a3")
+	b1 := enqueue(t, q, 2, "b1")
+	c1 := enqueue(t, q, 3, "c1")
+	b2 := enqueue(t, q, 2, "b2")
+
+	if !running.running {
+		t.Fatalf("first job is not running\n")
+	}
+
+	// users take turns, the first user already has a running job
+	expected := []*Ticket{b1, c1, a2, b2, a3}
+	if actual := q.queued(); !reflect.DeepEqual(actual, expected) {
+		for _, ticket := range actual {
+			t.Errorf("actual order [%s]\n", ticket.job.Command)
+		}
+	}
+
+	// the first user has no jobs ahead of a2 anymore, and it is the oldest one
+	q.Done(running, nil)
+	if !a2.running {
+		t.Errorf("actual running [%v]\n", a2.running)
+	}
+	if pos := q.position(b1); pos != 1 {
+		t.Errorf("actual position [%d]\n", pos)
+	}
+}
+
+func TestQueueFairnessAfterDone(t *testing.T) {
+	q := NewQueue(newMemoryJobs(), 10, 1)
+
+	b1 := enqueue(t, q, 2, "b1")
+	a1 := enqueue(t, q, 1, "a1")
+	a2 := enqueue(t, q, 1, "a2")
+
+	// a1 is done before it is started, a2 has no user jobs ahead of it now
+	q.Done(a1, context.Canceled)
+	c1 := enqueue(t, q, 3, "c1")
+	d1 := enqueue(t, q, 4, "d1")
+
+	expected := []*Ticket{a2, c1, d1}
+	if actual := q.queued(); !reflect.DeepEqual(actual, expected) {
+		for _, ticket := range actual {
+			t.Errorf("actual order [%s]\n", ticket.job.Command)
+		}
+	}
+
+	q.Done(b1, nil)
+	if !a2.running {
+		t.Errorf("actual running [%v]\n", a2.running)
+	}
+}
+
+func TestQueueWait(t *testing.T) {
+	store := newMemoryJobs()
+	q := NewQueue(store, 10, 1)
+
+	first := enqueue(t, q, 1, "first")
+	second := enqueue(t, q, 2, "second")
+
+	var positions []int
+	done := make(chan error)
+	go func() {
+		done <- q.Wait(context.Background(), second, func(pos int) { positions = append(positions, pos) })
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	q.Done(first, errors.New("python script failed"))
+
+	if err := <-done; err != nil {
+		t.Fatalf("actual error [%s]\n", err)
+	}
+	if !reflect.DeepEqual(positions, []int{1}) {
+		t.Errorf("actual positions [%v]\n", positions)
+	}
+	if status := store.status(first.JobID()); status != storage.JobFailed {
+		t.Errorf("actual status [%s]\n", status)
+	}
+	if status := store.status(second.JobID()); status != storage.JobRunning {
+		t.Errorf("actual status [%s]\n", status)
+	}
+}
+
+func TestQueueCancel(t *testing.T) {
+	store := newMemoryJobs()
+	q := NewQueue(store, 2, 1)
+
+	first := enqueue(t, q, 1, "first")
+	second := enqueue(t, q, 2, "second")
+
+	if _, err := q.Enqueue(context.Background(), storage.Job{UserID: 3, Command: "third"}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("actual error [%v]\n", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := q.Wait(ctx, second, func(int) {}); !errors.Is(err, context.Canceled) {
+		t.Errorf("actual error [%v]\n", err)
+	}
+	if status := store.status(second.JobID()); status != storage.JobCancelled {
+		t.Errorf("actual status [%s]\n", status)
+	}
+
+	q.Done(first, nil)
+	if status := store.status(first.JobID()); status != storage.JobSucceeded {
+		t.Errorf("actual status [%s]\n", status)
+	}
+	if len(q.tickets) != 0 || q.running != 0 {
+		t.Errorf("actual tickets [%d], running [%d]\n", len(q.tickets), q.running)
+	}
+}
+
+func TestQueueRestore(t *testing.T) {
+	store := newMemoryJobs()
+
+	// the previous run is shut down with two jobs in the queue
+	ctx, shutdown := context.WithCancel(context.Background())
+	q := NewQueue(store, 10, 1)
+	if _, err := q.Restore(ctx); err != nil {
+		t.Fatalf("actual error [%s]\n", err)
+	}
+	running := enqueue(t, q, 1, "/changevoice start 1")
+	queued := enqueue(t, q, 2, "/changevoice start 2")
+	shutdown()
+	q.Done(running, context.Canceled)
+	q.Done(queued, context.Canceled)
+
+	if store.status(running.JobID()) != storage.JobRunning || store.status(queued.JobID()) != storage.JobQueued {
+		t.Fatalf("actual statuses [%s] [%s]\n", store.status(running.JobID()), store.status(queued.JobID()))
+	}
+
+	q = NewQueue(store, 10, 1)
+	jobs, err := q.Restore(context.Background())
+	if err != nil {
+		t.Fatalf("actual error [%s]\n", err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != running.JobID() || jobs[1].ID != queued.JobID() {
+		t.Fatalf("actual jobs [%v]\n", jobs)
+	}
+
+	// the restored jobs keep their order, even when they are enqueued again in a different one
+	fresh := enqueue(t, q, 3, "/extractvoice start X")
+	second := enqueue(t, q, 2, "/changevoice start 2")
+	first := enqueue(t, q, 1, "/changevoice start 1")
+
+	if second.JobID() != queued.JobID() || first.JobID() != running.JobID() {
+		t.Errorf("actual ids [%d] [%d]\n", first.JobID(), second.JobID())
+	}
+	if pos := q.position(first); pos != 1 {
+		t.Errorf("actual position [%d]\n", pos)
+	}
+	if pos := q.position(second); pos != 2 {
+		t.Errorf("actual position [%d]\n", pos)
+	}
+	if !fresh.running {
+		t.Errorf("actual running [%v]\n", fresh.running)
+	}
+}
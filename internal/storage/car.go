@@ -3,6 +3,9 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -16,27 +19,76 @@ func NewCarStorage(db *sqlx.DB) *CarStorage {
 	return &CarStorage{db: db}
 }
 
+// Units of the car, the receipts are always stored in kilometers and milliliters.
+const (
+	DistanceKilometers = "km"
+	DistanceMiles      = "mi"
+	VolumeLiters       = "l"
+	VolumeGallons      = "gal"
+)
+
+// BaseCurrency is used until the user chooses another one, the exchange rates are relative to it.
+const BaseCurrency = "EUR"
+
+// Car roles, the owner is the user of the car and the others are granted with car_access.
+// The viewers can only see the car, the editors can also change the receipts and the maintenance plans.
+const (
+	CarRoleViewer = "viewer"
+	CarRoleEditor = "editor"
+	CarRoleOwner  = "owner"
+)
+
 type CarBase struct {
-	ID     int64          `db:"id"`
-	UserID int64          `db:"user_id"`
-	Name   string         `db:"name"`
-	Year   int64          `db:"year"`
-	Plate  sql.NullString `db:"plate"`
-	Price  sql.NullInt64  `db:"price"`
+	ID           int64          `db:"id"`
+	UserID       int64          `db:"user_id"`
+	Name         string         `db:"name"`
+	Year         int64          `db:"year"`
+	Plate        sql.NullString `db:"plate"`
+	Price        sql.NullInt64  `db:"price"`  // in the base currency of the user
+	Resale       sql.NullInt64  `db:"resale"` // in the base currency of the user
+	DistanceUnit string         `db:"distance_unit"`
+	VolumeUnit   string         `db:"volume_unit"`
 }
 
 type CarDetails struct {
 	CarBase
-	Kilometers int64 `db:"kilometers"`
+	Kilometers int64  `db:"kilometers"`
+	Currency   string `db:"currency"` // base currency of the owner
+	Role       string `db:"role"`     // of the requesting user
+	Shares     int64  `db:"shares"`
 }
 
+func (c *CarDetails) IsOwner() bool {
+	return c.Role == CarRoleOwner
+}
+
+func (c *CarDetails) CanEdit() bool {
+	return c.Role == CarRoleOwner || c.Role == CarRoleEditor
+}
+
+// carUsersJoin joins the users of the car "c" as "u" with their role, the owner and everyone it is shared with.
+const carUsersJoin = `
+	join (
+		select id as car_id, user_id, 'owner' as role from car
+		union all
+		select car_id, user_id, role from car_access
+	) u on u.car_id = c.id`
+
+// carEditableSelect selects the cars whose receipts the user can change, as the owner or an editor.
+const carEditableSelect = `
+	select car_id from (
+		select id as car_id, user_id from car
+		union all
+		select car_id, user_id from car_access where role = 'editor'
+	) where user_id = ?`
+
 func (s *CarStorage) SelectCarsFromDB(ctx context.Context, userID int64) ([]CarDetails, error) {
 	var cars []CarDetails
 	stmt := `
-		select id, user_id, name, year, plate, price
-		from car
-		where user_id = ?
-		order by year, name;
+		select c.id, c.user_id, c.name, c.year, c.plate, c.price, c.resale, c.distance_unit, c.volume_unit, u.role
+		from car c` + carUsersJoin + `
+		where u.user_id = ?
+		order by c.year, c.name;
 	`
 	err := s.db.SelectContext(ctx, &cars, stmt, userID)
 	return cars, err
@@ -52,8 +104,14 @@ func (s *CarStorage) GetCarFromDB(ctx context.Context, userID int64, carID int64
 			,c.year
 			,c.plate
 			,c.price
+			,c.resale
+			,c.distance_unit
+			,c.volume_unit
 			,coalesce(f.kilometers, 0) as kilometers
-		from car c
+			,coalesce(cs.currency, 'EUR') as currency
+			,u.role
+			,(select count(*) from car_access a where a.car_id = c.id) as shares
+		from car c` + carUsersJoin + `
 		left join (
 			select
 				car_id
@@ -61,7 +119,8 @@ func (s *CarStorage) GetCarFromDB(ctx context.Context, userID int64, carID int64
 			from fuel
 			group by car_id
 		) f on f.car_id = c.id
-		where c.user_id = ? and c.id = ?;
+		left join car_settings cs on cs.user_id = c.user_id
+		where u.user_id = ? and c.id = ?;
 	`
 	err := s.db.GetContext(ctx, &car, stmt, userID, carID)
 	return car, err
@@ -77,8 +136,14 @@ func (s *CarStorage) DeleteCarFromDB(ctx context.Context, userID int64, carID in
 }
 
 func (s *CarStorage) InsertCarIntoDB(ctx context.Context, car CarBase) (int64, error) {
-	stmt := "insert into car (user_id, name, year, plate, price) values (?,?,?,?,?);"
-	res, err := s.db.ExecContext(ctx, stmt, car.UserID, car.Name, car.Year, car.Plate, car.Price)
+	if car.DistanceUnit == "" {
+		car.DistanceUnit = DistanceKilometers
+	}
+	if car.VolumeUnit == "" {
+		car.VolumeUnit = VolumeLiters
+	}
+	stmt := "insert into car (user_id, name, year, plate, price, resale, distance_unit, volume_unit) values (?,?,?,?,?,?,?,?);"
+	res, err := s.db.ExecContext(ctx, stmt, car.UserID, car.Name, car.Year, car.Plate, car.Price, car.Resale, car.DistanceUnit, car.VolumeUnit)
 	if err != nil {
 		return 0, err
 	}
@@ -86,28 +151,339 @@ func (s *CarStorage) InsertCarIntoDB(ctx context.Context, car CarBase) (int64, e
 }
 
 func (s *CarStorage) UpdateCarInDB(ctx context.Context, car CarBase) (int64, error) {
-	stmt := "update car set user_id = ?, name = ?, year = ?, plate = ?, price = ? where id = ?;"
-	res, err := s.db.ExecContext(ctx, stmt, car.UserID, car.Name, car.Year, car.Plate, car.Price, car.ID)
+	stmt := `
+		update car set user_id = ?, name = ?, year = ?, plate = ?, price = ?, resale = ?, distance_unit = ?, volume_unit = ?
+		where id = ?;
+	`
+	res, err := s.db.ExecContext(ctx, stmt, car.UserID, car.Name, car.Year, car.Plate, car.Price, car.Resale, car.DistanceUnit, car.VolumeUnit, car.ID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+type CarAccess struct {
+	CarID  int64  `db:"car_id"`
+	UserID int64  `db:"user_id"`
+	Name   string `db:"name"`
+	Role   string `db:"role"`
+}
+
+// SelectCarAccessFromDB returns the users the car is shared with, only to its owner.
+func (s *CarStorage) SelectCarAccessFromDB(ctx context.Context, userID int64, carID int64) ([]CarAccess, error) {
+	var access []CarAccess
+	stmt := `
+		select
+			a.car_id
+			,a.user_id
+			,coalesce(us.name, '') as name
+			,a.role
+		from car_access a
+		join car c on c.id = a.car_id
+		left join user us on us.id = a.user_id
+		where c.user_id = ? and c.id = ?
+		order by a.role desc, a.id;
+	`
+	err := s.db.SelectContext(ctx, &access, stmt, userID, carID)
+	return access, err
+}
+
+// UpsertCarAccessIntoDB shares the car of the user, or changes the role of the user it is already shared with.
+func (s *CarStorage) UpsertCarAccessIntoDB(ctx context.Context, userID int64, access CarAccess) (int64, error) {
+	stmt := `select id from car where user_id = ? and id = ?;`
+	var check int64
+	err := s.db.GetContext(ctx, &check, stmt, userID, access.CarID)
+	if err != nil {
+		return 0, err
+	}
+	if access.UserID == userID {
+		return 0, errors.New("car can not be shared with its owner")
+	}
+
+	stmt = `
+		insert into car_access (car_id, user_id, role) values (?,?,?)
+		on conflict (car_id, user_id) do update set role = excluded.role;
+	`
+	res, err := s.db.ExecContext(ctx, stmt, access.CarID, access.UserID, access.Role)
 	if err != nil {
 		return 0, err
 	}
 	return res.RowsAffected()
 }
 
+// DeleteCarAccessFromDB revokes the access of the user to the car, either by the owner or by the user itself.
+func (s *CarStorage) DeleteCarAccessFromDB(ctx context.Context, userID int64, carID int64, accessUserID int64) (int64, error) {
+	stmt := `
+		delete from car_access where car_id = ? and user_id = ?
+			and (user_id = ? or car_id in (select id from car where user_id = ?));
+	`
+	res, err := s.db.ExecContext(ctx, stmt, carID, accessUserID, userID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetCarCurrencyFromDB returns the base currency of the user, BaseCurrency if it was never changed.
+func (s *CarStorage) GetCarCurrencyFromDB(ctx context.Context, userID int64) (string, error) {
+	var currency string
+	stmt := `select currency from car_settings where user_id = ?;`
+	err := s.db.GetContext(ctx, &currency, stmt, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return BaseCurrency, nil
+	}
+	return currency, err
+}
+
+func (s *CarStorage) SetCarCurrencyInDB(ctx context.Context, userID int64, currency string) error {
+	stmt := `
+		insert into car_settings (user_id, currency) values (?,?)
+		on conflict (user_id) do update set currency = excluded.currency;
+	`
+	_, err := s.db.ExecContext(ctx, stmt, userID, currency)
+	return err
+}
+
+// ExchangeRate is the amount of the currency worth 1 BaseCurrency, shared by all users and set by the admins.
+type ExchangeRate struct {
+	Currency  string  `db:"currency"`
+	Rate      float64 `db:"rate"`
+	Timestamp int64   `db:"timestamp"`
+}
+
+func (r *ExchangeRate) GetTimestamp() string {
+	return time.Unix(r.Timestamp, 0).UTC().Format("02 January 2006")
+}
+
+func (s *CarStorage) SelectExchangeRatesFromDB(ctx context.Context) ([]ExchangeRate, error) {
+	var rates []ExchangeRate
+	stmt := `select currency, rate, timestamp from exchange_rate order by currency;`
+	err := s.db.SelectContext(ctx, &rates, stmt)
+	return rates, err
+}
+
+func (s *CarStorage) GetExchangeRateFromDB(ctx context.Context, currency string) (ExchangeRate, error) {
+	var rate ExchangeRate
+	stmt := `select currency, rate, timestamp from exchange_rate where currency = ?;`
+	err := s.db.GetContext(ctx, &rate, stmt, currency)
+	return rate, err
+}
+
+// UpsertExchangeRatesIntoDB inserts or replaces all the rates in one transaction.
+func (s *CarStorage) UpsertExchangeRatesIntoDB(ctx context.Context, rates []ExchangeRate) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, rate := range rates {
+		stmt := `
+			insert into exchange_rate (currency, rate, timestamp) values (?,?,?)
+			on conflict (currency) do update set rate = excluded.rate, timestamp = excluded.timestamp;
+		`
+		if _, err := tx.ExecContext(ctx, stmt, rate.Currency, rate.Rate, rate.Timestamp); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SelectMissingCurrenciesFromDB returns the currencies of the receipts of the user cars and the cars shared with the user,
+// including the base currency of the owners,
+// which have no exchange rate and are therefore converted 1:1.
+func (s *CarStorage) SelectMissingCurrenciesFromDB(ctx context.Context, userID int64) ([]string, error) {
+	var currencies []string
+	stmt := `
+		select distinct x.currency
+		from (
+			select car_id, currency from fuel
+			union all
+			select car_id, currency from service
+			union all
+			select car_id, currency from lease
+			union all
+			select c.id as car_id, cs.currency from car c join car_settings cs on cs.user_id = c.user_id
+		) x
+		join car c on c.id = x.car_id` + carUsersJoin + `
+		left join exchange_rate r on r.currency = x.currency
+		where u.user_id = ? and x.currency != ? and r.currency is null
+		order by x.currency;
+	`
+	err := s.db.SelectContext(ctx, &currencies, stmt, userID, BaseCurrency)
+	return currencies, err
+}
+
+// currencyOrBase stores the receipts without a currency in BaseCurrency, like the column default.
+func currencyOrBase(currency string) string {
+	if currency == "" {
+		return BaseCurrency
+	}
+	return currency
+}
+
+// baseCentsJoin joins the exchange rates of the receipt alias and of the base currency of the car owner,
+// the car has to be joined as "c".
+func baseCentsJoin(alias string) string {
+	return fmt.Sprintf(`
+		left join car_settings cs on cs.user_id = c.user_id
+		left join exchange_rate rr on rr.currency = %s.currency
+		left join exchange_rate rb on rb.currency = coalesce(cs.currency, 'EUR')`, alias)
+}
+
+// baseCents converts the cents of the receipt alias into the base currency through BaseCurrency,
+// the currencies without a rate are converted 1:1, see baseCentsJoin.
+func baseCents(alias string) string {
+	return fmt.Sprintf("cast(round(%s.cents * coalesce(rb.rate, 1) / coalesce(rr.rate, 1)) as integer)", alias)
+}
+
+// receiptsCTE selects the fuel, service and lease receipts of all cars into "r" in the base currency of their owner.
+var receiptsCTE = `
+	with x as (
+		select 'fuel' as category, car_id, user_id, timestamp, milliliters, cents, currency from fuel
+		union all
+		select 'service' as category, car_id, user_id, timestamp, 0, cents, currency from service
+		union all
+		select 'lease' as category, car_id, user_id, timestamp, 0, cents, currency from lease
+	), r as (
+		select x.category, x.car_id, coalesce(x.user_id, c.user_id) as user_id, x.timestamp, x.milliliters, ` + baseCents("x") + ` as cents
+		from x
+		join car c on c.id = x.car_id` + baseCentsJoin("x") + `
+	)`
+
+// CarCosts are in the base currency of the user.
+type CarCosts struct {
+	FuelCents      int64 `db:"fuel_cents"`
+	ServiceCents   int64 `db:"service_cents"`
+	LeaseCents     int64 `db:"lease_cents"`
+	FirstTimestamp int64 `db:"first_timestamp"` // earliest receipt, the start of the ownership
+}
+
+func (c *CarCosts) GetFuelAmount() float64 {
+	return float64(c.FuelCents) / 100
+}
+
+func (c *CarCosts) GetServiceAmount() float64 {
+	return float64(c.ServiceCents) / 100
+}
+
+func (c *CarCosts) GetLeaseAmount() float64 {
+	return float64(c.LeaseCents) / 100
+}
+
+func (c *CarCosts) GetAmount() float64 {
+	return float64(c.FuelCents+c.ServiceCents+c.LeaseCents) / 100
+}
+
+// GetCarCostsFromDB sums the fuel, service and lease receipts of the car.
+func (s *CarStorage) GetCarCostsFromDB(ctx context.Context, userID int64, carID int64) (CarCosts, error) {
+	var costs CarCosts
+	stmt := receiptsCTE + `
+		select
+			coalesce(sum(case when r.category = 'fuel' then r.cents end), 0) as fuel_cents
+			,coalesce(sum(case when r.category = 'service' then r.cents end), 0) as service_cents
+			,coalesce(sum(case when r.category = 'lease' then r.cents end), 0) as lease_cents
+			,coalesce(min(r.timestamp), 0) as first_timestamp
+		from car c` + carUsersJoin + `
+		left join r on r.car_id = c.id
+		where u.user_id = ? and c.id = ?;
+	`
+	err := s.db.GetContext(ctx, &costs, stmt, userID, carID)
+	return costs, err
+}
+
+// CarSpend is in the base currency of the user.
+type CarSpend struct {
+	Period       string `db:"period"`
+	FuelCents    int64  `db:"fuel_cents"`
+	ServiceCents int64  `db:"service_cents"`
+	LeaseCents   int64  `db:"lease_cents"`
+}
+
+// SelectCarSpendByMonthFromDB sums the receipts by category for the last months, in chronological order.
+func (s *CarStorage) SelectCarSpendByMonthFromDB(ctx context.Context, userID int64, carID int64, months int64) ([]CarSpend, error) {
+	var spend []CarSpend
+	stmt := receiptsCTE + `
+		select * from (
+			select
+				strftime('%Y-%m', r.timestamp, 'unixepoch') as period
+				,coalesce(sum(case when r.category = 'fuel' then r.cents end), 0) as fuel_cents
+				,coalesce(sum(case when r.category = 'service' then r.cents end), 0) as service_cents
+				,coalesce(sum(case when r.category = 'lease' then r.cents end), 0) as lease_cents
+			from r
+			join car c on c.id = r.car_id` + carUsersJoin + `
+			where u.user_id = ? and c.id = ?
+			group by 1
+			order by 1 desc
+			limit ?
+		)
+		order by period;
+	`
+	err := s.db.SelectContext(ctx, &spend, stmt, userID, carID, months)
+	return spend, err
+}
+
+// CarDriverSpend is in the base currency of the car owner.
+type CarDriverSpend struct {
+	UserID       int64  `db:"user_id"`
+	Name         string `db:"name"`
+	Receipts     int64  `db:"receipts"`
+	Milliliters  int64  `db:"milliliters"`
+	FuelCents    int64  `db:"fuel_cents"`
+	ServiceCents int64  `db:"service_cents"`
+	LeaseCents   int64  `db:"lease_cents"`
+}
+
+func (c *CarDriverSpend) GetAmount() float64 {
+	return float64(c.FuelCents+c.ServiceCents+c.LeaseCents) / 100
+}
+
+// SelectCarSpendByUserFromDB sums the receipts of the car by the user who entered them, the biggest spender first.
+func (s *CarStorage) SelectCarSpendByUserFromDB(ctx context.Context, userID int64, carID int64) ([]CarDriverSpend, error) {
+	var spend []CarDriverSpend
+	stmt := receiptsCTE + `
+		select
+			r.user_id
+			,coalesce(us.name, '') as name
+			,count(*) as receipts
+			,sum(r.milliliters) as milliliters
+			,coalesce(sum(case when r.category = 'fuel' then r.cents end), 0) as fuel_cents
+			,coalesce(sum(case when r.category = 'service' then r.cents end), 0) as service_cents
+			,coalesce(sum(case when r.category = 'lease' then r.cents end), 0) as lease_cents
+		from r
+		join car c on c.id = r.car_id` + carUsersJoin + `
+		left join user us on us.id = r.user_id
+		where u.user_id = ? and c.id = ?
+		group by r.user_id
+		order by sum(r.cents) desc, r.user_id;
+	`
+	err := s.db.SelectContext(ctx, &spend, stmt, userID, carID)
+	return spend, err
+}
+
 type FuelBase struct {
-	ID          int64  `db:"id"`
-	CarID       int64  `db:"car_id"`
-	Timestamp   int64  `db:"timestamp"`
-	Type        string `db:"type"`
-	Cents       int64  `db:"cents"`
-	Milliliters int64  `db:"milliliters"`
-	Kilometers  int64  `db:"kilometers"`
+	ID          int64          `db:"id"`
+	CarID       int64          `db:"car_id"`
+	UserID      int64          `db:"user_id"` // who entered the receipt
+	Timestamp   int64          `db:"timestamp"`
+	Type        string         `db:"type"`
+	Cents       int64          `db:"cents"`
+	Currency    string         `db:"currency"`
+	Milliliters int64          `db:"milliliters"`
+	Kilometers  int64          `db:"kilometers"`
+	FullTank    bool           `db:"full_tank"` // partial fills are only counted in the consumption of the next full tank
+	Photo       sql.NullString `db:"photo"`     // telegram file id of the paper receipt
 }
 
 type FuelDetails struct {
 	FuelBase
-	KilometersR int64 `db:"kilometersr"`
-	CountRows   int64 `db:"countrows"`
+	BaseCents    int64  `db:"base_cents"` // in the base currency of the owner
+	UserName     string `db:"user_name"`
+	KilometersR  int64  `db:"kilometersr"`
+	MillilitersC int64  `db:"milliliters_c"` // refueled since the previous full tank, including this one
+	KilometersC  int64  `db:"kilometers_c"`  // traveled since the previous full tank, 0 if it is unknown
+	CountRows    int64  `db:"countrows"`
 }
 
 func (f *FuelBase) GetTimestamp() string {
@@ -118,58 +494,264 @@ func (f *FuelBase) GetLiters() float64 {
 	return float64(f.Milliliters) / 1000
 }
 
-func (f *FuelBase) GetEuro() float64 {
+func (f *FuelBase) GetAmount() float64 {
 	return float64(f.Cents) / 100
 }
 
-func (f *FuelBase) GetEurPerLiter() float64 {
-	return f.GetEuro() / f.GetLiters()
-}
-
-func (f *FuelDetails) GetEurPerKilometer() float64 {
-	return f.GetEuro() / float64(f.KilometersR)
+func (f *FuelBase) GetAmountPerLiter() float64 {
+	return f.GetAmount() / f.GetLiters()
 }
 
+// GetLitersPerKilometer uses the full-to-full method, it is 0 for the partial fills and the first full tank.
 func (f *FuelDetails) GetLitersPerKilometer() float64 {
-	return (f.GetLiters() / float64(f.KilometersR)) * 100
+	if f.KilometersC <= 0 {
+		return 0
+	}
+	return (float64(f.MillilitersC) / 1000 / float64(f.KilometersC)) * 100
 }
 
-func (s *CarStorage) GetFuelFromDB(ctx context.Context, userID int64, carID int64, offset int64) (FuelDetails, error) {
-	var fuel FuelDetails
-	stmt := `
+// fuelDetailsCTE selects the receipts of the car into "d" with the distance since the previous receipt,
+// and the fills and the distance since the previous full tank. The segment of the receipt is the number of
+// full tanks before it, so the partial fills share the segment with the next full tank.
+var fuelDetailsCTE = `
+	with s as (
 		select
 			f.id
 			,f.car_id
+			,coalesce(f.user_id, c.user_id) as user_id
+			,coalesce(us.name, '') as user_name
 			,f.timestamp
 			,f.type
 			,f.milliliters
 			,f.kilometers
 			,f.cents
-			,coalesce(f.kilometers - lag(f.kilometers) over (order by f.timestamp, f.id), f.kilometers) as kilometersr
-			,count(*) over () as countrows
+			,f.currency
+			,f.full_tank
+			,f.photo
+			,` + baseCents("f") + ` as base_cents
+			,coalesce(sum(f.full_tank) over (order by f.timestamp, f.id rows between unbounded preceding and 1 preceding), 0) as segment
 		from fuel f
-		join car c on c.id = f.car_id 
-		where c.user_id = ? and c.id = ?
-		order by f.timestamp desc, f.id desc
+		join car c on c.id = f.car_id` + carUsersJoin + baseCentsJoin("f") + `
+		left join user us on us.id = coalesce(f.user_id, c.user_id)
+		where u.user_id = ? and c.id = ?
+	), d as (
+		select
+			s.id
+			,s.car_id
+			,s.user_id
+			,s.user_name
+			,s.timestamp
+			,s.type
+			,s.milliliters
+			,s.kilometers
+			,s.cents
+			,s.currency
+			,s.full_tank
+			,s.photo
+			,s.base_cents
+			,coalesce(s.kilometers - lag(s.kilometers) over (order by s.timestamp, s.id), s.kilometers) as kilometersr
+			,case when s.full_tank then sum(s.milliliters) over (partition by s.segment) else 0 end as milliliters_c
+			,case when s.full_tank then coalesce(s.kilometers - lag(s.kilometers) over (partition by s.full_tank order by s.timestamp, s.id), 0) else 0 end as kilometers_c
+			,count(*) over () as countrows
+		from s
+	)`
+
+func (s *CarStorage) GetFuelFromDB(ctx context.Context, userID int64, carID int64, offset int64) (FuelDetails, error) {
+	var fuel FuelDetails
+	stmt := fuelDetailsCTE + `
+		select * from d
+		order by d.timestamp desc, d.id desc
 		limit 1 offset ?;
 	`
 	err := s.db.GetContext(ctx, &fuel, stmt, userID, carID, offset)
 	return fuel, err
 }
 
+// GetFuelByIDFromDB returns the receipt with the traveled distance since the previous one.
+func (s *CarStorage) GetFuelByIDFromDB(ctx context.Context, userID int64, carID int64, fuelID int64) (FuelDetails, error) {
+	var fuel FuelDetails
+	stmt := fuelDetailsCTE + `
+		select * from d where d.id = ?;
+	`
+	err := s.db.GetContext(ctx, &fuel, stmt, userID, carID, fuelID)
+	return fuel, err
+}
+
+type FuelNeighbours struct {
+	Prev *FuelBase // nil for the first receipt
+	Next *FuelBase // nil for the last receipt
+}
+
+// GetFuelNeighboursFromDB returns the receipts right before and after the timestamp, ordered as in GetFuelFromDB.
+// The fuelID of the edited receipt excludes it, the new receipts with 0 are placed after the others of the same day.
+func (s *CarStorage) GetFuelNeighboursFromDB(ctx context.Context, userID int64, carID int64, timestamp int64, fuelID int64) (FuelNeighbours, error) {
+	var neighbours FuelNeighbours
+	if fuelID == 0 {
+		fuelID = math.MaxInt64
+	}
+
+	stmtPrev := `
+		select f.id, f.car_id, coalesce(f.user_id, c.user_id) as user_id, f.timestamp, f.type, f.milliliters, f.kilometers, f.cents, f.currency, f.full_tank
+		from fuel f
+		join car c on c.id = f.car_id` + carUsersJoin + `
+		where u.user_id = ? and c.id = ?
+			and (f.timestamp < ? or (f.timestamp = ? and f.id < ?))
+		order by f.timestamp desc, f.id desc
+		limit 1;
+	`
+	stmtNext := `
+		select f.id, f.car_id, coalesce(f.user_id, c.user_id) as user_id, f.timestamp, f.type, f.milliliters, f.kilometers, f.cents, f.currency, f.full_tank
+		from fuel f
+		join car c on c.id = f.car_id` + carUsersJoin + `
+		where u.user_id = ? and c.id = ?
+			and (f.timestamp > ? or (f.timestamp = ? and f.id > ?))
+		order by f.timestamp, f.id
+		limit 1;
+	`
+
+	get := func(stmt string) (*FuelBase, error) {
+		var fuel FuelBase
+		err := s.db.GetContext(ctx, &fuel, stmt, userID, carID, timestamp, timestamp, fuelID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return &fuel, err
+	}
+
+	var err error
+	if neighbours.Prev, err = get(stmtPrev); err != nil {
+		return neighbours, err
+	}
+	neighbours.Next, err = get(stmtNext)
+	return neighbours, err
+}
+
+const (
+	FuelStatsMonthly = "%Y-%m"
+	FuelStatsYearly  = "%Y"
+)
+
+type FuelStats struct {
+	Period         string          `db:"period"`
+	Receipts       int64           `db:"receipts"`
+	Cents          int64           `db:"cents"` // in the base currency of the user
+	Milliliters    int64           `db:"milliliters"`
+	Kilometers     int64           `db:"kilometers"`
+	MillilitersR   int64           `db:"milliliters_r"` // refueled after a known distance, used for the consumption
+	Best           sql.NullFloat64 `db:"best"`
+	BestTimestamp  int64           `db:"best_timestamp"`
+	Worst          sql.NullFloat64 `db:"worst"`
+	WorstTimestamp int64           `db:"worst_timestamp"`
+	CountRows      int64           `db:"countrows"`
+}
+
+func (f *FuelStats) GetLiters() float64 {
+	return float64(f.Milliliters) / 1000
+}
+
+func (f *FuelStats) GetAmount() float64 {
+	return float64(f.Cents) / 100
+}
+
+func (f *FuelStats) GetAmountPerLiter() float64 {
+	if f.Milliliters == 0 {
+		return 0
+	}
+	return f.GetAmount() / f.GetLiters()
+}
+
+func (f *FuelStats) GetAmountPerKilometer() float64 {
+	if f.Kilometers == 0 {
+		return 0
+	}
+	return f.GetAmount() / float64(f.Kilometers)
+}
+
+func (f *FuelStats) GetLitersPerKilometer() float64 {
+	if f.Kilometers == 0 {
+		return 0
+	}
+	return (float64(f.MillilitersR) / 1000 / float64(f.Kilometers)) * 100
+}
+
+// SelectFuelStatsFromDB aggregates the fuel receipts by period, one of FuelStatsMonthly or FuelStatsYearly.
+// Returns the period at offset, starting from the latest one, followed by the previous period if there is any.
+func (s *CarStorage) SelectFuelStatsFromDB(ctx context.Context, userID int64, carID int64, period string, offset int64) ([]FuelStats, error) {
+	var stats []FuelStats
+	stmt := fuelDetailsCTE + `, p as (
+			select
+				strftime(?, d.timestamp, 'unixepoch') as period
+				,d.timestamp
+				,d.base_cents
+				,d.milliliters
+				,d.milliliters_c
+				,d.kilometers_c
+				,case when d.kilometers_c > 0 then cast(d.milliliters_c as real) / d.kilometers_c / 10 end as consumption
+			from d
+		), b as (
+			select
+				p.*
+				,first_value(p.timestamp) over (partition by p.period order by p.consumption is null, p.consumption) as best_timestamp
+				,first_value(p.timestamp) over (partition by p.period order by p.consumption desc) as worst_timestamp
+			from p
+		)
+		select
+			b.period
+			,count(*) as receipts
+			,sum(b.base_cents) as cents
+			,sum(b.milliliters) as milliliters
+			,coalesce(sum(case when b.consumption is not null then b.kilometers_c end), 0) as kilometers
+			,coalesce(sum(case when b.consumption is not null then b.milliliters_c end), 0) as milliliters_r
+			,min(b.consumption) as best
+			,max(b.best_timestamp) as best_timestamp
+			,max(b.consumption) as worst
+			,max(b.worst_timestamp) as worst_timestamp
+			,count(*) over () as countrows
+		from b
+		group by b.period
+		order by b.period desc
+		limit 2 offset ?;
+	`
+	err := s.db.SelectContext(ctx, &stats, stmt, userID, carID, period, offset)
+	return stats, err
+}
+
+// SelectFuelsFromDB returns all fuel receipts of the car in chronological order.
+func (s *CarStorage) SelectFuelsFromDB(ctx context.Context, userID int64, carID int64) ([]FuelDetails, error) {
+	var fuels []FuelDetails
+	stmt := fuelDetailsCTE + `
+		select * from d
+		order by d.timestamp, d.id;
+	`
+	err := s.db.SelectContext(ctx, &fuels, stmt, userID, carID)
+	return fuels, err
+}
+
 func (s *CarStorage) InsertFuelIntoDB(ctx context.Context, fuel FuelBase) (int64, error) {
-	stmt := "insert into fuel (car_id, timestamp, type, milliliters, kilometers, cents) values (?,?,?,?,?,?);"
-	res, err := s.db.ExecContext(ctx, stmt, fuel.CarID, fuel.Timestamp, fuel.Type, fuel.Milliliters, fuel.Kilometers, fuel.Cents)
+	stmt := "insert into fuel (car_id, user_id, timestamp, type, milliliters, kilometers, cents, currency, full_tank, photo) values (?,nullif(?,0),?,?,?,?,?,?,?,?);"
+	res, err := s.db.ExecContext(ctx, stmt, fuel.CarID, fuel.UserID, fuel.Timestamp, fuel.Type, fuel.Milliliters, fuel.Kilometers, fuel.Cents, currencyOrBase(fuel.Currency), fuel.FullTank, fuel.Photo)
 	if err != nil {
 		return 0, err
 	}
 	return res.LastInsertId()
 }
 
+func (s *CarStorage) UpdateFuelInDB(ctx context.Context, userID int64, fuel FuelBase) (int64, error) {
+	stmt := `
+		update fuel set timestamp = ?, type = ?, milliliters = ?, kilometers = ?, cents = ?, currency = ?, full_tank = ?, photo = ?
+		where id = ? and car_id in (` + carEditableSelect + `);
+	`
+	res, err := s.db.ExecContext(ctx, stmt, fuel.Timestamp, fuel.Type, fuel.Milliliters, fuel.Kilometers, fuel.Cents, currencyOrBase(fuel.Currency), fuel.FullTank, fuel.Photo, fuel.ID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func (s *CarStorage) DeleteFuelFromDB(ctx context.Context, userID int64, fuelID int64) (int64, error) {
 	stmt := `
 		delete from fuel where id = ?
-			and car_id in (select id from car where user_id = ?);
+			and car_id in (` + carEditableSelect + `);
 	`
 	res, err := s.db.ExecContext(ctx, stmt, fuelID, userID)
 	if err != nil {
@@ -179,19 +761,24 @@ func (s *CarStorage) DeleteFuelFromDB(ctx context.Context, userID int64, fuelID
 }
 
 type ServiceBase struct {
-	ID          int64  `db:"id"`
-	CarID       int64  `db:"car_id"`
-	Timestamp   int64  `db:"timestamp"`
-	Description string `db:"description"`
-	Cents       int64  `db:"cents"`
+	ID          int64          `db:"id"`
+	CarID       int64          `db:"car_id"`
+	UserID      int64          `db:"user_id"` // who entered the receipt
+	Timestamp   int64          `db:"timestamp"`
+	Description string         `db:"description"`
+	Cents       int64          `db:"cents"`
+	Currency    string         `db:"currency"`
+	Photo       sql.NullString `db:"photo"` // telegram file id of the paper receipt
 }
 
 type ServiceDetails struct {
 	ServiceBase
-	CountRows int64 `db:"countrows"`
+	BaseCents int64  `db:"base_cents"` // in the base currency of the owner
+	UserName  string `db:"user_name"`
+	CountRows int64  `db:"countrows"`
 }
 
-func (s *ServiceBase) GetEuro() float64 {
+func (s *ServiceBase) GetAmount() float64 {
 	return float64(s.Cents) / 100
 }
 
@@ -205,13 +792,19 @@ func (s *CarStorage) GetServiceFromDB(ctx context.Context, userID int64, carID i
 		select
 			s.id
 			,s.car_id
+			,coalesce(s.user_id, c.user_id) as user_id
+			,coalesce(us.name, '') as user_name
 			,s.timestamp
 			,s.description
 			,s.cents
+			,s.currency
+			,s.photo
+			,` + baseCents("s") + ` as base_cents
 			,count(*) over () as countrows
 		from service s
-		join car c on c.id = s.car_id 
-		where c.user_id = ? and c.id = ?
+		join car c on c.id = s.car_id` + carUsersJoin + baseCentsJoin("s") + `
+		left join user us on us.id = coalesce(s.user_id, c.user_id)
+		where u.user_id = ? and c.id = ?
 		order by s.timestamp desc, s.id desc
 		limit 1 offset ?;
 	`
@@ -219,19 +812,81 @@ func (s *CarStorage) GetServiceFromDB(ctx context.Context, userID int64, carID i
 	return service, err
 }
 
+func (s *CarStorage) GetServiceByIDFromDB(ctx context.Context, userID int64, carID int64, serviceID int64) (ServiceDetails, error) {
+	var service ServiceDetails
+	stmt := `
+		select
+			s.id
+			,s.car_id
+			,coalesce(s.user_id, c.user_id) as user_id
+			,coalesce(us.name, '') as user_name
+			,s.timestamp
+			,s.description
+			,s.cents
+			,s.currency
+			,s.photo
+			,` + baseCents("s") + ` as base_cents
+			,1 as countrows
+		from service s
+		join car c on c.id = s.car_id` + carUsersJoin + baseCentsJoin("s") + `
+		left join user us on us.id = coalesce(s.user_id, c.user_id)
+		where u.user_id = ? and c.id = ? and s.id = ?;
+	`
+	err := s.db.GetContext(ctx, &service, stmt, userID, carID, serviceID)
+	return service, err
+}
+
+// SelectServicesFromDB returns all service receipts of the car in chronological order.
+func (s *CarStorage) SelectServicesFromDB(ctx context.Context, userID int64, carID int64) ([]ServiceDetails, error) {
+	var services []ServiceDetails
+	stmt := `
+		select
+			s.id
+			,s.car_id
+			,coalesce(s.user_id, c.user_id) as user_id
+			,coalesce(us.name, '') as user_name
+			,s.timestamp
+			,s.description
+			,s.cents
+			,s.currency
+			,s.photo
+			,` + baseCents("s") + ` as base_cents
+			,count(*) over () as countrows
+		from service s
+		join car c on c.id = s.car_id` + carUsersJoin + baseCentsJoin("s") + `
+		left join user us on us.id = coalesce(s.user_id, c.user_id)
+		where u.user_id = ? and c.id = ?
+		order by s.timestamp, s.id;
+	`
+	err := s.db.SelectContext(ctx, &services, stmt, userID, carID)
+	return services, err
+}
+
 func (s *CarStorage) InsertServiceIntoDB(ctx context.Context, service ServiceBase) (int64, error) {
-	stmt := "insert into service (car_id, timestamp, description, cents) values (?,?,?,?);"
-	res, err := s.db.ExecContext(ctx, stmt, service.CarID, service.Timestamp, service.Description, service.Cents)
+	stmt := "insert into service (car_id, user_id, timestamp, description, cents, currency, photo) values (?,nullif(?,0),?,?,?,?,?);"
+	res, err := s.db.ExecContext(ctx, stmt, service.CarID, service.UserID, service.Timestamp, service.Description, service.Cents, currencyOrBase(service.Currency), service.Photo)
 	if err != nil {
 		return 0, err
 	}
 	return res.LastInsertId()
 }
 
+func (s *CarStorage) UpdateServiceInDB(ctx context.Context, userID int64, service ServiceBase) (int64, error) {
+	stmt := `
+		update service set timestamp = ?, description = ?, cents = ?, currency = ?, photo = ?
+		where id = ? and car_id in (` + carEditableSelect + `);
+	`
+	res, err := s.db.ExecContext(ctx, stmt, service.Timestamp, service.Description, service.Cents, currencyOrBase(service.Currency), service.Photo, service.ID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func (s *CarStorage) DeleteServiceFromDB(ctx context.Context, userID int64, serviceID int64) (int64, error) {
 	stmt := `
 		delete from service where id = ?
-			and car_id in (select id from car where user_id = ?);
+			and car_id in (` + carEditableSelect + `);
 	`
 	res, err := s.db.ExecContext(ctx, stmt, serviceID, userID)
 	if err != nil {
@@ -243,22 +898,27 @@ func (s *CarStorage) DeleteServiceFromDB(ctx context.Context, userID int64, serv
 type LeaseBase struct {
 	ID          int64          `db:"id"`
 	CarID       int64          `db:"car_id"`
+	UserID      int64          `db:"user_id"` // who entered the receipt
 	Timestamp   int64          `db:"timestamp"`
 	Description sql.NullString `db:"description"`
 	Cents       int64          `db:"cents"`
+	Currency    string         `db:"currency"`
+	Photo       sql.NullString `db:"photo"` // telegram file id of the paper receipt
 }
 
 type LeaseDetails struct {
 	LeaseBase
-	CentsRT   int64 `db:"cents_rt"`
-	CountRows int64 `db:"countrows"`
+	BaseCents int64  `db:"base_cents"` // in the base currency of the owner
+	CentsRT   int64  `db:"cents_rt"`   // in the base currency of the owner
+	UserName  string `db:"user_name"`
+	CountRows int64  `db:"countrows"`
 }
 
-func (l *LeaseBase) GetEuro() float64 {
+func (l *LeaseBase) GetAmount() float64 {
 	return float64(l.Cents) / 100
 }
 
-func (l *LeaseDetails) GetEuroRT() float64 {
+func (l *LeaseDetails) GetBaseAmountRT() float64 {
 	return float64(l.CentsRT) / 100
 }
 
@@ -272,14 +932,20 @@ func (s *CarStorage) GetLeaseFromDB(ctx context.Context, userID int64, carID int
 		select
 			l.id
 			,l.car_id
+			,coalesce(l.user_id, c.user_id) as user_id
+			,coalesce(us.name, '') as user_name
 			,l.timestamp
 			,l.description
 			,l.cents
-			,sum(l.cents) over (order by l.timestamp) as cents_rt
+			,l.currency
+			,l.photo
+			,` + baseCents("l") + ` as base_cents
+			,sum(` + baseCents("l") + `) over (order by l.timestamp) as cents_rt
 			,count(*) over () as countrows
 		from lease l
-		join car c on c.id = l.car_id 
-		where c.user_id = ? and c.id = ?
+		join car c on c.id = l.car_id` + carUsersJoin + baseCentsJoin("l") + `
+		left join user us on us.id = coalesce(l.user_id, c.user_id)
+		where u.user_id = ? and c.id = ?
 		order by l.timestamp desc, l.id desc
 		limit 1 offset ?;
 	`
@@ -287,19 +953,86 @@ func (s *CarStorage) GetLeaseFromDB(ctx context.Context, userID int64, carID int
 	return lease, err
 }
 
+// GetLeaseByIDFromDB returns the receipt with the running total of the lease payments.
+func (s *CarStorage) GetLeaseByIDFromDB(ctx context.Context, userID int64, carID int64, leaseID int64) (LeaseDetails, error) {
+	var lease LeaseDetails
+	stmt := `
+		select * from (
+			select
+				l.id
+				,l.car_id
+				,coalesce(l.user_id, c.user_id) as user_id
+				,coalesce(us.name, '') as user_name
+				,l.timestamp
+				,l.description
+				,l.cents
+				,l.currency
+				,l.photo
+				,` + baseCents("l") + ` as base_cents
+				,sum(` + baseCents("l") + `) over (order by l.timestamp) as cents_rt
+				,count(*) over () as countrows
+			from lease l
+			join car c on c.id = l.car_id` + carUsersJoin + baseCentsJoin("l") + `
+			left join user us on us.id = coalesce(l.user_id, c.user_id)
+			where u.user_id = ? and c.id = ?
+		) where id = ?;
+	`
+	err := s.db.GetContext(ctx, &lease, stmt, userID, carID, leaseID)
+	return lease, err
+}
+
+// SelectLeasesFromDB returns all lease receipts of the car in chronological order.
+func (s *CarStorage) SelectLeasesFromDB(ctx context.Context, userID int64, carID int64) ([]LeaseDetails, error) {
+	var leases []LeaseDetails
+	stmt := `
+		select
+			l.id
+			,l.car_id
+			,coalesce(l.user_id, c.user_id) as user_id
+			,coalesce(us.name, '') as user_name
+			,l.timestamp
+			,l.description
+			,l.cents
+			,l.currency
+			,l.photo
+			,` + baseCents("l") + ` as base_cents
+			,sum(` + baseCents("l") + `) over (order by l.timestamp) as cents_rt
+			,count(*) over () as countrows
+		from lease l
+		join car c on c.id = l.car_id` + carUsersJoin + baseCentsJoin("l") + `
+		left join user us on us.id = coalesce(l.user_id, c.user_id)
+		where u.user_id = ? and c.id = ?
+		order by l.timestamp, l.id;
+	`
+	err := s.db.SelectContext(ctx, &leases, stmt, userID, carID)
+	return leases, err
+}
+
 func (s *CarStorage) InsertLeaseIntoDB(ctx context.Context, lease LeaseBase) (int64, error) {
-	stmt := "insert into lease (car_id, timestamp, description, cents) values (?,?,?,?);"
-	res, err := s.db.ExecContext(ctx, stmt, lease.CarID, lease.Timestamp, lease.Description, lease.Cents)
+	stmt := "insert into lease (car_id, user_id, timestamp, description, cents, currency, photo) values (?,nullif(?,0),?,?,?,?,?);"
+	res, err := s.db.ExecContext(ctx, stmt, lease.CarID, lease.UserID, lease.Timestamp, lease.Description, lease.Cents, currencyOrBase(lease.Currency), lease.Photo)
 	if err != nil {
 		return 0, err
 	}
 	return res.LastInsertId()
 }
 
+func (s *CarStorage) UpdateLeaseInDB(ctx context.Context, userID int64, lease LeaseBase) (int64, error) {
+	stmt := `
+		update lease set timestamp = ?, description = ?, cents = ?, currency = ?, photo = ?
+		where id = ? and car_id in (` + carEditableSelect + `);
+	`
+	res, err := s.db.ExecContext(ctx, stmt, lease.Timestamp, lease.Description, lease.Cents, currencyOrBase(lease.Currency), lease.Photo, lease.ID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func (s *CarStorage) DeleteLeaseFromDB(ctx context.Context, userID int64, leaseID int64) (int64, error) {
 	stmt := `
 		delete from lease where id = ?
-			and car_id in (select id from car where user_id = ?);
+			and car_id in (` + carEditableSelect + `);
 	`
 	res, err := s.db.ExecContext(ctx, stmt, leaseID, userID)
 	if err != nil {
@@ -307,3 +1040,212 @@ func (s *CarStorage) DeleteLeaseFromDB(ctx context.Context, userID int64, leaseI
 	}
 	return res.RowsAffected()
 }
+
+type CarRecords struct {
+	Fuels    []FuelBase
+	Services []ServiceBase
+	Leases   []LeaseBase
+}
+
+// InsertCarRecordsIntoDB inserts all the receipts in one transaction, nothing is inserted if any of them fails.
+// The receipts which already exist with the same date, mileage and amount are skipped, it returns the number of inserted ones.
+func (s *CarStorage) InsertCarRecordsIntoDB(ctx context.Context, records CarRecords) (int64, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var inserted int64
+	insert := func(stmt string, args ...any) error {
+		res, err := tx.ExecContext(ctx, stmt, args...)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		inserted += affected
+		return err
+	}
+
+	for _, fuel := range records.Fuels {
+		stmt := `
+			insert into fuel (car_id, user_id, timestamp, type, milliliters, kilometers, cents, currency, full_tank)
+			select ?,nullif(?,0),?,?,?,?,?,?,?
+			where not exists (select 1 from fuel where car_id = ? and timestamp = ? and kilometers = ? and cents = ?);
+		`
+		if err := insert(stmt, fuel.CarID, fuel.UserID, fuel.Timestamp, fuel.Type, fuel.Milliliters, fuel.Kilometers, fuel.Cents, currencyOrBase(fuel.Currency), fuel.FullTank,
+			fuel.CarID, fuel.Timestamp, fuel.Kilometers, fuel.Cents); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, service := range records.Services {
+		stmt := `
+			insert into service (car_id, user_id, timestamp, description, cents, currency)
+			select ?,nullif(?,0),?,?,?,?
+			where not exists (select 1 from service where car_id = ? and timestamp = ? and cents = ?);
+		`
+		if err := insert(stmt, service.CarID, service.UserID, service.Timestamp, service.Description, service.Cents, currencyOrBase(service.Currency),
+			service.CarID, service.Timestamp, service.Cents); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, lease := range records.Leases {
+		stmt := `
+			insert into lease (car_id, user_id, timestamp, description, cents, currency)
+			select ?,nullif(?,0),?,?,?,?
+			where not exists (select 1 from lease where car_id = ? and timestamp = ? and cents = ?);
+		`
+		if err := insert(stmt, lease.CarID, lease.UserID, lease.Timestamp, lease.Description, lease.Cents, currencyOrBase(lease.Currency),
+			lease.CarID, lease.Timestamp, lease.Cents); err != nil {
+			return 0, err
+		}
+	}
+
+	return inserted, tx.Commit()
+}
+
+type MaintenanceBase struct {
+	ID             int64         `db:"id"`
+	CarID          int64         `db:"car_id"`
+	Description    string        `db:"description"`
+	Kilometers     sql.NullInt64 `db:"kilometers"` // interval, null if the plan is not based on mileage
+	Months         sql.NullInt64 `db:"months"`     // interval, null if the plan is not based on time
+	LastKilometers int64         `db:"last_kilometers"`
+	LastTimestamp  int64         `db:"last_timestamp"`
+	SnoozedUntil   int64         `db:"snoozed_until"`
+	Reminded       int64         `db:"reminded_timestamp"` // when the last reminder was sent
+}
+
+type MaintenanceDetails struct {
+	MaintenanceBase
+	UserID        int64  `db:"user_id"`
+	CarName       string `db:"car_name"`
+	CarYear       int64  `db:"car_year"`
+	CarKilometers int64  `db:"car_kilometers"` // latest odometer reading
+	CarDistance   string `db:"car_distance_unit"`
+}
+
+func (m *MaintenanceBase) GetLastTimestamp() string {
+	return time.Unix(m.LastTimestamp, 0).UTC().Format("Monday, 02 January 2006")
+}
+
+// GetDueKilometers returns the odometer reading when the maintenance is due, valid only if Kilometers is.
+func (m *MaintenanceBase) GetDueKilometers() int64 {
+	return m.LastKilometers + m.Kilometers.Int64
+}
+
+// GetDueTime returns the date when the maintenance is due, valid only if Months is.
+func (m *MaintenanceBase) GetDueTime() time.Time {
+	return time.Unix(m.LastTimestamp, 0).UTC().AddDate(0, int(m.Months.Int64), 0)
+}
+
+const maintenanceDetailsSelect = `
+	select
+		m.id
+		,m.car_id
+		,m.description
+		,m.kilometers
+		,m.months
+		,m.last_kilometers
+		,m.last_timestamp
+		,m.snoozed_until
+		,m.reminded_timestamp
+		,c.user_id
+		,c.name as car_name
+		,c.year as car_year
+		,max(coalesce(f.kilometers, 0), m.last_kilometers) as car_kilometers
+		,c.distance_unit as car_distance_unit
+	from maintenance m
+	join car c on c.id = m.car_id
+	left join (
+		select
+			car_id
+			,max(kilometers) as kilometers
+		from fuel
+		group by car_id
+	) f on f.car_id = c.id
+`
+
+func (s *CarStorage) SelectMaintenancesFromDB(ctx context.Context, userID int64, carID int64) ([]MaintenanceDetails, error) {
+	var maintenances []MaintenanceDetails
+	stmt := maintenanceDetailsSelect + carUsersJoin + `
+		where u.user_id = ? and c.id = ?
+		order by m.description, m.id;
+	`
+	err := s.db.SelectContext(ctx, &maintenances, stmt, userID, carID)
+	return maintenances, err
+}
+
+func (s *CarStorage) GetMaintenanceFromDB(ctx context.Context, userID int64, carID int64, maintenanceID int64) (MaintenanceDetails, error) {
+	var maintenance MaintenanceDetails
+	stmt := maintenanceDetailsSelect + carUsersJoin + `
+		where u.user_id = ? and c.id = ? and m.id = ?;
+	`
+	err := s.db.GetContext(ctx, &maintenance, stmt, userID, carID, maintenanceID)
+	return maintenance, err
+}
+
+// SelectMaintenancesToRemindFromDB returns the plans of the cars the user can edit which are not snoozed at the timestamp,
+// and were not reminded after the since timestamp. Whether they are due is up to the caller.
+// The plans of the shared cars are reminded once, to the first of the drivers.
+func (s *CarStorage) SelectMaintenancesToRemindFromDB(ctx context.Context, userID int64, timestamp int64, since int64) ([]MaintenanceDetails, error) {
+	var maintenances []MaintenanceDetails
+	stmt := maintenanceDetailsSelect + `
+		where c.id in (` + carEditableSelect + `) and m.snoozed_until <= ? and m.reminded_timestamp <= ?
+		order by c.year, c.name, m.description, m.id;
+	`
+	err := s.db.SelectContext(ctx, &maintenances, stmt, userID, timestamp, since)
+	return maintenances, err
+}
+
+// CountMaintenancesFromDB returns the number of plans of all the cars the user can edit.
+func (s *CarStorage) CountMaintenancesFromDB(ctx context.Context, userID int64) (int64, error) {
+	var count int64
+	stmt := `
+		select count(*)
+		from maintenance m
+		where m.car_id in (` + carEditableSelect + `);
+	`
+	err := s.db.GetContext(ctx, &count, stmt, userID)
+	return count, err
+}
+
+func (s *CarStorage) InsertMaintenanceIntoDB(ctx context.Context, maintenance MaintenanceBase) (int64, error) {
+	stmt := `
+		insert into maintenance (car_id, description, kilometers, months, last_kilometers, last_timestamp, snoozed_until, reminded_timestamp)
+		values (?,?,?,?,?,?,?,?);
+	`
+	res, err := s.db.ExecContext(ctx, stmt, maintenance.CarID, maintenance.Description, maintenance.Kilometers, maintenance.Months,
+		maintenance.LastKilometers, maintenance.LastTimestamp, maintenance.SnoozedUntil, maintenance.Reminded)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (s *CarStorage) UpdateMaintenanceInDB(ctx context.Context, userID int64, maintenance MaintenanceBase) (int64, error) {
+	stmt := `
+		update maintenance set description = ?, kilometers = ?, months = ?, last_kilometers = ?, last_timestamp = ?, snoozed_until = ?, reminded_timestamp = ?
+		where id = ? and car_id in (` + carEditableSelect + `);
+	`
+	res, err := s.db.ExecContext(ctx, stmt, maintenance.Description, maintenance.Kilometers, maintenance.Months, maintenance.LastKilometers,
+		maintenance.LastTimestamp, maintenance.SnoozedUntil, maintenance.Reminded, maintenance.ID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *CarStorage) DeleteMaintenanceFromDB(ctx context.Context, userID int64, maintenanceID int64) (int64, error) {
+	stmt := `
+		delete from maintenance where id = ?
+			and car_id in (` + carEditableSelect + `);
+	`
+	res, err := s.db.ExecContext(ctx, stmt, maintenanceID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -33,6 +34,24 @@ type HolidayDaysByYear struct {
 	Days int64 `db:"days"`
 }
 
+// HolidayAllowance is the number of holiday days of the year, it stays the same for the next years until changed.
+// Up to CarryDays unused days are carried over to the next year, and can be used there for CarryMonths if set.
+type HolidayAllowance struct {
+	ID          int64         `db:"id"`
+	UserID      int64         `db:"user_id"`
+	Year        int64         `db:"year"`
+	Days        int64         `db:"days"`
+	CarryDays   int64         `db:"carry_days"`
+	CarryMonths sql.NullInt64 `db:"carry_months"`
+}
+
+type PublicHoliday struct {
+	ID        int64  `db:"id"`
+	UserID    int64  `db:"user_id"`
+	Timestamp int64  `db:"timestamp"`
+	Name      string `db:"name"`
+}
+
 func (h *HolidayBase) GetStartTimestamp() string {
 	return time.Unix(h.Start, 0).UTC().Format("Monday, 02 January 2006")
 }
@@ -53,6 +72,18 @@ func (s *HolidayStorage) SelectHolidayDaysByYearFromDB(ctx context.Context, user
 	return holidays, err
 }
 
+func (s *HolidayStorage) SelectHolidaysFromDB(ctx context.Context, userID int64) ([]HolidayBase, error) {
+	var holidays []HolidayBase
+	stmt := `
+		select id, user_id, start, end, days
+		from holiday
+		where user_id = ?
+		order by start;
+	`
+	err := s.db.SelectContext(ctx, &holidays, stmt, userID)
+	return holidays, err
+}
+
 func (s *HolidayStorage) GetHolidayFromDB(ctx context.Context, userID int64, offset int64) (HolidayDetails, error) {
 	var holiday HolidayDetails
 	stmt := `
@@ -84,3 +115,61 @@ func (s *HolidayStorage) DeleteHolidayFromDB(ctx context.Context, userID int64,
 	}
 	return res.RowsAffected()
 }
+
+func (p *PublicHoliday) GetTimestamp() string {
+	return time.Unix(p.Timestamp, 0).UTC().Format("Monday, 02 January 2006")
+}
+
+func (s *HolidayStorage) SelectHolidayAllowancesFromDB(ctx context.Context, userID int64) ([]HolidayAllowance, error) {
+	var allowances []HolidayAllowance
+	stmt := `
+		select id, user_id, year, days, carry_days, carry_months
+		from holiday_allowance
+		where user_id = ?
+		order by year;
+	`
+	err := s.db.SelectContext(ctx, &allowances, stmt, userID)
+	return allowances, err
+}
+
+// UpsertHolidayAllowanceIntoDB sets the allowance of the year, or replaces the one already set.
+func (s *HolidayStorage) UpsertHolidayAllowanceIntoDB(ctx context.Context, allowance HolidayAllowance) error {
+	stmt := `
+		insert into holiday_allowance (user_id, year, days, carry_days, carry_months) values (?,?,?,?,?)
+		on conflict (user_id, year) do update set days = excluded.days, carry_days = excluded.carry_days, carry_months = excluded.carry_months;
+	`
+	_, err := s.db.ExecContext(ctx, stmt, allowance.UserID, allowance.Year, allowance.Days, allowance.CarryDays, allowance.CarryMonths)
+	return err
+}
+
+// SelectPublicHolidaysFromDB returns the public holidays between the timestamps, both included.
+func (s *HolidayStorage) SelectPublicHolidaysFromDB(ctx context.Context, userID int64, from int64, to int64) ([]PublicHoliday, error) {
+	var holidays []PublicHoliday
+	stmt := `
+		select id, user_id, timestamp, name
+		from public_holiday
+		where user_id = ? and timestamp between ? and ?
+		order by timestamp;
+	`
+	err := s.db.SelectContext(ctx, &holidays, stmt, userID, from, to)
+	return holidays, err
+}
+
+// UpsertPublicHolidayIntoDB adds the public holiday, or renames the one already on the same day.
+func (s *HolidayStorage) UpsertPublicHolidayIntoDB(ctx context.Context, holiday PublicHoliday) error {
+	stmt := `
+		insert into public_holiday (user_id, timestamp, name) values (?,?,?)
+		on conflict (user_id, timestamp) do update set name = excluded.name;
+	`
+	_, err := s.db.ExecContext(ctx, stmt, holiday.UserID, holiday.Timestamp, holiday.Name)
+	return err
+}
+
+func (s *HolidayStorage) DeletePublicHolidayFromDB(ctx context.Context, userID int64, holidayID int64) (int64, error) {
+	stmt := `delete from public_holiday where user_id = ? and id = ?;`
+	res, err := s.db.ExecContext(ctx, stmt, userID, holidayID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Job statuses, queued and running jobs are resumed after a restart.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+type JobStorage struct {
+	db *sqlx.DB
+}
+
+func NewJobStorage(db *sqlx.DB) *JobStorage {
+	return &JobStorage{db: db}
+}
+
+// Job is a queued command, executed again on behalf of the user to resume it.
+type Job struct {
+	ID         int64          `db:"id"`
+	UserID     int64          `db:"user_id"`
+	UserName   string         `db:"user_name"`
+	ChatID     int64          `db:"chat_id"`
+	ThreadID   int64          `db:"thread_id"`
+	Command    string         `db:"command"`
+	Status     string         `db:"status"`
+	Error      sql.NullString `db:"error"`
+	CreatedAt  int64          `db:"created_at"`
+	StartedAt  sql.NullInt64  `db:"started_at"`
+	FinishedAt sql.NullInt64  `db:"finished_at"`
+}
+
+func (s *JobStorage) InsertJobIntoDB(ctx context.Context, job Job) (int64, error) {
+	stmt := `
+		insert into job (user_id, user_name, chat_id, thread_id, command, status, created_at)
+		values (?,?,?,?,?,?,?);
+	`
+	res, err := s.db.ExecContext(ctx, stmt, job.UserID, job.UserName, job.ChatID, job.ThreadID, job.Command, job.Status, job.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (s *JobStorage) SelectJobsByStatusFromDB(ctx context.Context, statuses ...string) ([]Job, error) {
+	var jobs []Job
+	stmt := `
+		select id, user_id, user_name, chat_id, thread_id, command, status, error, created_at, started_at, finished_at from job
+		where status in (?` + strings.Repeat(",?", len(statuses)-1) + `)
+		order by id;
+	`
+	args := make([]any, 0, len(statuses))
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+	err := s.db.SelectContext(ctx, &jobs, stmt, args...)
+	return jobs, err
+}
+
+// SetJobStatusInDB updates the job status, the timestamp is saved as the start time for running jobs, and as the finish time for finished ones.
+func (s *JobStorage) SetJobStatusInDB(ctx context.Context, jobID int64, status string, errMsg string, timestamp int64) error {
+	stmt := `
+		update job set
+			status = :status,
+			error = nullif(:error, ''),
+			started_at = case :status when 'queued' then null when 'running' then :timestamp else started_at end,
+			finished_at = case :status when 'queued' then null when 'running' then null else :timestamp end
+		where id = :id;
+	`
+	_, err := s.db.NamedExecContext(ctx, stmt, map[string]any{
+		"id":        jobID,
+		"status":    status,
+		"error":     errMsg,
+		"timestamp": timestamp,
+	})
+	return err
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type StateStorage struct {
+	db *sqlx.DB
+}
+
+func NewStateStorage(db *sqlx.DB) *StateStorage {
+	return &StateStorage{db: db}
+}
+
+// State is a conversation step waiting for the user input, with the json encoded draft collected so far.
+// Conversations are kept per chat, user and forum topic (thread 0 outside of topics).
+type State struct {
+	ChatID   int64  `db:"chat_id"`
+	UserID   int64  `db:"user_id"`
+	ThreadID int64  `db:"thread_id"`
+	Step     string `db:"step"`
+	Draft    string `db:"draft"`
+}
+
+func (s *StateStorage) GetStateFromDB(ctx context.Context, chatID int64, userID int64, threadID int64) (State, error) {
+	var state State
+	stmt := `
+		select chat_id, user_id, thread_id, step, draft from state
+		where chat_id = ? and user_id = ? and thread_id = ?;
+	`
+	err := s.db.GetContext(ctx, &state, stmt, chatID, userID, threadID)
+	return state, err
+}
+
+func (s *StateStorage) SetStateInDB(ctx context.Context, state State) error {
+	stmt := `
+		insert into state (chat_id, user_id, thread_id, step, draft) values (?,?,?,?,?)
+		on conflict (chat_id, user_id, thread_id) do update set step = excluded.step, draft = excluded.draft;
+	`
+	_, err := s.db.ExecContext(ctx, stmt, state.ChatID, state.UserID, state.ThreadID, state.Step, state.Draft)
+	return err
+}
+
+func (s *StateStorage) DeleteStateFromDB(ctx context.Context, chatID int64, userID int64, threadID int64) error {
+	stmt := `delete from state where chat_id = ? and user_id = ? and thread_id = ?;`
+	_, err := s.db.ExecContext(ctx, stmt, chatID, userID, threadID)
+	return err
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Catch-up policies of the tasks missed while the bot was down.
+const (
+	TaskCatchUpOnce = "once" // missed runs are merged into one run as soon as possible
+	TaskCatchUpSkip = "skip" // missed runs are dropped, one-shot tasks are deleted
+)
+
+type TaskStorage struct {
+	db *sqlx.DB
+}
+
+func NewTaskStorage(db *sqlx.DB) *TaskStorage {
+	return &TaskStorage{db: db}
+}
+
+// Task is a command executed on behalf of the user at the scheduled time, repeatedly if it has a cron spec.
+type Task struct {
+	ID        int64  `db:"id"`
+	Key       string `db:"key"` // unique per user, scheduling the same key again replaces the task
+	UserID    int64  `db:"user_id"`
+	UserName  string `db:"user_name"`
+	ChatID    int64  `db:"chat_id"`
+	ThreadID  int64  `db:"thread_id"`
+	Command   string `db:"command"`
+	Spec      string `db:"spec"` // cron spec, empty for one-shot tasks
+	CatchUp   string `db:"catch_up"`
+	NextRunAt int64  `db:"next_run_at"`
+	CreatedAt int64  `db:"created_at"`
+}
+
+// UpsertTaskInDB inserts the task, or replaces the task of the user with the same key.
+func (s *TaskStorage) UpsertTaskInDB(ctx context.Context, task Task) error {
+	stmt := `
+		insert into task (key, user_id, user_name, chat_id, thread_id, command, spec, catch_up, next_run_at, created_at)
+		values (?,?,?,?,?,?,?,?,?,?)
+		on conflict (user_id, key) do update set
+			user_name = excluded.user_name
+			,chat_id = excluded.chat_id
+			,thread_id = excluded.thread_id
+			,command = excluded.command
+			,spec = excluded.spec
+			,catch_up = excluded.catch_up
+			,next_run_at = excluded.next_run_at;
+	`
+	_, err := s.db.ExecContext(ctx, stmt, task.Key, task.UserID, task.UserName, task.ChatID, task.ThreadID, task.Command,
+		task.Spec, task.CatchUp, task.NextRunAt, task.CreatedAt)
+	return err
+}
+
+// SelectDueTasksFromDB returns the tasks scheduled at the timestamp or earlier, the most overdue first.
+func (s *TaskStorage) SelectDueTasksFromDB(ctx context.Context, timestamp int64) ([]Task, error) {
+	var tasks []Task
+	stmt := `
+		select id, key, user_id, user_name, chat_id, thread_id, command, spec, catch_up, next_run_at, created_at from task
+		where next_run_at <= ?
+		order by next_run_at, id;
+	`
+	err := s.db.SelectContext(ctx, &tasks, stmt, timestamp)
+	return tasks, err
+}
+
+func (s *TaskStorage) SetTaskNextRunInDB(ctx context.Context, taskID int64, timestamp int64) error {
+	stmt := `update task set next_run_at = ? where id = ?;`
+	_, err := s.db.ExecContext(ctx, stmt, timestamp, taskID)
+	return err
+}
+
+func (s *TaskStorage) DeleteTaskFromDB(ctx context.Context, taskID int64) error {
+	stmt := `delete from task where id = ?;`
+	_, err := s.db.ExecContext(ctx, stmt, taskID)
+	return err
+}
+
+func (s *TaskStorage) DeleteTaskByKeyFromDB(ctx context.Context, userID int64, key string) error {
+	stmt := `delete from task where user_id = ? and key = ?;`
+	_, err := s.db.ExecContext(ctx, stmt, userID, key)
+	return err
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// User roles, ordered from the least to the most privileged.
+const (
+	RoleBlocked = "blocked"
+	RolePending = "pending"
+	RoleMember  = "member"
+	RoleAdmin   = "admin"
+)
+
+type UserStorage struct {
+	db *sqlx.DB
+}
+
+func NewUserStorage(db *sqlx.DB) *UserStorage {
+	return &UserStorage{db: db}
+}
+
+type User struct {
+	ID        int64  `db:"id"`
+	Name      string `db:"name"`
+	Role      string `db:"role"`
+	Timestamp int64  `db:"timestamp"`
+}
+
+func (u *User) GetTimestamp() string {
+	return time.Unix(u.Timestamp, 0).UTC().Format("Monday, 02 January 2006")
+}
+
+func (s *UserStorage) GetUserFromDB(ctx context.Context, userID int64) (User, error) {
+	var user User
+	stmt := `select id, name, role, timestamp from user where id = ?;`
+	err := s.db.GetContext(ctx, &user, stmt, userID)
+	return user, err
+}
+
+func (s *UserStorage) SelectUsersFromDB(ctx context.Context) ([]User, error) {
+	var users []User
+	stmt := `
+		select id, name, role, timestamp from user
+		order by case role when 'pending' then 0 when 'admin' then 1 when 'member' then 2 else 3 end, timestamp;
+	`
+	err := s.db.SelectContext(ctx, &users, stmt)
+	return users, err
+}
+
+func (s *UserStorage) SelectUsersByRoleFromDB(ctx context.Context, role string) ([]User, error) {
+	var users []User
+	stmt := `select id, name, role, timestamp from user where role = ? order by timestamp;`
+	err := s.db.SelectContext(ctx, &users, stmt, role)
+	return users, err
+}
+
+// InsertUserIntoDB adds a new user, returns false if the user already exists.
+func (s *UserStorage) InsertUserIntoDB(ctx context.Context, user User) (bool, error) {
+	stmt := `insert into user (id, name, role, timestamp) values (?,?,?,?) on conflict (id) do nothing;`
+	res, err := s.db.ExecContext(ctx, stmt, user.ID, user.Name, user.Role, user.Timestamp)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// UpsertUserInDB adds a new user, or sets the role of the existing one.
+func (s *UserStorage) UpsertUserInDB(ctx context.Context, user User) error {
+	stmt := `
+		insert into user (id, name, role, timestamp) values (?,?,?,?)
+		on conflict (id) do update set role = excluded.role;
+	`
+	_, err := s.db.ExecContext(ctx, stmt, user.ID, user.Name, user.Role, user.Timestamp)
+	return err
+}
+
+func (s *UserStorage) SetUserRoleInDB(ctx context.Context, userID int64, role string) (int64, error) {
+	stmt := `update user set role = ? where id = ?;`
+	res, err := s.db.ExecContext(ctx, stmt, role, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -28,27 +28,31 @@ type AudioSeparatorResult struct {
 	VoicePath string
 }
 
-func NewAudioSeparator() *AudioSeparator {
+// NewAudioSeparator expects the audio-separator venv at root, or next to the executable if root is empty.
+func NewAudioSeparator(root string) *AudioSeparator {
+	if root == "" {
+		root = filepath.Join(GetExecutablePath(), "audio-separator")
+	}
+
+	mode := "CPU"
 	if _, err := exec.LookPath("nvidia-smi"); err == nil {
-		return &AudioSeparator{
-			Mode:       "CUDA",
-			Model:      "UVR-MDX-NET-Voc_FT",
-			PathCLI:    filepath.Join(GetExecutablePath(), "audio-separator", "bin", "audio-separator"),
-			PathModels: filepath.Join(GetExecutablePath(), "audio-separator", "models"),
-			PathOutput: filepath.Join(GetExecutablePath(), "audio-separator", "output"),
-		}
-	} else {
-		return &AudioSeparator{
-			Mode:       "CPU",
-			Model:      "UVR-MDX-NET-Voc_FT",
-			PathCLI:    filepath.Join(GetExecutablePath(), "audio-separator", "bin", "audio-separator"),
-			PathModels: filepath.Join(GetExecutablePath(), "audio-separator", "models"),
-			PathOutput: filepath.Join(GetExecutablePath(), "audio-separator", "output"),
-		}
+		mode = "CUDA"
+	}
+
+	return &AudioSeparator{
+		Mode:       mode,
+		Model:      "UVR-MDX-NET-Voc_FT",
+		PathCLI:    filepath.Join(root, "bin", "audio-separator"),
+		PathModels: filepath.Join(root, "models"),
+		PathOutput: filepath.Join(root, "output"),
 	}
 }
 
-func (c *AudioSeparator) Run(ctx context.Context, file DownloadedFile) (AudioSeparatorResult, error) {
+func (c *AudioSeparator) Requirements() []Requirement {
+	return []Requirement{RequireFile("audio-separator", c.PathCLI)}
+}
+
+func (c *AudioSeparator) Run(ctx context.Context, file DownloadedFile, progress func(string)) (AudioSeparatorResult, error) {
 	baseName := strings.TrimSuffix(filepath.Base(file.Path), filepath.Ext(file.Name))
 	res := AudioSeparatorResult{
 		MusicName: fmt.Sprintf("Instrumental_%s", file.Name),
@@ -87,13 +91,14 @@ func (c *AudioSeparator) Run(ctx context.Context, file DownloadedFile) (AudioSep
 		)
 	}
 
-	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	output := NewProgressWriter("Splitting audio", "%", TqdmParser(), progress)
+	output.Pipe(cmd)
 
 	err := cmd.Run()
 	if err != nil && err.Error() == "signal: killed" {
 		return AudioSeparatorResult{}, context.Canceled
 	} else if err != nil {
-		return AudioSeparatorResult{}, fmt.Errorf("%w: %s", err, cmd.Stderr)
+		return AudioSeparatorResult{}, fmt.Errorf("%w: %s", err, output.LastLine())
 	}
 
 	return res, nil
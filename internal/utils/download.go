@@ -24,6 +24,18 @@ func GetDownloadFolderPath() string {
 	return filepath.Join(GetExecutablePath(), "temp")
 }
 
+// GetDatasetFolderPath returns the folder with the uploaded voice samples of the model.
+func GetDatasetFolderPath(modelID int64) string {
+	return filepath.Join(GetExecutablePath(), "datasets", fmt.Sprint(modelID))
+}
+
+// RandomID returns a random uuid-like identifier.
+func RandomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
 type DownloadedFile struct {
 	ID   string
 	Name string
@@ -73,9 +85,7 @@ func Download(ctx context.Context, arg1 string, arg2 string) (DownloadedFile, er
 		return DownloadedFile{}, err
 	}
 
-	b := make([]byte, 16)
-	rand.Read(b)
-	fileID := fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	fileID := RandomID()
 
 	downloadFolderPath := GetDownloadFolderPath()
 	os.MkdirAll(downloadFolderPath, os.ModePerm)
@@ -173,3 +183,30 @@ func Download(ctx context.Context, arg1 string, arg2 string) (DownloadedFile, er
 		return df, nil
 	}
 }
+
+// DownloadBytes downloads the file into memory, failing if it is larger than limit bytes.
+func DownloadBytes(ctx context.Context, rawURL string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed: %s", res.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("file is larger than %d bytes", limit)
+	}
+	return data, nil
+}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ProgressInterval limits how often the progress is reported, the inline keyboard edits are rate limited by telegram.
+const ProgressInterval = 3 * time.Second
+
+// ProgressParser extracts the completed and the total amount of work from a line of the tool output.
+type ProgressParser func(line string) (done float64, total float64, ok bool)
+
+var tqdmRegexp = regexp.MustCompile(`(\d+)%\|`)
+
+// TqdmParser parses the percent of tqdm progress bars, e.g. " 45%|████▌     | 9/20 [00:10<00:12, 1.10it/s]".
+func TqdmParser() ProgressParser {
+	return func(line string) (float64, float64, bool) {
+		m := tqdmRegexp.FindStringSubmatch(line)
+		if m == nil {
+			return 0, 0, false
+		}
+		percent, _ := strconv.ParseFloat(m[1], 64)
+		return percent, 100, true
+	}
+}
+
+var epochRegexp = regexp.MustCompile(`Epoch:\s*(\d+)`)
+
+// EpochParser parses the rvc training log, e.g. "====> Epoch: 40 [2024-01-01 12:00:00] | (0:00:05.123)".
+func EpochParser(total int) ProgressParser {
+	return func(line string) (float64, float64, bool) {
+		m := epochRegexp.FindStringSubmatch(line)
+		if m == nil {
+			return 0, 0, false
+		}
+		epoch, _ := strconv.ParseFloat(m[1], 64)
+		return epoch, float64(total), true
+	}
+}
+
+var (
+	durationRegexp = regexp.MustCompile(`Duration: (\d+):(\d+):(\d+(?:\.\d+)?)`)
+	outTimeRegexp  = regexp.MustCompile(`^out_time_us=(\d+)`)
+)
+
+// FFmpegParser parses the "-progress" output of ffmpeg, the total is the longest input duration.
+func FFmpegParser() ProgressParser {
+	var duration float64
+	return func(line string) (float64, float64, bool) {
+		if m := durationRegexp.FindStringSubmatch(line); m != nil {
+			hours, _ := strconv.ParseFloat(m[1], 64)
+			minutes, _ := strconv.ParseFloat(m[2], 64)
+			seconds, _ := strconv.ParseFloat(m[3], 64)
+			duration = max(duration, hours*3600+minutes*60+seconds)
+			return 0, 0, false
+		}
+		if m := outTimeRegexp.FindStringSubmatch(line); m != nil && duration > 0 {
+			us, _ := strconv.ParseFloat(m[1], 64)
+			return min(us/1e6, duration), duration, true
+		}
+		return 0, 0, false
+	}
+}
+
+// ProgressWriter parses the tool output line by line, and reports the progress with the estimated time left.
+// Without a parser it only keeps the last line of the output for the error message.
+// The reports are throttled with ProgressInterval, it is safe to use the writer for both stdout and stderr.
+type ProgressWriter struct {
+	stage  string
+	unit   string // "%" or the name of the units, e.g. "epochs"
+	parser ProgressParser
+	report func(string)
+
+	mu       sync.Mutex
+	buf      []byte
+	lastLine string
+	started  time.Time // time of the first parsed progress
+	startAt  float64   // progress done at the started time
+	reported time.Time
+}
+
+func NewProgressWriter(stage string, unit string, parser ProgressParser, report func(string)) *ProgressWriter {
+	return &ProgressWriter{stage: stage, unit: unit, parser: parser, report: report}
+}
+
+func (w *ProgressWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		// progress bars redraw the same line with \r
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		line := string(bytes.TrimSpace(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+		if line != "" {
+			w.lastLine = line
+			w.parse(line, time.Now())
+		}
+	}
+
+	return len(p), nil
+}
+
+// LastLine returns the last line of the output, usually the error message.
+func (w *ProgressWriter) LastLine() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastLine
+}
+
+// Pipe sends the command output to the console and to the writer.
+func (w *ProgressWriter) Pipe(cmd *exec.Cmd) {
+	cmd.Stdout = io.MultiWriter(os.Stdout, w)
+	cmd.Stderr = io.MultiWriter(os.Stderr, w)
+}
+
+func (w *ProgressWriter) parse(line string, now time.Time) {
+	if w.parser == nil {
+		return
+	}
+
+	done, total, ok := w.parser(line)
+	if !ok || total <= 0 {
+		return
+	}
+
+	if w.started.IsZero() {
+		w.started, w.startAt = now, done
+	}
+
+	if !w.reported.IsZero() && now.Sub(w.reported) < ProgressInterval {
+		return
+	}
+	w.reported = now
+
+	var status string
+	if w.unit == "%" {
+		status = fmt.Sprintf("%s %.0f%%", w.stage, done/total*100)
+	} else {
+		status = fmt.Sprintf("%s %.0f/%.0f %s", w.stage, done, total, w.unit)
+	}
+
+	if done > w.startAt && done < total {
+		elapsed := now.Sub(w.started).Seconds()
+		left := time.Duration(elapsed * (total - done) / (done - w.startAt) * float64(time.Second))
+		status += ", ETA " + formatETA(left)
+	}
+
+	w.report(status)
+}
+
+// formatETA rounds the duration for humans, e.g. "40s", "6m" or "1h20m".
+func formatETA(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Round(time.Second).Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Round(time.Minute).Minutes()))
+	default:
+		d = d.Round(time.Minute)
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+}
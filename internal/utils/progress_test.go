@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressParsers(t *testing.T) {
+	ffmpeg := FFmpegParser()
+
+	tests := []struct {
+		name   string
+		parser ProgressParser
+		line   string
+		done   float64
+		total  float64
+		ok     bool
+	}{
+		{"tqdm", TqdmParser(), " 45%|████▌     | 9/20 [00:10<00:12,  1.10it/s]", 45, 100, true},
+		{"tqdm other", TqdmParser(), "Separation duration: 00:00:12", 0, 0, false},
+		{"epoch", EpochParser(150), "INFO:40:====> Epoch: 40 [2024-01-01 12:00:00] | (0:00:05.123)", 40, 150, true},
+		{"epoch other", EpochParser(150), "INFO:40:Saving model", 0, 0, false},
+		{"ffmpeg before duration", ffmpeg, "out_time_us=1000000", 0, 0, false},
+		{"ffmpeg duration", ffmpeg, "  Duration: 00:03:20.00, start: 0.000000, bitrate: 1411 kb/s", 0, 0, false},
+		{"ffmpeg time", ffmpeg, "out_time_us=50000000", 50, 200, true},
+		{"ffmpeg end", ffmpeg, "out_time_us=250000000", 200, 200, true},
+	}
+
+	for _, tt := range tests {
+		done, total, ok := tt.parser(tt.line)
+		if done != tt.done || total != tt.total || ok != tt.ok {
+			t.Errorf("%s: actual [%v/%v %v]\n", tt.name, done, total, ok)
+		}
+	}
+}
+
+func TestProgressWriter(t *testing.T) {
+	var reports []string
+	w := NewProgressWriter("Training", "epochs", EpochParser(150), func(s string) { reports = append(reports, s) })
+
+	start := time.Now()
+	w.parse("====> Epoch: 10", start)
+	w.parse("====> Epoch: 11", start.Add(time.Second))   // throttled
+	w.parse("====> Epoch: 40", start.Add(2*time.Minute)) // 30 epochs in 2m, 110 left
+
+	expected := []string{"Training 10/150 epochs", "Training 40/150 epochs, ETA 7m"}
+	if len(reports) != len(expected) {
+		t.Fatalf("actual [%v]\n", reports)
+	}
+	for i := range expected {
+		if reports[i] != expected[i] {
+			t.Errorf("actual [%s]\n", reports[i])
+		}
+	}
+
+	// progress bars redraw the line with \r, and the output can be split anywhere
+	var percents []string
+	w = NewProgressWriter("Splitting audio", "%", TqdmParser(), func(s string) { percents = append(percents, s) })
+	w.Write([]byte(" 10%|█   | 1/10\r 20%|██  "))
+	w.Write([]byte("| 2/10\rError: out of memory\n"))
+
+	if len(percents) != 1 || percents[0] != "Splitting audio 10%" {
+		t.Errorf("actual [%v]\n", percents)
+	}
+	if w.LastLine() != "Error: out of memory" {
+		t.Errorf("actual [%s]\n", w.LastLine())
+	}
+}
+
+func TestFormatETA(t *testing.T) {
+	tests := []struct {
+		d        time.Duration
+		expected string
+	}{
+		{40 * time.Second, "40s"},
+		{6*time.Minute + 10*time.Second, "6m"},
+		{80 * time.Minute, "1h20m"},
+	}
+
+	for _, tt := range tests {
+		if actual := formatETA(tt.d); actual != tt.expected {
+			t.Errorf("%v: actual [%s]\n", tt.d, actual)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Requirement is an external tool a command depends on.
+type Requirement struct {
+	Name  string       // tool name shown to the users, e.g. ffmpeg
+	Check func() error // returns an error if the tool is not available
+}
+
+// RequireBinary checks that the binary is available in the PATH.
+func RequireBinary(name string) Requirement {
+	return Requirement{Name: name, Check: func() error {
+		_, err := exec.LookPath(name)
+		return err
+	}}
+}
+
+// RequireFile checks that the file exists, e.g. a binary installed next to the bot.
+func RequireFile(name string, path string) Requirement {
+	return Requirement{Name: name, Check: func() error {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("%s not found: %w", name, err)
+		}
+		return nil
+	}}
+}
+
+// ProbeRequirements checks the requirements, and returns the names of the missing ones.
+func ProbeRequirements(requirements []Requirement) ([]string, error) {
+	var missing []string
+	var errs []error
+	for _, r := range requirements {
+		if err := r.Check(); err != nil {
+			missing = append(missing, r.Name)
+			errs = append(errs, err)
+		}
+	}
+	return missing, errors.Join(errs...)
+}
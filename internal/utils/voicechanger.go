@@ -9,12 +9,11 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
-
-	"mr-weasel/internal/storage"
 )
 
 type VoiceChanger struct {
 	Mode         string
+	PathRoot     string
 	PathPython   string
 	PathInferCLI string
 	PathTrainCLI string
@@ -29,30 +28,37 @@ type VoiceChangerResult struct {
 	Path string
 }
 
-func NewVoiceChanger() *VoiceChanger {
+// NewVoiceChanger expects the rvc-project checkout at root, or next to the executable if root is empty.
+// The python interpreter defaults to the project venv, and can point to a Windows venv when running under WSL.
+// The cli scripts are started from the project folder with relative paths, so they work for both.
+func NewVoiceChanger(root string, python string) *VoiceChanger {
+	if root == "" {
+		root = filepath.Join(GetExecutablePath(), "rvc-project")
+	}
+	if python == "" {
+		python = filepath.Join(root, ".venv", "bin", "python")
+	}
+
+	mode := "CPU"
 	if _, err := exec.LookPath("nvidia-smi"); err == nil {
-		return &VoiceChanger{
-			Mode:         "CUDA",
-			PathPython:   "/mnt/d/rvc-project/.venv/Scripts/python.exe",
-			PathInferCLI: "D:\\rvc-project\\infer-cli.py",
-			PathTrainCLI: "D:\\rvc-project\\train-cli.py",
-			PathDatasets: "/mnt/d/rvc-project/assets/datasets",
-			PathWeights:  "/mnt/d/rvc-project/assets/weights",
-			PathLogs:     "/mnt/d/rvc-project/logs",
-			PathOutput:   "/mnt/d/rvc-project/TEMP",
-		}
-	} else {
-		return &VoiceChanger{
-			Mode:         "CPU",
-			PathPython:   filepath.Join(GetExecutablePath(), "rvc-project", ".venv", "bin", "python"),
-			PathInferCLI: filepath.Join(GetExecutablePath(), "rvc-project", "infer-cli.py"),
-			PathTrainCLI: filepath.Join(GetExecutablePath(), "rvc-project", "train-cli.py"),
-			PathDatasets: filepath.Join(GetExecutablePath(), "rvc-project", "assets", "datasets"),
-			PathWeights:  filepath.Join(GetExecutablePath(), "rvc-project", "assets", "weights"),
-			PathLogs:     filepath.Join(GetExecutablePath(), "rvc-project", "logs"),
-			PathOutput:   filepath.Join(GetExecutablePath(), "rvc-project", "TEMP"),
-		}
+		mode = "CUDA"
 	}
+
+	return &VoiceChanger{
+		Mode:         mode,
+		PathRoot:     root,
+		PathPython:   python,
+		PathInferCLI: "infer-cli.py",
+		PathTrainCLI: "train-cli.py",
+		PathDatasets: filepath.Join(root, "assets", "datasets"),
+		PathWeights:  filepath.Join(root, "assets", "weights"),
+		PathLogs:     filepath.Join(root, "logs"),
+		PathOutput:   filepath.Join(root, "TEMP"),
+	}
+}
+
+func (vc *VoiceChanger) Requirements() []Requirement {
+	return []Requirement{RequireFile("rvc venv", vc.PathPython)}
 }
 
 func (vc *VoiceChanger) DeleteAll(modelID int64) {
@@ -70,12 +76,14 @@ func (vc *VoiceChanger) IsTrained(modelID int64) bool {
 	return errors.Join(err1, err2) == nil
 }
 
-func (vc *VoiceChanger) RunTrain(ctx context.Context, experiment storage.RvcExperimentDetails) error {
-	modelFolder := fmt.Sprint(experiment.ModelID.Int64)
+func (vc *VoiceChanger) RunTrain(ctx context.Context, modelID int64, progress func(string)) error {
+	modelFolder := fmt.Sprint(modelID)
 
 	var cmd *exec.Cmd
+	var epochs int
 	switch vc.Mode {
 	case "CUDA":
+		epochs = 150
 		cmd = exec.CommandContext(ctx, vc.PathPython, vc.PathTrainCLI,
 			"--name", modelFolder,
 			"--dataset", filepath.Join("assets", "datasets", modelFolder),
@@ -85,13 +93,14 @@ func (vc *VoiceChanger) RunTrain(ctx context.Context, experiment storage.RvcExpe
 			"--gpu_rmvpe", "0-0",
 			"--gpu", "0",
 			"--batch_size", "8",
-			"--total_epoch", "150",
+			"--total_epoch", fmt.Sprint(epochs),
 			"--save_epoch", "10",
 			"--save_latest", "1",
 			"--cache_gpu", "0",
 			"--save_every_weights", "0",
 		)
 	default:
+		epochs = 10
 		cmd = exec.CommandContext(ctx, vc.PathPython, vc.PathTrainCLI,
 			"--name", modelFolder,
 			"--dataset", filepath.Join("assets", "datasets", modelFolder),
@@ -101,7 +110,7 @@ func (vc *VoiceChanger) RunTrain(ctx context.Context, experiment storage.RvcExpe
 			"--gpu_rmvpe", "-",
 			"--gpu", "",
 			"--batch_size", "1",
-			"--total_epoch", "10",
+			"--total_epoch", fmt.Sprint(epochs),
 			"--save_epoch", "2",
 			"--save_latest", "1",
 			"--cache_gpu", "0",
@@ -109,13 +118,15 @@ func (vc *VoiceChanger) RunTrain(ctx context.Context, experiment storage.RvcExpe
 		)
 	}
 
-	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Dir = vc.PathRoot
+	output := NewProgressWriter("Training", "epochs", EpochParser(epochs), progress)
+	output.Pipe(cmd)
 
 	err := cmd.Run()
 	if err != nil && err.Error() == "signal: killed" {
 		return context.Canceled
 	} else if err != nil {
-		return fmt.Errorf("%w: %s", err, cmd.Stderr)
+		return fmt.Errorf("%w: %s", err, output.LastLine())
 	}
 
 	// move index to the weights folder, and remove logs
@@ -131,14 +142,14 @@ func (vc *VoiceChanger) RunTrain(ctx context.Context, experiment storage.RvcExpe
 	return nil
 }
 
-func (vc *VoiceChanger) RunInfer(ctx context.Context, experiment storage.RvcExperimentDetails, voicePath string) (VoiceChangerResult, error) {
-	audioFile, _ := GetDownloadedFile(experiment.Audio.String)
-	modelFolder := fmt.Sprint(experiment.ModelID.Int64)
+// RunInfer changes the voice in voicePath with the trained model, audioName is the original song name used for the output file.
+func (vc *VoiceChanger) RunInfer(ctx context.Context, modelID int64, modelName string, transpose int64, audioName string, voicePath string, progress func(string)) (VoiceChangerResult, error) {
+	modelFolder := fmt.Sprint(modelID)
 	inputName := regexp.MustCompile(`[^a-zA-Z0-9 ]+`).ReplaceAllString(filepath.Base(voicePath), "")
 
-	baseName := strings.TrimSuffix(filepath.Base(audioFile.Name), filepath.Ext(audioFile.Name))
-	outputNameWav := fmt.Sprintf("%s.%s.wav", experiment.ModelName.String, regexp.MustCompile(`[^a-zA-Z0-9 ]+`).ReplaceAllString(baseName, ""))
-	outputNameMp3 := fmt.Sprintf("%s.%s.mp3", experiment.ModelName.String, baseName)
+	baseName := strings.TrimSuffix(filepath.Base(audioName), filepath.Ext(audioName))
+	outputNameWav := fmt.Sprintf("%s.%s.wav", modelName, regexp.MustCompile(`[^a-zA-Z0-9 ]+`).ReplaceAllString(baseName, ""))
+	outputNameMp3 := fmt.Sprintf("%s.%s.mp3", modelName, baseName)
 
 	CopyCrossDevice(voicePath, filepath.Join(vc.PathOutput, inputName))
 	defer os.Remove(filepath.Join(vc.PathOutput, inputName))
@@ -153,7 +164,7 @@ func (vc *VoiceChanger) RunInfer(ctx context.Context, experiment storage.RvcExpe
 			"--model", fmt.Sprintf("%s.pth", modelFolder),
 			"--index", filepath.Join("assets", "weights", fmt.Sprintf("%s.index", modelFolder)),
 			"--method", "rmvpe",
-			"--transpose", fmt.Sprint(experiment.Transpose.Int64),
+			"--transpose", fmt.Sprint(transpose),
 			// "--ratio", "0.75",
 			// "--filter", "3",
 			// "--resample", "0",
@@ -167,7 +178,7 @@ func (vc *VoiceChanger) RunInfer(ctx context.Context, experiment storage.RvcExpe
 			"--model", fmt.Sprintf("%s.pth", modelFolder),
 			"--index", filepath.Join("assets", "weights", fmt.Sprintf("%s.index", modelFolder)),
 			"--method", "pm",
-			"--transpose", fmt.Sprint(experiment.Transpose.Int64),
+			"--transpose", fmt.Sprint(transpose),
 			// "--ratio", "0.75",
 			// "--filter", "3",
 			// "--resample", "0",
@@ -176,13 +187,15 @@ func (vc *VoiceChanger) RunInfer(ctx context.Context, experiment storage.RvcExpe
 		)
 	}
 
-	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Dir = vc.PathRoot
+	output := NewProgressWriter("Changing voice", "", nil, progress)
+	output.Pipe(cmd)
 
 	err := cmd.Run()
 	if err != nil && err.Error() == "signal: killed" {
 		return VoiceChangerResult{}, context.Canceled
 	} else if err != nil {
-		return VoiceChangerResult{}, fmt.Errorf("%w: %s", err, cmd.Stderr)
+		return VoiceChangerResult{}, fmt.Errorf("%w: %s", err, output.LastLine())
 	}
 
 	ffmpeg, err := exec.LookPath("ffmpeg")
@@ -191,6 +204,7 @@ func (vc *VoiceChanger) RunInfer(ctx context.Context, experiment storage.RvcExpe
 	}
 
 	cmd = exec.CommandContext(ctx, ffmpeg,
+		"-progress", "pipe:1", "-nostats",
 		"-i", filepath.Join(vc.PathOutput, outputNameWav),
 		"-b:a", "320k",
 		"-filter_complex", "compand=attacks=0:points=-80/-900|-45/-15|-27/-9|0/-7|20/-7:gain=5",
@@ -198,13 +212,14 @@ func (vc *VoiceChanger) RunInfer(ctx context.Context, experiment storage.RvcExpe
 		filepath.Join(vc.PathOutput, outputNameMp3),
 	)
 
-	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	output = NewProgressWriter("Converting", "%", FFmpegParser(), progress)
+	output.Pipe(cmd)
 
 	err = cmd.Run()
 	if err != nil && err.Error() == "signal: killed" {
 		return VoiceChangerResult{}, context.Canceled
 	} else if err != nil {
-		return VoiceChangerResult{}, fmt.Errorf("%w: %s", err, cmd.Stderr)
+		return VoiceChangerResult{}, fmt.Errorf("%w: %s", err, output.LastLine())
 	}
 
 	res := VoiceChangerResult{
@@ -214,7 +229,7 @@ func (vc *VoiceChanger) RunInfer(ctx context.Context, experiment storage.RvcExpe
 	return res, nil
 }
 
-func (vc *VoiceChanger) RunMix(ctx context.Context, musicPath string, voicePath string) (VoiceChangerResult, error) {
+func (vc *VoiceChanger) RunMix(ctx context.Context, musicPath string, voicePath string, progress func(string)) (VoiceChangerResult, error) {
 	mixNameMp3 := fmt.Sprintf("Mix.%s", filepath.Base(voicePath))
 
 	ffmpeg, err := exec.LookPath("ffmpeg")
@@ -223,6 +238,7 @@ func (vc *VoiceChanger) RunMix(ctx context.Context, musicPath string, voicePath
 	}
 
 	cmd := exec.CommandContext(ctx, ffmpeg,
+		"-progress", "pipe:1", "-nostats",
 		"-i", musicPath,
 		"-i", voicePath,
 		"-filter_complex", "amix=inputs=2:duration=longest",
@@ -232,13 +248,14 @@ func (vc *VoiceChanger) RunMix(ctx context.Context, musicPath string, voicePath
 		filepath.Join(vc.PathOutput, mixNameMp3),
 	)
 
-	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	output := NewProgressWriter("Mixing", "%", FFmpegParser(), progress)
+	output.Pipe(cmd)
 
 	err = cmd.Run()
 	if err != nil && err.Error() == "signal: killed" {
 		return VoiceChangerResult{}, context.Canceled
 	} else if err != nil {
-		return VoiceChangerResult{}, fmt.Errorf("%w: %s", err, cmd.Stderr)
+		return VoiceChangerResult{}, fmt.Errorf("%w: %s", err, output.LastLine())
 	}
 
 	res := VoiceChangerResult{
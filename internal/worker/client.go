@@ -0,0 +1,236 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Client pulls the jobs from the bot dispatcher and executes them on this machine.
+type Client struct {
+	url       string
+	token     string
+	dir       string
+	executor  Executor
+	http      *http.Client
+	heartbeat time.Duration
+	retry     time.Duration
+}
+
+// NewClient creates a worker for the dispatcher at url, the inputs are downloaded into dir.
+func NewClient(url string, token string, dir string, executor Executor) *Client {
+	return &Client{
+		url:       url,
+		token:     token,
+		dir:       dir,
+		executor:  executor,
+		http:      &http.Client{},
+		heartbeat: 10 * time.Second,
+		retry:     5 * time.Second,
+	}
+}
+
+// Run executes the jobs one by one, until ctx is done.
+func (c *Client) Run(ctx context.Context) {
+	log.Printf("[INFO] Worker started for %s\n", c.url)
+	for ctx.Err() == nil {
+		job, err := c.next(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Println("[ERROR]", err)
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(c.retry):
+			}
+			continue
+		} else if job == nil {
+			continue
+		}
+
+		log.Printf("[INFO] Job %s %s started\n", job.ID, job.Kind)
+		if err := c.process(ctx, *job); err != nil {
+			log.Printf("[ERROR] Job %s %s failed: %s\n", job.ID, job.Kind, err)
+		} else {
+			log.Printf("[INFO] Job %s %s done\n", job.ID, job.Kind)
+		}
+	}
+	log.Println("[INFO] Worker stopped")
+}
+
+func (c *Client) process(ctx context.Context, job Job) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dir := filepath.Join(c.dir, job.ID)
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	status := ""
+
+	// the progress is sent right away and repeated as a heartbeat, the bot answers 410 when the job is cancelled
+	report := func() {
+		mu.Lock()
+		s := status
+		mu.Unlock()
+		if err := c.post(ctx, fmt.Sprintf("/jobs/%s/progress", job.ID), progressRequest{Status: s}); errors.Is(err, ErrJobCancelled) {
+			cancel()
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(c.heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report()
+			}
+		}
+	}()
+
+	progress := func(s string) {
+		mu.Lock()
+		status = s
+		mu.Unlock()
+		report()
+	}
+
+	fetch := func(ctx context.Context, key string) (string, error) {
+		name, ok := job.Inputs[key]
+		if !ok {
+			return "", fmt.Errorf("input %q not found", key)
+		}
+		return c.download(ctx, fmt.Sprintf("/jobs/%s/inputs/%s", job.ID, url.PathEscape(key)), filepath.Join(dir, key, filepath.Base(name)))
+	}
+
+	artifacts, err := c.executor.Execute(ctx, job, fetch, progress)
+	if err == nil {
+		for key, artifact := range artifacts {
+			path := fmt.Sprintf("/jobs/%s/artifacts/%s?name=%s", job.ID, url.PathEscape(key), url.QueryEscape(artifact.Name))
+			if err = c.upload(ctx, path, artifact.Path); err != nil {
+				break
+			}
+		}
+	}
+
+	if errors.Is(err, ErrJobCancelled) || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	done := doneRequest{}
+	if err != nil {
+		done.Error = err.Error()
+	}
+	if postErr := c.post(ctx, fmt.Sprintf("/jobs/%s/done", job.ID), done); postErr != nil {
+		return postErr
+	}
+	return err
+}
+
+// next long polls the dispatcher, and returns nil when there are no jobs.
+func (c *Client) next(ctx context.Context) (*Job, error) {
+	res, err := c.do(ctx, http.MethodPost, "/jobs/next", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+
+	var job Job
+	if err := json.NewDecoder(res.Body).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (c *Client) post(ctx context.Context, path string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.do(ctx, http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (c *Client) download(ctx context.Context, path string, dst string) (string, error) {
+	res, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	os.MkdirAll(filepath.Dir(dst), os.ModePerm)
+	file, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, res.Body); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+func (c *Client) upload(ctx context.Context, path string, src string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	res, err := c.do(ctx, http.MethodPut, path, file)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// do sends an authorized request, the dispatcher answers 410 for the jobs it is no longer waiting for.
+func (c *Client) do(ctx context.Context, method string, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case res.StatusCode == http.StatusGone:
+		res.Body.Close()
+		return nil, ErrJobCancelled
+	case res.StatusCode >= 400:
+		res.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", method, path, res.Status)
+	}
+	return res, nil
+}
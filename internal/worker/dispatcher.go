@@ -0,0 +1,381 @@
+package worker
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"mr-weasel/internal/utils"
+)
+
+// Dispatcher hands the jobs over HTTP to the remote workers, and waits for their artifacts.
+//
+//	POST /jobs/next                  long polls the next job, 204 when there is nothing to do
+//	GET  /jobs/{id}/inputs/{key}     downloads the job input
+//	POST /jobs/{id}/progress         reports the job status, 410 when the job is cancelled
+//	PUT  /jobs/{id}/artifacts/{key}  uploads the job artifact, the file name is in the name query parameter
+//	POST /jobs/{id}/done             finishes the job, with an optional error message
+//
+// Every request must have the "Authorization: Bearer <token>" header.
+type Dispatcher struct {
+	token        string
+	dir          string
+	pollTimeout  time.Duration
+	staleTimeout time.Duration
+	mux          *http.ServeMux
+
+	mu      sync.Mutex
+	waiting []*dispatchedJob
+	jobs    map[string]*dispatchedJob
+	wake    chan struct{}
+}
+
+type dispatchedJob struct {
+	job      Job
+	inputs   map[string]string
+	progress ProgressFunc
+	done     chan string
+
+	mu        sync.Mutex
+	closed    bool
+	seen      time.Time // last request from the worker, zero while waiting
+	artifacts map[string]Artifact
+}
+
+type progressRequest struct {
+	Status string `json:"status"`
+}
+
+type doneRequest struct {
+	Error string `json:"error,omitempty"`
+}
+
+// NewDispatcher creates a dispatcher storing uploaded artifacts in dir.
+func NewDispatcher(token string, dir string) *Dispatcher {
+	d := &Dispatcher{
+		token:        token,
+		dir:          dir,
+		pollTimeout:  20 * time.Second,
+		staleTimeout: time.Minute,
+		mux:          http.NewServeMux(),
+		jobs:         make(map[string]*dispatchedJob),
+		wake:         make(chan struct{}),
+	}
+	d.mux.HandleFunc("POST /jobs/next", d.handleNext)
+	d.mux.HandleFunc("GET /jobs/{id}/inputs/{key}", d.handleInput)
+	d.mux.HandleFunc("POST /jobs/{id}/progress", d.handleProgress)
+	d.mux.HandleFunc("PUT /jobs/{id}/artifacts/{key}", d.handleArtifact)
+	d.mux.HandleFunc("POST /jobs/{id}/done", d.handleDone)
+	return d
+}
+
+func (d *Dispatcher) Name() string {
+	return "Remote"
+}
+
+func (d *Dispatcher) Requirements() []utils.Requirement {
+	return nil
+}
+
+// Run waits for the artifacts uploaded into the job folder, the folder is removed by the release func or on error.
+func (d *Dispatcher) Run(ctx context.Context, job Job, inputs map[string]string, progress ProgressFunc) (map[string]Artifact, func(), error) {
+	dj := &dispatchedJob{
+		job:       job,
+		inputs:    inputs,
+		progress:  progress,
+		done:      make(chan string, 1),
+		artifacts: make(map[string]Artifact),
+	}
+
+	progress("Waiting for worker...")
+
+	d.mu.Lock()
+	d.jobs[job.ID] = dj
+	d.waiting = append(d.waiting, dj)
+	close(d.wake)
+	d.wake = make(chan struct{})
+	d.mu.Unlock()
+
+	artifacts, err := d.wait(ctx, dj)
+	d.remove(dj)
+
+	release := func() {
+		if err := os.RemoveAll(filepath.Join(d.dir, job.ID)); err != nil {
+			log.Println("[ERROR]", err)
+		}
+	}
+	if err != nil {
+		release()
+		return nil, func() {}, err
+	}
+	return artifacts, release, nil
+}
+
+func (d *Dispatcher) wait(ctx context.Context, dj *dispatchedJob) (map[string]Artifact, error) {
+	ticker := time.NewTicker(d.staleTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case errMsg := <-dj.done:
+			if errMsg != "" {
+				return nil, errors.New(errMsg)
+			}
+			dj.mu.Lock()
+			defer dj.mu.Unlock()
+			return dj.artifacts, nil
+		case <-ticker.C:
+			// the worker sends progress periodically, silence means it has crashed
+			dj.mu.Lock()
+			stale := !dj.seen.IsZero() && time.Since(dj.seen) > d.staleTimeout
+			dj.mu.Unlock()
+			if stale {
+				return nil, errors.New("worker stopped responding")
+			}
+		}
+	}
+}
+
+// remove forgets the job, so the worker gets 410 on its next request and stops.
+func (d *Dispatcher) remove(dj *dispatchedJob) {
+	d.mu.Lock()
+	delete(d.jobs, dj.job.ID)
+	for i, w := range d.waiting {
+		if w == dj {
+			d.waiting = append(d.waiting[:i], d.waiting[i+1:]...)
+			break
+		}
+	}
+	d.mu.Unlock()
+
+	dj.mu.Lock()
+	dj.closed = true
+	dj.mu.Unlock()
+}
+
+func (d *Dispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, _ := bearerToken(r)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(d.token)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	d.mux.ServeHTTP(w, r)
+}
+
+// Start serves the worker API on addr in a background goroutine, until ctx is done.
+// The address is bound before returning, so the listen errors are reported to the caller, e.g. a port already in use.
+func (d *Dispatcher) Start(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Addr: addr, Handler: d, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		log.Printf("[INFO] Worker dispatcher started on %s\n", ln.Addr())
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println("[ERROR]", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+		log.Println("[INFO] Worker dispatcher closed")
+	}()
+
+	return nil
+}
+
+func (d *Dispatcher) handleNext(w http.ResponseWriter, r *http.Request) {
+	timer := time.NewTimer(d.pollTimeout)
+	defer timer.Stop()
+
+	for {
+		d.mu.Lock()
+		if len(d.waiting) > 0 {
+			dj := d.waiting[0]
+			d.waiting = d.waiting[1:]
+			d.mu.Unlock()
+			dj.touch()
+			writeJSON(w, dj.job)
+			return
+		}
+		wake := d.wake
+		d.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-timer.C:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) handleInput(w http.ResponseWriter, r *http.Request) {
+	dj := d.get(r.PathValue("id"))
+	if dj == nil {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	path, ok := dj.inputs[r.PathValue("key")]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	io.Copy(w, file)
+}
+
+func (d *Dispatcher) handleProgress(w http.ResponseWriter, r *http.Request) {
+	var req progressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	dj := d.get(r.PathValue("id"))
+	if dj == nil {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	// progress is called under the lock, so it never races with Run returning
+	dj.mu.Lock()
+	defer dj.mu.Unlock()
+	if dj.closed {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	if req.Status != "" {
+		dj.progress(req.Status)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (d *Dispatcher) handleArtifact(w http.ResponseWriter, r *http.Request) {
+	dj := d.get(r.PathValue("id"))
+	if dj == nil {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	name := filepath.Base(r.URL.Query().Get("name"))
+	if name == "." || name == string(filepath.Separator) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// the key is unescaped, "%2F" would escape the job folder
+	key := r.PathValue("key")
+	if key == "" || strings.ContainsAny(key, `/\`) || strings.Contains(key, "..") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	dir := filepath.Join(d.dir, dj.job.ID)
+	os.MkdirAll(dir, os.ModePerm)
+	path := filepath.Join(dir, fmt.Sprintf("%s.%s", key, name))
+
+	file, err := os.Create(path)
+	if err != nil {
+		log.Println("[ERROR]", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, r.Body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// the folder is already removed if Run has returned during the upload
+	dj.mu.Lock()
+	defer dj.mu.Unlock()
+	if dj.closed {
+		os.RemoveAll(dir)
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	dj.artifacts[key] = Artifact{Name: name, Path: path}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (d *Dispatcher) handleDone(w http.ResponseWriter, r *http.Request) {
+	var req doneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	dj := d.get(r.PathValue("id"))
+	if dj == nil {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	select {
+	case dj.done <- req.Error:
+	default: // already done
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// get returns the job by id, and marks the worker as alive.
+func (d *Dispatcher) get(id string) *dispatchedJob {
+	d.mu.Lock()
+	dj := d.jobs[id]
+	d.mu.Unlock()
+	if dj != nil {
+		dj.touch()
+	}
+	return dj
+}
+
+func (dj *dispatchedJob) touch() {
+	dj.mu.Lock()
+	dj.seen = time.Now()
+	dj.mu.Unlock()
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len(prefix) || auth[:len(prefix)] != prefix {
+		return "", false
+	}
+	return auth[len(prefix):], true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+
+	"mr-weasel/internal/utils"
+)
+
+// Kinds of the jobs understood by the worker.
+const (
+	KindSeparate = "separate" // inputs: audio, params: name; artifacts: music, voice
+	KindTrain    = "train"    // inputs: dataset files, params: model_id
+	KindInfer    = "infer"    // inputs: voice, params: model_id, model_name, transpose, name; artifacts: voice
+	KindMix      = "mix"      // inputs: music, voice; artifacts: mix
+	KindDelete   = "delete"   // params: model_id
+)
+
+// ErrJobCancelled is returned to the worker when the bot is no longer waiting for the job.
+var ErrJobCancelled = errors.New("job cancelled")
+
+// Job is a unit of work sent from the bot to the worker.
+type Job struct {
+	ID     string            `json:"id"`
+	Kind   string            `json:"kind"`
+	Params map[string]string `json:"params,omitempty"`
+	Inputs map[string]string `json:"inputs,omitempty"` // input key to the file name
+}
+
+// Artifact is a file produced by the job.
+type Artifact struct {
+	Name string
+	Path string
+}
+
+// ProgressFunc receives a short status of the running job.
+type ProgressFunc func(status string)
+
+// Runner runs jobs on behalf of the bot, inputs are the local paths by their keys.
+// Progress is never called after Run returns.
+// The release func removes the artifacts once the caller has consumed them, it is never nil.
+type Runner interface {
+	Name() string
+	Requirements() []utils.Requirement
+	Run(ctx context.Context, job Job, inputs map[string]string, progress ProgressFunc) (map[string]Artifact, func(), error)
+}
+
+// FetchFunc returns the local path of the job input.
+type FetchFunc func(ctx context.Context, key string) (string, error)
+
+// Executor does the actual work on the worker side.
+type Executor interface {
+	Execute(ctx context.Context, job Job, fetch FetchFunc, progress ProgressFunc) (map[string]Artifact, error)
+}
+
+// ExecutorFunc is an adapter to use ordinary functions as an Executor.
+type ExecutorFunc func(ctx context.Context, job Job, fetch FetchFunc, progress ProgressFunc) (map[string]Artifact, error)
+
+func (f ExecutorFunc) Execute(ctx context.Context, job Job, fetch FetchFunc, progress ProgressFunc) (map[string]Artifact, error) {
+	return f(ctx, job, fetch, progress)
+}
+
+// NewJob creates a job with a random id, the inputs keep the file names of the local paths.
+func NewJob(kind string, params map[string]string, inputs map[string]string) Job {
+	job := Job{ID: utils.RandomID(), Kind: kind, Params: params, Inputs: map[string]string{}}
+	for key, path := range inputs {
+		job.Inputs[key] = filepath.Base(path)
+	}
+	return job
+}
@@ -0,0 +1,38 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"mr-weasel/internal/utils"
+)
+
+// Local runs the jobs in the bot process, when the tools are installed on the same machine.
+type Local struct {
+	tools *Tools
+}
+
+func NewLocal(tools *Tools) *Local {
+	return &Local{tools: tools}
+}
+
+func (l *Local) Name() string {
+	return l.tools.Mode()
+}
+
+func (l *Local) Requirements() []utils.Requirement {
+	return l.tools.Requirements()
+}
+
+// Run keeps the artifacts, the tools write them to their own output folders.
+func (l *Local) Run(ctx context.Context, job Job, inputs map[string]string, progress ProgressFunc) (map[string]Artifact, func(), error) {
+	fetch := func(ctx context.Context, key string) (string, error) {
+		path, ok := inputs[key]
+		if !ok {
+			return "", fmt.Errorf("input %q not found", key)
+		}
+		return path, nil
+	}
+	artifacts, err := l.tools.Execute(ctx, job, fetch, progress)
+	return artifacts, func() {}, err
+}
@@ -0,0 +1,147 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"mr-weasel/internal/utils"
+)
+
+// Tools executes the jobs with the audio-separator and rvc-project installed on this machine.
+type Tools struct {
+	separator *utils.AudioSeparator
+	changer   *utils.VoiceChanger
+}
+
+func NewTools(separator *utils.AudioSeparator, changer *utils.VoiceChanger) *Tools {
+	return &Tools{separator: separator, changer: changer}
+}
+
+func (t *Tools) Mode() string {
+	return t.separator.Mode
+}
+
+func (t *Tools) Requirements() []utils.Requirement {
+	return append(t.separator.Requirements(), t.changer.Requirements()...)
+}
+
+func (t *Tools) Execute(ctx context.Context, job Job, fetch FetchFunc, progress ProgressFunc) (map[string]Artifact, error) {
+	switch job.Kind {
+	case KindSeparate:
+		return t.separate(ctx, job, fetch, progress)
+	case KindTrain:
+		return nil, t.train(ctx, job, fetch, progress)
+	case KindInfer:
+		return t.infer(ctx, job, fetch, progress)
+	case KindMix:
+		return t.mix(ctx, job, fetch, progress)
+	case KindDelete:
+		return nil, t.delete(job)
+	default:
+		return nil, fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+}
+
+func (t *Tools) separate(ctx context.Context, job Job, fetch FetchFunc, progress ProgressFunc) (map[string]Artifact, error) {
+	audioPath, err := fetch(ctx, "audio")
+	if err != nil {
+		return nil, err
+	}
+
+	progress("Splitting audio...")
+	res, err := t.separator.Run(ctx, utils.DownloadedFile{ID: job.ID, Name: job.Params["name"], Path: audioPath}, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]Artifact{
+		"music": {Name: res.MusicName, Path: res.MusicPath},
+		"voice": {Name: res.VoiceName, Path: res.VoicePath},
+	}, nil
+}
+
+// train skips the models trained before, the dataset is fetched only when needed.
+func (t *Tools) train(ctx context.Context, job Job, fetch FetchFunc, progress ProgressFunc) error {
+	modelID, err := strconv.ParseInt(job.Params["model_id"], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	if t.changer.IsTrained(modelID) {
+		return nil
+	}
+
+	progress("Uploading dataset...")
+	datasetPath := filepath.Join(t.changer.PathDatasets, fmt.Sprint(modelID))
+	os.MkdirAll(datasetPath, os.ModePerm)
+
+	for key, name := range job.Inputs {
+		path, err := fetch(ctx, key)
+		if err != nil {
+			return err
+		}
+		if err := utils.CopyCrossDevice(path, filepath.Join(datasetPath, name)); err != nil {
+			return err
+		}
+	}
+
+	progress("Training new model...")
+	return t.changer.RunTrain(ctx, modelID, progress)
+}
+
+func (t *Tools) infer(ctx context.Context, job Job, fetch FetchFunc, progress ProgressFunc) (map[string]Artifact, error) {
+	modelID, err := strconv.ParseInt(job.Params["model_id"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	transpose, err := strconv.ParseInt(job.Params["transpose"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	voicePath, err := fetch(ctx, "voice")
+	if err != nil {
+		return nil, err
+	}
+
+	progress("Changing voice...")
+	res, err := t.changer.RunInfer(ctx, modelID, job.Params["model_name"], transpose, job.Params["name"], voicePath, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]Artifact{"voice": {Name: res.Name, Path: res.Path}}, nil
+}
+
+func (t *Tools) mix(ctx context.Context, job Job, fetch FetchFunc, progress ProgressFunc) (map[string]Artifact, error) {
+	musicPath, err := fetch(ctx, "music")
+	if err != nil {
+		return nil, err
+	}
+
+	voicePath, err := fetch(ctx, "voice")
+	if err != nil {
+		return nil, err
+	}
+
+	progress("Mixing...")
+	res, err := t.changer.RunMix(ctx, musicPath, voicePath, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]Artifact{"mix": {Name: res.Name, Path: res.Path}}, nil
+}
+
+func (t *Tools) delete(job Job) error {
+	modelID, err := strconv.ParseInt(job.Params["model_id"], 10, 64)
+	if err != nil {
+		return err
+	}
+	t.changer.DeleteAll(modelID)
+	return nil
+}
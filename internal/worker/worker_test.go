@@ -0,0 +1,240 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testToken = "secret"
+
+func startTestWorker(t *testing.T, executor Executor) *Dispatcher {
+	t.Helper()
+
+	dispatcher := NewDispatcher(testToken, t.TempDir())
+	dispatcher.pollTimeout = 100 * time.Millisecond
+	server := httptest.NewServer(dispatcher)
+
+	client := NewClient(server.URL, testToken, t.TempDir(), executor)
+	client.heartbeat = 20 * time.Millisecond
+	client.retry = 20 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		client.Run(ctx)
+		close(done)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		server.Close()
+	})
+
+	return dispatcher
+}
+
+// upper uppercases the audio input into the voice artifact.
+func upper(ctx context.Context, job Job, fetch FetchFunc, progress ProgressFunc) (map[string]Artifact, error) {
+	path, err := fetch(ctx, "audio")
+	if err != nil {
+		return nil, err
+	}
+
+	progress("Splitting audio...")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	output := filepath.Join(filepath.Dir(path), "output")
+	if err := os.WriteFile(output, []byte(strings.ToUpper(string(data))), 0o644); err != nil {
+		return nil, err
+	}
+
+	return map[string]Artifact{"voice": {Name: "Vocals_" + job.Params["name"], Path: output}}, nil
+}
+
+func TestDispatcherRun(t *testing.T) {
+	dispatcher := startTestWorker(t, ExecutorFunc(upper))
+
+	input := filepath.Join(t.TempDir(), "song.mp3")
+	os.WriteFile(input, []byte("la la la"), 0o644)
+
+	var mu sync.Mutex
+	var statuses []string
+	progress := func(status string) {
+		mu.Lock()
+		statuses = append(statuses, status)
+		mu.Unlock()
+	}
+
+	job := NewJob(KindSeparate, map[string]string{"name": "song.mp3"}, map[string]string{"audio": input})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	artifacts, release, err := dispatcher.Run(ctx, job, map[string]string{"audio": input}, progress)
+	if err != nil {
+		t.Fatalf("actual error [%s]\n", err)
+	}
+
+	voice, ok := artifacts["voice"]
+	if !ok {
+		t.Fatalf("actual artifacts [%v]\n", artifacts)
+	}
+	if voice.Name != "Vocals_song.mp3" {
+		t.Errorf("actual name [%s]\n", voice.Name)
+	}
+
+	data, err := os.ReadFile(voice.Path)
+	if err != nil {
+		t.Fatalf("actual error [%s]\n", err)
+	}
+	if string(data) != "LA LA LA" {
+		t.Errorf("actual data [%s]\n", data)
+	}
+
+	// the artifacts are kept until the caller has consumed them
+	release()
+	if _, err := os.Stat(filepath.Dir(voice.Path)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("actual error [%v], expected the job folder to be removed\n", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(statuses) < 2 || statuses[0] != "Waiting for worker..." || statuses[1] != "Splitting audio..." {
+		t.Errorf("actual statuses [%v]\n", statuses)
+	}
+}
+
+func TestDispatcherError(t *testing.T) {
+	dispatcher := startTestWorker(t, ExecutorFunc(func(ctx context.Context, job Job, fetch FetchFunc, progress ProgressFunc) (map[string]Artifact, error) {
+		return nil, errors.New("python script failed")
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, _, err := dispatcher.Run(ctx, NewJob(KindMix, nil, nil), nil, func(string) {})
+	if err == nil || err.Error() != "python script failed" {
+		t.Errorf("actual error [%v]\n", err)
+	}
+}
+
+func TestDispatcherCancel(t *testing.T) {
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	dispatcher := startTestWorker(t, ExecutorFunc(func(ctx context.Context, job Job, fetch FetchFunc, progress ProgressFunc) (map[string]Artifact, error) {
+		close(started)
+		<-ctx.Done()
+		close(stopped)
+		return nil, ctx.Err()
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	_, _, err := dispatcher.Run(ctx, NewJob(KindTrain, nil, nil), nil, func(string) {})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("actual error [%v]\n", err)
+	}
+
+	// the worker learns about the cancellation from the heartbeat
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("worker job was not cancelled\n")
+	}
+}
+
+func TestDispatcherUnauthorized(t *testing.T) {
+	dispatcher := NewDispatcher(testToken, t.TempDir())
+
+	tests := []struct {
+		header string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/jobs/unknown/inputs/audio", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		dispatcher.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%q: actual status [%d]\n", tt.header, rec.Code)
+		}
+	}
+}
+
+func TestDispatcherStartListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// the port is already in use
+	dispatcher := NewDispatcher(testToken, t.TempDir())
+	if err := dispatcher.Start(context.Background(), ln.Addr().String()); err == nil {
+		t.Fatalf("expected the listen error\n")
+	}
+}
+
+func TestDispatcherArtifactKey(t *testing.T) {
+	dir := t.TempDir()
+	dispatcher := NewDispatcher(testToken, filepath.Join(dir, "jobs"))
+	job := NewJob(KindSeparate, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx, job, nil, func(string) {})
+
+	tests := []struct {
+		key    string
+		status int
+	}{
+		{"..%2F..%2Fescaped", http.StatusBadRequest},
+		{"a%5Cb", http.StatusBadRequest},
+		{"voice", http.StatusOK},
+	}
+	for _, tt := range tests {
+		status := 0
+		for i := 0; i < 50 && (status == 0 || status == http.StatusGone); i++ {
+			req := httptest.NewRequest(http.MethodPut, "/jobs/"+job.ID+"/artifacts/"+tt.key+"?name=song.mp3", strings.NewReader("la"))
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			rec := httptest.NewRecorder()
+			dispatcher.ServeHTTP(rec, req)
+			status = rec.Code
+			if status == http.StatusGone {
+				time.Sleep(10 * time.Millisecond) // Run has not registered the job yet
+			}
+		}
+		if status != tt.status {
+			t.Errorf("%q: actual status [%d]\n", tt.key, status)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.song.mp3")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("actual error [%v], expected no file outside of the job folder\n", err)
+	}
+}
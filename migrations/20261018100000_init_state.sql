@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+create table state (
+    user_id integer primary key,
+    step text not null,
+    draft text not null
+) strict;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table state;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+create table state_chat (
+    chat_id integer not null,
+    user_id integer not null,
+    thread_id integer not null default 0,
+    step text not null,
+    draft text not null,
+    primary key (chat_id, user_id, thread_id)
+) strict;
+
+-- states were kept per user, assume they belong to the private chat
+insert into state_chat (chat_id, user_id, step, draft) select user_id, user_id, step, draft from state;
+
+drop table state;
+alter table state_chat rename to state;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+create table state_user (
+    user_id integer primary key,
+    step text not null,
+    draft text not null
+) strict;
+
+insert into state_user (user_id, step, draft) select user_id, step, draft from state where chat_id = user_id and thread_id = 0;
+
+drop table state;
+alter table state_user rename to state;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+create table user (
+    id integer primary key,
+    name text not null,
+    role text not null check (role in ('blocked', 'pending', 'member', 'admin')),
+    timestamp integer not null
+) strict;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table user;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+create table job (
+    id integer primary key,
+    user_id integer not null,
+    user_name text not null,
+    chat_id integer not null,
+    thread_id integer not null default 0,
+    command text not null,
+    status text not null check (status in ('queued', 'running', 'succeeded', 'failed', 'cancelled')),
+    error text,
+    created_at integer not null,
+    started_at integer,
+    finished_at integer
+) strict;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+create index job_status_idx on job (status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table job;
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table car add column resale integer;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table car drop column resale;
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table fuel add column full_tank integer not null default 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table fuel drop column full_tank;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+create table maintenance (
+    id integer primary key,
+    car_id integer not null references car(id) on delete cascade,
+    description text not null,
+    kilometers integer,
+    months integer,
+    last_kilometers integer not null,
+    last_timestamp integer not null,
+    snoozed_until integer not null default 0,
+    reminded_timestamp integer not null default 0
+) strict;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table maintenance;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+create table task (
+    id integer primary key,
+    key text not null,
+    user_id integer not null,
+    user_name text not null,
+    chat_id integer not null,
+    thread_id integer not null default 0,
+    command text not null,
+    spec text not null default '',
+    catch_up text not null check (catch_up in ('once', 'skip')),
+    next_run_at integer not null,
+    created_at integer not null
+) strict;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+create unique index task_user_key_idx on task (user_id, key);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+create index task_next_run_at_idx on task (next_run_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table task;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table fuel add column currency text not null default 'EUR';
+alter table service add column currency text not null default 'EUR';
+alter table lease add column currency text not null default 'EUR';
+alter table car add column distance_unit text not null default 'km' check (distance_unit in ('km', 'mi'));
+alter table car add column volume_unit text not null default 'l' check (volume_unit in ('l', 'gal'));
+
+create table car_settings (
+    user_id integer primary key,
+    currency text not null default 'EUR'
+) strict;
+
+create table exchange_rate (
+    currency text primary key,
+    rate real not null, -- units of the currency per 1 EUR
+    timestamp integer not null
+) strict;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table exchange_rate;
+drop table car_settings;
+alter table car drop column volume_unit;
+alter table car drop column distance_unit;
+alter table lease drop column currency;
+alter table service drop column currency;
+alter table fuel drop column currency;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+create table car_access (
+    id integer primary key,
+    car_id integer not null references car(id) on delete cascade,
+    user_id integer not null,
+    role text not null check (role in ('viewer', 'editor')),
+    unique (car_id, user_id)
+) strict;
+
+-- null for the receipts entered before the cars could be shared, they are counted to the car owner
+alter table fuel add column user_id integer;
+alter table service add column user_id integer;
+alter table lease add column user_id integer;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table lease drop column user_id;
+alter table service drop column user_id;
+alter table fuel drop column user_id;
+drop table car_access;
+-- +goose StatementEnd
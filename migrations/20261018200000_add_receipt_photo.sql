@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- telegram file id of the receipt photo, the file is kept by telegram and sent again by its id
+alter table fuel add column photo text;
+alter table service add column photo text;
+alter table lease add column photo text;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table lease drop column photo;
+alter table service drop column photo;
+alter table fuel drop column photo;
+-- +goose StatementEnd
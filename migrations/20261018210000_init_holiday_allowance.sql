@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+create table holiday_allowance (
+    id integer primary key,
+    user_id integer not null,
+    year integer not null,
+    days integer not null,
+    carry_days integer not null default 0,
+    carry_months integer,
+    unique (user_id, year)
+) strict;
+
+create table public_holiday (
+    id integer primary key,
+    user_id integer not null,
+    timestamp integer not null,
+    name text not null,
+    unique (user_id, timestamp)
+) strict;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table public_holiday;
+drop table holiday_allowance;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- maintenance reminders were sent by polling before, they run as daily tasks of the plan owners now
+-- +goose StatementBegin
+insert into task (key, user_id, user_name, chat_id, command, spec, catch_up, next_run_at, created_at)
+select distinct 'car_maint_remind', c.user_id, '', c.user_id, '/car maint_remind', '0 9 * * *', 'once', 0, unixepoch()
+from maintenance m
+join car c on c.id = m.car_id
+where true
+on conflict (user_id, key) do nothing;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+delete from task where key = 'car_maint_remind';
+-- +goose StatementEnd